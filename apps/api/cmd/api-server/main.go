@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
+	_ "time/tzdata" // schedule time zones work without zoneinfo installed
 
 	"github.com/dendianugerah/velld/internal"
 	"github.com/dendianugerah/velld/internal/auth"
@@ -27,6 +32,11 @@ func main() {
 		dbPath = filepath.Join("data", "velld.db")
 	}
 
+	backupDir := os.Getenv("BACKUP_DIR")
+	if backupDir == "" {
+		backupDir = "./backups"
+	}
+
 	dbDir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
 		log.Fatalf("Failed to create database directory: %v", err)
@@ -61,6 +71,10 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		os.Exit(runReconcile(os.Args[2:], backupDir, db, authRepo, cryptoService))
+	}
+
 	connRepo := connection.NewConnectionRepository(db, cryptoService)
 	connService := connection.NewConnectionService(connRepo, connManager)
 
@@ -91,7 +105,7 @@ func main() {
 
 	backupService := backup.NewBackupService(
 		connRepo,
-		"./backups",
+		backupDir,
 		backupRepo,
 		settingsService,
 		notificationRepo,
@@ -120,10 +134,42 @@ func main() {
 	protected.HandleFunc("/backups/{id}", backupHandler.GetBackup).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/backups/{id}", backupHandler.DeleteBackup).Methods("DELETE", "OPTIONS")
 	protected.HandleFunc("/backups/{id}/download", backupHandler.DownloadBackup).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/verify", backupHandler.VerifyBackup).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/pin", backupHandler.PinBackup).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/unpin", backupHandler.UnpinBackup).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{id}/pin-events", backupHandler.GetBackupPinEvents).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/backups/restore", backupHandler.RestoreBackup).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups/compare/{sourceId}/{targetId}", backupHandler.CompareBackups).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/backups/{connection_id}/schedule/disable", backupHandler.DisableBackupSchedule).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/backups/{connection_id}/schedule", backupHandler.UpdateBackupSchedule).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/schedule/runs", backupHandler.GetScheduleRuns).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/retention/preview", backupHandler.PreviewRetention).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/destinations", backupHandler.GetConnectionDestinations).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/backups/{connection_id}/destinations", backupHandler.SetConnectionDestinations).Methods("PUT", "OPTIONS")
+
+	protected.HandleFunc("/schedules", backupHandler.ListSchedules).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/schedules", backupHandler.CreateSchedule).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/schedules/preview", backupHandler.PreviewSchedule).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/schedules/{id}", backupHandler.GetSchedule).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/schedules/{id}", backupHandler.UpdateSchedule).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/schedules/{id}", backupHandler.DeleteSchedule).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/schedules/{id}/runs", backupHandler.GetScheduleRunsByID).Methods("GET", "OPTIONS")
+
+	// Admin routes, limited to ADMIN_USERNAMES
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.NewAdminMiddleware(secrets.AdminUsernames).RequireAdmin)
+	admin.HandleFunc("/schedules/reload", backupHandler.ReloadSchedules).Methods("POST", "OPTIONS")
+
+	protected.HandleFunc("/storage/destinations", backupHandler.ListStorageDestinations).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/storage/destinations", backupHandler.CreateStorageDestination).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/storage/destinations/{id}", backupHandler.UpdateStorageDestination).Methods("PUT", "OPTIONS")
+	protected.HandleFunc("/storage/destinations/{id}", backupHandler.DeleteStorageDestination).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/storage/destinations/{id}/test", backupHandler.TestStorageDestination).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/storage/destinations/{id}/reconcile", backupHandler.ReconcileStorageDestination).Methods("POST", "OPTIONS")
+
+	protected.HandleFunc("/jobs/{id}", backupHandler.GetJob).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/jobs/{id}", backupHandler.CancelJob).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/jobs/{id}/logs", backupHandler.GetJobLogs).Methods("GET", "OPTIONS")
 
 	settingsHandler := settings.NewSettingsHandler(settingsService)
 
@@ -136,8 +182,23 @@ func main() {
 	protected.HandleFunc("/notifications", notificationHandler.GetNotifications).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/notifications/mark-read", notificationHandler.MarkAsRead).Methods("POST", "OPTIONS")
 
+	server := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+
+		log.Println("Server shutting down")
+		backupService.Shutdown()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
 	log.Println("Server starting on :8080")
-	if err := http.ListenAndServe(":8080", r); err != nil {
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
 }
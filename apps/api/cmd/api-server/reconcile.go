@@ -0,0 +1,65 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dendianugerah/velld/internal/auth"
+	"github.com/dendianugerah/velld/internal/backup"
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/settings"
+)
+
+// runReconcile implements the reconcile command, which compares one of a
+// user's storage destinations with the backup catalog and prints the report
+// as JSON. backupDir is the server's backup directory, which -backup-dir
+// overrides. It returns the process exit code.
+func runReconcile(args []string, backupDir string, db *sql.DB, authRepo *auth.AuthRepository, cryptoService *common.EncryptionService) int {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	username := flags.String("user", "", "user owning the destination (required)")
+	destinationID := flags.String("destination", "s3", "destination ID, or s3 for the S3 storage in settings")
+	importOrphans := flags.Bool("import", false, "import orphaned objects as backups")
+	flags.StringVar(&backupDir, "backup-dir", backupDir, "local backup directory, by default BACKUP_DIR or ./backups")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s reconcile -user <username> [-destination <id>] [-import] [-backup-dir <dir>]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *username == "" {
+		flags.Usage()
+		return 2
+	}
+
+	user, err := authRepo.GetUserByUsername(*username)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to find user %s: %v\n", *username, err)
+		return 1
+	}
+
+	backupService := backup.NewMaintenanceBackupService(
+		connection.NewConnectionRepository(db, cryptoService),
+		backupDir,
+		backup.NewBackupRepository(db),
+		settings.NewSettingsService(settings.NewSettingsRepository(db), cryptoService),
+		cryptoService,
+	)
+
+	report, err := backupService.ReconcileStorage(*destinationID, user.ID, backup.ReconcileRequest{Import: *importOrphans})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reconcile destination %s: %v\n", *destinationID, err)
+		return 1
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write report: %v\n", err)
+		return 1
+	}
+	return 0
+}
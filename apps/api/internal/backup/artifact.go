@@ -0,0 +1,232 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+
+	"filippo.io/age"
+	"github.com/dendianugerah/velld/internal/settings"
+)
+
+// artifactOptions controls how a dump is transformed before it is stored.
+type artifactOptions struct {
+	Compression      string
+	CompressionLevel int
+	Encryption       *backupEncryption
+}
+
+// backupFileName builds the file name for a dump of dbName, including the
+// engine, compression and encryption extensions.
+func backupFileName(dbName, timestamp string, dumper Dumper, opts artifactOptions) string {
+	name := fmt.Sprintf("%s_%s%s%s", dbName, timestamp, dumper.FileExtension(), compressionExtension(opts.Compression))
+	if opts.Encryption != nil {
+		name += encryptionExtension
+	}
+	return name
+}
+
+// dumpResult describes a backup file written by runDump or streamDump.
+type dumpResult struct {
+	Size             int64
+	UncompressedSize int64
+	// Checksum is the hex SHA-256 of the file as stored.
+	Checksum string
+}
+
+// dumpError is returned by streamDump when the dump tool fails. Output is its
+// stderr, or the run error if it wrote nothing; ExitCode is -1 if the tool
+// did not exit normally.
+type dumpError struct {
+	Output   string
+	ExitCode int
+}
+
+func (e *dumpError) Error() string {
+	return e.Output
+}
+
+// dumpProgress lets a job observe its dumps while they run. A nil
+// *dumpProgress is valid and discards everything.
+type dumpProgress struct {
+	// Log receives the dump tool's stderr and progress messages.
+	Log io.Writer
+	// written counts the bytes stored across every dump of the job.
+	written atomic.Int64
+}
+
+func (p *dumpProgress) logf(format string, args ...interface{}) {
+	if p == nil || p.Log == nil {
+		return
+	}
+	fmt.Fprintf(p.Log, format+"\n", args...)
+}
+
+func (p *dumpProgress) bytesWritten() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.written.Load()
+}
+
+// runDump runs a dump command and streams its stdout into outputPath,
+// compressing and encrypting it on the way so the plaintext dump never
+// touches disk.
+func runDump(cmd *exec.Cmd, outputPath string, opts artifactOptions, progress *dumpProgress) (*dumpResult, error) {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %v", err)
+	}
+
+	result, err := streamDump(cmd, file, opts, progress)
+	if closeErr := file.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write backup file: %v", closeErr)
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return nil, err
+	}
+	return result, nil
+}
+
+// streamDump runs a dump command and writes its stdout to w, compressed and
+// encrypted as configured.
+func streamDump(cmd *exec.Cmd, w io.Writer, opts artifactOptions, progress *dumpProgress) (*dumpResult, error) {
+	hasher := sha256.New()
+	outputCounter := &countingWriter{w: io.MultiWriter(w, hasher)}
+	if progress != nil {
+		outputCounter.total = &progress.written
+	}
+
+	var encryptor io.WriteCloser = nopWriteCloser{outputCounter}
+	if opts.Encryption != nil {
+		var err error
+		encryptor, err = age.Encrypt(outputCounter, opts.Encryption.Recipients...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialise backup encryption: %v", err)
+		}
+	}
+
+	compressor, err := newCompressWriter(encryptor, opts.Compression, opts.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	dumpCounter := &countingWriter{w: compressor}
+	var stderr bytes.Buffer
+	cmd.Stdout = dumpCounter
+	cmd.Stderr = &stderr
+	if progress != nil && progress.Log != nil {
+		cmd.Stderr = io.MultiWriter(&stderr, progress.Log)
+	}
+
+	runErr := cmd.Run()
+
+	// Close from the outermost layer in so every layer flushes its trailer
+	var closeErr error
+	for _, c := range []io.Closer{compressor, encryptor} {
+		if err := c.Close(); err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+
+	if runErr != nil {
+		errorMsg := strings.TrimSpace(stderr.String())
+		if errorMsg == "" {
+			errorMsg = runErr.Error()
+		}
+		exitCode := -1
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+		return nil, &dumpError{Output: errorMsg, ExitCode: exitCode}
+	}
+
+	if closeErr != nil {
+		return nil, fmt.Errorf("failed to write backup file: %v", closeErr)
+	}
+
+	return &dumpResult{
+		Size:             outputCounter.n,
+		UncompressedSize: dumpCounter.n,
+		Checksum:         hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// openBackupArtifact opens a backup file and returns its plaintext,
+// decrypting and decompressing it as it is read.
+func (s *BackupService) openBackupArtifact(path string, backup *Backup) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var reader io.Reader = file
+	if backup.Encryption != "" && backup.Encryption != settings.BackupEncryptionNone {
+		if backup.EncryptionKey == nil {
+			file.Close()
+			return nil, fmt.Errorf("backup is encrypted but has no data key")
+		}
+		reader, err = s.newDecryptReader(file, *backup.EncryptionKey)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to decrypt backup file: %w", err)
+		}
+	}
+
+	decompressor, err := newDecompressReader(reader, backup.Compression)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to decompress backup file: %w", err)
+	}
+
+	return &stackedReadCloser{Reader: decompressor, closers: []io.Closer{decompressor, file}}, nil
+}
+
+// stackedReadCloser reads from the outermost reader of a chain and closes
+// every layer, innermost last.
+type stackedReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *stackedReadCloser) Close() error {
+	var firstErr error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// countingWriter counts the bytes written through it, optionally adding them
+// to a shared total as well.
+type countingWriter struct {
+	w     io.Writer
+	n     int64
+	total *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if c.total != nil {
+		c.total.Add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,254 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+)
+
+// azureBlockSize is the block size of Azure uploads. A block blob holds at
+// most 50000 blocks, so objects are capped at about 780 GiB.
+const azureBlockSize = 16 << 20
+
+// azureUploadConcurrency is how many blocks of an upload are sent at once,
+// each buffered in memory.
+const azureUploadConcurrency = 4
+
+// azureCopyPollInterval is how often a server-side copy is checked.
+const azureCopyPollInterval = time.Second
+
+type AzureConfig struct {
+	AccountName string
+	// AccountKey authenticates with a shared key. Without it SASToken is
+	// used, and the container must already exist.
+	AccountKey string
+	SASToken   string
+	Container  string
+	// ServiceURL overrides https://<account>.blob.core.windows.net, such as
+	// http://127.0.0.1:10000/devstoreaccount1 for Azurite.
+	ServiceURL string
+}
+
+// AzureStorage keeps objects as block blobs in an Azure Blob Storage
+// container.
+type AzureStorage struct {
+	client    *azblob.Client
+	container string
+}
+
+func NewAzureStorage(config AzureConfig) (*AzureStorage, error) {
+	serviceURL := config.ServiceURL
+	if serviceURL == "" {
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net/", config.AccountName)
+	}
+	if !strings.HasSuffix(serviceURL, "/") {
+		serviceURL += "/"
+	}
+
+	var client *azblob.Client
+	var err error
+	switch {
+	case config.AccountKey != "":
+		credential, credErr := azblob.NewSharedKeyCredential(config.AccountName, config.AccountKey)
+		if credErr != nil {
+			return nil, fmt.Errorf("invalid Azure account key: %w", credErr)
+		}
+		client, err = azblob.NewClientWithSharedKeyCredential(serviceURL, credential, nil)
+	case config.SASToken != "":
+		client, err = azblob.NewClientWithNoCredential(serviceURL+"?"+strings.TrimPrefix(config.SASToken, "?"), nil)
+	default:
+		return nil, fmt.Errorf("no Azure authentication method provided (account key or SAS token required)")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure client: %w", err)
+	}
+
+	// SAS tokens are usually scoped to a container that already exists and
+	// cannot create one
+	if config.AccountKey != "" {
+		_, err = client.CreateContainer(context.Background(), config.Container, nil)
+		if err != nil && !bloberror.HasCode(err, bloberror.ContainerAlreadyExists) {
+			return nil, fmt.Errorf("failed to create container: %w", err)
+		}
+	}
+
+	return &AzureStorage{client: client, container: config.Container}, nil
+}
+
+func (s *AzureStorage) blobClient(key string) *blob.Client {
+	return s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(key)
+}
+
+func (s *AzureStorage) wrapNotFound(err error, key string) error {
+	if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+		return fmt.Errorf("%w: %s", errStorageNotFound, key)
+	}
+	return err
+}
+
+// Put uploads r as a block blob, staging blocks as they are read.
+func (s *AzureStorage) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	contentType := "application/octet-stream"
+	opts := &azblob.UploadStreamOptions{
+		BlockSize:   azureBlockSize,
+		Concurrency: azureUploadConcurrency,
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+	}
+	if checksum != "" {
+		opts.Metadata = map[string]*string{checksumMetadataKey: &checksum}
+	}
+
+	counter := &countingReader{r: r}
+	if _, err := s.client.UploadStream(ctx, s.container, key, counter, opts); err != nil {
+		return fmt.Errorf("failed to upload to Azure: %w", err)
+	}
+	// The blob is committed once the stream ends, so a short read has to be
+	// undone
+	if size >= 0 && counter.n != size {
+		s.Delete(context.Background(), key)
+		return fmt.Errorf("failed to upload to Azure: wrote %d bytes, expected %d", counter.n, size)
+	}
+	return nil
+}
+
+func (s *AzureStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.client.DownloadStream(ctx, s.container, key, nil)
+	if err != nil {
+		return nil, s.wrapNotFound(err, key)
+	}
+	return resp.Body, nil
+}
+
+func (s *AzureStorage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteBlob(ctx, s.container, key, nil)
+	if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return fmt.Errorf("failed to delete blob from Azure: %w", err)
+	}
+	return nil
+}
+
+func (s *AzureStorage) List(ctx context.Context, prefix string) ([]StorageObject, error) {
+	var objects []StorageObject
+	opts := &container.ListBlobsFlatOptions{}
+	if prefix != "" {
+		opts.Prefix = &prefix
+	}
+
+	pager := s.client.NewListBlobsFlatPager(s.container, opts)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list blobs: %w", err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			object := StorageObject{Key: *item.Name}
+			if item.Properties != nil {
+				if item.Properties.ContentLength != nil {
+					object.Size = *item.Properties.ContentLength
+				}
+				if item.Properties.LastModified != nil {
+					object.ModTime = *item.Properties.LastModified
+				}
+			}
+			objects = append(objects, object)
+		}
+	}
+	return objects, nil
+}
+
+// Stat returns a blob's size and the sha256 metadata stored with it, which
+// is empty for blobs uploaded without a checksum.
+func (s *AzureStorage) Stat(ctx context.Context, key string) (*StorageObject, error) {
+	props, err := s.blobClient(key).GetProperties(ctx, nil)
+	if err != nil {
+		return nil, s.wrapNotFound(err, key)
+	}
+
+	object := &StorageObject{Key: key}
+	if props.ContentLength != nil {
+		object.Size = *props.ContentLength
+	}
+	if props.LastModified != nil {
+		object.ModTime = *props.LastModified
+	}
+	for k, value := range props.Metadata {
+		if strings.EqualFold(k, checksumMetadataKey) && value != nil {
+			object.Checksum = *value
+		}
+	}
+	return object, nil
+}
+
+// SetChecksum adds the checksum of a blob uploaded without one, such as a
+// streamed dump, to its metadata.
+func (s *AzureStorage) SetChecksum(ctx context.Context, key, checksum string) error {
+	client := s.blobClient(key)
+	props, err := client.GetProperties(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to set blob checksum: %w", s.wrapNotFound(err, key))
+	}
+	metadata := make(map[string]*string, len(props.Metadata)+1)
+	for k, value := range props.Metadata {
+		if !strings.EqualFold(k, checksumMetadataKey) {
+			metadata[k] = value
+		}
+	}
+	metadata[checksumMetadataKey] = &checksum
+	if _, err := client.SetMetadata(ctx, metadata, nil); err != nil {
+		return fmt.Errorf("failed to set blob checksum: %w", s.wrapNotFound(err, key))
+	}
+	return nil
+}
+
+// Move copies a blob server-side, waits for the copy to finish and deletes
+// the original.
+func (s *AzureStorage) Move(ctx context.Context, oldKey, newKey string) error {
+	src := s.blobClient(oldKey)
+	dst := s.blobClient(newKey)
+
+	resp, err := dst.StartCopyFromURL(ctx, src.URL(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to copy blob: %w", s.wrapNotFound(err, oldKey))
+	}
+
+	status := resp.CopyStatus
+	for status != nil && *status == blob.CopyStatusTypePending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(azureCopyPollInterval):
+		}
+		props, err := dst.GetProperties(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to check blob copy: %w", err)
+		}
+		status = props.CopyStatus
+	}
+	if status != nil && *status != blob.CopyStatusTypeSuccess {
+		return fmt.Errorf("failed to copy blob: copy status %s", *status)
+	}
+
+	if err := s.Delete(ctx, oldKey); err != nil {
+		return fmt.Errorf("failed to delete old blob: %w", err)
+	}
+	return nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
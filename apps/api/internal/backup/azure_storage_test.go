@@ -0,0 +1,85 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// azuriteAccountKey is the well-known key of Azurite's devstoreaccount1.
+const azuriteAccountKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+
+// newAzuriteStorage connects to the Azurite blob service at
+// VELLD_TEST_AZURITE_URL, such as http://127.0.0.1:10000/devstoreaccount1,
+// skipping the test when it is not set. docker-compose.test.yml starts one.
+func newAzuriteStorage(t *testing.T) *AzureStorage {
+	t.Helper()
+	serviceURL := os.Getenv("VELLD_TEST_AZURITE_URL")
+	if serviceURL == "" {
+		t.Skip("VELLD_TEST_AZURITE_URL is not set")
+	}
+	storage, err := NewAzureStorage(AzureConfig{
+		AccountName: "devstoreaccount1",
+		AccountKey:  azuriteAccountKey,
+		Container:   "velld-test",
+		ServiceURL:  serviceURL,
+	})
+	if err != nil {
+		t.Fatalf("NewAzureStorage: %v", err)
+	}
+	return storage
+}
+
+func TestAzureStorage(t *testing.T) {
+	storage := newAzuriteStorage(t)
+
+	// More than one block, so the upload is staged in several
+	data := bytes.Repeat([]byte("0123456789abcdef"), azureBlockSize/16+4096)
+	testStorage(t, storage, "velld-test-"+uuid.NewString(), data)
+}
+
+func TestAzureStorageChecksumAndShortRead(t *testing.T) {
+	storage := newAzuriteStorage(t)
+	ctx := context.Background()
+	prefix := "velld-test-" + uuid.NewString()
+
+	key := storageKey(prefix, "conn-1", "db.sql.gz")
+	checksum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if err := storage.Put(ctx, key, bytes.NewReader([]byte("test")), 4, checksum); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	defer storage.Delete(ctx, key)
+	info, err := storage.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Checksum != checksum {
+		t.Errorf("Stat checksum = %q, want %q", info.Checksum, checksum)
+	}
+
+	// A streamed blob is given its checksum once the stream ends
+	streamed := storageKey(prefix, "conn-1", "streamed.sql.gz")
+	if err := storage.Put(ctx, streamed, bytes.NewReader([]byte("test")), -1, ""); err != nil {
+		t.Fatalf("Put of unknown size: %v", err)
+	}
+	defer storage.Delete(ctx, streamed)
+	if err := storage.SetChecksum(ctx, streamed, checksum); err != nil {
+		t.Fatalf("SetChecksum: %v", err)
+	}
+	if info, err := storage.Stat(ctx, streamed); err != nil || info.Checksum != checksum || info.Size != 4 {
+		t.Errorf("Stat of streamed blob = %v, %v, want 4 bytes with checksum %q", info, err, checksum)
+	}
+
+	// A reader ending early must not leave a truncated blob behind
+	short := storageKey(prefix, "conn-1", "short.sql.gz")
+	if err := storage.Put(ctx, short, bytes.NewReader([]byte("test")), 10, ""); err == nil {
+		t.Error("Put of a short reader succeeded")
+	}
+	if _, err := storage.Stat(ctx, short); !errors.Is(err, errStorageNotFound) {
+		t.Errorf("Stat of the short upload = %v, want %v", err, errStorageNotFound)
+	}
+}
@@ -3,12 +3,12 @@ package backup
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/common/response"
@@ -32,13 +32,90 @@ func (h *BackupHandler) CreateBackup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	backup, err := h.backupService.CreateBackup(req.ConnectionID)
+	job, err := h.backupService.EnqueueBackup(req.ConnectionID)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	response.SendSuccess(w, "Backup created successfully", backup)
+	response.SendSuccess(w, "Backup queued successfully", job)
+}
+
+func (h *BackupHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := h.backupService.GetJob(jobID, userID)
+	if err != nil {
+		sendJobError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Job retrieved successfully", job)
+}
+
+func (h *BackupHandler) GetJobLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var after int64
+	if afterStr := r.URL.Query().Get("after"); afterStr != "" {
+		if a, err := strconv.ParseInt(afterStr, 10, 64); err == nil && a > 0 {
+			after = a
+		}
+	}
+
+	logs, err := h.backupService.GetJobLogs(jobID, userID, after)
+	if err != nil {
+		sendJobError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Job logs retrieved successfully", logs)
+}
+
+func (h *BackupHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	jobID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	job, err := h.backupService.CancelJob(jobID, userID)
+	if err != nil {
+		sendJobError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Job cancelled successfully", job)
+}
+
+func sendJobError(w http.ResponseWriter, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Job not found")
+	case errors.Is(err, errUnauthorized):
+		response.SendError(w, http.StatusForbidden, "Not authorized to access this job")
+	case errors.Is(err, errJobFinished):
+		response.SendError(w, http.StatusConflict, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
 }
 
 func (h *BackupHandler) GetBackup(w http.ResponseWriter, r *http.Request) {
@@ -73,10 +150,14 @@ func (h *BackupHandler) DeleteBackup(w http.ResponseWriter, r *http.Request) {
 			response.SendError(w, http.StatusNotFound, "Backup not found")
 			return
 		}
-		if err.Error() == "unauthorized" {
+		if errors.Is(err, errUnauthorized) {
 			response.SendError(w, http.StatusForbidden, "Not authorized to delete this backup")
 			return
 		}
+		if errors.Is(err, errBackupPinned) {
+			response.SendError(w, http.StatusConflict, err.Error())
+			return
+		}
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -84,6 +165,118 @@ func (h *BackupHandler) DeleteBackup(w http.ResponseWriter, r *http.Request) {
 	response.SendSuccess(w, "Backup deleted successfully", nil)
 }
 
+func (h *BackupHandler) VerifyBackup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	verification, err := h.backupService.VerifyBackup(backupID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "Backup not found")
+			return
+		}
+		if errors.Is(err, errUnauthorized) {
+			response.SendError(w, http.StatusForbidden, "Not authorized to verify this backup")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup verified successfully", verification)
+}
+
+func (h *BackupHandler) PinBackup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req PinBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	backup, err := h.backupService.PinBackup(backupID, userID, &req)
+	if err != nil {
+		sendPinError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Backup pinned successfully", backup)
+}
+
+func (h *BackupHandler) UnpinBackup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// The body is optional; it only carries a reason for the audit trail
+	var req UnpinBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	backup, err := h.backupService.UnpinBackup(backupID, userID, &req)
+	if err != nil {
+		sendPinError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Backup unpinned successfully", backup)
+}
+
+func (h *BackupHandler) GetBackupPinEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	backupID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	events, err := h.backupService.GetBackupPinEvents(backupID, userID)
+	if err != nil {
+		sendPinError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Pin history retrieved successfully", events)
+}
+
+func sendPinError(w http.ResponseWriter, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Backup not found")
+	case errors.Is(err, errUnauthorized):
+		response.SendError(w, http.StatusForbidden, "Not authorized to access this backup")
+	case errors.Is(err, errBackupNotPinned):
+		response.SendError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, errInvalidPin):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
 func (h *BackupHandler) ListBackups(w http.ResponseWriter, r *http.Request) {
 	userID, err := common.GetUserIDFromContext(r.Context())
 	if err != nil {
@@ -134,17 +327,16 @@ func (h *BackupHandler) ScheduleBackup(w http.ResponseWriter, r *http.Request) {
 		response.SendError(w, http.StatusBadRequest, "connection_id is required")
 		return
 	}
-	if req.CronSchedule == "" {
-		response.SendError(w, http.StatusBadRequest, "cron_schedule is required")
-		return
-	}
-	if req.RetentionDays <= 0 {
-		response.SendError(w, http.StatusBadRequest, "retention_days must be greater than 0")
+	if !checkScheduleRequest(w, req.CronSchedule, req.RetentionDays, req.RetentionPolicy) {
 		return
 	}
 
 	err := h.backupService.ScheduleBackup(&req)
 	if err != nil {
+		if errors.Is(err, errInvalidSchedule) {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -179,12 +371,7 @@ func (h *BackupHandler) UpdateBackupSchedule(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if req.CronSchedule == "" {
-		response.SendError(w, http.StatusBadRequest, "cron_schedule is required")
-		return
-	}
-	if req.RetentionDays <= 0 {
-		response.SendError(w, http.StatusBadRequest, "retention_days must be greater than 0")
+	if !checkScheduleRequest(w, req.CronSchedule, req.RetentionDays, req.RetentionPolicy) {
 		return
 	}
 
@@ -194,6 +381,10 @@ func (h *BackupHandler) UpdateBackupSchedule(w http.ResponseWriter, r *http.Requ
 			response.SendError(w, http.StatusNotFound, "No active schedule found")
 			return
 		}
+		if errors.Is(err, errInvalidSchedule) {
+			response.SendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -201,6 +392,58 @@ func (h *BackupHandler) UpdateBackupSchedule(w http.ResponseWriter, r *http.Requ
 	response.SendSuccess(w, "Backup schedule updated successfully", nil)
 }
 
+func (h *BackupHandler) GetScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	runs, err := h.backupService.GetScheduleRuns(connectionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			response.SendError(w, http.StatusNotFound, "No schedule found")
+			return
+		}
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Schedule runs retrieved successfully", runs)
+}
+
+func (h *BackupHandler) PreviewRetention(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	// The body is optional; without one the current schedule is previewed
+	var req RetentionPreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	preview, err := h.backupService.PreviewRetention(connectionID, userID, &req)
+	if err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			response.SendError(w, http.StatusNotFound, "Connection not found")
+		case errors.Is(err, errUnauthorized):
+			response.SendError(w, http.StatusForbidden, "Not authorized to access this connection")
+		case errors.Is(err, errInvalidRetention):
+			response.SendError(w, http.StatusBadRequest, err.Error())
+		default:
+			response.SendError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	response.SendSuccess(w, "Retention preview generated successfully", preview)
+}
+
 func (h *BackupHandler) GetBackupStats(w http.ResponseWriter, r *http.Request) {
 	userID, err := common.GetUserIDFromContext(r.Context())
 	if err != nil {
@@ -238,29 +481,23 @@ func (h *BackupHandler) DownloadBackup(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Ensure backup file is available (local or download from S3)
-	filePath, isTemp, err := h.backupService.ensureBackupFileAvailable(backup, userID)
+	filePath, release, err := h.backupService.ensureBackupFileAvailable(backup, userID)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	defer release()
 
-	// Clean up temp file after download if needed
-	if isTemp {
-		defer func() {
-			if err := os.Remove(filePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp file %s: %v\n", filePath, err)
-			}
-		}()
-	}
-
-	file, err := os.Open(filePath)
+	// Downloads are served decrypted and decompressed so they can be restored by hand
+	file, err := h.backupService.openBackupArtifact(filePath, backup)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, "Failed to open backup file")
 		return
 	}
 	defer file.Close()
 
-	filename := filepath.Base(backup.Path)
+	filename := strings.TrimSuffix(filepath.Base(backup.Path), encryptionExtension)
+	filename = strings.TrimSuffix(filename, compressionExtension(backup.Compression))
 	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
 	w.Header().Set("Content-Type", "application/octet-stream")
 
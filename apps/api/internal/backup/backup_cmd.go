@@ -2,37 +2,10 @@ package backup
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
 
-	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/connection"
 )
 
-var requiredTools = map[string]string{
-	"postgresql": "pg_dump",
-	"mysql":      "mysqldump",
-	"mariadb":    "mysqldump",
-	"mongodb":    "mongodump",
-	"redis":      "redis-cli",
-}
-
-func (s *BackupService) verifyBackupTools(dbType string) error {
-	if _, exists := requiredTools[dbType]; !exists {
-		return fmt.Errorf("unsupported database type: %s", dbType)
-	}
-	return nil
-}
-
-func (s *BackupService) findDatabaseBinaryPath(dbType string) string {
-	if path := common.FindBinaryPath(dbType, requiredTools[dbType]); path != "" {
-		return path
-	}
-
-	return ""
-}
-
 func (s *BackupService) setupSSHTunnelIfNeeded(conn *connection.StoredConnection) (*connection.SSHTunnel, string, int, error) {
 	if !conn.SSHEnabled {
 		return nil, conn.Host, conn.Port, nil
@@ -57,105 +30,3 @@ func (s *BackupService) setupSSHTunnelIfNeeded(conn *connection.StoredConnection
 
 	return tunnel, "127.0.0.1", tunnel.GetLocalPort(), nil
 }
-
-func (s *BackupService) createPgDumpCmd(conn *connection.StoredConnection, outputPath string) *exec.Cmd {
-	binaryPath := s.findDatabaseBinaryPath("postgresql")
-	if binaryPath == "" {
-		fmt.Printf("ERROR: pg_dump binary not found. Please install PostgreSQL client tools.\n")
-		return nil
-	}
-
-	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(requiredTools["postgresql"]))
-
-	// Use original host/port (SSH tunnel handled at backup execution level)
-	cmd := exec.Command(binPath,
-		"-h", conn.Host,
-		"-p", fmt.Sprintf("%d", conn.Port),
-		"-U", conn.Username,
-		"-d", conn.DatabaseName,
-		"-f", outputPath,
-	)
-
-	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
-	return cmd
-}
-
-func (s *BackupService) createMySQLDumpCmd(conn *connection.StoredConnection, outputPath string) *exec.Cmd {
-	binaryPath := s.findDatabaseBinaryPath(conn.Type)
-	if binaryPath == "" {
-		fmt.Printf("ERROR: mysqldump binary not found. Please install MySQL/MariaDB client tools.\n")
-		return nil
-	}
-
-	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(requiredTools[conn.Type]))
-
-	args := []string{
-		"-h", conn.Host,
-		"-P", fmt.Sprintf("%d", conn.Port),
-		"-u", conn.Username,
-		fmt.Sprintf("-p%s", conn.Password),
-	}
-
-	if !conn.SSL {
-		args = append(args, "--skip-ssl")
-	} else {
-		args = append(args, "--ssl-mode=REQUIRED")
-	}
-
-	args = append(args, conn.DatabaseName, "-r", outputPath)
-
-	cmd := exec.Command(binPath, args...)
-	return cmd
-}
-
-func (s *BackupService) createMongoDumpCmd(conn *connection.StoredConnection, outputPath string) *exec.Cmd {
-	binaryPath := s.findDatabaseBinaryPath("mongodb")
-	if binaryPath == "" {
-		fmt.Printf("ERROR: mongodump binary not found. Please install MongoDB Database Tools.\n")
-		return nil
-	}
-
-	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(requiredTools["mongodb"]))
-	args := []string{
-		"--host", conn.Host,
-		"--port", fmt.Sprintf("%d", conn.Port),
-		"--db", conn.DatabaseName,
-		"--out", filepath.Dir(outputPath),
-	}
-
-	if conn.Username != "" {
-		args = append(args, "--username", conn.Username)
-	}
-
-	if conn.Password != "" {
-		args = append(args, "--password", conn.Password)
-	}
-
-	return exec.Command(binPath, args...)
-}
-
-func (s *BackupService) createRedisDumpCmd(conn *connection.StoredConnection, outputPath string) *exec.Cmd {
-	binaryPath := s.findDatabaseBinaryPath("redis")
-	if binaryPath == "" {
-		fmt.Printf("ERROR: redis-cli binary not found. Please install Redis tools.\n")
-		return nil
-	}
-
-	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(requiredTools["redis"]))
-	args := []string{
-		"-h", conn.Host,
-		"-p", fmt.Sprintf("%d", conn.Port),
-	}
-
-	if conn.Password != "" {
-		args = append(args, "-a", conn.Password)
-	}
-
-	if conn.DatabaseName != "" {
-		args = append(args, "-n", conn.DatabaseName)
-	}
-
-	args = append(args, "--rdb", outputPath)
-
-	return exec.Command(binPath, args...)
-}
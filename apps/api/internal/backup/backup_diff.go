@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/dendianugerah/velld/internal/common"
@@ -53,39 +52,27 @@ func (h *BackupHandler) CompareBackups(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Ensure both backup files are available (local or download from S3)
-	sourceFilePath, sourceIsTemp, err := h.backupService.ensureBackupFileAvailable(sourceBackup, userID)
+	sourceFilePath, releaseSource, err := h.backupService.ensureBackupFileAvailable(sourceBackup, userID)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to access source backup: %v", err))
 		return
 	}
+	defer releaseSource()
 
-	targetFilePath, targetIsTemp, err := h.backupService.ensureBackupFileAvailable(targetBackup, userID)
+	targetFilePath, releaseTarget, err := h.backupService.ensureBackupFileAvailable(targetBackup, userID)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to access target backup: %v", err))
 		return
 	}
+	defer releaseTarget()
 
-	// Clean up temp files after comparison
-	defer func() {
-		if sourceIsTemp {
-			if err := os.Remove(sourceFilePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp source file %s: %v\n", sourceFilePath, err)
-			}
-		}
-		if targetIsTemp {
-			if err := os.Remove(targetFilePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp target file %s: %v\n", targetFilePath, err)
-			}
-		}
-	}()
-
-	sourceContent, err := readBackupFile(sourceFilePath)
+	sourceContent, err := h.backupService.readBackupFile(sourceFilePath, sourceBackup)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read source backup: %v", err))
 		return
 	}
 
-	targetContent, err := readBackupFile(targetFilePath)
+	targetContent, err := h.backupService.readBackupFile(targetFilePath, targetBackup)
 	if err != nil {
 		response.SendError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read target backup: %v", err))
 		return
@@ -96,9 +83,9 @@ func (h *BackupHandler) CompareBackups(w http.ResponseWriter, r *http.Request) {
 	response.SendSuccess(w, "Backup comparison completed", diff)
 }
 
-// readBackupFile reads a backup file and returns its content
-func readBackupFile(path string) (string, error) {
-	file, err := os.Open(path)
+// readBackupFile reads a backup file and returns its plaintext content
+func (s *BackupService) readBackupFile(path string, backup *Backup) (string, error) {
+	file, err := s.openBackupArtifact(path, backup)
 	if err != nil {
 		return "", err
 	}
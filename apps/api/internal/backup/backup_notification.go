@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/dendianugerah/velld/internal/mail"
@@ -32,35 +33,142 @@ func (s *BackupService) createFailureNotification(connID string, backupErr error
 		return fmt.Errorf("invalid user ID for connection: %s", connID)
 	}
 
-	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+	metadata := map[string]interface{}{
+		"connection_id": connID,
+		"database_name": conn.DatabaseName,
+		"database_type": conn.Type,
+		"error":         backupErr.Error(),
+		"timestamp":     time.Now().Format(time.RFC3339),
+	}
+
+	return s.notifyUser(conn.UserID, backupAlert{
+		Type:         notification.BackupFailed,
+		Title:        "Backup Failed",
+		Message:      fmt.Sprintf("Backup failed for database '%s': %v", conn.DatabaseName, backupErr),
+		EmailSubject: "Velld - Backup Failed",
+		EmailBody:    fmt.Sprintf("Backup failed for database '%s'. Error: %v", conn.DatabaseName, backupErr),
+		Metadata:     metadata,
+	})
+}
+
+// createCorruptionNotification alerts the owner of a backup whose stored
+// copies no longer match the checksum recorded when it was taken.
+func (s *BackupService) createCorruptionNotification(backup *Backup, verification *BackupVerification) error {
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
 	if err != nil {
-		log.Printf("Failed to get user settings: %v", err)
-		return fmt.Errorf("failed to get user settings: %v", err)
+		return fmt.Errorf("failed to get connection details: %v", err)
 	}
 
-	if userSettings == nil {
-		log.Printf("No settings found for user: %s", conn.UserID)
-		return fmt.Errorf("no settings found for user: %s", conn.UserID)
+	var problems []string
+	for _, location := range verification.Locations {
+		if location.Match {
+			continue
+		}
+		problem := fmt.Sprintf("%s copy %s does not match", location.Location, location.Path)
+		if location.Error != "" {
+			problem = fmt.Sprintf("%s copy %s: %s", location.Location, location.Path, location.Error)
+		}
+		problems = append(problems, problem)
 	}
+	details := strings.Join(problems, "; ")
 
 	metadata := map[string]interface{}{
-		"connection_id": connID,
+		"backup_id":     backup.ID.String(),
+		"connection_id": backup.ConnectionID,
 		"database_name": conn.DatabaseName,
 		"database_type": conn.Type,
-		"error":         backupErr.Error(),
+		"error":         details,
+		"timestamp":     verification.VerifiedAt.Format(time.RFC3339),
+	}
+
+	return s.notifyUser(conn.UserID, backupAlert{
+		Type:         notification.BackupCorrupted,
+		Title:        "Backup Corrupted",
+		Message:      fmt.Sprintf("Backup %s of database '%s' failed integrity verification: %s", backup.ID, conn.DatabaseName, details),
+		EmailSubject: "Velld - Backup Corrupted",
+		EmailBody:    fmt.Sprintf("Backup %s of database '%s' failed integrity verification. %s", backup.ID, conn.DatabaseName, details),
+		Metadata:     metadata,
+	})
+}
+
+// createUploadMissingNotification alerts the owner of a backup that still
+// lacks a copy on one of its destinations hours after it completed.
+func (s *BackupService) createUploadMissingNotification(backup *Backup, hours int) error {
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection details: %v", err)
+	}
+
+	copies, err := s.backupRepo.GetBackupCopies(backup.ID.String())
+	if err != nil {
+		return fmt.Errorf("failed to get backup copies: %v", err)
+	}
+
+	var missing []string
+	for _, copy := range copies {
+		if copy.Status == copyUploaded {
+			continue
+		}
+		problem := copy.DestinationName
+		if copy.Error != nil {
+			problem = fmt.Sprintf("%s: %s", copy.DestinationName, *copy.Error)
+		}
+		missing = append(missing, problem)
+	}
+	details := strings.Join(missing, "; ")
+
+	metadata := map[string]interface{}{
+		"backup_id":     backup.ID.String(),
+		"connection_id": backup.ConnectionID,
+		"database_name": conn.DatabaseName,
+		"database_type": conn.Type,
+		"error":         details,
 		"timestamp":     time.Now().Format(time.RFC3339),
 	}
 
-	metadataJSON, _ := json.Marshal(metadata)
+	return s.notifyUser(conn.UserID, backupAlert{
+		Type:         notification.UploadMissing,
+		Title:        "Backup Not Uploaded",
+		Message:      fmt.Sprintf("Backup %s of database '%s' is still missing offsite copies after %d hours: %s", backup.ID, conn.DatabaseName, hours, details),
+		EmailSubject: "Velld - Backup Not Uploaded",
+		EmailBody:    fmt.Sprintf("Backup %s of database '%s' has not been copied to all of its storage destinations %d hours after it completed. %s", backup.ID, conn.DatabaseName, hours, details),
+		Metadata:     metadata,
+	})
+}
+
+// backupAlert is a notification delivered through every channel the user
+// has enabled.
+type backupAlert struct {
+	Type         notification.NotificationType
+	Title        string
+	Message      string
+	EmailSubject string
+	EmailBody    string
+	Metadata     map[string]interface{}
+}
+
+func (s *BackupService) notifyUser(userID uuid.UUID, alert backupAlert) error {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	if err != nil {
+		log.Printf("Failed to get user settings: %v", err)
+		return fmt.Errorf("failed to get user settings: %v", err)
+	}
+
+	if userSettings == nil {
+		log.Printf("No settings found for user: %s", userID)
+		return fmt.Errorf("no settings found for user: %s", userID)
+	}
+
+	metadataJSON, _ := json.Marshal(alert.Metadata)
 
 	// Create dashboard notification if enabled
 	if userSettings.NotifyDashboard {
 		notification := &notification.Notification{
 			ID:        uuid.New(),
-			UserID:    conn.UserID,
-			Title:     "Backup Failed",
-			Message:   fmt.Sprintf("Backup failed for database '%s': %v", conn.DatabaseName, backupErr),
-			Type:      notification.BackupFailed,
+			UserID:    userID,
+			Title:     alert.Title,
+			Message:   alert.Message,
+			Type:      alert.Type,
 			Status:    notification.StatusUnread,
 			Metadata:  metadataJSON,
 			CreatedAt: time.Now(),
@@ -74,18 +182,18 @@ func (s *BackupService) createFailureNotification(connID string, backupErr error
 
 	// Send webhook notification if enabled
 	if userSettings.NotifyWebhook && userSettings.WebhookURL != nil {
-		go s.sendWebhookNotification(*userSettings.WebhookURL, metadata)
+		go s.sendWebhookNotification(*userSettings.WebhookURL, alert.Metadata)
 	}
 
 	// Send email notification if enabled
 	if userSettings.NotifyEmail && userSettings.Email != nil {
 		log.Printf("Attempting to send email notification to: %s", *userSettings.Email)
 		// Use separate goroutine for email to prevent blocking
-		go func(emailAddr string, userSettings *settings.UserSettings, meta map[string]interface{}) {
-			if err := s.sendEmailNotification(emailAddr, userSettings, meta); err != nil {
+		go func(emailAddr string, userSettings *settings.UserSettings, subject, body string) {
+			if err := s.sendEmailNotification(emailAddr, userSettings, subject, body); err != nil {
 				log.Printf("Failed to send email notification: %v", err)
 			}
-		}(*userSettings.Email, userSettings, metadata)
+		}(*userSettings.Email, userSettings, alert.EmailSubject, alert.EmailBody)
 	} else {
 		log.Printf("Email notification skipped - enabled: %v, email configured: %v",
 			userSettings.NotifyEmail, userSettings.Email != nil)
@@ -110,7 +218,7 @@ func (s *BackupService) sendWebhookNotification(webhookURL string, data map[stri
 	}
 }
 
-func (s *BackupService) sendEmailNotification(email string, userSettings *settings.UserSettings, data map[string]interface{}) error {
+func (s *BackupService) sendEmailNotification(email string, userSettings *settings.UserSettings, subject, body string) error {
 	if userSettings == nil {
 		return fmt.Errorf("settings cannot be nil")
 	}
@@ -143,8 +251,8 @@ func (s *BackupService) sendEmailNotification(email string, userSettings *settin
 	msg := &mail.Message{
 		From:    *userSettings.SMTPUsername,
 		To:      email,
-		Subject: "Velld - Backup Failed",
-		Body:    fmt.Sprintf("Backup failed for database '%s'. Error: %v", data["database_name"], data["error"]),
+		Subject: subject,
+		Body:    body,
 	}
 
 	if err := mail.SendEmail(smtpConfig, msg); err != nil {
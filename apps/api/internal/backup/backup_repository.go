@@ -36,12 +36,18 @@ func (r *BackupRepository) CreateBackupSchedule(schedule *BackupSchedule) error
 	now := time.Now().Format(time.RFC3339)
 	_, err := r.db.Exec(`
 		INSERT INTO backup_schedules (
-			id, connection_id, enabled, cron_schedule, retention_days,
-			next_run_time, last_backup_time, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
-		schedule.ID, schedule.ConnectionID, schedule.Enabled,
-		schedule.CronSchedule, schedule.RetentionDays,
-		nextRunStr, lastBackupStr, now, now)
+			id, connection_id, name, enabled, cron_schedule, timezone, retention_days,
+			schema_only, dump_databases,
+			max_attempts, retry_initial_delay, retry_max_delay,
+			keep_last, keep_daily, keep_weekly, keep_monthly, keep_yearly,
+			missed_run_policy, next_run_time, last_backup_time, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)`,
+		schedule.ID, schedule.ConnectionID, schedule.Name, schedule.Enabled,
+		schedule.CronSchedule, schedule.Timezone, schedule.RetentionDays,
+		schedule.SchemaOnly, strings.Join(schedule.Databases, ","),
+		schedule.MaxAttempts, schedule.RetryInitialDelay, schedule.RetryMaxDelay,
+		schedule.KeepLast, schedule.KeepDaily, schedule.KeepWeekly, schedule.KeepMonthly, schedule.KeepYearly,
+		schedule.MissedRunPolicy, nextRunStr, lastBackupStr, now, now)
 	return err
 }
 
@@ -63,19 +69,45 @@ func (r *BackupRepository) UpdateBackupSchedule(schedule *BackupSchedule) error
 		SET enabled = $1, 
 		    cron_schedule = $2, 
 		    retention_days = $3, 
-		    next_run_time = $4,
-		    last_backup_time = $5,
-		    updated_at = $6
-		WHERE id = $7
+		    max_attempts = $4,
+		    retry_initial_delay = $5,
+		    retry_max_delay = $6,
+		    keep_last = $7,
+		    keep_daily = $8,
+		    keep_weekly = $9,
+		    keep_monthly = $10,
+		    keep_yearly = $11,
+		    next_run_time = $12,
+		    last_backup_time = $13,
+		    updated_at = $14,
+		    name = $15,
+		    schema_only = $16,
+		    dump_databases = $17,
+		    timezone = $18,
+		    missed_run_policy = $19
+		WHERE id = $20
 	`
 
 	_, err := r.db.Exec(query,
 		schedule.Enabled,
 		schedule.CronSchedule,
 		schedule.RetentionDays,
+		schedule.MaxAttempts,
+		schedule.RetryInitialDelay,
+		schedule.RetryMaxDelay,
+		schedule.KeepLast,
+		schedule.KeepDaily,
+		schedule.KeepWeekly,
+		schedule.KeepMonthly,
+		schedule.KeepYearly,
 		nextRunStr,
 		lastBackupStr,
 		time.Now(),
+		schedule.Name,
+		schedule.SchemaOnly,
+		strings.Join(schedule.Databases, ","),
+		schedule.Timezone,
+		schedule.MissedRunPolicy,
 		schedule.ID)
 	if err != nil {
 		return fmt.Errorf("failed to update backup schedule: %v", err)
@@ -84,28 +116,48 @@ func (r *BackupRepository) UpdateBackupSchedule(schedule *BackupSchedule) error
 	return nil
 }
 
-func (r *BackupRepository) GetBackupSchedule(connectionID string) (*BackupSchedule, error) {
+// scheduleColumns lists the columns read by scanBackupSchedule, in order.
+const scheduleColumns = `
+	id, connection_id, COALESCE(name, ''), enabled, cron_schedule, COALESCE(timezone, ''), retention_days,
+	COALESCE(schema_only, false), COALESCE(dump_databases, ''),
+	COALESCE(max_attempts, 1), COALESCE(retry_initial_delay, 60), COALESCE(retry_max_delay, 900),
+	COALESCE(keep_last, 0), COALESCE(keep_daily, 0), COALESCE(keep_weekly, 0),
+	COALESCE(keep_monthly, 0), COALESCE(keep_yearly, 0),
+	COALESCE(missed_run_policy, 'run_once'), next_run_time, last_backup_time,
+	last_run_status, last_run_at, COALESCE(skipped_runs, 0),
+	created_at, updated_at`
+
+func scanBackupSchedule(row rowScanner) (*BackupSchedule, error) {
 	var (
 		nextRunStr    sql.NullString
 		lastBackupStr sql.NullString
+		lastRunAtStr  sql.NullString
+		databasesStr  string
 		createdAtStr  string
 		updatedAtStr  string
 	)
 	schedule := &BackupSchedule{}
-	err := r.db.QueryRow(`
-		SELECT id, connection_id, enabled, cron_schedule, retention_days,
-		       next_run_time, last_backup_time, created_at, updated_at 
-		FROM backup_schedules 
-		WHERE connection_id = $1
-		ORDER BY created_at DESC LIMIT 1`,
-		connectionID).Scan(
-		&schedule.ID, &schedule.ConnectionID, &schedule.Enabled,
-		&schedule.CronSchedule, &schedule.RetentionDays,
-		&nextRunStr, &lastBackupStr, &createdAtStr, &updatedAtStr)
+	err := row.Scan(
+		&schedule.ID, &schedule.ConnectionID, &schedule.Name, &schedule.Enabled,
+		&schedule.CronSchedule, &schedule.Timezone, &schedule.RetentionDays,
+		&schedule.SchemaOnly, &databasesStr,
+		&schedule.MaxAttempts, &schedule.RetryInitialDelay, &schedule.RetryMaxDelay,
+		&schedule.KeepLast, &schedule.KeepDaily, &schedule.KeepWeekly,
+		&schedule.KeepMonthly, &schedule.KeepYearly,
+		&schedule.MissedRunPolicy, &nextRunStr, &lastBackupStr,
+		&schedule.LastRunStatus, &lastRunAtStr, &schedule.SkippedRuns,
+		&createdAtStr, &updatedAtStr)
 	if err != nil {
 		return nil, err
 	}
 
+	schedule.Databases = []string{}
+	for _, db := range strings.Split(databasesStr, ",") {
+		if db != "" {
+			schedule.Databases = append(schedule.Databases, db)
+		}
+	}
+
 	// Parse next_run_time if not null
 	if nextRunStr.Valid {
 		nextRun, err := common.ParseTime(nextRunStr.String)
@@ -124,6 +176,15 @@ func (r *BackupRepository) GetBackupSchedule(connectionID string) (*BackupSchedu
 		schedule.LastBackupTime = &lastBackup
 	}
 
+	// Parse last_run_at if not null
+	if lastRunAtStr.Valid {
+		lastRunAt, err := common.ParseTime(lastRunAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing last_run_at: %v", err)
+		}
+		schedule.LastRunAt = &lastRunAt
+	}
+
 	// Parse created_at and updated_at
 	createdAt, err := common.ParseTime(createdAtStr)
 	if err != nil {
@@ -140,70 +201,142 @@ func (r *BackupRepository) GetBackupSchedule(connectionID string) (*BackupSchedu
 	return schedule, nil
 }
 
-func (r *BackupRepository) GetAllActiveSchedules() ([]*BackupSchedule, error) {
-	rows, err := r.db.Query(`
-		SELECT id, connection_id, enabled, cron_schedule, retention_days,
-		       next_run_time, last_backup_time, created_at, updated_at 
+// GetBackupSchedule returns the connection's most recently created
+// schedule, the one the per-connection schedule endpoints manage. These
+// acted on the newest schedule before connections could have several, and
+// the migration to named schedules handed unowned backups to it too, so it
+// stays the newest rather than becoming the oldest.
+func (r *BackupRepository) GetBackupSchedule(connectionID string) (*BackupSchedule, error) {
+	return scanBackupSchedule(r.db.QueryRow(`
+		SELECT `+scheduleColumns+`
 		FROM backup_schedules 
-		WHERE enabled = true
-		ORDER BY created_at DESC`)
+		WHERE connection_id = $1
+		ORDER BY created_at DESC LIMIT 1`,
+		connectionID))
+}
+
+func (r *BackupRepository) GetBackupScheduleByID(id string) (*BackupSchedule, error) {
+	return scanBackupSchedule(r.db.QueryRow(`
+		SELECT `+scheduleColumns+`
+		FROM backup_schedules 
+		WHERE id = $1`,
+		id))
+}
+
+func (r *BackupRepository) queryBackupSchedules(query string, args ...interface{}) ([]*BackupSchedule, error) {
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var schedules []*BackupSchedule
+	schedules := []*BackupSchedule{}
 	for rows.Next() {
-		var (
-			nextRunStr    sql.NullString
-			lastBackupStr sql.NullString
-			createdAtStr  string
-			updatedAtStr  string
-		)
-		schedule := &BackupSchedule{}
-		err := rows.Scan(
-			&schedule.ID, &schedule.ConnectionID, &schedule.Enabled,
-			&schedule.CronSchedule, &schedule.RetentionDays,
-			&nextRunStr, &lastBackupStr, &createdAtStr, &updatedAtStr)
+		schedule, err := scanBackupSchedule(rows)
 		if err != nil {
 			return nil, err
 		}
+		schedules = append(schedules, schedule)
+	}
 
-		// Parse next_run_time if not null
-		if nextRunStr.Valid {
-			nextRun, err := common.ParseTime(nextRunStr.String)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing next_run_time: %v", err)
-			}
-			schedule.NextRunTime = &nextRun
-		}
+	return schedules, rows.Err()
+}
 
-		// Parse last_backup_time if not null
-		if lastBackupStr.Valid {
-			lastBackup, err := common.ParseTime(lastBackupStr.String)
-			if err != nil {
-				return nil, fmt.Errorf("error parsing last_backup_time: %v", err)
-			}
-			schedule.LastBackupTime = &lastBackup
-		}
+func (r *BackupRepository) GetAllActiveSchedules() ([]*BackupSchedule, error) {
+	return r.queryBackupSchedules(`
+		SELECT ` + scheduleColumns + `
+		FROM backup_schedules 
+		WHERE enabled = true
+		ORDER BY created_at DESC`)
+}
 
-		// Parse created_at and updated_at
-		createdAt, err := common.ParseTime(createdAtStr)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing created_at: %v", err)
-		}
-		schedule.CreatedAt = createdAt
+// GetBackupSchedulesByConnectionID returns all of a connection's
+// schedules, oldest first.
+func (r *BackupRepository) GetBackupSchedulesByConnectionID(connectionID string) ([]*BackupSchedule, error) {
+	return r.queryBackupSchedules(`
+		SELECT `+scheduleColumns+`
+		FROM backup_schedules
+		WHERE connection_id = $1
+		ORDER BY created_at ASC`,
+		connectionID)
+}
 
-		updatedAt, err := common.ParseTime(updatedAtStr)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing updated_at: %v", err)
+// ListBackupSchedules returns the schedules of a user's connections,
+// optionally only those of one connection, oldest first.
+func (r *BackupRepository) ListBackupSchedules(userID uuid.UUID, connectionID string) ([]*BackupSchedule, error) {
+	return r.queryBackupSchedules(`
+		SELECT `+scheduleColumns+`
+		FROM backup_schedules
+		WHERE connection_id IN (SELECT id FROM connections WHERE user_id = $1)
+		  AND ($2 = '' OR connection_id = $2)
+		ORDER BY created_at ASC`,
+		userID, connectionID)
+}
+
+// DeleteBackupSchedule removes a schedule and its run history. Its backups
+// are kept and no longer belong to any schedule.
+func (r *BackupRepository) DeleteBackupSchedule(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`UPDATE backups SET schedule_id = NULL WHERE schedule_id = $1`,
+		`UPDATE backup_jobs SET schedule_id = NULL WHERE schedule_id = $1`,
+		`DELETE FROM backup_schedule_run_attempts
+		 WHERE run_id IN (SELECT id FROM backup_schedule_runs WHERE schedule_id = $1)`,
+		`DELETE FROM backup_schedule_runs WHERE schedule_id = $1`,
+		`DELETE FROM backup_schedules WHERE id = $1`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, id); err != nil {
+			return fmt.Errorf("failed to delete backup schedule: %v", err)
 		}
-		schedule.UpdatedAt = updatedAt
+	}
+	return tx.Commit()
+}
 
-		schedules = append(schedules, schedule)
+// UpdateScheduleRunStatus records the state of a schedule's latest run
+// without touching its configuration.
+func (r *BackupRepository) UpdateScheduleRunStatus(scheduleID string, status string, at time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE backup_schedules
+		SET last_run_status = $1, last_run_at = $2, updated_at = $3
+		WHERE id = $4`,
+		status, formatRunTime(at), time.Now().Format(time.RFC3339), scheduleID)
+	return err
+}
+
+// UpdateScheduleRunTimes records when a schedule last took a backup and
+// when it runs next, leaving its settings alone. A nil nextRun keeps the
+// current next run time.
+func (r *BackupRepository) UpdateScheduleRunTimes(scheduleID string, nextRun *time.Time, lastBackup time.Time) error {
+	var nextRunStr *string
+	if nextRun != nil {
+		str := nextRun.Format(time.RFC3339)
+		nextRunStr = &str
 	}
 
-	return schedules, rows.Err()
+	_, err := r.db.Exec(`
+		UPDATE backup_schedules
+		SET next_run_time = COALESCE($1, next_run_time), last_backup_time = $2, updated_at = $3
+		WHERE id = $4`,
+		nextRunStr, lastBackup.Format(time.RFC3339), time.Now().Format(time.RFC3339), scheduleID)
+	return err
+}
+
+// RecordSkippedScheduleRun records a run that did not start because the
+// connection was already being backed up.
+func (r *BackupRepository) RecordSkippedScheduleRun(scheduleID string, at time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE backup_schedules
+		SET last_run_status = 'skipped', last_run_at = $1,
+		    skipped_runs = COALESCE(skipped_runs, 0) + 1, updated_at = $2
+		WHERE id = $3`,
+		formatRunTime(at), time.Now().Format(time.RFC3339), scheduleID)
+	return err
 }
 
 // Backup Methods
@@ -212,29 +345,56 @@ func (r *BackupRepository) CreateBackup(backup *Backup) error {
 	_, err := r.db.Exec(`
 		INSERT INTO backups (
 			id, connection_id, schedule_id, status, path, s3_object_key, size,
+			compression, uncompressed_size, encryption, encryption_key,
+			checksum, integrity_status, error_output, exit_code, upload_status,
 			started_time, completed_time, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)`,
 		backup.ID, backup.ConnectionID, backup.ScheduleID,
 		backup.Status, backup.Path, backup.S3ObjectKey, backup.Size,
+		compressionOrNone(backup.Compression), backup.UncompressedSize,
+		encryptionOrNone(backup.Encryption), backup.EncryptionKey,
+		backup.Checksum, integrityStatusOrUnknown(backup.IntegrityStatus),
+		backup.ErrorOutput, backup.ExitCode, backup.UploadStatus,
 		backup.StartedTime, backup.CompletedTime,
 		backup.CreatedAt, backup.UpdatedAt)
 	return err
 }
 
-func (r *BackupRepository) UpdateBackupStatus(id string, status string) error {
-	_, err := r.db.Exec("UPDATE backups SET status = $1, updated_at = $2 WHERE id = $3",
+// FinishBackup saves the outcome of a backup that was created in progress.
+func (r *BackupRepository) FinishBackup(backup *Backup) error {
+	_, err := r.db.Exec(`
+		UPDATE backups
+		SET status = $1, s3_object_key = $2, size = $3, uncompressed_size = $4,
+		    checksum = $5, integrity_status = $6, error_output = $7, exit_code = $8,
+		    upload_status = $9, completed_time = $10, updated_at = $11
+		WHERE id = $12`,
+		backup.Status, backup.S3ObjectKey, backup.Size, backup.UncompressedSize,
+		backup.Checksum, integrityStatusOrUnknown(backup.IntegrityStatus),
+		backup.ErrorOutput, backup.ExitCode, backup.UploadStatus,
+		backup.CompletedTime, time.Now().Format(time.RFC3339), backup.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update backup: %v", err)
+	}
+	return nil
+}
+
+func (r *BackupRepository) UpdateBackupUploadStatus(id string, status *string) error {
+	_, err := r.db.Exec(`
+		UPDATE backups SET upload_status = $1, updated_at = $2 WHERE id = $3`,
 		status, time.Now().Format(time.RFC3339), id)
 	return err
 }
 
-func (r *BackupRepository) GetBackupsOlderThan(connectionID string, cutoffTime time.Time) ([]*Backup, error) {
+// GetBackupsMissingUploads returns completed backups that finished before
+// cutoff and still lack a copy on one of their destinations, skipping those
+// already alerted on.
+func (r *BackupRepository) GetBackupsMissingUploads(cutoff time.Time) ([]*Backup, error) {
 	rows, err := r.db.Query(`
-		SELECT id, path, s3_object_key, created_at 
-		FROM backups 
-		WHERE connection_id = $1 
-		AND created_at < $2 
-		AND status = 'completed'`,
-		connectionID, cutoffTime)
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE status = 'completed' AND upload_status IN ('pending', 'failed')
+		  AND upload_alerted_at IS NULL AND completed_time <= $1
+		ORDER BY completed_time ASC`, cutoff.Format(time.RFC3339))
 	if err != nil {
 		return nil, err
 	}
@@ -242,43 +402,87 @@ func (r *BackupRepository) GetBackupsOlderThan(connectionID string, cutoffTime t
 
 	var backups []*Backup
 	for rows.Next() {
-		backup := &Backup{}
-		var createdAtStr string
-		err := rows.Scan(&backup.ID, &backup.Path, &backup.S3ObjectKey, &createdAtStr)
+		backup, err := scanBackup(rows)
 		if err != nil {
 			return nil, err
 		}
-		createdAt, err := common.ParseTime(createdAtStr)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing created_at: %v", err)
-		}
-		backup.CreatedAt = createdAt
 		backups = append(backups, backup)
 	}
 	return backups, rows.Err()
 }
 
+func (r *BackupRepository) MarkUploadAlerted(id string, alertedAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE backups SET upload_alerted_at = $1 WHERE id = $2`,
+		alertedAt.Format(time.RFC3339), id)
+	return err
+}
+
+// InterruptUnfinishedBackups marks backups left in progress by a previous
+// process as interrupted, since their dumps no longer exist.
+func (r *BackupRepository) InterruptUnfinishedBackups(reason string) (int64, error) {
+	now := time.Now().Format(time.RFC3339)
+	result, err := r.db.Exec(`
+		UPDATE backups
+		SET status = 'interrupted', error_output = $1, completed_time = $2, updated_at = $2
+		WHERE status = 'in_progress'`,
+		reason, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *BackupRepository) UpdateBackupStatus(id string, status string) error {
+	_, err := r.db.Exec("UPDATE backups SET status = $1, updated_at = $2 WHERE id = $3",
+		status, time.Now().Format(time.RFC3339), id)
+	return err
+}
+
 func (r *BackupRepository) DeleteBackup(id string) error {
+	if _, err := r.db.Exec("DELETE FROM backup_copies WHERE backup_id = $1", id); err != nil {
+		return err
+	}
 	_, err := r.db.Exec("DELETE FROM backups WHERE id = $1", id)
 	return err
 }
 
-func (r *BackupRepository) GetBackup(id string) (*Backup, error) {
+// backupColumns lists the columns read by scanBackup, in order.
+const backupColumns = `
+	id, connection_id, schedule_id, status, path, s3_object_key, size,
+	COALESCE(compression, 'none'), COALESCE(uncompressed_size, 0),
+	COALESCE(encryption, 'none'), encryption_key,
+	checksum, COALESCE(integrity_status, 'unknown'), verified_at,
+	error_output, exit_code,
+	COALESCE(pinned, 0), pin_reason, pinned_at, pin_expires_at,
+	upload_status,
+	started_time, completed_time, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBackup(row rowScanner) (*Backup, error) {
 	var (
 		startedTimeStr   string
 		completedTimeStr sql.NullString
+		verifiedAtStr    sql.NullString
+		pinnedAtStr      sql.NullString
+		pinExpiresAtStr  sql.NullString
 		createdAtStr     string
 		updatedAtStr     string
 	)
 	backup := &Backup{}
-	err := r.db.QueryRow(`
-		SELECT id, connection_id, schedule_id, status, path, s3_object_key, size,
-			   started_time, completed_time, created_at, updated_at 
-		FROM backups WHERE id = $1`, id).
-		Scan(&backup.ID, &backup.ConnectionID, &backup.ScheduleID,
-			&backup.Status, &backup.Path, &backup.S3ObjectKey, &backup.Size,
-			&startedTimeStr, &completedTimeStr,
-			&createdAtStr, &updatedAtStr)
+	err := row.Scan(&backup.ID, &backup.ConnectionID, &backup.ScheduleID,
+		&backup.Status, &backup.Path, &backup.S3ObjectKey, &backup.Size,
+		&backup.Compression, &backup.UncompressedSize,
+		&backup.Encryption, &backup.EncryptionKey,
+		&backup.Checksum, &backup.IntegrityStatus, &verifiedAtStr,
+		&backup.ErrorOutput, &backup.ExitCode,
+		&backup.Pinned, &backup.PinReason, &pinnedAtStr, &pinExpiresAtStr,
+		&backup.UploadStatus,
+		&startedTimeStr, &completedTimeStr,
+		&createdAtStr, &updatedAtStr)
 	if err != nil {
 		return nil, err
 	}
@@ -299,6 +503,32 @@ func (r *BackupRepository) GetBackup(id string) (*Backup, error) {
 		backup.CompletedTime = &completedTime
 	}
 
+	// Parse verified_at if not null
+	if verifiedAtStr.Valid {
+		verifiedAt, err := common.ParseTime(verifiedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing verified_at: %v", err)
+		}
+		backup.VerifiedAt = &verifiedAt
+	}
+
+	// Parse pinned_at and pin_expires_at if not null
+	if pinnedAtStr.Valid {
+		pinnedAt, err := common.ParseTime(pinnedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing pinned_at: %v", err)
+		}
+		backup.PinnedAt = &pinnedAt
+	}
+	if pinExpiresAtStr.Valid {
+		pinExpiresAt, err := common.ParseTime(pinExpiresAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing pin_expires_at: %v", err)
+		}
+		backup.PinExpiresAt = &pinExpiresAt
+	}
+	backup.Pinned = pinActive(backup.Pinned, backup.PinExpiresAt)
+
 	// Parse created_at and updated_at
 	createdAt, err := common.ParseTime(createdAtStr)
 	if err != nil {
@@ -315,6 +545,12 @@ func (r *BackupRepository) GetBackup(id string) (*Backup, error) {
 	return backup, nil
 }
 
+func (r *BackupRepository) GetBackup(id string) (*Backup, error) {
+	return scanBackup(r.db.QueryRow(`
+		SELECT `+backupColumns+`
+		FROM backups WHERE id = $1`, id))
+}
+
 func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) ([]*BackupList, int, error) {
 	whereClause := "WHERE c.user_id = $1"
 	args := []interface{}{opts.UserID}
@@ -340,6 +576,11 @@ func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) (
 	query := fmt.Sprintf(`
 		SELECT 
 			b.id, b.connection_id, c.type, b.schedule_id, b.status, b.path, b.s3_object_key, b.size,
+			COALESCE(b.compression, 'none'), COALESCE(b.uncompressed_size, 0),
+			COALESCE(b.encryption, 'none'), b.checksum, COALESCE(b.integrity_status, 'unknown'),
+			b.error_output, b.exit_code,
+			COALESCE(b.pinned, 0), b.pin_reason, b.pin_expires_at,
+			b.upload_status,
 			b.started_time, b.completed_time, b.created_at, b.updated_at,
 			c.database_name
 		FROM backups b
@@ -368,6 +609,11 @@ func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) (
 		err := rows.Scan(
 			&backup.ID, &backup.ConnectionID, &backup.DatabaseType,
 			&backup.ScheduleID, &backup.Status, &backup.Path, &backup.S3ObjectKey, &backup.Size,
+			&backup.Compression, &backup.UncompressedSize,
+			&backup.Encryption, &backup.Checksum, &backup.IntegrityStatus,
+			&backup.ErrorOutput, &backup.ExitCode,
+			&backup.Pinned, &backup.PinReason, &backup.PinExpiresAt,
+			&backup.UploadStatus,
 			&startedTimeStr, &completedTimeStr,
 			&createdAtStr, &updatedAtStr,
 			&backup.DatabaseName,
@@ -376,6 +622,14 @@ func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) (
 			return nil, 0, err
 		}
 
+		if backup.PinExpiresAt != nil {
+			pinExpiresAt, err := common.ParseTime(*backup.PinExpiresAt)
+			if err != nil {
+				return nil, 0, fmt.Errorf("error parsing pin_expires_at: %v", err)
+			}
+			backup.Pinned = pinActive(backup.Pinned, &pinExpiresAt)
+		}
+
 		backup.StartedTime = startedTimeStr.String
 		backup.CompletedTime = completedTimeStr.String
 		backup.CreatedAt = createdAtStr
@@ -387,15 +641,6 @@ func (r *BackupRepository) GetAllBackupsWithPagination(opts BackupListOptions) (
 	return backups, total, rows.Err()
 }
 
-func (r *BackupRepository) UpdateBackupStatusAndSchedule(id string, status string, scheduleID string) error {
-	_, err := r.db.Exec(`
-		UPDATE backups 
-		SET status = $1, schedule_id = $2, updated_at = $3 
-		WHERE id = $4`,
-		status, scheduleID, time.Now().Format(time.RFC3339), id)
-	return err
-}
-
 func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error) {
 	stats := &BackupStats{
 		TotalBackups:    0,
@@ -404,16 +649,18 @@ func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error
 		AverageDuration: 0,
 		SuccessRate:     100, // Default to 100% if no backups
 	}
+	var completedCount int
 
 	err := r.db.QueryRow(`
 		SELECT 
 				COALESCE(COUNT(*), 0) as total_backups,
-				COALESCE(SUM(CASE WHEN b.status != 'completed' THEN 1 ELSE 0 END), 0) as failed_backups,
+				COALESCE(SUM(CASE WHEN b.status = 'completed' THEN 1 ELSE 0 END), 0) as completed_backups,
+				COALESCE(SUM(CASE WHEN b.status IN ('failed', 'interrupted') THEN 1 ELSE 0 END), 0) as failed_backups,
 				COALESCE(SUM(b.size), 0) as total_size
 		FROM backups b
 		INNER JOIN connections c ON b.connection_id = c.id
 		WHERE c.user_id = $1
-	`, userID).Scan(&stats.TotalBackups, &stats.FailedBackups, &stats.TotalSize)
+	`, userID).Scan(&stats.TotalBackups, &completedCount, &stats.FailedBackups, &stats.TotalSize)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return stats, nil // Return default values if no data
@@ -421,10 +668,10 @@ func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error
 		return nil, fmt.Errorf("failed to get backup counts: %v", err)
 	}
 
-	// Calculate success rate only if there are backups
-	if stats.TotalBackups > 0 {
-		successfulBackups := stats.TotalBackups - stats.FailedBackups
-		stats.SuccessRate = float64(successfulBackups) / float64(stats.TotalBackups) * 100
+	// Calculate success rate over finished backups only; running and
+	// cancelled backups neither succeeded nor failed
+	if finished := completedCount + stats.FailedBackups; finished > 0 {
+		stats.SuccessRate = float64(completedCount) / float64(finished) * 100
 	}
 
 	// Calculate average duration for completed backups
@@ -475,8 +722,7 @@ func (r *BackupRepository) GetBackupStats(userID uuid.UUID) (*BackupStats, error
 
 func (r *BackupRepository) GetBackupsByConnectionID(connectionID string) ([]*Backup, error) {
 	rows, err := r.db.Query(`
-		SELECT id, connection_id, schedule_id, status, path, s3_object_key, size,
-		       started_time, completed_time, created_at, updated_at
+		SELECT `+backupColumns+`
 		FROM backups
 		WHERE connection_id = $1
 		ORDER BY created_at DESC`,
@@ -488,49 +734,41 @@ func (r *BackupRepository) GetBackupsByConnectionID(connectionID string) ([]*Bac
 
 	var backups []*Backup
 	for rows.Next() {
-		backup := &Backup{}
-		var startedTimeStr, createdAtStr, updatedAtStr string
-		var completedTimeStr sql.NullString
-
-		err := rows.Scan(
-			&backup.ID, &backup.ConnectionID, &backup.ScheduleID, &backup.Status,
-			&backup.Path, &backup.S3ObjectKey, &backup.Size,
-			&startedTimeStr, &completedTimeStr, &createdAtStr, &updatedAtStr,
-		)
-		if err != nil {
-			return nil, err
-		}
-
-		backup.StartedTime, err = common.ParseTime(startedTimeStr)
+		backup, err := scanBackup(rows)
 		if err != nil {
 			return nil, err
 		}
+		backups = append(backups, backup)
+	}
 
-		if completedTimeStr.Valid {
-			completedTime, err := common.ParseTime(completedTimeStr.String)
-			if err != nil {
-				return nil, err
-			}
-			backup.CompletedTime = &completedTime
-		}
+	return backups, rows.Err()
+}
 
-		backup.CreatedAt, err = common.ParseTime(createdAtStr)
-		if err != nil {
-			return nil, err
-		}
+// GetBackupsByScheduleID returns the backups a schedule took, newest first.
+func (r *BackupRepository) GetBackupsByScheduleID(scheduleID string) ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE schedule_id = $1
+		ORDER BY created_at DESC`,
+		scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-		backup.UpdatedAt, err = common.ParseTime(updatedAtStr)
+	var backups []*Backup
+	for rows.Next() {
+		backup, err := scanBackup(rows)
 		if err != nil {
 			return nil, err
 		}
-
 		backups = append(backups, backup)
 	}
 
 	return backups, rows.Err()
 }
 
-
 func (r *BackupRepository) UpdateBackupS3ObjectKey(backupID string, s3ObjectKey string) error {
 	_, err := r.db.Exec(`
 		UPDATE backups 
@@ -539,3 +777,41 @@ func (r *BackupRepository) UpdateBackupS3ObjectKey(backupID string, s3ObjectKey
 		s3ObjectKey, backupID)
 	return err
 }
+
+func (r *BackupRepository) UpdateBackupIntegrity(backupID string, status string, verifiedAt time.Time) error {
+	_, err := r.db.Exec(`
+		UPDATE backups
+		SET integrity_status = $1, verified_at = $2, updated_at = $3
+		WHERE id = $4`,
+		status, verifiedAt.Format(time.RFC3339), time.Now().Format(time.RFC3339), backupID)
+	return err
+}
+
+// GetBackupsDueForVerification returns completed backups with a checksum that
+// have not been verified since the given time, oldest verification first.
+func (r *BackupRepository) GetBackupsDueForVerification(verifiedBefore time.Time, limit int) ([]*Backup, error) {
+	rows, err := r.db.Query(`
+		SELECT `+backupColumns+`
+		FROM backups
+		WHERE status = 'completed'
+		AND checksum IS NOT NULL
+		AND (verified_at IS NULL OR verified_at < $1)
+		ORDER BY COALESCE(verified_at, '') ASC, created_at ASC
+		LIMIT $2`,
+		verifiedBefore.Format(time.RFC3339), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var backups []*Backup
+	for rows.Next() {
+		backup, err := scanBackup(rows)
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, backup)
+	}
+
+	return backups, rows.Err()
+}
@@ -0,0 +1,58 @@
+package backup
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pressly/goose"
+)
+
+// newTestRepository returns a repository over a fresh, fully migrated
+// database.
+func newTestRepository(t *testing.T) *BackupRepository {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "velld.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := goose.SetDialect("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := goose.Up(db, "../database/migrations"); err != nil {
+		t.Fatalf("migrating: %v", err)
+	}
+	return NewBackupRepository(db)
+}
+
+func TestGetBackupScheduleReturnsNewest(t *testing.T) {
+	repo := newTestRepository(t)
+	connectionID := uuid.NewString()
+
+	// created_at only has seconds, so it is set by hand
+	var newest string
+	for i, createdAt := range []string{"2026-01-02T00:00:00Z", "2026-03-01T00:00:00Z", "2026-02-01T00:00:00Z"} {
+		schedule := &BackupSchedule{ID: uuid.New(), ConnectionID: connectionID, Name: "schedule", CronSchedule: "0 0 2 * * *", RetentionDays: 7}
+		if err := repo.CreateBackupSchedule(schedule); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.db.Exec(`UPDATE backup_schedules SET created_at = $1 WHERE id = $2`, createdAt, schedule.ID); err != nil {
+			t.Fatal(err)
+		}
+		if i == 1 {
+			newest = schedule.ID.String()
+		}
+	}
+
+	schedule, err := repo.GetBackupSchedule(connectionID)
+	if err != nil {
+		t.Fatalf("GetBackupSchedule: %v", err)
+	}
+	if schedule.ID.String() != newest {
+		t.Errorf("GetBackupSchedule returned %s, want the newest schedule %s", schedule.ID, newest)
+	}
+}
@@ -3,11 +3,7 @@ package backup
 import (
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"strings"
 
-	"github.com/dendianugerah/velld/internal/common"
 	"github.com/dendianugerah/velld/internal/connection"
 )
 
@@ -16,13 +12,6 @@ type RestoreRequest struct {
 	ConnectionID string `json:"connection_id"`
 }
 
-var restoreTools = map[string]string{
-	"postgresql": "psql",
-	"mysql":      "mysql",
-	"mariadb":    "mysql",
-	"mongodb":    "mongorestore",
-}
-
 // RestoreBackup restores a backup to a target database connection
 func (s *BackupService) RestoreBackup(backupID string, connectionID string) error {
 	backup, err := s.backupRepo.GetBackup(backupID)
@@ -35,24 +24,23 @@ func (s *BackupService) RestoreBackup(backupID string, connectionID string) erro
 		return fmt.Errorf("failed to get connection: %v", err)
 	}
 
-	// Ensure backup file is available (local or download from S3)
-	filePath, isTemp, err := s.ensureBackupFileAvailable(backup, conn.UserID)
+	restorer, err := getRestorer(conn.Type)
 	if err != nil {
 		return err
 	}
 
-	// Clean up temp file after restore if needed
-	if isTemp {
-		defer func() {
-			if err := os.Remove(filePath); err != nil {
-				fmt.Printf("Warning: Failed to remove temp file %s: %v\n", filePath, err)
-			}
-		}()
+	if legacy, ok := restorer.(legacyRestorer); ok {
+		if dir, ok := legacy.LegacyBackupDir(backup.Path); ok {
+			return s.restoreLegacyBackup(legacy, restorer, dir, conn)
+		}
 	}
 
-	if err := s.verifyRestoreTools(conn.Type); err != nil {
+	// Ensure backup file is available (local or download from S3)
+	filePath, release, err := s.ensureBackupFileAvailable(backup, conn.UserID)
+	if err != nil {
 		return err
 	}
+	defer release()
 
 	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(conn)
 	if err != nil {
@@ -64,209 +52,49 @@ func (s *BackupService) RestoreBackup(backupID string, connectionID string) erro
 		conn.Port = effectivePort
 	}
 
-	var cmd *exec.Cmd
-	switch conn.Type {
-	case "postgresql":
-		cmd = s.createPsqlRestoreCmd(conn, filePath)
-	case "mysql", "mariadb":
-		cmd = s.createMySQLRestoreCmd(conn, filePath)
-	case "mongodb":
-		cmd = s.createMongoRestoreCmd(conn, filePath)
-	default:
-		return fmt.Errorf("unsupported database type for restore: %s", conn.Type)
+	cmd, err := createRestoreCmd(restorer, conn)
+	if err != nil {
+		return err
 	}
 
-	if cmd == nil {
-		return fmt.Errorf("restore tool not found for %s. Please ensure %s is installed", conn.Type, restoreTools[conn.Type])
+	reader, err := s.openBackupArtifact(filePath, backup)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %v", err)
 	}
+	defer reader.Close()
 
+	cmd.Stdin = reader
 	output, err := cmd.CombinedOutput()
-	return s.validateRestoreOutput(conn.Type, conn.DatabaseName, output, err)
-}
-
-func (s *BackupService) validateRestoreOutput(dbType, dbName string, output []byte, cmdErr error) error {
-	switch dbType {
-	case "postgresql":
-		return s.validatePostgreSQLRestore(output, cmdErr)
-	case "mysql", "mariadb":
-		return s.validateMySQLRestore(dbName, output, cmdErr)
-	case "mongodb":
-		return s.validateMongoDBRestore(dbName, output, cmdErr)
-	default:
-		return fmt.Errorf("unsupported database type: %s", dbType)
-	}
-}
-
-func (s *BackupService) validatePostgreSQLRestore(output []byte, cmdErr error) error {
-	outputStr := string(output)
-	lines := strings.Split(outputStr, "\n")
-
-	var criticalErrors []string
-
-	for _, line := range lines {
-		if !strings.Contains(line, "ERROR:") {
-			continue
-		}
-
-		if isCriticalPostgreSQLError(line) {
-			criticalErrors = append(criticalErrors, line)
-		}
-	}
-
-	if len(criticalErrors) > 0 {
-		for _, errLine := range criticalErrors {
-			if strings.Contains(errLine, "already exists") {
-				return fmt.Errorf("restore failed: target database must be empty. See documentation for restore best practices.\n\nError details:\n%s", errLine)
-			}
-		}
-		return fmt.Errorf("restore failed with %d error(s):\n%s", len(criticalErrors), strings.Join(criticalErrors, "\n"))
-	}
-
-	if cmdErr != nil {
-		return fmt.Errorf("restore failed: %s", cmdErr.Error())
-	}
-
-	return nil
-}
-
-func (s *BackupService) validateMySQLRestore(dbName string, output []byte, cmdErr error) error {
-	if cmdErr != nil {
-		outputStr := string(output)
-		if outputStr == "" {
-			outputStr = cmdErr.Error()
-		}
-		return fmt.Errorf("restore failed for database '%s': %s", dbName, outputStr)
-	}
-	return nil
+	return restorer.ValidateRestore(conn.DatabaseName, output, err)
 }
 
-func (s *BackupService) validateMongoDBRestore(dbName string, output []byte, cmdErr error) error {
-	if cmdErr != nil {
-		outputStr := string(output)
-		if outputStr == "" {
-			outputStr = cmdErr.Error()
-		}
-		return fmt.Errorf("restore failed for database '%s': %s", dbName, outputStr)
-	}
-	return nil
-}
-
-func isCriticalPostgreSQLError(line string) bool {
-	nonCriticalPatterns := []string{
-		"WARNING:",
-		"must be member of role",
-		"no privileges",
-		"NOTICE:",
-	}
-
-	for _, pattern := range nonCriticalPatterns {
-		if strings.Contains(line, pattern) {
-			return false
-		}
+// restoreLegacyBackup restores a backup kept in an engine's old on-disk
+// format. Those were never uploaded to storage, so only the local copy is
+// used.
+func (s *BackupService) restoreLegacyBackup(legacy legacyRestorer, restorer Restorer, dir string, conn *connection.StoredConnection) error {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("backup directory %s not found", dir)
 	}
 
-	return true
-}
-
-func (s *BackupService) verifyRestoreTools(dbType string) error {
-	if _, exists := restoreTools[dbType]; !exists {
-		return fmt.Errorf("unsupported database type: %s", dbType)
-	}
-	return nil
-}
-
-func (s *BackupService) findDatabaseRestorePath(dbType string) string {
-	if path := common.FindBinaryPath(dbType, restoreTools[dbType]); path != "" {
-		return path
-	}
-	return ""
-}
-
-func (s *BackupService) createPsqlRestoreCmd(conn *connection.StoredConnection, backupPath string) *exec.Cmd {
-	binaryPath := s.findDatabaseRestorePath("postgresql")
-	if binaryPath == "" {
-		fmt.Printf("ERROR: psql binary not found. Please install PostgreSQL client tools.\n")
-		return nil
-	}
-
-	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(restoreTools["postgresql"]))
-
-	// Use -v ON_ERROR_STOP=1 to exit immediately on first error
-	// This ensures errors are properly caught
-	cmd := exec.Command(binPath,
-		"-h", conn.Host,
-		"-p", fmt.Sprintf("%d", conn.Port),
-		"-U", conn.Username,
-		"-d", conn.DatabaseName,
-		"-f", backupPath,
-		"-v", "ON_ERROR_STOP=1", // Exit on first error
-	)
-
-	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
-	return cmd
-}
-
-func (s *BackupService) createMySQLRestoreCmd(conn *connection.StoredConnection, backupPath string) *exec.Cmd {
-	binaryPath := s.findDatabaseRestorePath(conn.Type)
-	if binaryPath == "" {
-		fmt.Printf("ERROR: mysql binary not found. Please install MySQL/MariaDB client tools.\n")
-		return nil
-	}
-
-	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(restoreTools[conn.Type]))
-
-	args := []string{
-		"-h", conn.Host,
-		"-P", fmt.Sprintf("%d", conn.Port),
-		"-u", conn.Username,
-		fmt.Sprintf("-p%s", conn.Password),
-	}
-
-	if !conn.SSL {
-		args = append(args, "--skip-ssl")
-	} else {
-		args = append(args, "--ssl-mode=REQUIRED")
-	}
-
-	args = append(args, conn.DatabaseName)
-
-	cmd := exec.Command(binPath, args...)
-
-	file, err := os.Open(backupPath)
+	binPath, err := findTool(conn.Type, restorer.RestoreTool())
 	if err != nil {
-		fmt.Printf("ERROR: failed to open backup file: %v\n", err)
-		return nil
-	}
-
-	cmd.Stdin = file
-	return cmd
-}
-
-func (s *BackupService) createMongoRestoreCmd(conn *connection.StoredConnection, backupPath string) *exec.Cmd {
-	binaryPath := s.findDatabaseRestorePath("mongodb")
-	if binaryPath == "" {
-		fmt.Printf("ERROR: mongorestore binary not found. Please install MongoDB Database Tools.\n")
-		return nil
+		return err
 	}
 
-	binPath := filepath.Join(binaryPath, common.GetPlatformExecutableName(restoreTools["mongodb"]))
-
-	backupDir := filepath.Dir(backupPath)
-
-	args := []string{
-		"--host", conn.Host,
-		"--port", fmt.Sprintf("%d", conn.Port),
-		"--db", conn.DatabaseName,
-		backupDir,
+	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(conn)
+	if err != nil {
+		return fmt.Errorf("failed to setup SSH tunnel: %v", err)
 	}
-
-	if conn.Username != "" {
-		args = append(args, "--username", conn.Username)
+	if tunnel != nil {
+		defer tunnel.Stop()
+		conn.Host = effectiveHost
+		conn.Port = effectivePort
 	}
 
-	if conn.Password != "" {
-		args = append(args, "--password", conn.Password)
+	cmd, err := legacy.LegacyRestoreCmd(binPath, dir, conn)
+	if err != nil {
+		return err
 	}
-
-	return exec.Command(binPath, args...)
+	output, err := cmd.CombinedOutput()
+	return restorer.ValidateRestore(conn.DatabaseName, output, err)
 }
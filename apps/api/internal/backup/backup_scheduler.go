@@ -1,88 +1,248 @@
 package backup
 
 import (
-	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/robfig/cron/v3"
 )
 
-func (s *BackupService) ScheduleBackup(req *ScheduleBackupRequest) error {
-	// Check if a schedule already exists for this connection
-	existingSchedule, err := s.backupRepo.GetBackupSchedule(req.ConnectionID)
-	if err != nil && err != sql.ErrNoRows {
-		return fmt.Errorf("failed to check existing schedule: %v", err)
-	}
-
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	schedule, err := parser.Parse(req.CronSchedule)
-	if err != nil {
-		return fmt.Errorf("invalid cron schedule: %v", err)
-	}
-
-	nextRun := schedule.Next(time.Now())
+// defaultScheduleName names schedules created without a name.
+const defaultScheduleName = "Default"
 
-	if existingSchedule != nil {
-		// Update existing schedule
-		existingSchedule.Enabled = true
-		existingSchedule.CronSchedule = req.CronSchedule
-		existingSchedule.RetentionDays = req.RetentionDays
-		existingSchedule.NextRunTime = &nextRun
-		existingSchedule.UpdatedAt = time.Now()
+var errInvalidSchedule = errors.New("invalid schedule")
 
-		if err := s.backupRepo.UpdateBackupSchedule(existingSchedule); err != nil {
-			return fmt.Errorf("failed to update backup schedule: %v", err)
-		}
+// invalidSchedule marks a validation error of a schedule request.
+func invalidSchedule(err error) error {
+	return fmt.Errorf("%w: %v", errInvalidSchedule, err)
+}
 
-		// Update cron job
-		scheduleID := existingSchedule.ID.String()
-		if oldEntryID, exists := s.cronEntries[scheduleID]; exists {
-			s.cronManager.Remove(oldEntryID)
+// applyDumpOptions copies the set fields of req onto schedule and checks the
+// connection's engine supports them.
+func applyDumpOptions(schedule *BackupSchedule, req DumpOptionsRequest, dbType string) error {
+	if req.SchemaOnly != nil {
+		schedule.SchemaOnly = *req.SchemaOnly
+	}
+	if req.Databases != nil {
+		databases := []string{}
+		for _, db := range req.Databases {
+			db = strings.TrimSpace(db)
+			if db == "" || strings.Contains(db, ",") {
+				return fmt.Errorf("invalid database name %q", db)
+			}
+			databases = append(databases, db)
 		}
+		schedule.Databases = databases
+	}
+	return checkDumpOptions(dbType, schedule.DumpOptions)
+}
 
-		entryID, err := s.cronManager.AddFunc(req.CronSchedule, func() {
-			s.executeCronBackup(existingSchedule)
-		})
-		if err != nil {
-			return fmt.Errorf("failed to schedule backup: %v", err)
-		}
+// CreateSchedule adds a schedule to one of the user's connections, next to
+// any it already has.
+func (s *BackupService) CreateSchedule(req *ScheduleBackupRequest, userID uuid.UUID) (*BackupSchedule, error) {
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	if conn.UserID != userID {
+		return nil, errUnauthorized
+	}
+	return s.createSchedule(req, conn.Type)
+}
 
-		s.cronEntries[scheduleID] = entryID
-		return nil
+func (s *BackupService) createSchedule(req *ScheduleBackupRequest, dbType string) (*BackupSchedule, error) {
+	cronSchedule, err := parseSchedule(req.CronSchedule, req.Timezone)
+	if err != nil {
+		return nil, invalidSchedule(err)
 	}
+	nextRun := cronSchedule.Next(time.Now())
 
-	// Create new schedule if none exists
-	backupSchedule := &BackupSchedule{
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = defaultScheduleName
+	}
+	schedule := &BackupSchedule{
 		ID:            uuid.New(),
 		ConnectionID:  req.ConnectionID,
+		Name:          name,
 		Enabled:       true,
 		CronSchedule:  req.CronSchedule,
+		Timezone:      req.Timezone,
 		RetentionDays: req.RetentionDays,
+		DumpOptions:   DumpOptions{Databases: []string{}},
 		NextRunTime:   &nextRun,
 		CreatedAt:     time.Now(),
 		UpdatedAt:     time.Now(),
 	}
+	if err := applyRetryPolicy(schedule, req.RetryPolicy); err != nil {
+		return nil, invalidSchedule(err)
+	}
+	if err := applyRetentionPolicy(schedule, req.RetentionPolicy); err != nil {
+		return nil, invalidSchedule(err)
+	}
+	if err := applyDumpOptions(schedule, req.DumpOptionsRequest, dbType); err != nil {
+		return nil, invalidSchedule(err)
+	}
+	if err := applyMissedRunPolicy(schedule, req.MissedRunPolicy); err != nil {
+		return nil, invalidSchedule(err)
+	}
 
-	if err := s.backupRepo.CreateBackupSchedule(backupSchedule); err != nil {
-		return fmt.Errorf("failed to save backup schedule: %v", err)
+	if err := s.backupRepo.CreateBackupSchedule(schedule); err != nil {
+		return nil, fmt.Errorf("failed to save backup schedule: %v", err)
 	}
+	if err := s.scheduler.register(schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
 
-	scheduleID := backupSchedule.ID.String()
-	entryID, err := s.cronManager.AddFunc(req.CronSchedule, func() {
-		s.executeCronBackup(backupSchedule)
-	})
+// ScheduleBackup enables the connection's most recent schedule with the
+// requested settings, creating it if the connection has none.
+func (s *BackupService) ScheduleBackup(req *ScheduleBackupRequest) error {
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
 	if err != nil {
-		return fmt.Errorf("failed to schedule backup: %v", err)
+		return fmt.Errorf("failed to get connection: %v", err)
 	}
 
-	s.cronEntries[scheduleID] = entryID
-	return nil
+	existingSchedule, err := s.backupRepo.GetBackupSchedule(req.ConnectionID)
+	if err == sql.ErrNoRows {
+		_, err := s.createSchedule(req, conn.Type)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check existing schedule: %v", err)
+	}
+
+	enabled := true
+	update := &UpdateScheduleRequest{
+		Enabled:            &enabled,
+		CronSchedule:       req.CronSchedule,
+		RetentionDays:      req.RetentionDays,
+		RetryPolicy:        req.RetryPolicy,
+		RetentionPolicy:    req.RetentionPolicy,
+		DumpOptionsRequest: req.DumpOptionsRequest,
+	}
+	if req.Name != "" {
+		update.Name = &req.Name
+	}
+	if req.Timezone != "" {
+		update.Timezone = &req.Timezone
+	}
+	if req.MissedRunPolicy != "" {
+		update.MissedRunPolicy = &req.MissedRunPolicy
+	}
+	return s.updateSchedule(existingSchedule, update, conn.Type)
+}
+
+// getOwnedSchedule returns a schedule of one of the user's connections.
+func (s *BackupService) getOwnedSchedule(scheduleID string, userID uuid.UUID) (*BackupSchedule, string, error) {
+	schedule, err := s.backupRepo.GetBackupScheduleByID(scheduleID)
+	if err != nil {
+		return nil, "", err
+	}
+	conn, err := s.connStorage.GetConnection(schedule.ConnectionID)
+	if err != nil {
+		return nil, "", err
+	}
+	if conn.UserID != userID {
+		return nil, "", errUnauthorized
+	}
+	return schedule, conn.Type, nil
+}
+
+func (s *BackupService) GetSchedule(scheduleID string, userID uuid.UUID) (*BackupSchedule, error) {
+	schedule, _, err := s.getOwnedSchedule(scheduleID, userID)
+	return schedule, err
+}
+
+// ListSchedules returns the user's schedules, only those of connectionID
+// unless it is empty.
+func (s *BackupService) ListSchedules(userID uuid.UUID, connectionID string) ([]*BackupSchedule, error) {
+	return s.backupRepo.ListBackupSchedules(userID, connectionID)
+}
+
+func (s *BackupService) UpdateSchedule(scheduleID string, userID uuid.UUID, req *UpdateScheduleRequest) (*BackupSchedule, error) {
+	schedule, dbType, err := s.getOwnedSchedule(scheduleID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.updateSchedule(schedule, req, dbType); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// DeleteSchedule stops a schedule and deletes it with its run history. The
+// backups it took are kept but no longer fall under any retention.
+func (s *BackupService) DeleteSchedule(scheduleID string, userID uuid.UUID) error {
+	if _, _, err := s.getOwnedSchedule(scheduleID, userID); err != nil {
+		return err
+	}
+	s.scheduler.unregister(scheduleID)
+	return s.backupRepo.DeleteBackupSchedule(scheduleID)
 }
 
+// updateSchedule applies req to schedule, saves it and replaces its cron
+// entry, or removes it if the schedule ends up disabled.
+func (s *BackupService) updateSchedule(schedule *BackupSchedule, req *UpdateScheduleRequest, dbType string) error {
+	timezone := schedule.Timezone
+	if req.Timezone != nil {
+		timezone = *req.Timezone
+	}
+	cronSchedule, err := parseSchedule(req.CronSchedule, timezone)
+	if err != nil {
+		return invalidSchedule(err)
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return fmt.Errorf("%w: name must not be empty", errInvalidSchedule)
+		}
+		schedule.Name = name
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+	schedule.CronSchedule = req.CronSchedule
+	schedule.Timezone = timezone
+	schedule.RetentionDays = req.RetentionDays
+	if err := applyRetryPolicy(schedule, req.RetryPolicy); err != nil {
+		return invalidSchedule(err)
+	}
+	if err := applyRetentionPolicy(schedule, req.RetentionPolicy); err != nil {
+		return invalidSchedule(err)
+	}
+	if err := applyDumpOptions(schedule, req.DumpOptionsRequest, dbType); err != nil {
+		return invalidSchedule(err)
+	}
+	if req.MissedRunPolicy != nil {
+		if err := applyMissedRunPolicy(schedule, *req.MissedRunPolicy); err != nil {
+			return invalidSchedule(err)
+		}
+	}
+	nextRun := cronSchedule.Next(time.Now())
+	schedule.NextRunTime = &nextRun
+	schedule.UpdatedAt = time.Now()
+
+	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
+		return fmt.Errorf("failed to update backup schedule: %v", err)
+	}
+
+	if !schedule.Enabled {
+		s.scheduler.unregister(schedule.ID.String())
+		return nil
+	}
+	return s.scheduler.register(schedule)
+}
+
+// executeCronBackup runs a schedule whose cron entry fired, retrying
+// failures as configured, and records the run. The run is skipped if the
+// schedule's previous run, including its retries, has not finished.
 func (s *BackupService) executeCronBackup(schedule *BackupSchedule) {
 	// if schedule.CronSchedule == "0 */1 * * * *" {
 	// 	err := fmt.Errorf("test failure: this is a simulated backup failure for SMTP testing")
@@ -92,125 +252,158 @@ func (s *BackupService) executeCronBackup(schedule *BackupSchedule) {
 	// 	return
 	// }
 
-	backup, err := s.CreateBackup(schedule.ConnectionID)
-	if err != nil {
+	scheduleIDStr := schedule.ID.String()
+	run := newScheduleRun(scheduleIDStr)
+	if err := s.backupRepo.CreateScheduleRun(run); err != nil {
+		fmt.Printf("Error recording run of schedule %s: %v\n", scheduleIDStr, err)
+	}
+
+	err := errScheduleBusy
+	if ctx, done, ok := s.scheduler.begin(scheduleIDStr); ok {
+		defer done()
+		_, err = s.runScheduleAttempts(ctx, schedule, run)
+	}
+	switch {
+	case errors.Is(err, errScheduleBusy):
+		fmt.Printf("Skipping scheduled backup for schedule %s: %v\n", scheduleIDStr, err)
+		run.Status = jobSkipped
+		if err := s.backupRepo.RecordSkippedScheduleRun(scheduleIDStr, time.Now()); err != nil {
+			fmt.Printf("Error recording skipped run of schedule %s: %v\n", scheduleIDStr, err)
+		}
+	case errors.Is(err, errBackupCancelled):
+		fmt.Printf("Scheduled backup for schedule %s was cancelled\n", scheduleIDStr)
+		run.Status = jobCancelled
+		s.recordScheduleRunStatus(scheduleIDStr, jobCancelled)
+	case err != nil:
+		run.Status = jobFailed
+		s.recordScheduleRunStatus(scheduleIDStr, jobFailed)
 		if notifyErr := s.createFailureNotification(schedule.ConnectionID, err); notifyErr != nil {
 			fmt.Printf("Error creating failure notification: %v\n", notifyErr)
 		}
-	} else {
-		scheduleIDStr := schedule.ID.String()
-		if err := s.backupRepo.UpdateBackupStatusAndSchedule(backup.ID.String(), backup.Status, scheduleIDStr); err != nil {
-			fmt.Printf("Error updating backup status and schedule: %v\n", err)
-		}
+	default:
+		run.Status = jobCompleted
+		s.recordScheduleRunStatus(scheduleIDStr, jobCompleted)
 	}
 
-	// Update schedule's next run time and last backup time
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	cronSchedule, _ := parser.Parse(schedule.CronSchedule)
-	nextRun := cronSchedule.Next(time.Now())
-	schedule.NextRunTime = &nextRun
-	now := time.Now()
-	schedule.LastBackupTime = &now
-	schedule.UpdatedAt = now
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	if err != nil {
+		msg := err.Error()
+		run.Error = &msg
+	}
+	if err := s.backupRepo.UpdateScheduleRun(run); err != nil {
+		fmt.Printf("Error updating run of schedule %s: %v\n", scheduleIDStr, err)
+	}
 
-	if err := s.backupRepo.UpdateBackupSchedule(schedule); err != nil {
+	// The schedule may have changed while the backup ran, so record its
+	// run times and apply its retention as it is saved now
+	current, err := s.backupRepo.GetBackupScheduleByID(scheduleIDStr)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			fmt.Printf("Error reloading schedule %s: %v\n", scheduleIDStr, err)
+		}
+		return
+	}
+	now := time.Now()
+	var nextRun *time.Time
+	if cronSchedule, err := parseSchedule(current.CronSchedule, current.Timezone); err == nil {
+		next := cronSchedule.Next(now)
+		nextRun = &next
+	}
+	if err := s.backupRepo.UpdateScheduleRunTimes(scheduleIDStr, nextRun, now); err != nil {
 		fmt.Printf("Error updating backup schedule: %v\n", err)
 	}
 
-	if schedule.RetentionDays > 0 {
-		s.cleanupOldBackups(schedule.ConnectionID, schedule.RetentionDays)
+	s.cleanupOldBackups(current)
+}
+
+// ReloadSchedules rebuilds the scheduler's cron entries from the saved
+// schedules, picking up schedules changed in the database without going
+// through the API.
+func (s *BackupService) ReloadSchedules() (*ScheduleReload, error) {
+	schedules, err := s.backupRepo.GetAllActiveSchedules()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get active schedules: %v", err)
 	}
+	return s.scheduler.reload(schedules), nil
 }
 
-func (s *BackupService) cleanupOldBackups(connectionID string, retentionDays int) {
-	cutoffTime := time.Now().AddDate(0, 0, -retentionDays)
-	oldBackups, err := s.backupRepo.GetBackupsOlderThan(connectionID, cutoffTime)
+// runScheduledJob queues a scheduled backup and waits for it to finish,
+// returning the job's ID along with its outcome. The run is skipped with
+// errScheduleBusy if the schedule's previous run is still queued or running.
+func (s *BackupService) runScheduledJob(schedule *BackupSchedule) (*string, *Backup, error) {
+	a, err := s.enqueueBackup(schedule.ConnectionID, schedule, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	<-a.done
+	jobID := a.job.ID.String()
+	return &jobID, a.backup, a.err
+}
+
+func (s *BackupService) recordScheduleRunStatus(scheduleID string, status string) {
+	if err := s.backupRepo.UpdateScheduleRunStatus(scheduleID, status, time.Now()); err != nil {
+		fmt.Printf("Error updating run status of schedule %s: %v\n", scheduleID, err)
+	}
+}
+
+// cleanupOldBackups deletes the backups taken by the schedule that its
+// retention policy no longer keeps. Backups of the connection's other
+// schedules and manual backups are left alone.
+func (s *BackupService) cleanupOldBackups(schedule *BackupSchedule) {
+	connectionID := schedule.ConnectionID
+	backups, err := s.backupRepo.GetBackupsByScheduleID(schedule.ID.String())
 	if err != nil {
 		fmt.Printf("Error fetching old backups for cleanup: %v\n", err)
 		return
 	}
 
+	var oldBackups []*Backup
+	for _, d := range planRetention(schedule, backups, time.Now()) {
+		if !d.Keep {
+			oldBackups = append(oldBackups, d.Backup)
+		}
+	}
+
 	if len(oldBackups) == 0 {
 		return
 	}
 
-	// Get connection to retrieve user settings for S3
+	// Get connection to check its storage cleanup setting
 	conn, err := s.connStorage.GetConnection(connectionID)
 	if err != nil {
 		fmt.Printf("Error getting connection for cleanup: %v\n", err)
 		return
 	}
 
-	// Get user settings to check if S3 is enabled
-	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
-	if err != nil {
-		fmt.Printf("Warning: Failed to get user settings for cleanup: %v\n", err)
-		// Continue with local cleanup even if we can't get S3 settings
-	}
-
-	// Initialize S3 client if S3 is enabled and configured
-	var s3Storage *S3Storage
-	if userSettings != nil && userSettings.S3Enabled && 
-	   userSettings.S3Endpoint != nil && *userSettings.S3Endpoint != "" &&
-	   userSettings.S3Bucket != nil && *userSettings.S3Bucket != "" &&
-	   userSettings.S3AccessKey != nil && *userSettings.S3AccessKey != "" &&
-	   userSettings.S3SecretKey != nil && *userSettings.S3SecretKey != "" {
-		
-		secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
-		if err != nil {
-			fmt.Printf("Warning: Failed to decrypt S3 secret key for cleanup: %v\n", err)
-		} else {
-			region := "us-east-1"
-			if userSettings.S3Region != nil && *userSettings.S3Region != "" {
-				region = *userSettings.S3Region
-			}
+	// Clean up old backups
+	for _, backup := range oldBackups {
+		backupID := backup.ID.String()
 
-			pathPrefix := ""
-			if userSettings.S3PathPrefix != nil {
-				pathPrefix = *userSettings.S3PathPrefix
+		// Delete stored copies if the connection has storage cleanup enabled.
+		// A backup whose copies are not all deleted is kept, so the next
+		// cleanup tries them again.
+		if conn.S3CleanupOnRetention {
+			n, failed, err := s.deleteBackupCopies(backup, conn.UserID)
+			if n > 0 {
+				fmt.Printf("Deleted %d stored copies of backup %s (retention cleanup)\n", n, backupID)
 			}
-
-			s3Config := S3Config{
-				Endpoint:   *userSettings.S3Endpoint,
-				Region:     region,
-				Bucket:     *userSettings.S3Bucket,
-				AccessKey:  *userSettings.S3AccessKey,
-				SecretKey:  secretKey,
-				UseSSL:     userSettings.S3UseSSL,
-				PathPrefix: pathPrefix,
+			if err == nil && len(failed) > 0 {
+				err = copiesNotDeleted(failed)
 			}
-
-			s3Storage, err = NewS3Storage(s3Config)
 			if err != nil {
-				fmt.Printf("Warning: Failed to create S3 storage client for cleanup: %v\n", err)
-				s3Storage = nil
-			}
-		}
-	}
-
-	// Clean up old backups
-	ctx := context.Background()
-	for _, backup := range oldBackups {
-		backupID := backup.ID.String()
-		
-		// Delete from S3 if object key exists, S3 is configured, and connection has S3 cleanup enabled
-		if backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" && s3Storage != nil && conn.S3CleanupOnRetention {
-			if err := s3Storage.DeleteFile(ctx, *backup.S3ObjectKey); err != nil {
-				fmt.Printf("Warning: Failed to delete S3 object %s for backup %s: %v\n", 
-					*backup.S3ObjectKey, backupID, err)
-			} else {
-				fmt.Printf("Deleted S3 object %s for backup %s (retention cleanup)\n", 
-					*backup.S3ObjectKey, backupID)
+				fmt.Printf("Warning: Keeping backup %s for the next cleanup: %v\n", backupID, err)
+				continue
 			}
 		}
 
 		// Delete local file if it exists
 		if _, err := os.Stat(backup.Path); err == nil {
 			if err := os.Remove(backup.Path); err != nil {
-				fmt.Printf("Warning: Failed to delete local file %s for backup %s: %v\n", 
+				fmt.Printf("Warning: Failed to delete local file %s for backup %s: %v\n",
 					backup.Path, backupID, err)
 			} else {
-				fmt.Printf("Deleted local file %s for backup %s (retention cleanup)\n", 
+				fmt.Printf("Deleted local file %s for backup %s (retention cleanup)\n",
 					backup.Path, backupID)
 			}
 		}
@@ -223,8 +416,8 @@ func (s *BackupService) cleanupOldBackups(connectionID string, retentionDays int
 		}
 	}
 
-	fmt.Printf("Retention cleanup completed: processed %d old backups for connection %s\n", 
-		len(oldBackups), connectionID)
+	fmt.Printf("Retention cleanup completed: processed %d old backups for schedule %s of connection %s\n",
+		len(oldBackups), schedule.ID, connectionID)
 }
 
 func (s *BackupService) DisableBackupSchedule(connectionID string) error {
@@ -233,11 +426,7 @@ func (s *BackupService) DisableBackupSchedule(connectionID string) error {
 		return err
 	}
 
-	scheduleID := schedule.ID.String()
-	if entryID, exists := s.cronEntries[scheduleID]; exists {
-		s.cronManager.Remove(entryID)
-		delete(s.cronEntries, scheduleID)
-	}
+	s.scheduler.unregister(schedule.ID.String())
 
 	schedule.Enabled = false
 	schedule.UpdatedAt = time.Now()
@@ -248,41 +437,15 @@ func (s *BackupService) DisableBackupSchedule(connectionID string) error {
 	return nil
 }
 
+// UpdateBackupSchedule updates the connection's most recent schedule.
 func (s *BackupService) UpdateBackupSchedule(connectionID string, req *UpdateScheduleRequest) error {
 	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
 	if err != nil {
 		return err
 	}
-
-	parser := cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
-	_, err = parser.Parse(req.CronSchedule)
-	if err != nil {
-		return fmt.Errorf("invalid cron schedule: %v", err)
-	}
-
-	schedule.CronSchedule = req.CronSchedule
-	schedule.RetentionDays = req.RetentionDays
-	err = s.backupRepo.UpdateBackupSchedule(schedule)
+	conn, err := s.connStorage.GetConnection(connectionID)
 	if err != nil {
 		return err
 	}
-
-	// Remove old cron job
-	if entryID, ok := s.cronEntries[schedule.ID.String()]; ok {
-		s.cronManager.Remove(entryID)
-		delete(s.cronEntries, schedule.ID.String())
-	}
-
-	// Add new cron job
-	entryID, err := s.cronManager.AddFunc(schedule.CronSchedule, func() {
-		s.executeCronBackup(schedule)
-	})
-	if err != nil {
-		return fmt.Errorf("failed to register cron job: %v", err)
-	}
-
-	// Store the new entry ID
-	s.cronEntries[schedule.ID.String()] = entryID
-
-	return nil
+	return s.updateSchedule(schedule, req, conn.Type)
 }
@@ -2,11 +2,13 @@ package backup
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dendianugerah/velld/internal/common"
@@ -14,18 +16,41 @@ import (
 	"github.com/dendianugerah/velld/internal/notification"
 	"github.com/dendianugerah/velld/internal/settings"
 	"github.com/google/uuid"
-	"github.com/robfig/cron/v3"
 )
 
+// Backup statuses. A backup is created in progress before its dump starts;
+// one still in progress when the server restarts becomes "interrupted".
+const (
+	backupInProgress = "in_progress"
+	backupCompleted  = "completed"
+	backupFailed     = "failed"
+	backupCancelled  = "cancelled"
+)
+
+// errUnauthorized is returned when a user asks for something they do not own.
+var errUnauthorized = errors.New("unauthorized")
+
 type BackupService struct {
 	connStorage      *connection.ConnectionRepository
 	backupDir        string
 	backupRepo       *BackupRepository
-	cronManager      *cron.Cron
-	cronEntries      map[string]cron.EntryID // map[scheduleID]entryID
+	scheduler        *scheduler
 	settingsService  *settings.SettingsService
 	notificationRepo *notification.NotificationRepository
 	cryptoService    *common.EncryptionService
+	jobs             *jobQueue
+	downloads        *downloadCache
+
+	// localStorageRoots are the directories local destinations may use
+	localStorageRoots []string
+
+	// uploadReconcileMu keeps upload reconciler runs from overlapping
+	uploadReconcileMu sync.Mutex
+
+	// destinationLimiters holds the bandwidth limiters of each destination
+	// by ID, created as destinations are opened
+	limitersMu          sync.Mutex
+	destinationLimiters map[string]*destinationLimiters
 }
 
 func NewBackupService(
@@ -40,27 +65,72 @@ func NewBackupService(
 		panic(err)
 	}
 
-	cronManager := cron.New(cron.WithSeconds())
 	service := &BackupService{
-		connStorage:      connStorage,
-		backupDir:        backupDir,
-		backupRepo:       backupRepo,
-		settingsService:  settingsService,
-		notificationRepo: notificationRepo,
-		cryptoService:    cryptoService,
-		cronManager:      cronManager,
-		cronEntries:      make(map[string]cron.EntryID),
+		connStorage:       connStorage,
+		backupDir:         backupDir,
+		backupRepo:        backupRepo,
+		settingsService:   settingsService,
+		notificationRepo:  notificationRepo,
+		cryptoService:     cryptoService,
+		localStorageRoots: localStorageRootsFromEnv(),
+	}
+	service.scheduler = newScheduler(backupRepo.GetBackupScheduleByID, service.executeCronBackup)
+	service.jobs = newJobQueue(concurrencyLimitsFromEnv(), service.runJob)
+	downloads, err := downloadCacheFromEnv()
+	if err != nil {
+		panic(err)
 	}
+	service.downloads = downloads
+	service.failUnfinishedJobs()
+	service.interruptUnfinishedBackups()
+	service.failInterruptedUploads()
 
-	// Recover existing schedules before starting the cron manager
+	// Recover existing schedules before starting the scheduler
 	if err := service.recoverSchedules(); err != nil {
 		fmt.Printf("Error recovering schedules: %v\n", err)
 	}
 
-	cronManager.Start()
+	if err := service.scheduler.addTask(integritySweepSchedule, service.runIntegritySweep); err != nil {
+		fmt.Printf("Error scheduling integrity sweep: %v\n", err)
+	}
+	if err := service.scheduler.addTask(uploadReconcileSchedule, service.runUploadReconciler); err != nil {
+		fmt.Printf("Error scheduling upload reconciler: %v\n", err)
+	}
+
+	service.scheduler.start()
 	return service
 }
 
+// Shutdown stops running schedules, cancelling the retries they are
+// waiting on. Backups already running are left to finish.
+func (s *BackupService) Shutdown() {
+	s.scheduler.stop()
+}
+
+// NewMaintenanceBackupService builds a service for one-off commands such as
+// storage reconciliation. Unlike NewBackupService it recovers no schedules
+// and runs no jobs or background work, so it can be used next to a running
+// server. It cannot run backups.
+func NewMaintenanceBackupService(
+	connStorage *connection.ConnectionRepository,
+	backupDir string,
+	backupRepo *BackupRepository,
+	settingsService *settings.SettingsService,
+	cryptoService *common.EncryptionService,
+) *BackupService {
+	return &BackupService{
+		connStorage:       connStorage,
+		backupDir:         backupDir,
+		backupRepo:        backupRepo,
+		settingsService:   settingsService,
+		cryptoService:     cryptoService,
+		localStorageRoots: localStorageRootsFromEnv(),
+	}
+}
+
+// recoverSchedules registers the enabled schedules on startup. Runs they
+// missed while the server was down are recorded and made up for as each
+// schedule's missed run policy says.
 func (s *BackupService) recoverSchedules() error {
 	schedules, err := s.backupRepo.GetAllActiveSchedules()
 	if err != nil {
@@ -68,54 +138,77 @@ func (s *BackupService) recoverSchedules() error {
 	}
 
 	now := time.Now()
+	jitter := time.Duration(positiveIntFromEnv("BACKUP_MISSED_RUN_JITTER", defaultMissedRunJitter)) * time.Second
 	for _, schedule := range schedules {
 		scheduleID := schedule.ID.String()
 
-		// Check if we missed any backups
 		if schedule.NextRunTime != nil && schedule.NextRunTime.Before(now) {
-			// Execute a backup immediately for missed schedule
-			go s.executeCronBackup(schedule)
+			s.recoverMissedRuns(schedule, now, jitter)
 		}
 
 		// Re-register the cron job
-		entryID, err := s.cronManager.AddFunc(schedule.CronSchedule, func() {
-			s.executeCronBackup(schedule)
-		})
-		if err != nil {
+		if err := s.scheduler.register(schedule); err != nil {
 			fmt.Printf("Error re-registering schedule %s: %v\n", scheduleID, err)
-			continue
 		}
-
-		s.cronEntries[scheduleID] = entryID
 	}
 
 	return nil
 }
 
-func (s *BackupService) CreateBackup(connectionID string) (*Backup, error) {
+// createBackup takes a backup of a connection, with the dump options of
+// the schedule it runs for, if any. It runs on a job worker; cancelling ctx
+// kills the dump and returns errBackupCancelled.
+func (s *BackupService) createBackup(ctx context.Context, connectionID string, schedule *BackupSchedule, progress *dumpProgress) (*Backup, error) {
 	conn, err := s.connStorage.GetConnection(connectionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get connection: %v", err)
 	}
 
+	if schedule != nil && len(schedule.Databases) > 0 {
+		conn.SelectedDatabases = schedule.Databases
+	}
+
 	// Check if multi-database backup is needed
 	if len(conn.SelectedDatabases) > 0 {
 		// Create backups for all selected databases
-		return s.createMultiDatabaseBackup(conn)
+		return s.createMultiDatabaseBackup(ctx, conn, schedule, progress)
 	}
 
 	// Single database backup
-	return s.createSingleDatabaseBackup(conn, conn.DatabaseName)
+	return s.createSingleDatabaseBackup(ctx, conn, conn.DatabaseName, schedule, progress)
 }
 
-func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnection) (*Backup, error) {
-	if err := s.verifyBackupTools(conn.Type); err != nil {
+// scheduleDump returns the ID and dump options of the schedule a backup
+// runs for; manual backups have neither.
+func scheduleDump(schedule *BackupSchedule) (*string, DumpOptions) {
+	if schedule == nil {
+		return nil, DumpOptions{}
+	}
+	scheduleID := schedule.ID.String()
+	return &scheduleID, schedule.DumpOptions
+}
+
+func (s *BackupService) createMultiDatabaseBackup(ctx context.Context, conn *connection.StoredConnection, schedule *BackupSchedule, progress *dumpProgress) (*Backup, error) {
+	dumper, err := getDumper(conn.Type)
+	if err != nil {
 		return nil, err
 	}
 
-	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(conn)
+	connectionFolder := filepath.Join(s.backupDir, common.SanitizeConnectionName(conn.Name))
+	if err := os.MkdirAll(connectionFolder, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create connection backup folder: %v", err)
+	}
+
+	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to setup SSH tunnel: %v", err)
+		return nil, fmt.Errorf("failed to get user settings: %v", err)
+	}
+
+	// A tunnel failure fails every database, but each still gets a row in
+	// the history
+	tunnel, effectiveHost, effectivePort, tunnelErr := s.setupSSHTunnelIfNeeded(conn)
+	if tunnelErr != nil {
+		tunnelErr = fmt.Errorf("failed to setup SSH tunnel: %v", tunnelErr)
 	}
 	if tunnel != nil {
 		defer tunnel.Stop()
@@ -123,78 +216,94 @@ func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnect
 		conn.Port = effectivePort
 	}
 
-	connectionFolder := filepath.Join(s.backupDir, common.SanitizeConnectionName(conn.Name))
-	if err := os.MkdirAll(connectionFolder, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create connection backup folder: %v", err)
-	}
-
 	timestamp := time.Now().Format("20060102_150405")
 	startTime := time.Now()
+	scheduleID, dumpOpts := scheduleDump(schedule)
 
 	var failedDatabases []string
 	var successfulBackups []*Backup
 
 	for _, dbName := range conn.SelectedDatabases {
-		backupID := uuid.New()
-		filename := fmt.Sprintf("%s_%s.sql", dbName, timestamp)
-		backupPath := filepath.Join(connectionFolder, filename)
+		// Every database gets its own data key
+		encryption, err := s.newBackupEncryption(userSettings)
+		if err != nil {
+			return nil, err
+		}
 
-		tempConn := *conn
-		tempConn.DatabaseName = dbName
+		opts := artifactOptions{
+			Compression:      conn.Compression,
+			CompressionLevel: conn.CompressionLevel,
+			Encryption:       encryption,
+		}
 
-		var cmd *exec.Cmd
-		switch conn.Type {
-		case "postgresql":
-			cmd = s.createPgDumpCmd(&tempConn, backupPath)
-		case "mysql", "mariadb":
-			cmd = s.createMySQLDumpCmd(&tempConn, backupPath)
-		case "mongodb":
-			cmd = s.createMongoDumpCmd(&tempConn, backupPath)
-		case "redis":
-			cmd = s.createRedisDumpCmd(&tempConn, backupPath)
-		default:
-			return nil, fmt.Errorf("unsupported database type for backup: %s", conn.Type)
+		filename := backupFileName(dbName, timestamp, dumper, opts)
+		backup := &Backup{
+			ID:           uuid.New(),
+			ConnectionID: conn.ID,
+			ScheduleID:   scheduleID,
+			StartedTime:  startTime,
+			Status:       backupInProgress,
+			Path:         filepath.Join(connectionFolder, filename),
+			Compression:  compressionOrNone(conn.Compression),
+			CreatedAt:    time.Now(),
+			UpdatedAt:    time.Now(),
 		}
+		setBackupEncryption(backup, encryption)
 
-		if cmd == nil {
-			fmt.Printf("Warning: backup tool not found for database '%s'\n", dbName)
+		if err := s.backupRepo.CreateBackup(backup); err != nil {
+			fmt.Printf("Warning: Failed to save backup record for '%s': %v\n", dbName, err)
 			failedDatabases = append(failedDatabases, dbName)
 			continue
 		}
 
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			fmt.Printf("Warning: Failed to backup database '%s': %s\n", dbName, string(output))
+		if tunnelErr != nil {
+			s.failBackup(backup, tunnelErr)
 			failedDatabases = append(failedDatabases, dbName)
 			continue
 		}
 
-		fileInfo, err := os.Stat(backupPath)
+		tempConn := *conn
+		tempConn.DatabaseName = dbName
+
+		cmd, err := createDumpCmd(ctx, dumper, &tempConn, dumpOpts)
 		if err != nil {
-			fmt.Printf("Warning: Failed to get file info for database '%s': %v\n", dbName, err)
+			fmt.Printf("Warning: %v\n", err)
+			progress.logf("Skipping database '%s': %v", dbName, err)
+			s.failBackup(backup, err)
 			failedDatabases = append(failedDatabases, dbName)
 			continue
 		}
 
-		backup := &Backup{
-			ID:           backupID,
-			ConnectionID: conn.ID,
-			StartedTime:  startTime,
-			Status:       "completed",
-			Path:         backupPath,
-			Size:         fileInfo.Size(),
-			CreatedAt:    time.Now(),
-			UpdatedAt:    time.Now(),
+		progress.logf("Dumping database '%s' (%d/%d)", dbName, len(successfulBackups)+len(failedDatabases)+1, len(conn.SelectedDatabases))
+		result, streamed, err := s.dumpBackup(ctx, cmd, backup, conn, opts, progress)
+		if ctx.Err() != nil {
+			s.cancelBackup(backup)
+			return nil, errBackupCancelled
+		}
+		if err != nil {
+			fmt.Printf("Warning: Failed to backup database '%s': %v\n", dbName, err)
+			progress.logf("Failed to backup database '%s': %v", dbName, err)
+			s.failBackup(backup, err)
+			failedDatabases = append(failedDatabases, dbName)
+			continue
 		}
 
+		backup.Status = backupCompleted
+		backup.Size = result.Size
+		backup.UncompressedSize = result.UncompressedSize
+		backup.Checksum = &result.Checksum
+		backup.IntegrityStatus = integrityUnknown
 		now := time.Now()
 		backup.CompletedTime = &now
 
-		if err := s.uploadToS3IfEnabled(backup, conn.UserID, conn.Name); err != nil {
-			fmt.Printf("Warning: Failed to upload backup '%s' to S3: %v\n", dbName, err)
+		if !streamed {
+			if err := s.replicateBackup(backup, conn); err != nil {
+				fmt.Printf("Warning: Failed to copy backup '%s' to storage: %v\n", dbName, err)
+				progress.logf("Failed to copy backup of '%s' to storage: %v", dbName, err)
+			}
 		}
 
-		if err := s.backupRepo.CreateBackup(backup); err != nil {
+		if err := s.backupRepo.FinishBackup(backup); err != nil {
 			fmt.Printf("Warning: Failed to save backup record for '%s': %v\n", dbName, err)
 			failedDatabases = append(failedDatabases, dbName)
 			continue
@@ -203,6 +312,10 @@ func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnect
 		successfulBackups = append(successfulBackups, backup)
 	}
 
+	if tunnelErr != nil {
+		return nil, tunnelErr
+	}
+
 	if len(successfulBackups) == 0 {
 		if len(failedDatabases) > 0 {
 			return nil, fmt.Errorf("all database backups failed: %v", failedDatabases)
@@ -221,26 +334,31 @@ func (s *BackupService) createMultiDatabaseBackup(conn *connection.StoredConnect
 	return successfulBackups[0], nil
 }
 
-func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnection, dbName string) (*Backup, error) {
-	if err := s.verifyBackupTools(conn.Type); err != nil {
+func (s *BackupService) createSingleDatabaseBackup(ctx context.Context, conn *connection.StoredConnection, dbName string, schedule *BackupSchedule, progress *dumpProgress) (*Backup, error) {
+	dumper, err := getDumper(conn.Type)
+	if err != nil {
 		return nil, err
 	}
 
-	// Setup SSH tunnel if enabled
-	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(conn)
+	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to setup SSH tunnel: %v", err)
+		return nil, fmt.Errorf("failed to get user settings: %v", err)
 	}
-	if tunnel != nil {
-		defer tunnel.Stop()
-		// Update connection to use tunnel
-		conn.Host = effectiveHost
-		conn.Port = effectivePort
+
+	encryption, err := s.newBackupEncryption(userSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := artifactOptions{
+		Compression:      conn.Compression,
+		CompressionLevel: conn.CompressionLevel,
+		Encryption:       encryption,
 	}
 
 	backupID := uuid.New()
 	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("%s_%s.sql", dbName, timestamp)
+	filename := backupFileName(dbName, timestamp, dumper, opts)
 
 	connectionFolder := filepath.Join(s.backupDir, common.SanitizeConnectionName(conn.Name))
 	if err := os.MkdirAll(connectionFolder, 0755); err != nil {
@@ -248,69 +366,127 @@ func (s *BackupService) createSingleDatabaseBackup(conn *connection.StoredConnec
 	}
 
 	backupPath := filepath.Join(connectionFolder, filename)
+	scheduleID, dumpOpts := scheduleDump(schedule)
 
 	backup := &Backup{
 		ID:           backupID,
 		ConnectionID: conn.ID,
+		ScheduleID:   scheduleID,
 		StartedTime:  time.Now(),
-		Status:       "in_progress",
+		Status:       backupInProgress,
 		Path:         backupPath,
+		Compression:  compressionOrNone(conn.Compression),
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
+	setBackupEncryption(backup, encryption)
 
-	var cmd *exec.Cmd
-	switch conn.Type {
-	case "postgresql":
-		cmd = s.createPgDumpCmd(conn, backupPath)
-	case "mysql", "mariadb":
-		cmd = s.createMySQLDumpCmd(conn, backupPath)
-	case "mongodb":
-		cmd = s.createMongoDumpCmd(conn, backupPath)
-	case "redis":
-		cmd = s.createRedisDumpCmd(conn, backupPath)
-	default:
-		return nil, fmt.Errorf("unsupported database type for backup: %s", conn.Type)
+	// Record the backup before the dump so failures show up in the history
+	if err := s.backupRepo.CreateBackup(backup); err != nil {
+		return nil, fmt.Errorf("failed to save backup: %v", err)
 	}
 
-	if cmd == nil {
-		return nil, fmt.Errorf("backup tool not found for %s. Please ensure %s is installed and available in PATH", conn.Type, requiredTools[conn.Type])
+	// Setup SSH tunnel if enabled
+	tunnel, effectiveHost, effectivePort, err := s.setupSSHTunnelIfNeeded(conn)
+	if err != nil {
+		err = fmt.Errorf("failed to setup SSH tunnel: %v", err)
+		s.failBackup(backup, err)
+		return nil, err
+	}
+	if tunnel != nil {
+		defer tunnel.Stop()
+		// Update connection to use tunnel
+		conn.Host = effectiveHost
+		conn.Port = effectivePort
 	}
 
-	output, err := cmd.CombinedOutput()
+	cmd, err := createDumpCmd(ctx, dumper, conn, dumpOpts)
 	if err != nil {
-		errorMsg := string(output)
-		if errorMsg == "" {
-			errorMsg = err.Error()
-		}
-		return nil, fmt.Errorf("backup failed for %s database '%s' on %s:%d - %s",
-			conn.Type, dbName, conn.Host, conn.Port, errorMsg)
+		s.failBackup(backup, err)
+		return nil, err
 	}
 
-	// Get file size
-	fileInfo, err := os.Stat(backupPath)
+	progress.logf("Dumping database '%s'", dbName)
+	result, streamed, err := s.dumpBackup(ctx, cmd, backup, conn, opts, progress)
+	if ctx.Err() != nil {
+		s.cancelBackup(backup)
+		return nil, errBackupCancelled
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get backup file info: %v", err)
+		s.failBackup(backup, err)
+		return nil, fmt.Errorf("backup failed for %s database '%s' on %s:%d - %v",
+			conn.Type, dbName, conn.Host, conn.Port, err)
 	}
 
-	backup.Size = fileInfo.Size()
-	backup.Status = "completed"
+	backup.Size = result.Size
+	backup.UncompressedSize = result.UncompressedSize
+	backup.Checksum = &result.Checksum
+	backup.IntegrityStatus = integrityUnknown
+	backup.Status = backupCompleted
 	now := time.Now()
 	backup.CompletedTime = &now
 
-	if err := s.uploadToS3IfEnabled(backup, conn.UserID, conn.Name); err != nil {
-		fmt.Printf("Warning: Failed to upload backup to S3: %v\n", err)
+	if !streamed {
+		if err := s.replicateBackup(backup, conn); err != nil {
+			fmt.Printf("Warning: Failed to copy backup to storage: %v\n", err)
+			progress.logf("Failed to copy backup to storage: %v", err)
+		}
 	}
 
-	if err := s.backupRepo.CreateBackup(backup); err != nil {
+	if err := s.backupRepo.FinishBackup(backup); err != nil {
 		return nil, fmt.Errorf("failed to save backup: %v", err)
 	}
 
 	return backup, nil
 }
 
+// failBackup records an in-progress backup as failed with the error that
+// stopped it and, if the dump tool exited with an error, its exit code.
+func (s *BackupService) failBackup(backup *Backup, err error) {
+	msg := err.Error()
+	backup.ErrorOutput = &msg
+	var dumpErr *dumpError
+	if errors.As(err, &dumpErr) {
+		backup.ExitCode = &dumpErr.ExitCode
+	}
+	s.endBackup(backup, backupFailed)
+}
+
+// cancelBackup records an in-progress backup as cancelled.
+func (s *BackupService) cancelBackup(backup *Backup) {
+	s.endBackup(backup, backupCancelled)
+}
+
+func (s *BackupService) endBackup(backup *Backup, status string) {
+	now := time.Now()
+	backup.Status = status
+	backup.CompletedTime = &now
+	if err := s.backupRepo.FinishBackup(backup); err != nil {
+		fmt.Printf("Error recording %s backup %s: %v\n", status, backup.ID, err)
+	}
+}
+
+// interruptUnfinishedBackups marks backups orphaned by a previous process,
+// whose dumps died with it.
+func (s *BackupService) interruptUnfinishedBackups() {
+	if n, err := s.backupRepo.InterruptUnfinishedBackups("interrupted by server restart"); err != nil {
+		fmt.Printf("Error interrupting unfinished backups: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("Marked %d unfinished backups as interrupted\n", n)
+	}
+}
+
 func (s *BackupService) GetBackup(id string) (*Backup, error) {
-	return s.backupRepo.GetBackup(id)
+	backup, err := s.backupRepo.GetBackup(id)
+	if err != nil {
+		return nil, err
+	}
+
+	backup.Copies, err = s.backupRepo.GetBackupCopies(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup copies: %v", err)
+	}
+	return backup, nil
 }
 
 func (s *BackupService) DeleteBackup(backupID string, userID uuid.UUID) error {
@@ -325,46 +501,20 @@ func (s *BackupService) DeleteBackup(backupID string, userID uuid.UUID) error {
 		return fmt.Errorf("failed to verify backup ownership: %v", err)
 	}
 	if conn.UserID != userID {
-		return fmt.Errorf("unauthorized")
-	}
-
-	// Delete from S3 if an object key exists
-	if backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" {
-		userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
-		if err == nil && userSettings != nil && userSettings.S3Enabled &&
-			userSettings.S3Endpoint != nil && *userSettings.S3Endpoint != "" &&
-			userSettings.S3Bucket != nil && *userSettings.S3Bucket != "" &&
-			userSettings.S3AccessKey != nil && *userSettings.S3AccessKey != "" &&
-			userSettings.S3SecretKey != nil && *userSettings.S3SecretKey != "" {
-
-			secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
-			if err == nil {
-				region := "us-east-1"
-				if userSettings.S3Region != nil && *userSettings.S3Region != "" {
-					region = *userSettings.S3Region
-				}
-				pathPrefix := ""
-				if userSettings.S3PathPrefix != nil {
-					pathPrefix = *userSettings.S3PathPrefix
-				}
-				s3Config := S3Config{
-					Endpoint:   *userSettings.S3Endpoint,
-					Region:     region,
-					Bucket:     *userSettings.S3Bucket,
-					AccessKey:  *userSettings.S3AccessKey,
-					SecretKey:  secretKey,
-					UseSSL:     userSettings.S3UseSSL,
-					PathPrefix: pathPrefix,
-				}
-				s3Storage, err := NewS3Storage(s3Config)
-				if err == nil {
-					ctx := context.Background()
-					if err := s3Storage.DeleteFile(ctx, *backup.S3ObjectKey); err != nil {
-						fmt.Printf("Warning: failed to delete S3 object %s: %v\n", *backup.S3ObjectKey, err)
-					}
-				}
-			}
-		}
+		return errUnauthorized
+	}
+	if backup.Pinned {
+		return errBackupPinned
+	}
+
+	// Keep the backup while any stored copy is left, so deleting it again
+	// retries the copies that failed
+	_, failed, err := s.deleteBackupCopies(backup, userID)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return copiesNotDeleted(failed)
 	}
 
 	// Delete local file if it exists
@@ -397,175 +547,67 @@ func (s *BackupService) GetBackupStats(userID uuid.UUID) (*BackupStats, error) {
 	return s.backupRepo.GetBackupStats(userID)
 }
 
-func (s *BackupService) uploadToS3IfEnabled(backup *Backup, userID uuid.UUID, connectionName string) error {
-	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
-	if err != nil {
-		return fmt.Errorf("failed to get user settings: %w", err)
-	}
-
-	if !userSettings.S3Enabled {
-		return nil
-	}
-
-	if userSettings.S3Endpoint == nil || *userSettings.S3Endpoint == "" {
-		return fmt.Errorf("S3 endpoint not configured")
-	}
-	if userSettings.S3Bucket == nil || *userSettings.S3Bucket == "" {
-		return fmt.Errorf("S3 bucket not configured")
-	}
-	if userSettings.S3AccessKey == nil || *userSettings.S3AccessKey == "" {
-		return fmt.Errorf("S3 access key not configured")
-	}
-	if userSettings.S3SecretKey == nil || *userSettings.S3SecretKey == "" {
-		return fmt.Errorf("S3 secret key not configured")
-	}
-
-	secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
-	if err != nil {
-		return fmt.Errorf("failed to decrypt S3 secret key: %w", err)
-	}
-
-	// (default to us-east-1 if not set)
-	region := "us-east-1"
-	if userSettings.S3Region != nil && *userSettings.S3Region != "" {
-		region = *userSettings.S3Region
-	}
-
-	pathPrefix := ""
-	if userSettings.S3PathPrefix != nil {
-		pathPrefix = *userSettings.S3PathPrefix
-	}
-
-	s3Config := S3Config{
-		Endpoint:   *userSettings.S3Endpoint,
-		Region:     region,
-		Bucket:     *userSettings.S3Bucket,
-		AccessKey:  *userSettings.S3AccessKey,
-		SecretKey:  secretKey,
-		UseSSL:     userSettings.S3UseSSL,
-		PathPrefix: pathPrefix,
-	}
-
-	s3Storage, err := NewS3Storage(s3Config)
-	if err != nil {
-		return fmt.Errorf("failed to create S3 storage client: %w", err)
-	}
-
-	ctx := context.Background()
-	// Use sanitized connection name as subfolder
-	sanitizedConnectionName := common.SanitizeConnectionName(connectionName)
-	objectKey, err := s3Storage.UploadFileWithPath(ctx, backup.Path, sanitizedConnectionName)
-	if err != nil {
-		return fmt.Errorf("failed to upload backup to S3: %w", err)
-	}
-
-	backup.S3ObjectKey = &objectKey
-
-	fmt.Printf("Successfully uploaded backup %s to S3: %s\n", backup.ID, objectKey)
-
-	// Purge local backup file if enabled
-	if userSettings.S3PurgeLocal {
-		if err := os.Remove(backup.Path); err != nil {
-			fmt.Printf("Warning: Failed to purge local backup file %s: %v\n", backup.Path, err)
-		} else {
-			fmt.Printf("Successfully purged local backup file: %s\n", backup.Path)
-		}
-	}
-
-	return nil
-}
-
-// ensureBackupFileAvailable checks if backup file exists locally, if not downloads from S3
-// Returns the path to use and a boolean indicating if it's a temporary file that should be cleaned up
-func (s *BackupService) ensureBackupFileAvailable(backup *Backup, userID uuid.UUID) (string, bool, error) {
+// ensureBackupFileAvailable returns the path of a backup's file, using the
+// local file when it exists and otherwise the download cache, fetching it
+// from one of its stored copies if needed. release must be called once the
+// file is no longer used.
+func (s *BackupService) ensureBackupFileAvailable(backup *Backup, userID uuid.UUID) (string, func(), error) {
 	// Check if local file exists
 	if _, err := os.Stat(backup.Path); err == nil {
-		// Local file exists, use it
-		return backup.Path, false, nil
+		return backup.Path, func() {}, nil
 	}
 
-	// Local file doesn't exist, check if we have S3 object key
-	if backup.S3ObjectKey == nil || *backup.S3ObjectKey == "" {
-		return "", false, fmt.Errorf("backup file not found locally and no S3 object key available")
-	}
-
-	// Get user settings to configure S3 client
-	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	copies, err := s.backupRepo.GetBackupCopies(backup.ID.String())
 	if err != nil {
-		return "", false, fmt.Errorf("failed to get user settings: %w", err)
-	}
-
-	if !userSettings.S3Enabled {
-		return "", false, fmt.Errorf("backup file not found locally and S3 is not enabled")
+		return "", nil, fmt.Errorf("failed to get backup copies: %w", err)
 	}
 
-	// Validate S3 configuration
-	if userSettings.S3Endpoint == nil || *userSettings.S3Endpoint == "" {
-		return "", false, fmt.Errorf("S3 endpoint not configured")
-	}
-	if userSettings.S3Bucket == nil || *userSettings.S3Bucket == "" {
-		return "", false, fmt.Errorf("S3 bucket not configured")
-	}
-	if userSettings.S3AccessKey == nil || *userSettings.S3AccessKey == "" {
-		return "", false, fmt.Errorf("S3 access key not configured")
-	}
-	if userSettings.S3SecretKey == nil || *userSettings.S3SecretKey == "" {
-		return "", false, fmt.Errorf("S3 secret key not configured")
-	}
-
-	// Decrypt S3 secret key
-	secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
-	if err != nil {
-		return "", false, fmt.Errorf("failed to decrypt S3 secret key: %w", err)
-	}
-
-	// Configure S3 client
-	region := "us-east-1"
-	if userSettings.S3Region != nil && *userSettings.S3Region != "" {
-		region = *userSettings.S3Region
-	}
-
-	pathPrefix := ""
-	if userSettings.S3PathPrefix != nil {
-		pathPrefix = *userSettings.S3PathPrefix
+	// Try each uploaded copy until one downloads
+	var errs []string
+	for _, copy := range copies {
+		if copy.Status != copyUploaded || copy.ObjectKey == nil {
+			continue
+		}
+		path, release, err := s.downloads.acquire(backup, func(w io.Writer) error {
+			d, err := s.destinationByID(userID, copy.DestinationID)
+			if err != nil {
+				return err
+			}
+			defer d.close()
+			if err := downloadObject(d.storage, *copy.ObjectKey, w); err != nil {
+				return err
+			}
+			fmt.Printf("Downloaded backup %s from %s to the download cache\n", backup.ID, copy.DestinationName)
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", copy.DestinationName, err))
+			continue
+		}
+		return path, release, nil
 	}
 
-	s3Config := S3Config{
-		Endpoint:   *userSettings.S3Endpoint,
-		Region:     region,
-		Bucket:     *userSettings.S3Bucket,
-		AccessKey:  *userSettings.S3AccessKey,
-		SecretKey:  secretKey,
-		UseSSL:     userSettings.S3UseSSL,
-		PathPrefix: pathPrefix,
+	if len(errs) == 0 {
+		return "", nil, fmt.Errorf("backup file not found locally and no stored copy available")
 	}
+	return "", nil, fmt.Errorf("failed to download backup: %s", strings.Join(errs, "; "))
+}
 
-	s3Storage, err := NewS3Storage(s3Config)
+// downloadObject copies an object from storage to w
+func downloadObject(storage Storage, key string, w io.Writer) error {
+	object, err := storage.Get(context.Background(), key)
 	if err != nil {
-		return "", false, fmt.Errorf("failed to create S3 storage client: %w", err)
-	}
-
-	// Create temp file path
-	tempDir := filepath.Join(os.TempDir(), "velld-s3-downloads")
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		return "", false, fmt.Errorf("failed to create temp directory: %w", err)
+		return err
 	}
+	defer object.Close()
 
-	tempFilePath := filepath.Join(tempDir, filepath.Base(backup.Path))
-
-	// Download from S3
-	ctx := context.Background()
-	if err := s3Storage.DownloadFile(ctx, *backup.S3ObjectKey, tempFilePath); err != nil {
-		return "", false, fmt.Errorf("failed to download backup from S3: %w", err)
+	if _, err := io.Copy(w, object); err != nil {
+		return fmt.Errorf("failed to download object: %w", err)
 	}
-
-	fmt.Printf("Successfully downloaded backup %s from S3 to temp location: %s\n", backup.ID, tempFilePath)
-
-	// Return temp file path and indicate it should be cleaned up
-	return tempFilePath, true, nil
+	return nil
 }
 
-// CleanupS3BackupsForConnection deletes all S3 backups for a specific connection
+// CleanupS3BackupsForConnection deletes the stored copies of all backups for a specific connection
 func (s *BackupService) CleanupS3BackupsForConnection(connectionID string) error {
 	// Get all backups for this connection
 	backups, err := s.backupRepo.GetBackupsByConnectionID(connectionID)
@@ -577,81 +619,43 @@ func (s *BackupService) CleanupS3BackupsForConnection(connectionID string) error
 		return nil
 	}
 
-	// Get connection to retrieve user settings
 	conn, err := s.connStorage.GetConnection(connectionID)
 	if err != nil {
 		return fmt.Errorf("failed to get connection: %w", err)
 	}
 
-	// Get user settings for S3 configuration
-	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
-	if err != nil {
-		return fmt.Errorf("failed to get user settings: %w", err)
-	}
-
-	// Check if S3 is enabled and configured
-	if !userSettings.S3Enabled ||
-		userSettings.S3Endpoint == nil || *userSettings.S3Endpoint == "" ||
-		userSettings.S3Bucket == nil || *userSettings.S3Bucket == "" ||
-		userSettings.S3AccessKey == nil || *userSettings.S3AccessKey == "" ||
-		userSettings.S3SecretKey == nil || *userSettings.S3SecretKey == "" {
-		// S3 not configured, nothing to clean
-		return nil
-	}
-
-	// Decrypt S3 secret key
-	secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
-	if err != nil {
-		return fmt.Errorf("failed to decrypt S3 secret key: %w", err)
-	}
-
-	// Configure S3 client
-	region := "us-east-1"
-	if userSettings.S3Region != nil && *userSettings.S3Region != "" {
-		region = *userSettings.S3Region
-	}
-
-	pathPrefix := ""
-	if userSettings.S3PathPrefix != nil {
-		pathPrefix = *userSettings.S3PathPrefix
-	}
-
-	s3Config := S3Config{
-		Endpoint:   *userSettings.S3Endpoint,
-		Region:     region,
-		Bucket:     *userSettings.S3Bucket,
-		AccessKey:  *userSettings.S3AccessKey,
-		SecretKey:  secretKey,
-		UseSSL:     userSettings.S3UseSSL,
-		PathPrefix: pathPrefix,
-	}
-
-	s3Storage, err := NewS3Storage(s3Config)
-	if err != nil {
-		return fmt.Errorf("failed to create S3 storage client: %w", err)
-	}
-
-	// Delete S3 objects for all backups
-	ctx := context.Background()
 	deletedCount := 0
+	var failed []*BackupCopy
 	for _, backup := range backups {
-		if backup.S3ObjectKey != nil && *backup.S3ObjectKey != "" {
-			if err := s3Storage.DeleteFile(ctx, *backup.S3ObjectKey); err != nil {
-				fmt.Printf("Warning: Failed to delete S3 object %s: %v\n", *backup.S3ObjectKey, err)
-			} else {
-				deletedCount++
-				fmt.Printf("Deleted S3 object %s for backup %s (connection cleanup)\n",
-					*backup.S3ObjectKey, backup.ID)
-			}
+		if backup.Pinned {
+			fmt.Printf("Keeping stored copies of pinned backup %s (connection cleanup)\n", backup.ID)
+			continue
 		}
+		n, backupFailed, err := s.deleteBackupCopies(backup, conn.UserID)
+		if err != nil {
+			return err
+		}
+		deletedCount += n
+		failed = append(failed, backupFailed...)
 	}
 
-	fmt.Printf("S3 cleanup completed for connection %s: deleted %d objects\n", connectionID, deletedCount)
+	fmt.Printf("Storage cleanup completed for connection %s: deleted %d objects\n", connectionID, deletedCount)
+	if len(failed) > 0 {
+		return copiesNotDeleted(failed)
+	}
 	return nil
 }
 
-// RenameS3FolderForConnection renames the S3 folder when connection name changes
+// RenameS3FolderForConnection renames the connection folder on every destination when connection name changes
 func (s *BackupService) RenameS3FolderForConnection(connectionID string, oldName string, newName string) error {
+	// Sanitize old and new folder names
+	oldFolder := common.SanitizeConnectionName(oldName)
+	newFolder := common.SanitizeConnectionName(newName)
+
+	if oldFolder == newFolder {
+		return nil // Names are the same after sanitization, no rename needed
+	}
+
 	// Get all backups for this connection
 	backups, err := s.backupRepo.GetBackupsByConnectionID(connectionID)
 	if err != nil {
@@ -662,102 +666,79 @@ func (s *BackupService) RenameS3FolderForConnection(connectionID string, oldName
 		return nil // No backups to rename
 	}
 
-	// Get connection to retrieve user settings
 	conn, err := s.connStorage.GetConnection(connectionID)
 	if err != nil {
 		return fmt.Errorf("failed to get connection: %w", err)
 	}
 
-	// Get user settings for S3 configuration
-	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
-	if err != nil {
-		return fmt.Errorf("failed to get user settings: %w", err)
-	}
-
-	// Check if S3 is enabled and configured
-	if !userSettings.S3Enabled ||
-		userSettings.S3Endpoint == nil || *userSettings.S3Endpoint == "" ||
-		userSettings.S3Bucket == nil || *userSettings.S3Bucket == "" ||
-		userSettings.S3AccessKey == nil || *userSettings.S3AccessKey == "" ||
-		userSettings.S3SecretKey == nil || *userSettings.S3SecretKey == "" {
-		return nil // S3 not configured, nothing to rename
-	}
-
-	// Decrypt S3 secret key
-	secretKey, err := s.cryptoService.Decrypt(*userSettings.S3SecretKey)
-	if err != nil {
-		return fmt.Errorf("failed to decrypt S3 secret key: %w", err)
-	}
-
-	// Configure S3 client
-	region := "us-east-1"
-	if userSettings.S3Region != nil && *userSettings.S3Region != "" {
-		region = *userSettings.S3Region
-	}
-
-	pathPrefix := ""
-	if userSettings.S3PathPrefix != nil {
-		pathPrefix = *userSettings.S3PathPrefix
-	}
-
-	s3Config := S3Config{
-		Endpoint:   *userSettings.S3Endpoint,
-		Region:     region,
-		Bucket:     *userSettings.S3Bucket,
-		AccessKey:  *userSettings.S3AccessKey,
-		SecretKey:  secretKey,
-		UseSSL:     userSettings.S3UseSSL,
-		PathPrefix: pathPrefix,
-	}
-
-	s3Storage, err := NewS3Storage(s3Config)
-	if err != nil {
-		return fmt.Errorf("failed to create S3 storage client: %w", err)
-	}
-
-	// Sanitize old and new folder names
-	oldFolder := common.SanitizeConnectionName(oldName)
-	newFolder := common.SanitizeConnectionName(newName)
-
-	if oldFolder == newFolder {
-		return nil // Names are the same after sanitization, no rename needed
-	}
-
-	// Rename S3 objects
 	ctx := context.Background()
+	dests := make(map[string]*destination)
+	defer func() {
+		for _, d := range dests {
+			if d != nil {
+				d.close()
+			}
+		}
+	}()
 	renamedCount := 0
 	for _, backup := range backups {
-		if backup.S3ObjectKey == nil || *backup.S3ObjectKey == "" {
-			continue // No S3 object, skip
+		copies, err := s.backupRepo.GetBackupCopies(backup.ID.String())
+		if err != nil {
+			fmt.Printf("Warning: Failed to get copies of backup %s: %v\n", backup.ID, err)
+			continue
 		}
 
-		oldKey := *backup.S3ObjectKey
+		for _, copy := range copies {
+			if copy.Status != copyUploaded || copy.ObjectKey == nil {
+				continue
+			}
 
-		// Replace old folder with new folder in the object key
-		newKey := strings.Replace(oldKey, oldFolder, newFolder, 1)
+			oldKey := *copy.ObjectKey
 
-		if oldKey == newKey {
-			continue // No change needed
-		}
+			// Replace old folder with new folder in the object key
+			newKey := strings.Replace(oldKey, oldFolder, newFolder, 1)
 
-		// Move object in S3
-		if err := s3Storage.MoveFile(ctx, oldKey, newKey); err != nil {
-			fmt.Printf("Warning: Failed to rename S3 object %s to %s: %v\n", oldKey, newKey, err)
-			continue
-		}
+			if oldKey == newKey {
+				continue // No change needed
+			}
 
-		// Update database record with new S3 object key
-		backup.S3ObjectKey = &newKey
-		if err := s.backupRepo.UpdateBackupS3ObjectKey(backup.ID.String(), newKey); err != nil {
-			fmt.Printf("Warning: Failed to update S3 object key in database for backup %s: %v\n", backup.ID, err)
-			continue
-		}
+			// Open each destination once; a nil entry means it failed to open
+			d, ok := dests[copy.DestinationID]
+			if !ok {
+				d, err = s.destinationByID(conn.UserID, copy.DestinationID)
+				if err != nil {
+					fmt.Printf("Warning: Failed to open destination %s: %v\n", copy.DestinationName, err)
+				}
+				dests[copy.DestinationID] = d
+			}
+			if d == nil {
+				continue
+			}
+
+			if err := d.storage.Move(ctx, oldKey, newKey); err != nil {
+				fmt.Printf("Warning: Failed to rename object %s to %s on %s: %v\n", oldKey, newKey, d.Name, err)
+				continue
+			}
+
+			// Update database records with the new object key
+			copy.ObjectKey = &newKey
+			if err := s.backupRepo.SaveBackupCopy(copy); err != nil {
+				fmt.Printf("Warning: Failed to update object key in database for backup %s: %v\n", backup.ID, err)
+				continue
+			}
+			if copy.DestinationID == defaultS3DestinationID {
+				if err := s.backupRepo.UpdateBackupS3ObjectKey(backup.ID.String(), newKey); err != nil {
+					fmt.Printf("Warning: Failed to update S3 object key in database for backup %s: %v\n", backup.ID, err)
+					continue
+				}
+			}
 
-		renamedCount++
-		fmt.Printf("Renamed S3 object from %s to %s\n", oldKey, newKey)
+			renamedCount++
+			fmt.Printf("Renamed object on %s from %s to %s\n", d.Name, oldKey, newKey)
+		}
 	}
 
-	fmt.Printf("S3 folder rename completed for connection %s: renamed %d objects from %s to %s\n",
+	fmt.Printf("Folder rename completed for connection %s: renamed %d objects from %s to %s\n",
 		connectionID, renamedCount, oldFolder, newFolder)
 	return nil
 }
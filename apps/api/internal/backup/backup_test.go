@@ -0,0 +1,39 @@
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		send func(http.ResponseWriter, error)
+		err  error
+		want int
+	}{
+		{"job not found", sendJobError, sql.ErrNoRows, http.StatusNotFound},
+		{"job of another user", sendJobError, errUnauthorized, http.StatusForbidden},
+		{"job finished", sendJobError, fmt.Errorf("%w: completed", errJobFinished), http.StatusConflict},
+		{"job failure", sendJobError, errors.New("disk full"), http.StatusInternalServerError},
+		{"pin of another user", sendPinError, errUnauthorized, http.StatusForbidden},
+		{"invalid pin", sendPinError, fmt.Errorf("%w: reason is required", errInvalidPin), http.StatusBadRequest},
+		{"unpin of unpinned", sendPinError, errBackupNotPinned, http.StatusConflict},
+		{"schedule of another user", sendScheduleError, errUnauthorized, http.StatusForbidden},
+		{"invalid schedule", sendScheduleError, invalidSchedule(errors.New("bad cron")), http.StatusBadRequest},
+		{"destination of another user", sendDestinationError, errUnauthorized, http.StatusForbidden},
+		{"invalid destination", sendDestinationError, fmt.Errorf("%w: port", errInvalidDestination), http.StatusBadRequest},
+		{"destination in use", sendDestinationError, errDestinationInUse, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.send(w, tt.err)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
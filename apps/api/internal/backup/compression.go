@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressionExtension returns the suffix added to backup file names for a codec.
+func compressionExtension(compression string) string {
+	switch compression {
+	case connection.CompressionGzip:
+		return ".gz"
+	case connection.CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// compressionOrNone normalises an unset codec to "none" for storage on backups.
+func compressionOrNone(compression string) string {
+	if compression == "" {
+		return connection.CompressionNone
+	}
+	return compression
+}
+
+// newCompressWriter wraps w so that everything written is compressed with the
+// given codec. A level of 0 selects the codec's default level. Close must be
+// called to flush the compressed stream; it does not close w.
+func newCompressWriter(w io.Writer, compression string, level int) (io.WriteCloser, error) {
+	switch compression {
+	case "", connection.CompressionNone:
+		return nopWriteCloser{w}, nil
+	case connection.CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case connection.CompressionZstd:
+		opts := []zstd.EOption{}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
+
+// newDecompressReader wraps r so that reads return the decompressed stream.
+// Close releases the decoder; it does not close r.
+func newDecompressReader(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case "", connection.CompressionNone:
+		return io.NopCloser(r), nil
+	case connection.CompressionGzip:
+		return gzip.NewReader(r)
+	case connection.CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
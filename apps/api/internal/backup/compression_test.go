@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// TestDumpHelper is not a real test. dumpCommand runs the test binary with
+// VELLD_TEST_DUMP_FILE set, making it a dump tool that writes the file to
+// stdout.
+func TestDumpHelper(t *testing.T) {
+	path := os.Getenv("VELLD_TEST_DUMP_FILE")
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if _, err := io.Copy(os.Stdout, file); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+// dumpCommand returns a command that writes data to stdout, standing in for
+// a dump tool.
+func dumpCommand(t *testing.T, data []byte) *exec.Cmd {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dump")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDumpHelper$")
+	cmd.Env = append(os.Environ(), "VELLD_TEST_DUMP_FILE="+path)
+	return cmd
+}
+
+// testDump is a dump that compresses well but is not all repetition.
+func testDump() []byte {
+	var dump bytes.Buffer
+	for i := 0; dump.Len() < 2<<20; i++ {
+		fmt.Fprintf(&dump, "INSERT INTO orders VALUES (%d, 'customer-%d', %d.%02d);\n", i, i*7919%10007, i*31%997, i%100)
+	}
+	return dump.Bytes()
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	dump := testDump()
+	tests := []struct {
+		compression string
+		level       int
+	}{
+		{"", 0},
+		{connection.CompressionNone, 0},
+		{connection.CompressionGzip, 0},
+		{connection.CompressionGzip, 1},
+		{connection.CompressionGzip, 9},
+		{connection.CompressionZstd, 0},
+		{connection.CompressionZstd, 1},
+		{connection.CompressionZstd, 22},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q level %d", tt.compression, tt.level), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "backup")
+			opts := artifactOptions{Compression: tt.compression, CompressionLevel: tt.level}
+			result, err := runDump(dumpCommand(t, dump), path, opts, nil)
+			if err != nil {
+				t.Fatalf("runDump: %v", err)
+			}
+
+			stored, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Size != int64(len(stored)) {
+				t.Errorf("Size = %d, file has %d bytes", result.Size, len(stored))
+			}
+			if result.UncompressedSize != int64(len(dump)) {
+				t.Errorf("UncompressedSize = %d, dump has %d bytes", result.UncompressedSize, len(dump))
+			}
+			sum := sha256.Sum256(stored)
+			if result.Checksum != hex.EncodeToString(sum[:]) {
+				t.Errorf("Checksum = %s, file hashes to %x", result.Checksum, sum)
+			}
+			compressed := compressionOrNone(tt.compression) != connection.CompressionNone
+			if compressed && len(stored) >= len(dump)/2 {
+				t.Errorf("%d bytes compressed to %d", len(dump), len(stored))
+			}
+			if !compressed && !bytes.Equal(stored, dump) {
+				t.Error("uncompressed backup differs from the dump")
+			}
+
+			reader, err := (&BackupService{}).openBackupArtifact(path, &Backup{Compression: compressionOrNone(tt.compression)})
+			if err != nil {
+				t.Fatalf("openBackupArtifact: %v", err)
+			}
+			defer reader.Close()
+			restored, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("reading backup: %v", err)
+			}
+			if !bytes.Equal(restored, dump) {
+				t.Errorf("restored %d bytes that differ from the %d byte dump", len(restored), len(dump))
+			}
+		})
+	}
+}
+
+func TestCompressionUnsupported(t *testing.T) {
+	if _, err := newCompressWriter(io.Discard, "brotli", 0); err == nil {
+		t.Error("newCompressWriter accepted an unsupported codec")
+	}
+	if _, err := newDecompressReader(bytes.NewReader(nil), "brotli"); err == nil {
+		t.Error("newDecompressReader accepted an unsupported codec")
+	}
+
+	// A failed dump leaves no file behind
+	path := filepath.Join(t.TempDir(), "backup")
+	if _, err := runDump(dumpCommand(t, []byte("dump")), path, artifactOptions{Compression: "brotli"}, nil); err == nil {
+		t.Error("runDump accepted an unsupported codec")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("backup file left after a failed dump: %v", err)
+	}
+}
@@ -0,0 +1,301 @@
+package backup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// cronParser parses schedules, which have a leading seconds field.
+var cronParser = cron.NewParser(cron.Second | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// cronFieldNames names the fields of a schedule in order.
+var cronFieldNames = []string{"second", "minute", "hour", "day of month", "month", "day of week"}
+
+// zonedSchedule runs a cron expression on the wall clock of a time zone,
+// like a CRON_TZ= prefix, but with explicit handling of DST changes:
+//
+//   - A run whose time is skipped when clocks go forward runs as soon as the
+//     clocks have changed, e.g. 02:30 becomes 03:00.
+//   - Times repeated when clocks go back run once, at the earlier of their
+//     two occurrences in every zone, so an hour that happens twice is not
+//     backed up twice.
+type zonedSchedule struct {
+	// wall is the expression evaluated in UTC, which has no DST, standing
+	// in for the wall clock of location
+	wall     cron.Schedule
+	location *time.Location
+}
+
+// loadScheduleLocation returns the IANA time zone of a schedule, or the
+// server's local zone for schedules without one.
+func loadScheduleLocation(timezone string) (*time.Location, error) {
+	if timezone == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil || timezone == "Local" {
+		return nil, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	return location, nil
+}
+
+// parseSchedule parses a cron expression to be run in the given IANA time
+// zone. The zone is set with timezone rather than a CRON_TZ= or TZ= prefix.
+func parseSchedule(expr, timezone string) (*zonedSchedule, error) {
+	trimmed := strings.TrimSpace(expr)
+	if strings.HasPrefix(trimmed, "CRON_TZ=") || strings.HasPrefix(trimmed, "TZ=") {
+		return nil, fmt.Errorf("invalid cron schedule: set the time zone with timezone instead of a TZ prefix")
+	}
+	fields := strings.Fields(trimmed)
+	if len(fields) != len(cronFieldNames) {
+		return nil, fmt.Errorf("invalid cron schedule: expected 6 fields (second minute hour day-of-month month day-of-week), got %d", len(fields))
+	}
+	location, err := loadScheduleLocation(timezone)
+	if err != nil {
+		return nil, err
+	}
+	wall, err := cronParser.Parse("CRON_TZ=UTC " + trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cron schedule: %v", cronFieldError(fields, err))
+	}
+	return &zonedSchedule{wall: wall, location: location}, nil
+}
+
+// cronFieldError names the field of an expression the parser rejected, by
+// parsing each field on its own, and falls back to err.
+func cronFieldError(fields []string, err error) error {
+	for i, field := range fields {
+		probe := []string{"*", "*", "*", "*", "*", "*"}
+		probe[i] = field
+		if _, fieldErr := cronParser.Parse(strings.Join(probe, " ")); fieldErr != nil {
+			return fmt.Errorf("%s field %q: %v", cronFieldNames[i], field, fieldErr)
+		}
+	}
+	return err
+}
+
+// Next returns the first run after t.
+func (z *zonedSchedule) Next(t time.Time) time.Time {
+	wall := wallClock(t.In(z.location))
+
+	for {
+		wall = z.wall.Next(wall)
+		if wall.IsZero() {
+			return wall
+		}
+		next := z.instant(wall)
+		// A repeated wall time seen again on its second occurrence has
+		// already had its run
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// instant returns when the wall clock of z.location shows wall. Wall times
+// skipped by a DST change map to the moment of the change, and repeated
+// ones to the earlier of their two occurrences. time.Date alone picks
+// either occurrence depending on the zone.
+func (z *zonedSchedule) instant(wall time.Time) time.Time {
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(),
+		wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), z.location)
+	switch shown := wallClock(t); {
+	case shown.Before(wall):
+		// Normalised to before the change; run when it happens
+		_, end := t.ZoneBounds()
+		return end
+	case shown.After(wall):
+		start, _ := t.ZoneBounds()
+		return start
+	}
+
+	// When clocks went back by delta at the start of t's zone period, the
+	// same wall time was shown delta earlier too if t is within delta of
+	// the change
+	start, _ := t.ZoneBounds()
+	if start.IsZero() {
+		return t
+	}
+	_, offset := t.Zone()
+	_, before := start.Add(-time.Nanosecond).Zone()
+	if delta := time.Duration(before-offset) * time.Second; delta > 0 && t.Sub(start) < delta {
+		if earlier := t.Add(-delta); wallClock(earlier).Equal(wall) {
+			return earlier
+		}
+	}
+	return t
+}
+
+// wallClock returns the time of day and date t shows in its own zone, as
+// a UTC time.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(),
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+var (
+	weekdayNames = map[string]string{
+		"0": "Sunday", "1": "Monday", "2": "Tuesday", "3": "Wednesday",
+		"4": "Thursday", "5": "Friday", "6": "Saturday",
+		"sun": "Sunday", "mon": "Monday", "tue": "Tuesday", "wed": "Wednesday",
+		"thu": "Thursday", "fri": "Friday", "sat": "Saturday",
+	}
+	monthNames = map[string]string{
+		"jan": "January", "feb": "February", "mar": "March", "apr": "April",
+		"may": "May", "jun": "June", "jul": "July", "aug": "August",
+		"sep": "September", "oct": "October", "nov": "November", "dec": "December",
+	}
+)
+
+// describeCron spells out a six-field expression that parseSchedule
+// accepted, e.g. "0 30 2 * * 1-5" is "At 02:30 on Monday through Friday".
+func describeCron(expr string) string {
+	f := strings.Fields(expr)
+	sec, min, hour, dom, month, dow := f[0], f[1], f[2], f[3], f[4], f[5]
+
+	var phrases []string
+	times, atClock := clockTimes(sec, min, hour)
+	if atClock {
+		phrases = append(phrases, "at "+joinList(times))
+	} else {
+		units := []struct{ name, field string }{{"hour", hour}, {"minute", min}, {"second", sec}}
+		if sec == "0" {
+			units = units[:2]
+		}
+		for i, u := range units {
+			// "every hour" goes without saying when the minutes repeat
+			if isWildcard(u.field) && i+1 < len(units) && repeats(units[i+1].field) {
+				continue
+			}
+			phrases = append(phrases, describeField(u.field, u.name, false, nil))
+		}
+	}
+	description := strings.Join(phrases, ", ")
+
+	var days []string
+	if !isWildcard(dom) {
+		if d := describeField(dom, "day", true, nil); strings.HasPrefix(d, "every") {
+			days = append(days, d+" of the month")
+		} else {
+			days = append(days, "on day "+d+" of the month")
+		}
+	}
+	if !isWildcard(dow) {
+		d := describeField(dow, "day", true, func(v string) string {
+			if name, ok := weekdayNames[strings.ToLower(v)]; ok {
+				return name
+			}
+			return v
+		})
+		if !strings.HasPrefix(d, "every") {
+			d = "on " + d
+		}
+		days = append(days, d)
+	}
+	switch {
+	case len(days) > 0:
+		// cron runs on either day when both are restricted
+		description += " " + strings.Join(days, " or ")
+	case atClock:
+		description += " every day"
+	}
+	if !isWildcard(month) {
+		description += " in " + describeField(month, "month", true, func(v string) string {
+			if name, ok := monthNames[strings.ToLower(v)]; ok {
+				return name
+			}
+			if n, err := strconv.Atoi(v); err == nil && n >= 1 && n <= 12 {
+				return time.Month(n).String()
+			}
+			return v
+		})
+	}
+	return strings.ToUpper(description[:1]) + description[1:]
+}
+
+// clockTimes lists the times of day of an expression that runs at fixed
+// seconds, minutes and hours, such as 02:00 and 14:00 for "0 0 2,14".
+func clockTimes(sec, min, hour string) ([]string, bool) {
+	s, errS := strconv.Atoi(sec)
+	m, errM := strconv.Atoi(min)
+	if errS != nil || errM != nil {
+		return nil, false
+	}
+	var times []string
+	for _, h := range strings.Split(hour, ",") {
+		n, err := strconv.Atoi(h)
+		if err != nil {
+			return nil, false
+		}
+		t := fmt.Sprintf("%02d:%02d", n, m)
+		if s != 0 {
+			t += fmt.Sprintf(":%02d", s)
+		}
+		times = append(times, t)
+	}
+	return times, true
+}
+
+func isWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+// repeats reports whether a field matches at even steps over its whole
+// range, like "*" or "*/15".
+func repeats(field string) bool {
+	return isWildcard(field) || strings.HasPrefix(field, "*/") || strings.HasPrefix(field, "?/")
+}
+
+// describeField spells out one field of an expression in terms of unit.
+// Bare fields list their values without the unit, as with days and months,
+// and name turns a value into its display name.
+func describeField(field, unit string, bare bool, name func(string) string) string {
+	if name == nil {
+		name = func(v string) string { return v }
+	}
+	var values, steps []string
+	for _, part := range strings.Split(field, ",") {
+		base, step, hasStep := strings.Cut(part, "/")
+		every := "every " + unit
+		if hasStep && step != "1" {
+			every = "every " + step + " " + unit + "s"
+		}
+		from, to, isRange := strings.Cut(base, "-")
+		switch {
+		case isWildcard(base):
+			steps = append(steps, every)
+		case isRange && bare && !hasStep:
+			values = append(values, name(from)+" through "+name(to))
+		case isRange:
+			steps = append(steps, every+" from "+name(from)+" through "+name(to))
+		case hasStep:
+			steps = append(steps, every+" starting at "+name(base))
+		default:
+			values = append(values, name(base))
+		}
+	}
+	if len(values) > 0 {
+		list := joinList(values)
+		if !bare {
+			prefix := "at " + unit
+			if len(values) > 1 {
+				prefix += "s"
+			}
+			list = prefix + " " + list
+		}
+		steps = append([]string{list}, steps...)
+	}
+	return joinList(steps)
+}
+
+// joinList joins items as "a, b and c".
+func joinList(items []string) string {
+	if len(items) <= 1 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
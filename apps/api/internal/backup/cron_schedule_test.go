@@ -0,0 +1,136 @@
+package backup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZonedScheduleDST(t *testing.T) {
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	// In 2026 Berlin (UTC+1, +2 in summer) moves clocks from 02:00 to 03:00
+	// on March 29 and from 03:00 back to 02:00 on October 25. New York
+	// (UTC-5, -4 in summer) moves them from 02:00 to 03:00 on March 8 and
+	// from 02:00 back to 01:00 on November 1.
+	tests := []struct {
+		name     string
+		timezone string
+		expr     string
+		after    time.Time
+		want     []time.Time
+	}{
+		{
+			name:     "Berlin gap runs at the change",
+			timezone: "Europe/Berlin",
+			expr:     "0 30 2 * * *",
+			after:    utc(time.March, 28, 12, 0),
+			// 02:30 on the 29th does not exist and runs at 03:00 +02:00
+			want: []time.Time{utc(time.March, 29, 1, 0), utc(time.March, 30, 0, 30)},
+		},
+		{
+			name:     "Berlin overlap runs at the first occurrence",
+			timezone: "Europe/Berlin",
+			expr:     "0 30 2 * * *",
+			after:    utc(time.October, 24, 12, 0),
+			// 02:30 +02:00, not 02:30 +01:00, then 02:30 +01:00 the next day
+			want: []time.Time{utc(time.October, 25, 0, 30), utc(time.October, 26, 1, 30)},
+		},
+		{
+			name:     "Berlin hourly runs through the overlap once",
+			timezone: "Europe/Berlin",
+			expr:     "0 0 * * * *",
+			after:    utc(time.October, 24, 23, 30),
+			// 02:00 +02:00, then 03:00 +01:00; the second 02:00 is skipped
+			want: []time.Time{utc(time.October, 25, 0, 0), utc(time.October, 25, 2, 0)},
+		},
+		{
+			name:     "Berlin after the first occurrence waits a day",
+			timezone: "Europe/Berlin",
+			expr:     "0 30 2 * * *",
+			// Between the two 02:30s
+			after: utc(time.October, 25, 1, 0),
+			want:  []time.Time{utc(time.October, 26, 1, 30)},
+		},
+		{
+			name:     "New York gap runs at the change",
+			timezone: "America/New_York",
+			expr:     "0 30 2 * * *",
+			after:    utc(time.March, 7, 12, 0),
+			// 02:30 on the 8th does not exist and runs at 03:00 -04:00
+			want: []time.Time{utc(time.March, 8, 7, 0), utc(time.March, 9, 6, 30)},
+		},
+		{
+			name:     "New York overlap runs at the first occurrence",
+			timezone: "America/New_York",
+			expr:     "0 30 1 * * *",
+			after:    utc(time.October, 31, 12, 0),
+			// 01:30 -04:00, not 01:30 -05:00, then 01:30 -05:00 the next day
+			want: []time.Time{utc(time.November, 1, 5, 30), utc(time.November, 2, 6, 30)},
+		},
+		{
+			name:     "New York hourly runs through the overlap once",
+			timezone: "America/New_York",
+			expr:     "0 0 * * * *",
+			after:    utc(time.November, 1, 4, 30),
+			// 01:00 -04:00, then 02:00 -05:00; the second 01:00 is skipped
+			want: []time.Time{utc(time.November, 1, 5, 0), utc(time.November, 1, 7, 0)},
+		},
+		{
+			name:     "UTC has no changes",
+			timezone: "UTC",
+			expr:     "0 30 2 * * *",
+			after:    utc(time.October, 24, 12, 0),
+			want:     []time.Time{utc(time.October, 25, 2, 30), utc(time.October, 26, 2, 30)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseSchedule(tt.expr, tt.timezone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := tt.after
+			for i, want := range tt.want {
+				next = schedule.Next(next)
+				if !next.Equal(want) {
+					t.Fatalf("run %d at %v (%v), want %v", i, next.UTC(), next, want)
+				}
+			}
+		})
+	}
+}
+
+func TestZonedScheduleInstant(t *testing.T) {
+	wall := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		timezone string
+		wall     time.Time
+		want     time.Time
+	}{
+		// Gaps map to the change
+		{"Europe/Berlin", wall(time.March, 29, 2, 30), wall(time.March, 29, 1, 0)},
+		{"America/New_York", wall(time.March, 8, 2, 30), wall(time.March, 8, 7, 0)},
+		// Overlaps map to the earlier occurrence in both zones
+		{"Europe/Berlin", wall(time.October, 25, 2, 0), wall(time.October, 25, 0, 0)},
+		{"Europe/Berlin", wall(time.October, 25, 2, 59), wall(time.October, 25, 0, 59)},
+		{"America/New_York", wall(time.November, 1, 1, 0), wall(time.November, 1, 5, 0)},
+		{"America/New_York", wall(time.November, 1, 1, 59), wall(time.November, 1, 5, 59)},
+		// Just outside the overlaps
+		{"Europe/Berlin", wall(time.October, 25, 3, 0), wall(time.October, 25, 2, 0)},
+		{"America/New_York", wall(time.November, 1, 2, 0), wall(time.November, 1, 7, 0)},
+		{"Europe/Berlin", wall(time.October, 25, 1, 59), wall(time.October, 24, 23, 59)},
+	}
+	for _, tt := range tests {
+		schedule, err := parseSchedule("* * * * * *", tt.timezone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schedule.instant(tt.wall); !got.Equal(tt.want) {
+			t.Errorf("%s wall time %s is %v, want %v", tt.timezone,
+				tt.wall.Format("2006-01-02 15:04"), got.UTC(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,900 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/google/uuid"
+)
+
+// Storage destination types.
+const (
+	destinationLocal = "local"
+	destinationS3    = "s3"
+	destinationSFTP  = "sftp"
+	destinationAzure = "azure"
+	destinationGCS   = "gcs"
+)
+
+// defaultS3DestinationID identifies the S3 storage configured in user
+// settings. It has no storage_destinations row.
+const defaultS3DestinationID = "s3"
+
+// Backup copy statuses.
+const (
+	copyUploading = "uploading"
+	copyUploaded  = "uploaded"
+	copyFailed    = "failed"
+	// copyUnverified is a copy whose object was stored but could not be
+	// checked afterwards. The reconciler checks it again.
+	copyUnverified = "unverified"
+)
+
+var (
+	errInvalidDestination   = errors.New("invalid destination")
+	errDestinationNameTaken = errors.New("a destination with this name already exists")
+	errDestinationInUse     = errors.New("destination still holds backup copies")
+	errUploadUnverified     = errors.New("stored object could not be verified")
+	errCopiesNotDeleted     = errors.New("stored copies could not be deleted")
+)
+
+// destination is a storage destination opened for use.
+type destination struct {
+	ID         string
+	Name       string
+	PathPrefix string
+	storage    Storage
+}
+
+// objectKey returns the key a backup file is stored under on the
+// destination.
+func (d *destination) objectKey(connectionName, backupPath string) string {
+	return storageKey(d.PathPrefix, common.SanitizeConnectionName(connectionName), filepath.Base(backupPath))
+}
+
+// secrets returns the fields that are encrypted at rest.
+func (c *DestinationConfig) secrets() []*string {
+	return []*string{&c.SecretKey, &c.Password, &c.PrivateKey, &c.AccountKey, &c.SASToken, &c.CredentialsJSON}
+}
+
+// redact blanks the secrets before a config is returned by the API.
+func (c *DestinationConfig) redact() {
+	for _, secret := range c.secrets() {
+		*secret = ""
+	}
+}
+
+// close releases the connection held by backends that keep one open.
+func (d *destination) close() {
+	if closer, ok := d.storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			fmt.Printf("Warning: Failed to close destination %s: %v\n", d.Name, err)
+		}
+	}
+}
+
+// openDestination builds the storage behind a saved destination.
+func (s *BackupService) openDestination(dest *StorageDestination) (*destination, error) {
+	d := &destination{ID: dest.ID, Name: dest.Name, PathPrefix: dest.Config.PathPrefix}
+
+	switch dest.Type {
+	case destinationLocal:
+		storage, err := NewLocalStorage(dest.Config.Path, s.localStorageRoots)
+		if err != nil {
+			return nil, err
+		}
+		d.storage = storage
+	case destinationS3:
+		secretKey, err := s.cryptoService.Decrypt(dest.Config.SecretKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret key: %w", err)
+		}
+		region := dest.Config.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		storage, err := NewS3Storage(S3Config{
+			Endpoint:              dest.Config.Endpoint,
+			Region:                region,
+			Bucket:                dest.Config.Bucket,
+			AccessKey:             dest.Config.AccessKey,
+			SecretKey:             secretKey,
+			UseSSL:                dest.Config.UseSSL,
+			StorageClass:          dest.Config.StorageClass,
+			ServerSideEncryption:  dest.Config.ServerSideEncryption,
+			KMSKeyID:              dest.Config.KMSKeyID,
+			ObjectLockMode:        dest.Config.ObjectLockMode,
+			DisableBucketCreation: dest.Config.DisableBucketCreation,
+		})
+		if err != nil {
+			return nil, err
+		}
+		d.storage = storage
+	case destinationSFTP:
+		config := SFTPConfig{
+			Host:     dest.Config.Host,
+			Port:     dest.Config.Port,
+			Username: dest.Config.Username,
+			HostKey:  dest.Config.HostKey,
+			Path:     dest.Config.Path,
+		}
+		var err error
+		if dest.Config.Password != "" {
+			if config.Password, err = s.cryptoService.Decrypt(dest.Config.Password); err != nil {
+				return nil, fmt.Errorf("failed to decrypt password: %w", err)
+			}
+		}
+		if dest.Config.PrivateKey != "" {
+			if config.PrivateKey, err = s.cryptoService.Decrypt(dest.Config.PrivateKey); err != nil {
+				return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+			}
+		}
+		storage, err := NewSFTPStorage(config)
+		if err != nil {
+			return nil, err
+		}
+		d.storage = storage
+	case destinationAzure:
+		config := AzureConfig{
+			AccountName: dest.Config.AccountName,
+			Container:   dest.Config.Container,
+			ServiceURL:  dest.Config.Endpoint,
+		}
+		var err error
+		if dest.Config.AccountKey != "" {
+			if config.AccountKey, err = s.cryptoService.Decrypt(dest.Config.AccountKey); err != nil {
+				return nil, fmt.Errorf("failed to decrypt account key: %w", err)
+			}
+		}
+		if dest.Config.SASToken != "" {
+			if config.SASToken, err = s.cryptoService.Decrypt(dest.Config.SASToken); err != nil {
+				return nil, fmt.Errorf("failed to decrypt SAS token: %w", err)
+			}
+		}
+		storage, err := NewAzureStorage(config)
+		if err != nil {
+			return nil, err
+		}
+		d.storage = storage
+	case destinationGCS:
+		config := GCSConfig{Bucket: dest.Config.Bucket, Endpoint: dest.Config.Endpoint}
+		if dest.Config.CredentialsJSON != "" {
+			var err error
+			if config.CredentialsJSON, err = s.cryptoService.Decrypt(dest.Config.CredentialsJSON); err != nil {
+				return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+			}
+		}
+		storage, err := NewGCSStorage(config)
+		if err != nil {
+			return nil, err
+		}
+		d.storage = storage
+	default:
+		return nil, fmt.Errorf("unsupported destination type: %s", dest.Type)
+	}
+
+	if err := s.throttleDestination(d, dest); err != nil {
+		d.close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// defaultS3StorageDestination describes the S3 storage from the user's
+// settings. It returns nil without an error when S3 is not enabled.
+func (s *BackupService) defaultS3StorageDestination(userID uuid.UUID) (*StorageDestination, error) {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user settings: %w", err)
+	}
+
+	if !userSettings.S3Enabled {
+		return nil, nil
+	}
+
+	if userSettings.S3Endpoint == nil || *userSettings.S3Endpoint == "" ||
+		userSettings.S3Bucket == nil || *userSettings.S3Bucket == "" ||
+		userSettings.S3AccessKey == nil || *userSettings.S3AccessKey == "" ||
+		userSettings.S3SecretKey == nil || *userSettings.S3SecretKey == "" {
+		return nil, fmt.Errorf("S3 is not fully configured")
+	}
+
+	config := DestinationConfig{
+		Endpoint:              *userSettings.S3Endpoint,
+		Bucket:                *userSettings.S3Bucket,
+		AccessKey:             *userSettings.S3AccessKey,
+		SecretKey:             *userSettings.S3SecretKey,
+		UseSSL:                userSettings.S3UseSSL,
+		DisableBucketCreation: userSettings.S3DisableBucketCreation,
+	}
+	for _, field := range []struct {
+		value *string
+		dest  *string
+	}{
+		{userSettings.S3Region, &config.Region},
+		{userSettings.S3PathPrefix, &config.PathPrefix},
+		{userSettings.S3StorageClass, &config.StorageClass},
+		{userSettings.S3ServerSideEncryption, &config.ServerSideEncryption},
+		{userSettings.S3KMSKeyID, &config.KMSKeyID},
+		{userSettings.S3ObjectLockMode, &config.ObjectLockMode},
+	} {
+		if field.value != nil {
+			*field.dest = *field.value
+		}
+	}
+
+	return &StorageDestination{
+		ID:     defaultS3DestinationID,
+		Name:   defaultS3DestinationID,
+		Type:   destinationS3,
+		Config: config,
+	}, nil
+}
+
+// defaultS3Destination opens the S3 storage from the user's settings. It
+// returns nil without an error when S3 is not enabled.
+func (s *BackupService) defaultS3Destination(userID uuid.UUID) (*destination, error) {
+	dest, err := s.defaultS3StorageDestination(userID)
+	if err != nil || dest == nil {
+		return nil, err
+	}
+	return s.openDestination(dest)
+}
+
+// storageDestinationByID returns one of the user's destinations, including
+// the settings S3 storage.
+func (s *BackupService) storageDestinationByID(userID uuid.UUID, id string) (*StorageDestination, error) {
+	if id == defaultS3DestinationID {
+		dest, err := s.defaultS3StorageDestination(userID)
+		if err == nil && dest == nil {
+			err = fmt.Errorf("S3 is not enabled")
+		}
+		return dest, err
+	}
+
+	dest, err := s.backupRepo.GetStorageDestination(id)
+	if err != nil {
+		return nil, err
+	}
+	if dest.UserID != userID {
+		return nil, errUnauthorized
+	}
+	return dest, nil
+}
+
+// destinationByID opens one of the user's destinations, including the
+// settings S3 storage.
+func (s *BackupService) destinationByID(userID uuid.UUID, id string) (*destination, error) {
+	dest, err := s.storageDestinationByID(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.openDestination(dest)
+}
+
+// connectionStorageDestinations returns the destinations a connection's
+// backups are copied to. Connections without any configured use the
+// settings S3 storage when it is enabled.
+func (s *BackupService) connectionStorageDestinations(conn *connection.StoredConnection) ([]*StorageDestination, error) {
+	ids, err := s.backupRepo.GetConnectionDestinationIDs(conn.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection destinations: %w", err)
+	}
+
+	if len(ids) == 0 {
+		dest, err := s.defaultS3StorageDestination(conn.UserID)
+		if err != nil || dest == nil {
+			return nil, err
+		}
+		return []*StorageDestination{dest}, nil
+	}
+
+	var dests []*StorageDestination
+	for _, id := range ids {
+		dest, err := s.storageDestinationByID(conn.UserID, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get destination %s: %w", id, err)
+		}
+		dests = append(dests, dest)
+	}
+	return dests, nil
+}
+
+// destinationsForConnection opens every destination of a connection.
+func (s *BackupService) destinationsForConnection(conn *connection.StoredConnection) ([]*destination, error) {
+	configs, err := s.connectionStorageDestinations(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var dests []*destination
+	for _, config := range configs {
+		d, err := s.openDestination(config)
+		if err != nil {
+			for _, opened := range dests {
+				opened.close()
+			}
+			return nil, fmt.Errorf("failed to open destination %s: %w", config.Name, err)
+		}
+		dests = append(dests, d)
+	}
+	return dests, nil
+}
+
+// ListStorageDestinations returns the user's destinations, with the
+// settings S3 storage first when it is enabled.
+func (s *BackupService) ListStorageDestinations(userID uuid.UUID) ([]*StorageDestination, error) {
+	dests, err := s.backupRepo.ListStorageDestinations(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	userSettings, err := s.settingsService.GetUserSettingsInternal(userID)
+	if err == nil && userSettings.S3Enabled {
+		builtin := &StorageDestination{
+			ID:      defaultS3DestinationID,
+			Name:    defaultS3DestinationID,
+			Type:    destinationS3,
+			Builtin: true,
+		}
+		if userSettings.S3Endpoint != nil {
+			builtin.Config.Endpoint = *userSettings.S3Endpoint
+		}
+		if userSettings.S3Bucket != nil {
+			builtin.Config.Bucket = *userSettings.S3Bucket
+		}
+		dests = append([]*StorageDestination{builtin}, dests...)
+	}
+
+	for _, dest := range dests {
+		dest.Config.redact()
+	}
+	return dests, nil
+}
+
+func validateDestinationRequest(req *StorageDestinationRequest, localStorageRoots []string) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("%w: name is required", errInvalidDestination)
+	}
+	if req.Name == defaultS3DestinationID {
+		return fmt.Errorf("%w: name %q is reserved for the S3 storage in settings", errInvalidDestination, defaultS3DestinationID)
+	}
+
+	switch req.Type {
+	case destinationLocal:
+		if req.Config.Path == "" {
+			return fmt.Errorf("%w: path is required for local destinations", errInvalidDestination)
+		}
+		if _, err := checkLocalStoragePath(req.Config.Path, localStorageRoots); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidDestination, err)
+		}
+	case destinationS3:
+		if req.Config.Endpoint == "" || req.Config.Bucket == "" || req.Config.AccessKey == "" {
+			return fmt.Errorf("%w: endpoint, bucket and access_key are required for s3 destinations", errInvalidDestination)
+		}
+		req.Config.StorageClass = strings.ToUpper(strings.TrimSpace(req.Config.StorageClass))
+		if err := settings.ValidateS3StorageOptions(req.Config.StorageClass, req.Config.ServerSideEncryption,
+			req.Config.KMSKeyID, req.Config.ObjectLockMode); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidDestination, err)
+		}
+	case destinationSFTP:
+		if req.Config.Host == "" || req.Config.Username == "" {
+			return fmt.Errorf("%w: host and username are required for sftp destinations", errInvalidDestination)
+		}
+		if req.Config.Port < 0 || req.Config.Port > 65535 {
+			return fmt.Errorf("%w: port must be between 1 and 65535, or 0 for the default port 22", errInvalidDestination)
+		}
+		if _, err := sftpHostKeyCallback(req.Config.HostKey); err != nil {
+			return fmt.Errorf("%w: host_key: %v", errInvalidDestination, err)
+		}
+	case destinationAzure:
+		if req.Config.AccountName == "" || req.Config.Container == "" {
+			return fmt.Errorf("%w: account_name and container are required for azure destinations", errInvalidDestination)
+		}
+	case destinationGCS:
+		if req.Config.Bucket == "" {
+			return fmt.Errorf("%w: bucket is required for gcs destinations", errInvalidDestination)
+		}
+		if req.Config.CredentialsJSON != "" {
+			if _, err := parseServiceAccountKey(req.Config.CredentialsJSON); err != nil {
+				return fmt.Errorf("%w: %v", errInvalidDestination, err)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: type must be one of: local, s3, sftp, azure, gcs", errInvalidDestination)
+	}
+
+	if req.Config.BandwidthLimitMBps < 0 {
+		return fmt.Errorf("%w: bandwidth_limit_mbps must not be negative", errInvalidDestination)
+	}
+	if _, err := common.ParseBandwidthWindows(req.Config.FullSpeedWindows); err != nil {
+		return fmt.Errorf("%w: full_speed_windows: %v", errInvalidDestination, err)
+	}
+	return nil
+}
+
+// requireDestinationSecrets checks a sealed config carries the credentials
+// its type needs.
+func requireDestinationSecrets(destType string, config DestinationConfig) error {
+	switch destType {
+	case destinationS3:
+		if config.SecretKey == "" {
+			return fmt.Errorf("%w: secret_key is required for s3 destinations", errInvalidDestination)
+		}
+	case destinationSFTP:
+		if config.Password == "" && config.PrivateKey == "" {
+			return fmt.Errorf("%w: password or private_key is required for sftp destinations", errInvalidDestination)
+		}
+	case destinationAzure:
+		if config.AccountKey == "" && config.SASToken == "" {
+			return fmt.Errorf("%w: account_key or sas_token is required for azure destinations", errInvalidDestination)
+		}
+	case destinationGCS:
+		if config.CredentialsJSON == "" && config.Endpoint == "" {
+			return fmt.Errorf("%w: credentials_json is required for gcs destinations", errInvalidDestination)
+		}
+	}
+	return nil
+}
+
+// sealDestinationConfig encrypts the secrets of a config. Secrets left empty
+// keep their value from previous, if given.
+func (s *BackupService) sealDestinationConfig(config *DestinationConfig, previous *DestinationConfig) error {
+	secrets := config.secrets()
+	for i, secret := range secrets {
+		if *secret == "" {
+			if previous != nil {
+				*secret = *previous.secrets()[i]
+			}
+			continue
+		}
+		encrypted, err := s.cryptoService.Encrypt(*secret)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt destination secret: %v", err)
+		}
+		*secret = encrypted
+	}
+	return nil
+}
+
+func (s *BackupService) CreateStorageDestination(userID uuid.UUID, req StorageDestinationRequest) (*StorageDestination, error) {
+	if err := validateDestinationRequest(&req, s.localStorageRoots); err != nil {
+		return nil, err
+	}
+	if err := requireDestinationSecrets(req.Type, req.Config); err != nil {
+		return nil, err
+	}
+	if err := s.checkDestinationName(userID, "", req.Name); err != nil {
+		return nil, err
+	}
+
+	config := req.Config
+	if err := s.sealDestinationConfig(&config, nil); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	dest := &StorageDestination{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      req.Name,
+		Type:      req.Type,
+		Config:    config,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.backupRepo.CreateStorageDestination(dest); err != nil {
+		return nil, err
+	}
+
+	dest.Config.redact()
+	return dest, nil
+}
+
+func (s *BackupService) UpdateStorageDestination(id string, userID uuid.UUID, req StorageDestinationRequest) (*StorageDestination, error) {
+	dest, err := s.getOwnedDestination(id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDestinationRequest(&req, s.localStorageRoots); err != nil {
+		return nil, err
+	}
+	if err := s.checkDestinationName(userID, id, req.Name); err != nil {
+		return nil, err
+	}
+
+	config := req.Config
+	if err := s.sealDestinationConfig(&config, &dest.Config); err != nil {
+		return nil, err
+	}
+	if err := requireDestinationSecrets(req.Type, config); err != nil {
+		return nil, err
+	}
+
+	dest.Name = req.Name
+	dest.Type = req.Type
+	dest.Config = config
+	if err := s.backupRepo.UpdateStorageDestination(dest); err != nil {
+		return nil, err
+	}
+
+	dest.UpdatedAt = time.Now()
+	dest.Config.redact()
+	return dest, nil
+}
+
+// DeleteStorageDestination removes a destination. Destinations that still
+// hold uploaded copies are refused so those copies are not orphaned.
+func (s *BackupService) DeleteStorageDestination(id string, userID uuid.UUID) error {
+	if _, err := s.getOwnedDestination(id, userID); err != nil {
+		return err
+	}
+
+	n, err := s.backupRepo.CountBackupCopies(id)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errDestinationInUse
+	}
+
+	return s.backupRepo.DeleteStorageDestination(id)
+}
+
+// TestStorageDestination writes, stats and deletes a small object to check
+// the destination is reachable and writable.
+func (s *BackupService) TestStorageDestination(id string, userID uuid.UUID) error {
+	d, err := s.destinationByID(userID, id)
+	if err != nil {
+		return err
+	}
+	defer d.close()
+
+	ctx := context.Background()
+	key := storageKey(d.PathPrefix, ".velld-test-"+uuid.New().String())
+	content := "velld storage test"
+	if err := d.storage.Put(ctx, key, strings.NewReader(content), int64(len(content)), ""); err != nil {
+		return fmt.Errorf("failed to write test object: %w", err)
+	}
+	defer d.storage.Delete(ctx, key)
+
+	object, err := d.storage.Stat(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to read test object: %w", err)
+	}
+	if object.Size != int64(len(content)) {
+		return fmt.Errorf("test object has size %d, expected %d", object.Size, len(content))
+	}
+	return nil
+}
+
+// checkDestinationName refuses a name already used by another of the
+// user's destinations.
+func (s *BackupService) checkDestinationName(userID uuid.UUID, id, name string) error {
+	dests, err := s.backupRepo.ListStorageDestinations(userID)
+	if err != nil {
+		return err
+	}
+	for _, dest := range dests {
+		if dest.ID != id && strings.EqualFold(dest.Name, name) {
+			return errDestinationNameTaken
+		}
+	}
+	return nil
+}
+
+func (s *BackupService) getOwnedDestination(id string, userID uuid.UUID) (*StorageDestination, error) {
+	dest, err := s.backupRepo.GetStorageDestination(id)
+	if err != nil {
+		return nil, err
+	}
+	if dest.UserID != userID {
+		return nil, errUnauthorized
+	}
+	return dest, nil
+}
+
+func (s *BackupService) GetConnectionDestinations(connectionID string, userID uuid.UUID) ([]string, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if conn.UserID != userID {
+		return nil, errUnauthorized
+	}
+
+	ids, err := s.backupRepo.GetConnectionDestinationIDs(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, nil
+}
+
+func (s *BackupService) SetConnectionDestinations(connectionID string, userID uuid.UUID, ids []string) ([]string, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if conn.UserID != userID {
+		return nil, errUnauthorized
+	}
+
+	seen := make(map[string]bool)
+	unique := []string{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if id != defaultS3DestinationID {
+			if _, err := s.getOwnedDestination(id, userID); err != nil {
+				if err == sql.ErrNoRows {
+					return nil, fmt.Errorf("%w: destination %s not found", errInvalidDestination, id)
+				}
+				return nil, err
+			}
+		}
+		unique = append(unique, id)
+	}
+
+	if err := s.backupRepo.SetConnectionDestinations(connectionID, unique); err != nil {
+		return nil, err
+	}
+	return unique, nil
+}
+
+// replicateBackup copies a finished backup to every destination of its
+// connection and records the outcome per destination. Failed copies are
+// retried in the background by the upload reconciler.
+func (s *BackupService) replicateBackup(backup *Backup, conn *connection.StoredConnection) error {
+	dests, err := s.connectionStorageDestinations(conn)
+	if err != nil {
+		return err
+	}
+	if len(dests) == 0 {
+		return nil
+	}
+
+	var failed []string
+	for _, dest := range dests {
+		if err := s.uploadBackupCopy(backup, conn.Name, dest, nil); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", dest.Name, err))
+		}
+	}
+	s.applyUploadStatus(backup, conn.UserID)
+
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to copy backup to %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// uploadBackupCopy uploads the backup file to one destination and checks
+// the stored object matches it before recording the copy as uploaded.
+// Retries pass the existing copy so its key, attempt count and any
+// multipart upload to resume carry over. A failed copy is scheduled for
+// another attempt unless the local file is gone.
+func (s *BackupService) uploadBackupCopy(backup *Backup, connectionName string, dest *StorageDestination, copy *BackupCopy) error {
+	if copy == nil {
+		copy = &BackupCopy{BackupID: backup.ID.String(), DestinationID: dest.ID}
+	}
+	copy.DestinationName = dest.Name
+
+	d, err := s.openDestination(dest)
+	if err != nil {
+		err = fmt.Errorf("failed to open destination: %w", err)
+	} else {
+		defer d.close()
+		if copy.ObjectKey == nil {
+			key := d.objectKey(connectionName, backup.Path)
+			copy.ObjectKey = &key
+		}
+		recheck := copy.Status == copyUnverified
+		copy.Status = copyUploading
+		copy.NextAttemptAt = nil
+		if err := s.backupRepo.SaveBackupCopy(copy); err != nil {
+			fmt.Printf("Warning: Failed to record copy of backup %s on %s: %v\n", backup.ID, d.Name, err)
+		}
+		if recheck {
+			err = s.recheckBackupObject(backup, d.storage, copy)
+		} else {
+			err = s.putBackupFile(backup, d.storage, copy)
+		}
+	}
+
+	if err != nil {
+		msg := err.Error()
+		copy.Status = copyFailed
+		if errors.Is(err, errUploadUnverified) {
+			copy.Status = copyUnverified
+		}
+		copy.Error = &msg
+		copy.Attempts++
+		// An unverified object is checked again even without the local file
+		if _, statErr := os.Stat(backup.Path); statErr == nil || copy.Status == copyUnverified {
+			next := time.Now().Add(uploadRetryDelay(copy.Attempts))
+			copy.NextAttemptAt = &next
+		}
+	} else {
+		now := time.Now()
+		copy.Status = copyUploaded
+		copy.Size = backup.Size
+		copy.Error = nil
+		copy.UploadedAt = &now
+		if d.ID == defaultS3DestinationID {
+			backup.S3ObjectKey = copy.ObjectKey
+		}
+		fmt.Printf("Successfully uploaded backup %s to %s: %s\n", backup.ID, d.Name, *copy.ObjectKey)
+	}
+
+	if saveErr := s.backupRepo.SaveBackupCopy(copy); saveErr != nil {
+		fmt.Printf("Warning: Failed to record copy of backup %s on %s: %v\n", backup.ID, dest.Name, saveErr)
+	}
+	return err
+}
+
+// putBackupFile uploads the backup file under the copy's key, resuming the
+// copy's multipart upload on backends that support it, and verifies the
+// stored object. On storage with object lock the object is written locked.
+func (s *BackupService) putBackupFile(backup *Backup, storage Storage, copy *BackupCopy) error {
+	key := *copy.ObjectKey
+	ctx, err := s.backupLockContext(context.Background(), backup, storage)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(backup.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer file.Close()
+
+	checksum := ""
+	if backup.Checksum != nil {
+		checksum = *backup.Checksum
+	}
+
+	if resumable, ok := storage.(resumableStorage); ok {
+		uploadID := ""
+		if copy.UploadID != nil {
+			uploadID = *copy.UploadID
+		}
+		err = resumable.PutResumable(ctx, key, file, backup.Size, checksum, uploadID, func(uploadID string) {
+			// Save the upload before sending parts so a retry can resume it
+			copy.UploadID = &uploadID
+			if err := s.backupRepo.SaveBackupCopy(copy); err != nil {
+				fmt.Printf("Warning: Failed to record upload of backup %s: %v\n", backup.ID, err)
+			}
+		})
+	} else {
+		err = storage.Put(ctx, key, file, backup.Size, checksum)
+	}
+	if err != nil {
+		return err
+	}
+	copy.UploadID = nil
+
+	// Make sure the stored object is the file we sent before trusting it.
+	// One that turns out not to match is dropped, keeping the local copy;
+	// one that cannot be checked is kept for the reconciler to check again.
+	if err := verifyBackupObject(ctx, backup, storage, key); err != nil {
+		if !errors.Is(err, errUploadUnverified) {
+			if delErr := storage.Delete(ctx, key); delErr != nil {
+				fmt.Printf("Warning: Failed to delete mismatched object %s: %v\n", key, delErr)
+			}
+		}
+		return fmt.Errorf("failed to verify upload: %w", err)
+	}
+	return nil
+}
+
+// recheckBackupObject checks again an object whose upload could not be
+// verified, uploading the file anew if the object turns out not to match.
+func (s *BackupService) recheckBackupObject(backup *Backup, storage Storage, copy *BackupCopy) error {
+	key := *copy.ObjectKey
+	err := verifyBackupObject(context.Background(), backup, storage, key)
+	switch {
+	case err == nil:
+		return s.lockBackupObject(backup, storage, key)
+	case errors.Is(err, errUploadUnverified):
+		return fmt.Errorf("failed to verify upload: %w", err)
+	default:
+		fmt.Printf("Warning: Uploading backup %s again: %v\n", backup.ID, err)
+		return s.putBackupFile(backup, storage, copy)
+	}
+}
+
+// verifyBackupObject checks the object stored under key has the size and,
+// when both sides know it, the checksum of the backup file. It wraps
+// errUploadUnverified when the object cannot be looked at, as opposed to
+// looked at and found missing or different.
+func verifyBackupObject(ctx context.Context, backup *Backup, storage Storage, key string) error {
+	object, err := storage.Stat(ctx, key)
+	if errors.Is(err, errStorageNotFound) {
+		return fmt.Errorf("stored object is missing")
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUploadUnverified, err)
+	}
+	if object.Size != backup.Size {
+		return fmt.Errorf("stored object does not match local file (size %d, expected %d)", object.Size, backup.Size)
+	}
+	if backup.Checksum != nil && *backup.Checksum != "" && object.Checksum != "" && object.Checksum != *backup.Checksum {
+		return fmt.Errorf("stored object does not match local file (checksum %s, expected %s)", object.Checksum, *backup.Checksum)
+	}
+	return nil
+}
+
+// deleteBackupCopies removes the stored copies of a backup from their
+// destinations and aborts multipart uploads left by failed ones. Copies
+// deleted are forgotten; it returns how many there were and the copies that
+// could not be deleted, which keep their rows so the delete can be retried.
+func (s *BackupService) deleteBackupCopies(backup *Backup, ownerID uuid.UUID) (int, []*BackupCopy, error) {
+	copies, err := s.backupRepo.GetBackupCopies(backup.ID.String())
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get copies of backup %s: %w", backup.ID, err)
+	}
+
+	ctx := context.Background()
+	deleted := 0
+	var failed []*BackupCopy
+	for _, copy := range copies {
+		stored := copy.Status == copyUploaded || copy.Status == copyUnverified
+		if copy.ObjectKey == nil || (!stored && copy.UploadID == nil) {
+			continue
+		}
+		d, err := s.destinationByID(ownerID, copy.DestinationID)
+		if err != nil {
+			fmt.Printf("Warning: Failed to open destination %s: %v\n", copy.DestinationName, err)
+			if stored {
+				failed = append(failed, copy)
+			}
+			continue
+		}
+
+		if !stored {
+			if resumable, ok := d.storage.(resumableStorage); ok {
+				if err := resumable.AbortUpload(ctx, *copy.ObjectKey, *copy.UploadID); err != nil {
+					fmt.Printf("Warning: Failed to abort upload of %s to %s: %v\n", *copy.ObjectKey, d.Name, err)
+				}
+			}
+			d.close()
+			continue
+		}
+
+		err = d.storage.Delete(ctx, *copy.ObjectKey)
+		d.close()
+		if err != nil {
+			fmt.Printf("Warning: Failed to delete object %s from %s: %v\n", *copy.ObjectKey, d.Name, err)
+			failed = append(failed, copy)
+			continue
+		}
+		if err := s.backupRepo.DeleteBackupCopy(copy.BackupID, copy.DestinationID); err != nil {
+			fmt.Printf("Warning: Failed to forget deleted copy of backup %s on %s: %v\n", backup.ID, d.Name, err)
+		}
+		deleted++
+	}
+	return deleted, failed, nil
+}
+
+// copiesNotDeleted describes the copies deleteBackupCopies failed to delete.
+func copiesNotDeleted(failed []*BackupCopy) error {
+	names := make([]string, len(failed))
+	for i, copy := range failed {
+		names[i] = copy.DestinationName
+	}
+	return fmt.Errorf("%w on %s", errCopiesNotDeleted, strings.Join(names, ", "))
+}
@@ -0,0 +1,200 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/gorilla/mux"
+)
+
+func (h *BackupHandler) ListStorageDestinations(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dests, err := h.backupService.ListStorageDestinations(userID)
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Storage destinations retrieved successfully", dests)
+}
+
+func (h *BackupHandler) CreateStorageDestination(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req StorageDestinationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dest, err := h.backupService.CreateStorageDestination(userID, req)
+	if err != nil {
+		sendDestinationError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Storage destination created successfully", dest)
+}
+
+func (h *BackupHandler) UpdateStorageDestination(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	destinationID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req StorageDestinationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dest, err := h.backupService.UpdateStorageDestination(destinationID, userID, req)
+	if err != nil {
+		sendDestinationError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Storage destination updated successfully", dest)
+}
+
+func (h *BackupHandler) DeleteStorageDestination(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	destinationID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.backupService.DeleteStorageDestination(destinationID, userID); err != nil {
+		sendDestinationError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Storage destination deleted successfully", nil)
+}
+
+func (h *BackupHandler) TestStorageDestination(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	destinationID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.backupService.TestStorageDestination(destinationID, userID); err != nil {
+		if err == sql.ErrNoRows || errors.Is(err, errUnauthorized) {
+			sendDestinationError(w, err)
+			return
+		}
+		response.SendError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Storage destination is reachable", nil)
+}
+
+func (h *BackupHandler) ReconcileStorageDestination(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	destinationID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req ReconcileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	report, err := h.backupService.ReconcileStorage(destinationID, userID, req)
+	if err != nil {
+		sendDestinationError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Storage destination reconciled successfully", report)
+}
+
+func (h *BackupHandler) GetConnectionDestinations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ids, err := h.backupService.GetConnectionDestinations(connectionID, userID)
+	if err != nil {
+		sendDestinationError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Connection destinations retrieved successfully", ConnectionDestinationsRequest{DestinationIDs: ids})
+}
+
+func (h *BackupHandler) SetConnectionDestinations(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	connectionID := vars["connection_id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req ConnectionDestinationsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ids, err := h.backupService.SetConnectionDestinations(connectionID, userID, req.DestinationIDs)
+	if err != nil {
+		sendDestinationError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Connection destinations updated successfully", ConnectionDestinationsRequest{DestinationIDs: ids})
+}
+
+func sendDestinationError(w http.ResponseWriter, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Not found")
+	case errors.Is(err, errUnauthorized):
+		response.SendError(w, http.StatusForbidden, "Not authorized to access this resource")
+	case errors.Is(err, errInvalidDestination):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errDestinationNameTaken), errors.Is(err, errDestinationInUse):
+		response.SendError(w, http.StatusConflict, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
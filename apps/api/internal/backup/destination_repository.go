@@ -0,0 +1,330 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/google/uuid"
+)
+
+// destinationColumns lists the columns read by scanStorageDestination, in
+// order.
+const destinationColumns = `id, user_id, name, type, config, created_at, updated_at`
+
+func scanStorageDestination(row rowScanner) (*StorageDestination, error) {
+	var (
+		configStr    string
+		createdAtStr string
+		updatedAtStr string
+	)
+	dest := &StorageDestination{}
+	err := row.Scan(&dest.ID, &dest.UserID, &dest.Name, &dest.Type, &configStr,
+		&createdAtStr, &updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(configStr), &dest.Config); err != nil {
+		return nil, fmt.Errorf("error parsing destination config: %v", err)
+	}
+
+	createdAt, err := common.ParseTime(createdAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	dest.CreatedAt = createdAt
+
+	updatedAt, err := common.ParseTime(updatedAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+	dest.UpdatedAt = updatedAt
+
+	return dest, nil
+}
+
+func (r *BackupRepository) CreateStorageDestination(dest *StorageDestination) error {
+	config, err := json.Marshal(dest.Config)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`
+		INSERT INTO storage_destinations (id, user_id, name, type, config, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		dest.ID, dest.UserID.String(), dest.Name, dest.Type, string(config),
+		dest.CreatedAt.Format(time.RFC3339), dest.UpdatedAt.Format(time.RFC3339))
+	return err
+}
+
+func (r *BackupRepository) UpdateStorageDestination(dest *StorageDestination) error {
+	config, err := json.Marshal(dest.Config)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec(`
+		UPDATE storage_destinations
+		SET name = $1, type = $2, config = $3, updated_at = $4
+		WHERE id = $5`,
+		dest.Name, dest.Type, string(config), time.Now().Format(time.RFC3339), dest.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update storage destination: %v", err)
+	}
+	return nil
+}
+
+// DeleteStorageDestination removes a destination and detaches it from every
+// connection.
+func (r *BackupRepository) DeleteStorageDestination(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM connection_storage_destinations WHERE destination_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM storage_destinations WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *BackupRepository) GetStorageDestination(id string) (*StorageDestination, error) {
+	return scanStorageDestination(r.db.QueryRow(`
+		SELECT `+destinationColumns+`
+		FROM storage_destinations WHERE id = $1`, id))
+}
+
+func (r *BackupRepository) ListStorageDestinations(userID uuid.UUID) ([]*StorageDestination, error) {
+	rows, err := r.db.Query(`
+		SELECT `+destinationColumns+`
+		FROM storage_destinations
+		WHERE user_id = $1
+		ORDER BY name ASC`, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dests := []*StorageDestination{}
+	for rows.Next() {
+		dest, err := scanStorageDestination(rows)
+		if err != nil {
+			return nil, err
+		}
+		dests = append(dests, dest)
+	}
+	return dests, rows.Err()
+}
+
+// SetConnectionDestinations replaces the destinations of a connection.
+func (r *BackupRepository) SetConnectionDestinations(connectionID string, destinationIDs []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM connection_storage_destinations WHERE connection_id = $1`, connectionID); err != nil {
+		return err
+	}
+	for _, id := range destinationIDs {
+		if _, err := tx.Exec(`
+			INSERT INTO connection_storage_destinations (connection_id, destination_id)
+			VALUES ($1, $2)`, connectionID, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *BackupRepository) GetConnectionDestinationIDs(connectionID string) ([]string, error) {
+	rows, err := r.db.Query(`
+		SELECT destination_id FROM connection_storage_destinations
+		WHERE connection_id = $1
+		ORDER BY destination_id ASC`, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SaveBackupCopy inserts or replaces the copy of a backup on a destination.
+func (r *BackupRepository) SaveBackupCopy(copy *BackupCopy) error {
+	copy.UpdatedAt = time.Now()
+	_, err := r.db.Exec(`
+		INSERT INTO backup_copies (
+			backup_id, destination_id, destination_name, status, object_key,
+			size, error, attempts, next_attempt_at, upload_id, uploaded_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (backup_id, destination_id) DO UPDATE SET
+			destination_name = excluded.destination_name,
+			status = excluded.status,
+			object_key = excluded.object_key,
+			size = excluded.size,
+			error = excluded.error,
+			attempts = excluded.attempts,
+			next_attempt_at = excluded.next_attempt_at,
+			upload_id = excluded.upload_id,
+			uploaded_at = excluded.uploaded_at,
+			updated_at = excluded.updated_at`,
+		copy.BackupID, copy.DestinationID, copy.DestinationName, copy.Status, copy.ObjectKey,
+		copy.Size, copy.Error, copy.Attempts, formatNullableTime(copy.NextAttemptAt), copy.UploadID,
+		formatNullableTime(copy.UploadedAt), copy.UpdatedAt.Format(time.RFC3339))
+	return err
+}
+
+// DeleteBackupCopy forgets a backup's copy on one destination.
+func (r *BackupRepository) DeleteBackupCopy(backupID, destinationID string) error {
+	_, err := r.db.Exec(`
+		DELETE FROM backup_copies
+		WHERE backup_id = $1 AND destination_id = $2`, backupID, destinationID)
+	return err
+}
+
+// copyColumns lists the columns read by scanBackupCopy, in order.
+const copyColumns = `
+	backup_id, destination_id, destination_name, status, object_key,
+	COALESCE(size, 0), error, COALESCE(attempts, 0), next_attempt_at, upload_id,
+	uploaded_at, updated_at`
+
+func scanBackupCopy(row rowScanner) (*BackupCopy, error) {
+	var (
+		nextAttemptAtStr sql.NullString
+		uploadedAtStr    sql.NullString
+		updatedAtStr     string
+	)
+	copy := &BackupCopy{}
+	if err := row.Scan(&copy.BackupID, &copy.DestinationID, &copy.DestinationName,
+		&copy.Status, &copy.ObjectKey, &copy.Size, &copy.Error,
+		&copy.Attempts, &nextAttemptAtStr, &copy.UploadID,
+		&uploadedAtStr, &updatedAtStr); err != nil {
+		return nil, err
+	}
+
+	if nextAttemptAtStr.Valid {
+		nextAttemptAt, err := common.ParseTime(nextAttemptAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing next_attempt_at: %v", err)
+		}
+		copy.NextAttemptAt = &nextAttemptAt
+	}
+
+	if uploadedAtStr.Valid {
+		uploadedAt, err := common.ParseTime(uploadedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing uploaded_at: %v", err)
+		}
+		copy.UploadedAt = &uploadedAt
+	}
+
+	updatedAt, err := common.ParseTime(updatedAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+	copy.UpdatedAt = updatedAt
+
+	return copy, nil
+}
+
+func (r *BackupRepository) queryBackupCopies(query string, args ...interface{}) ([]*BackupCopy, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	copies := []*BackupCopy{}
+	for rows.Next() {
+		copy, err := scanBackupCopy(rows)
+		if err != nil {
+			return nil, err
+		}
+		copies = append(copies, copy)
+	}
+	return copies, rows.Err()
+}
+
+func (r *BackupRepository) GetBackupCopies(backupID string) ([]*BackupCopy, error) {
+	return r.queryBackupCopies(`
+		SELECT `+copyColumns+`
+		FROM backup_copies
+		WHERE backup_id = $1
+		ORDER BY destination_name ASC`, backupID)
+}
+
+// GetCopiesDueForUpload returns failed and unverified copies of completed
+// backups whose next attempt is due, oldest first.
+func (r *BackupRepository) GetCopiesDueForUpload(now time.Time, limit int) ([]*BackupCopy, error) {
+	return r.queryBackupCopies(`
+		SELECT `+copyColumns+`
+		FROM backup_copies
+		WHERE status IN ('failed', 'unverified') AND next_attempt_at IS NOT NULL AND next_attempt_at <= $1
+		  AND backup_id IN (SELECT id FROM backups WHERE status = 'completed')
+		ORDER BY next_attempt_at ASC
+		LIMIT $2`, now.Format(time.RFC3339), limit)
+}
+
+// FailInterruptedUploads marks copies left uploading by a previous process
+// as failed and due for a retry, keeping their multipart upload to resume.
+func (r *BackupRepository) FailInterruptedUploads(reason string) (int64, error) {
+	now := time.Now().Format(time.RFC3339)
+	result, err := r.db.Exec(`
+		UPDATE backup_copies
+		SET status = 'failed', error = $1, next_attempt_at = $2, updated_at = $2
+		WHERE status = 'uploading'`,
+		reason, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetDestinationObjects returns the object keys the user's backups have
+// recorded on a destination, in any copy status.
+func (r *BackupRepository) GetDestinationObjects(userID uuid.UUID, destinationID string) ([]*catalogObject, error) {
+	rows, err := r.db.Query(`
+		SELECT bc.backup_id, b.connection_id, bc.status, bc.object_key
+		FROM backup_copies bc
+		JOIN backups b ON b.id = bc.backup_id
+		JOIN connections c ON c.id = b.connection_id
+		WHERE bc.destination_id = $1 AND c.user_id = $2 AND bc.object_key IS NOT NULL`,
+		destinationID, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []*catalogObject
+	for rows.Next() {
+		object := &catalogObject{}
+		if err := rows.Scan(&object.BackupID, &object.ConnectionID, &object.Status, &object.Key); err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, rows.Err()
+}
+
+// CountBackupCopies returns how many uploaded copies a destination holds.
+func (r *BackupRepository) CountBackupCopies(destinationID string) (int, error) {
+	var n int
+	err := r.db.QueryRow(`
+		SELECT COUNT(*) FROM backup_copies
+		WHERE destination_id = $1 AND status = 'uploaded'`, destinationID).Scan(&n)
+	return n, err
+}
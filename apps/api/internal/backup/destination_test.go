@@ -0,0 +1,229 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// statStorage is storage whose Stat fails with err, or reports size when
+// it is set.
+type statStorage struct {
+	Storage
+	err  error
+	size int64
+}
+
+func (s *statStorage) Stat(ctx context.Context, key string) (*StorageObject, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	object, err := s.Storage.Stat(ctx, key)
+	if err == nil && s.size > 0 {
+		object.Size = s.size
+	}
+	return object, err
+}
+
+// newLocalBackup writes a backup file of data and returns the backup.
+func newLocalBackup(t *testing.T, data string) *Backup {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "db_20260101_020000.sql")
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &Backup{ID: uuid.New(), Path: path, Size: int64(len(data)), Status: backupCompleted}
+}
+
+// newTestLocalStorage returns storage in a fresh directory.
+func newTestLocalStorage(t *testing.T) *LocalStorage {
+	t.Helper()
+	root := t.TempDir()
+	storage, err := NewLocalStorage(root, []string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return storage
+}
+
+func TestPutBackupFileVerification(t *testing.T) {
+	const key = "conn/db_20260101_020000.sql"
+	s := &BackupService{backupRepo: newTestRepository(t)}
+	backup := newLocalBackup(t, "backup data")
+	ctx := context.Background()
+
+	tests := []struct {
+		name           string
+		statErr        error
+		statSize       int64
+		wantUnverified bool
+		wantKept       bool
+	}{
+		{name: "matching object is kept", wantKept: true},
+		{name: "size mismatch deletes the object", statSize: 3},
+		{name: "missing object", statErr: errStorageNotFound},
+		{name: "failed stat keeps the object", statErr: errors.New("connection reset"), wantUnverified: true, wantKept: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := newTestLocalStorage(t)
+			storage := &statStorage{Storage: local, err: tt.statErr, size: tt.statSize}
+			objectKey := key
+			err := s.putBackupFile(backup, storage, &BackupCopy{ObjectKey: &objectKey})
+			if tt.wantKept && !tt.wantUnverified {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil {
+				t.Fatal("upload verified")
+			}
+			if got := errors.Is(err, errUploadUnverified); got != tt.wantUnverified {
+				t.Errorf("unverified: %v, want %v (%v)", got, tt.wantUnverified, err)
+			}
+			_, statErr := local.Stat(ctx, key)
+			if kept := statErr == nil; kept != tt.wantKept {
+				t.Errorf("object kept: %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestRecheckBackupObject(t *testing.T) {
+	const key = "conn/db_20260101_020000.sql"
+	s := &BackupService{backupRepo: newTestRepository(t)}
+	backup := newLocalBackup(t, "backup data")
+	ctx := context.Background()
+	local := newTestLocalStorage(t)
+	objectKey := key
+	copy := &BackupCopy{ObjectKey: &objectKey, Status: copyUnverified}
+
+	// Still out of reach: stays unverified
+	err := s.recheckBackupObject(backup, &statStorage{Storage: local, err: errors.New("timeout")}, copy)
+	if !errors.Is(err, errUploadUnverified) {
+		t.Fatalf("got %v, want an unverified upload", err)
+	}
+
+	// Found to differ: the file is uploaded again
+	if err := local.Put(ctx, key, strings.NewReader("partial"), -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.recheckBackupObject(backup, local, copy); err != nil {
+		t.Fatal(err)
+	}
+	object, err := local.Stat(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object.Size != backup.Size {
+		t.Errorf("object is %d bytes, want %d", object.Size, backup.Size)
+	}
+
+	// Found to match: verified as it is
+	if err := s.recheckBackupObject(backup, local, copy); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadStatusOfUnverifiedCopies(t *testing.T) {
+	next := time.Now()
+	uploaded := &BackupCopy{Status: copyUploaded}
+	tests := []struct {
+		name   string
+		copies []*BackupCopy
+		want   string
+	}{
+		{"rechecked later", []*BackupCopy{uploaded, {Status: copyUnverified, NextAttemptAt: &next}}, uploadPending},
+		{"given up on", []*BackupCopy{uploaded, {Status: copyUnverified}}, uploadFailed},
+	}
+	for _, tt := range tests {
+		if got := uploadStatusOf(tt.copies); got == nil || *got != tt.want {
+			t.Errorf("%s: status %v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDeleteBackupCopiesKeepsFailures(t *testing.T) {
+	repo := newTestRepository(t)
+	root := t.TempDir()
+	s := &BackupService{backupRepo: repo, localStorageRoots: []string{root}}
+	userID := uuid.New()
+	ctx := context.Background()
+
+	backup := newLocalBackup(t, "backup data")
+	backup.ConnectionID = uuid.NewString()
+	if err := repo.CreateBackup(backup); err != nil {
+		t.Fatal(err)
+	}
+
+	newDestination := func(name string) *StorageDestination {
+		dest := &StorageDestination{
+			ID:     uuid.NewString(),
+			UserID: userID,
+			Name:   name,
+			Type:   destinationLocal,
+			Config: DestinationConfig{Path: filepath.Join(root, name)},
+		}
+		if err := repo.CreateStorageDestination(dest); err != nil {
+			t.Fatal(err)
+		}
+		return dest
+	}
+	newCopy := func(dest *StorageDestination, status string) *BackupCopy {
+		key := "conn/" + filepath.Base(backup.Path)
+		copy := &BackupCopy{
+			BackupID:        backup.ID.String(),
+			DestinationID:   dest.ID,
+			DestinationName: dest.Name,
+			Status:          status,
+			ObjectKey:       &key,
+		}
+		if err := repo.SaveBackupCopy(copy); err != nil {
+			t.Fatal(err)
+		}
+		return copy
+	}
+
+	nas := newDestination("nas")
+	newCopy(nas, copyUploaded)
+	d, err := s.destinationByID(userID, nas.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.storage.Put(ctx, "conn/"+filepath.Base(backup.Path), strings.NewReader("backup data"), -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	d.close()
+
+	// A destination that can no longer be opened fails its delete
+	gone := newDestination("gone")
+	newCopy(gone, copyUnverified)
+	if err := repo.DeleteStorageDestination(gone.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, failed, err := s.deleteBackupCopies(backup, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 || len(failed) != 1 || failed[0].DestinationID != gone.ID {
+		t.Fatalf("deleted %d, failed %v; want the copy on nas deleted and the one on gone failed", deleted, failed)
+	}
+	if !errors.Is(copiesNotDeleted(failed), errCopiesNotDeleted) {
+		t.Error("copiesNotDeleted does not wrap errCopiesNotDeleted")
+	}
+
+	// The failed copy keeps its row so the delete can be retried
+	copies, err := repo.GetBackupCopies(backup.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copies) != 1 || copies[0].DestinationID != gone.ID {
+		t.Errorf("copies left: %v, want only the one on gone", copies)
+	}
+}
@@ -0,0 +1,273 @@
+package backup
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// defaultDownloadCacheMB is the default size of the download cache.
+const defaultDownloadCacheMB = 2048
+
+// downloadCache keeps backups downloaded from storage so restores and
+// compares of the same backup download it once. Files are named
+// <backup id>.<random> and evicted least recently used first once the cache
+// grows past maxBytes, but never while in use.
+type downloadCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry // by backup ID
+	lru     *list.List             // of *cacheEntry, most recently used first
+	size    int64
+
+	// fetches de-duplicates concurrent downloads of the same backup
+	fetches singleflight.Group
+}
+
+type cacheEntry struct {
+	backupID string
+	path     string
+	size     int64
+	refs     int
+	elem     *list.Element
+	// verified is the checksum the file last matched, and verifiedAt the
+	// file's modification time then. Empty until the file is checked.
+	verified   string
+	verifiedAt time.Time
+}
+
+// newDownloadCache opens the cache in dir, keeping files left by a previous
+// run and removing unfinished downloads.
+func newDownloadCache(dir string, maxBytes int64) (*downloadCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create download cache directory: %w", err)
+	}
+	c := &downloadCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*cacheEntry),
+		lru:      list.New(),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read download cache directory: %w", err)
+	}
+	for _, file := range files {
+		path := filepath.Join(dir, file.Name())
+		info, err := file.Info()
+		backupID, _, ok := strings.Cut(file.Name(), ".")
+		if err != nil || file.IsDir() || !ok || strings.HasSuffix(file.Name(), ".partial") || c.entries[backupID] != nil {
+			os.RemoveAll(path)
+			continue
+		}
+		c.add(&cacheEntry{backupID: backupID, path: path, size: info.Size()})
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+// downloadCacheFromEnv opens the cache in DOWNLOAD_CACHE_DIR, bounded to
+// DOWNLOAD_CACHE_MAX_MB.
+func downloadCacheFromEnv() (*downloadCache, error) {
+	dir := strings.TrimSpace(os.Getenv("DOWNLOAD_CACHE_DIR"))
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "velld-download-cache")
+	}
+	maxMB := positiveIntFromEnv("DOWNLOAD_CACHE_MAX_MB", defaultDownloadCacheMB)
+	return newDownloadCache(dir, int64(maxMB)<<20)
+}
+
+// add puts a new entry at the front of the cache. The caller holds mu or
+// has the cache to itself.
+func (c *downloadCache) add(entry *cacheEntry) {
+	entry.elem = c.lru.PushFront(entry)
+	c.entries[entry.backupID] = entry
+	c.size += entry.size
+}
+
+// remove drops an entry from the cache and deletes its file. The caller
+// holds mu, and the entry must not be in use.
+func (c *downloadCache) remove(entry *cacheEntry) {
+	if c.entries[entry.backupID] == entry {
+		delete(c.entries, entry.backupID)
+	}
+	c.lru.Remove(entry.elem)
+	c.size -= entry.size
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: Failed to remove cached download %s: %v\n", entry.path, err)
+	}
+}
+
+// evict removes least recently used entries that are not in use until the
+// cache fits in maxBytes. The caller holds mu.
+func (c *downloadCache) evict() {
+	for elem := c.lru.Back(); elem != nil && c.size > c.maxBytes; {
+		entry := elem.Value.(*cacheEntry)
+		elem = elem.Prev()
+		if entry.refs == 0 {
+			c.remove(entry)
+		}
+	}
+}
+
+// acquire returns the cached file of a backup, downloading it with fetch on
+// a miss. The file matches the backup's checksum, when it has one, and
+// stays in place until release is called.
+func (c *downloadCache) acquire(backup *Backup, fetch func(w io.Writer) error) (string, func(), error) {
+	backupID := backup.ID.String()
+	// A file evicted or found corrupt between being fetched and acquired
+	// is fetched again
+	for attempt := 0; attempt < 3; attempt++ {
+		if entry := c.hold(backupID); entry != nil {
+			if err := c.check(entry, backup); err != nil {
+				fmt.Printf("Warning: Discarding cached download of backup %s: %v\n", backupID, err)
+				c.release(entry, true)
+				continue
+			}
+			return entry.path, func() { c.release(entry, false) }, nil
+		}
+
+		_, err, _ := c.fetches.Do(backupID, func() (interface{}, error) {
+			return nil, c.download(backup, fetch)
+		})
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	return "", nil, fmt.Errorf("failed to keep backup %s in the download cache", backupID)
+}
+
+// hold marks a backup's entry in use and moves it to the front, or returns
+// nil if it is not cached.
+func (c *downloadCache) hold(backupID string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[backupID]
+	if entry == nil {
+		return nil
+	}
+	entry.refs++
+	c.lru.MoveToFront(entry.elem)
+	return entry
+}
+
+// release ends a use of an entry. A discarded entry is no longer handed
+// out, and its file is deleted once nothing uses it.
+func (c *downloadCache) release(entry *cacheEntry, discard bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.refs--
+	if discard && c.entries[entry.backupID] == entry {
+		delete(c.entries, entry.backupID)
+	}
+	if entry.refs == 0 && c.entries[entry.backupID] != entry {
+		c.remove(entry)
+	}
+	c.evict()
+}
+
+// check makes sure a cached file still holds the backup. Files are hashed
+// again only if they or the backup's checksum changed since the last check.
+func (c *downloadCache) check(entry *cacheEntry, backup *Backup) error {
+	info, err := os.Stat(entry.path)
+	if err != nil {
+		return err
+	}
+	if backup.Size > 0 && info.Size() != backup.Size {
+		return fmt.Errorf("cached file has size %d, expected %d", info.Size(), backup.Size)
+	}
+	if backup.Checksum == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	verified := entry.verified == *backup.Checksum && entry.verifiedAt.Equal(info.ModTime())
+	c.mu.Unlock()
+	if verified {
+		return nil
+	}
+
+	checksum, _, err := hashFile(entry.path)
+	if err != nil {
+		return err
+	}
+	if checksum != *backup.Checksum {
+		return fmt.Errorf("cached file checksum %s does not match %s", checksum, *backup.Checksum)
+	}
+	c.mu.Lock()
+	entry.verified = checksum
+	entry.verifiedAt = info.ModTime()
+	c.mu.Unlock()
+	return nil
+}
+
+// download fetches a backup into a new cache file, checking it against the
+// backup's size and checksum before adding it.
+func (c *downloadCache) download(backup *Backup, fetch func(w io.Writer) error) error {
+	backupID := backup.ID.String()
+	file, err := os.CreateTemp(c.dir, backupID+".*.partial")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	partial := file.Name()
+
+	hasher := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(file, hasher)}
+	err = fetch(counter)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	checksum := hex.EncodeToString(hasher.Sum(nil))
+	if err == nil && backup.Size > 0 && counter.n != backup.Size {
+		err = fmt.Errorf("downloaded %d bytes, expected %d", counter.n, backup.Size)
+	}
+	if err == nil && backup.Checksum != nil && checksum != *backup.Checksum {
+		err = fmt.Errorf("downloaded file checksum %s does not match %s", checksum, *backup.Checksum)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+
+	path := strings.TrimSuffix(partial, ".partial")
+	if err := os.Rename(partial, path); err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("failed to rename downloaded file: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	entry := &cacheEntry{backupID: backupID, path: path, size: counter.n}
+	if backup.Checksum != nil {
+		entry.verified = checksum
+		entry.verifiedAt = info.ModTime()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if previous := c.entries[backupID]; previous != nil {
+		delete(c.entries, backupID)
+		if previous.refs == 0 {
+			c.remove(previous)
+		}
+	}
+	c.add(entry)
+	return nil
+}
@@ -0,0 +1,309 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// cachedBackup returns a backup of data with its size and checksum.
+func cachedBackup(data string) *Backup {
+	sum := sha256.Sum256([]byte(data))
+	checksum := hex.EncodeToString(sum[:])
+	return &Backup{ID: uuid.New(), Size: int64(len(data)), Checksum: &checksum}
+}
+
+// stubFetch downloads data, counting its calls.
+func stubFetch(data string, calls *atomic.Int32) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		calls.Add(1)
+		_, err := io.WriteString(w, data)
+		return err
+	}
+}
+
+// acquireFile acquires a backup and reads the cached file.
+func acquireFile(t *testing.T, c *downloadCache, backup *Backup, fetch func(w io.Writer) error) (string, func()) {
+	t.Helper()
+	path, release, err := c.acquire(backup, fetch)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading cached file: %v", err)
+	}
+	return string(data), release
+}
+
+// cachedIDs lists the backups in the cache, most recently used first.
+func cachedIDs(c *downloadCache) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var ids []string
+	for elem := c.lru.Front(); elem != nil; elem = elem.Next() {
+		ids = append(ids, elem.Value.(*cacheEntry).backupID)
+	}
+	return ids
+}
+
+// cacheFiles lists the file names in the cache directory.
+func cacheFiles(t *testing.T, c *downloadCache) []string {
+	t.Helper()
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func equalIDs(got []string, want ...*Backup) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i, backup := range want {
+		if got[i] != backup.ID.String() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDownloadCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, err := newDownloadCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, d := cachedBackup("aaaa"), cachedBackup("bbbb"), cachedBackup("dddd")
+	var calls atomic.Int32
+
+	data := map[*Backup]string{a: "aaaa", b: "bbbb"}
+	for _, backup := range []*Backup{a, b, a} {
+		_, release := acquireFile(t, c, backup, stubFetch(data[backup], &calls))
+		release()
+	}
+	// a was downloaded once, then used again
+	if n := calls.Load(); n != 2 {
+		t.Errorf("fetched %d times, want 2", n)
+	}
+	if ids := cachedIDs(c); !equalIDs(ids, a, b) {
+		t.Fatalf("cache holds %v, want a then b", ids)
+	}
+
+	// Past 10 bytes the least recently used backup, b, goes
+	got, release := acquireFile(t, c, d, stubFetch("dddd", &calls))
+	release()
+	if got != "dddd" {
+		t.Errorf("cached file holds %q", got)
+	}
+	if ids := cachedIDs(c); !equalIDs(ids, d, a) {
+		t.Errorf("cache holds %v, want d then a", ids)
+	}
+	if files := cacheFiles(t, c); len(files) != 2 {
+		t.Errorf("cache directory holds %v, want the files of d and a", files)
+	}
+	if c.size != 8 {
+		t.Errorf("cache size %d, want 8", c.size)
+	}
+}
+
+func TestDownloadCacheKeepsHeldEntries(t *testing.T) {
+	c, err := newDownloadCache(t.TempDir(), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := cachedBackup("aaaa"), cachedBackup("bbbb")
+	var calls atomic.Int32
+
+	pathA, releaseA, err := c.acquire(a, stubFetch("aaaa", &calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pathB, releaseB, err := c.acquire(b, stubFetch("bbbb", &calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both are in use, so the cache grows past its size rather than
+	// deleting a file under a restore
+	for _, path := range []string{pathA, pathB} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("held file was evicted: %v", err)
+		}
+	}
+
+	// Once released, the least recently used one makes room
+	releaseA()
+	if _, err := os.Stat(pathA); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("released file of a is still there: %v", err)
+	}
+	if _, err := os.Stat(pathB); err != nil {
+		t.Errorf("held file of b was evicted: %v", err)
+	}
+	releaseB()
+	if ids := cachedIDs(c); !equalIDs(ids, b) {
+		t.Errorf("cache holds %v, want b", ids)
+	}
+}
+
+func TestDownloadCacheDeduplicatesFetches(t *testing.T) {
+	c, err := newDownloadCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := cachedBackup("backup data")
+	var calls atomic.Int32
+	unblock := make(chan struct{})
+	fetch := func(w io.Writer) error {
+		calls.Add(1)
+		<-unblock
+		_, err := io.WriteString(w, "backup data")
+		return err
+	}
+
+	const callers = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path, release, err := c.acquire(backup, fetch)
+			if err == nil {
+				var data []byte
+				data, err = os.ReadFile(path)
+				if err == nil && string(data) != "backup data" {
+					err = errors.New("cached file holds " + string(data))
+				}
+				release()
+			}
+			errs <- err
+		}()
+	}
+	// Let every caller miss the cache and join the download
+	time.Sleep(100 * time.Millisecond)
+	close(unblock)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("fetched %d times for %d concurrent callers, want once", n, callers)
+	}
+	if files := cacheFiles(t, c); len(files) != 1 {
+		t.Errorf("cache directory holds %v, want one file", files)
+	}
+}
+
+func TestDownloadCacheDiscardsCorruptFile(t *testing.T) {
+	c, err := newDownloadCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := cachedBackup("backup data")
+	var calls atomic.Int32
+
+	path, release, err := c.acquire(backup, stubFetch("backup data", &calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	// Damage the file without changing its size; the new modification time
+	// makes the cache hash it again
+	if err := os.WriteFile(path, []byte("backup dada"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	data, release := acquireFile(t, c, backup, stubFetch("backup data", &calls))
+	release()
+	if data != "backup data" {
+		t.Errorf("cached file holds %q after the corrupt one was discarded", data)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("fetched %d times, want 2", n)
+	}
+	if files := cacheFiles(t, c); len(files) != 1 {
+		t.Errorf("cache directory holds %v, want only the new file", files)
+	}
+
+	// A download that does not match the backup is not cached at all
+	other := cachedBackup("other data")
+	if _, _, err := c.acquire(other, stubFetch("tampered!!", &calls)); err == nil {
+		t.Error("acquired a download that does not match its checksum")
+	}
+	if _, _, err := c.acquire(other, stubFetch("short", &calls)); err == nil {
+		t.Error("acquired a short download")
+	}
+	if files := cacheFiles(t, c); len(files) != 1 {
+		t.Errorf("cache directory holds %v after failed downloads", files)
+	}
+}
+
+func TestNewDownloadCacheReloadsFiles(t *testing.T) {
+	dir := t.TempDir()
+	// Reloaded files are added in directory order, the last one read being
+	// the most recently used, so the backup whose ID sorts first is evicted
+	evicted, kept := cachedBackup("evicted data"), cachedBackup("kept")
+	evicted.ID = uuid.MustParse("00000000-0000-4000-8000-000000000000")
+	kept.ID = uuid.MustParse("ffffffff-ffff-4fff-bfff-ffffffffffff")
+	write := func(name, data string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write(evicted.ID.String()+".1", "evicted data")
+	keptPath := write(kept.ID.String()+".2", "kept")
+	write(kept.ID.String()+".3", "kept")               // a second file for the same backup
+	write(uuid.NewString()+".4.partial", "unfinished") // an interrupted download
+	write("stray", "no backup ID")
+	if err := os.Mkdir(filepath.Join(dir, uuid.NewString()+".5"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newDownloadCache(dir, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := cachedIDs(c); !equalIDs(ids, kept) {
+		t.Fatalf("reloaded cache holds %v, want only %s", ids, kept.ID)
+	}
+	if files := cacheFiles(t, c); len(files) != 1 || filepath.Join(dir, files[0]) != keptPath {
+		t.Errorf("cache directory holds %v, want only %s", files, filepath.Base(keptPath))
+	}
+
+	// The reloaded file is used without downloading the backup again
+	var calls atomic.Int32
+	path, release, err := c.acquire(kept, stubFetch("unused", &calls))
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if path != keptPath || calls.Load() != 0 {
+		t.Errorf("acquired %s after %d fetches, want the reloaded %s", path, calls.Load(), keptPath)
+	}
+}
@@ -0,0 +1,245 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/dendianugerah/velld/internal/settings"
+)
+
+// newEncryptingService returns a service whose server key is key, repeated
+// to 32 bytes.
+func newEncryptingService(t *testing.T, key string) *BackupService {
+	t.Helper()
+	cryptoService, err := common.NewEncryptionService(strings.Repeat(key, 64/len(key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &BackupService{cryptoService: cryptoService}
+}
+
+// encryptDump writes dump to a backup file encrypted as userSettings ask,
+// returning its path and the backup row.
+func encryptDump(t *testing.T, s *BackupService, dump []byte, compression string, userSettings *settings.UserSettings) (string, *Backup) {
+	t.Helper()
+	encryption, err := s.newBackupEncryption(userSettings)
+	if err != nil {
+		t.Fatalf("newBackupEncryption: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "backup")
+	opts := artifactOptions{Compression: compression, Encryption: encryption}
+	result, err := runDump(dumpCommand(t, dump), path, opts, nil)
+	if err != nil {
+		t.Fatalf("runDump: %v", err)
+	}
+	if result.UncompressedSize != int64(len(dump)) {
+		t.Errorf("UncompressedSize = %d, dump has %d bytes", result.UncompressedSize, len(dump))
+	}
+
+	backup := &Backup{Compression: compressionOrNone(compression)}
+	setBackupEncryption(backup, encryption)
+	return path, backup
+}
+
+// readArtifact reads a backup's plaintext, returning the first error.
+func readArtifact(s *BackupService, path string, backup *Backup) ([]byte, error) {
+	reader, err := s.openBackupArtifact(path, backup)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	s := newEncryptingService(t, "a1")
+	serverMode := &settings.UserSettings{BackupEncryption: settings.BackupEncryptionServer}
+
+	// age encrypts in 64 KiB chunks
+	const chunk = 64 << 10
+	large := bytes.Repeat([]byte("0123456789abcdef"), (3*chunk+100)/16)
+	tests := []struct {
+		name        string
+		dump        []byte
+		compression string
+	}{
+		{"empty", nil, ""},
+		{"one byte", []byte("x"), ""},
+		{"exactly one chunk", bytes.Repeat([]byte("y"), chunk), ""},
+		{"several chunks", large, ""},
+		{"several chunks with gzip", large, connection.CompressionGzip},
+		{"several chunks with zstd", testDump(), connection.CompressionZstd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, backup := encryptDump(t, s, tt.dump, tt.compression, serverMode)
+			if backup.Encryption != backupEncryptionAge || backup.EncryptionKey == nil {
+				t.Fatalf("backup recorded encryption %q with key %v", backup.Encryption, backup.EncryptionKey)
+			}
+
+			stored, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.dump) > 16 && bytes.Contains(stored, tt.dump[:16]) {
+				t.Error("encrypted backup contains plaintext")
+			}
+
+			restored, err := readArtifact(s, path, backup)
+			if err != nil {
+				t.Fatalf("reading backup: %v", err)
+			}
+			if !bytes.Equal(restored, tt.dump) {
+				t.Errorf("restored %d bytes that differ from the %d byte dump", len(restored), len(tt.dump))
+			}
+		})
+	}
+}
+
+func TestEncryptionAgeRecipients(t *testing.T) {
+	s := newEncryptingService(t, "a1")
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients := "# ops\n" + identity.Recipient().String() + "\n"
+	dump := []byte("backup for the user's own key")
+
+	path, backup := encryptDump(t, s, dump, "", &settings.UserSettings{
+		BackupEncryption:    settings.BackupEncryptionAge,
+		BackupAgeRecipients: &recipients,
+	})
+
+	// The server can still restore it
+	if restored, err := readArtifact(s, path, backup); err != nil || !bytes.Equal(restored, dump) {
+		t.Errorf("server decryption = %q, %v", restored, err)
+	}
+
+	// And so can the user, without Velld
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := age.Decrypt(file, identity)
+	if err != nil {
+		t.Fatalf("decrypting with the user's identity: %v", err)
+	}
+	if restored, err := io.ReadAll(reader); err != nil || !bytes.Equal(restored, dump) {
+		t.Errorf("user decryption = %q, %v", restored, err)
+	}
+
+	// Age mode needs recipients to encrypt to
+	invalid := "not a recipient"
+	for _, userSettings := range []*settings.UserSettings{
+		{BackupEncryption: settings.BackupEncryptionAge},
+		{BackupEncryption: settings.BackupEncryptionAge, BackupAgeRecipients: &invalid},
+		{BackupEncryption: "rot13"},
+	} {
+		if _, err := s.newBackupEncryption(userSettings); err == nil {
+			t.Errorf("newBackupEncryption(%s, %v) succeeded", userSettings.BackupEncryption, userSettings.BackupAgeRecipients)
+		}
+	}
+}
+
+func TestEncryptionDisabled(t *testing.T) {
+	s := newEncryptingService(t, "a1")
+	for _, userSettings := range []*settings.UserSettings{nil, {}, {BackupEncryption: settings.BackupEncryptionNone}} {
+		encryption, err := s.newBackupEncryption(userSettings)
+		if err != nil || encryption != nil {
+			t.Errorf("newBackupEncryption(%v) = %v, %v, want no encryption", userSettings, encryption, err)
+		}
+	}
+}
+
+func TestEncryptionFailures(t *testing.T) {
+	s := newEncryptingService(t, "a1")
+	serverMode := &settings.UserSettings{BackupEncryption: settings.BackupEncryptionServer}
+	// Uncompressed, so the payload spans several chunks
+	dump := bytes.Repeat([]byte("secret rows\n"), 20000)
+	path, backup := encryptDump(t, s, dump, "", serverMode)
+	stored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, other := encryptDump(t, s, []byte("other"), "", serverMode)
+	withKey := func(key *string) *Backup {
+		b := *backup
+		b.EncryptionKey = key
+		return &b
+	}
+	// rewrite stores a changed copy of the backup file
+	rewrite := func(change func([]byte) []byte) string {
+		changed := filepath.Join(t.TempDir(), "changed")
+		if err := os.WriteFile(changed, change(bytes.Clone(stored)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return changed
+	}
+	flip := func(i int) func([]byte) []byte {
+		return func(data []byte) []byte {
+			data[i] ^= 0x01
+			return data
+		}
+	}
+	// The payload follows the header's MAC line: a 16 byte nonce, then
+	// chunks of 64 KiB plus a 16 byte tag
+	header := bytes.Index(stored, []byte("\n--- "))
+	if header < 0 {
+		t.Fatal("no age header in the backup")
+	}
+	payload := header + 1 + bytes.IndexByte(stored[header+1:], '\n') + 1
+	lastChunk := (len(stored) - payload - 16) % (64<<10 + 16)
+
+	tests := []struct {
+		name    string
+		service *BackupService
+		path    string
+		backup  *Backup
+	}{
+		{"another backup's data key", s, path, withKey(other.EncryptionKey)},
+		{"another server key", newEncryptingService(t, "b2"), path, backup},
+		{"no data key", s, path, withKey(nil)},
+		{"truncated to the header", s, rewrite(func(data []byte) []byte { return data[:header+50] }), backup},
+		{"last chunk cut short", s, rewrite(func(data []byte) []byte { return data[:len(data)-10] }), backup},
+		{"last chunk dropped", s, rewrite(func(data []byte) []byte { return data[:len(data)-lastChunk] }), backup},
+		{"tampered header", s, rewrite(flip(20)), backup},
+		{"tampered nonce", s, rewrite(flip(payload)), backup},
+		{"tampered first chunk", s, rewrite(flip(payload + 100)), backup},
+		{"tampered last byte", s, rewrite(flip(len(stored) - 1)), backup},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restored, err := readArtifact(tt.service, tt.path, tt.backup)
+			if err == nil {
+				t.Errorf("read %d bytes without an error", len(restored))
+			}
+		})
+	}
+}
+
+func TestEncryptionFileName(t *testing.T) {
+	encryption := &backupEncryption{}
+	tests := []struct {
+		opts artifactOptions
+		want string
+	}{
+		{artifactOptions{}, "shop_20260101_020000.sql"},
+		{artifactOptions{Compression: connection.CompressionZstd}, "shop_20260101_020000.sql.zst"},
+		{artifactOptions{Encryption: encryption}, "shop_20260101_020000.sql.age"},
+		{artifactOptions{Compression: connection.CompressionGzip, Encryption: encryption}, "shop_20260101_020000.sql.gz.age"},
+	}
+	for _, tt := range tests {
+		if got := backupFileName("shop", "20260101_020000", postgresEngine{}, tt.opts); got != tt.want {
+			t.Errorf("backupFileName(%+v) = %s, want %s", tt.opts, got, tt.want)
+		}
+	}
+}
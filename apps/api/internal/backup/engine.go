@@ -0,0 +1,125 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// Dumper takes backups for a single database engine. Each engine lives in its
+// own engine_<name>.go file and registers itself from init().
+type Dumper interface {
+	// DumpTool is the client binary used to take a backup, e.g. pg_dump.
+	DumpTool() string
+	// FileExtension is appended to backup file names, including the dot.
+	FileExtension() string
+	// DumpCmd builds the command that writes a backup of conn to stdout. The
+	// command must be bound to ctx so cancelling a job kills it. Options the
+	// engine does not support have been rejected by checkDumpOptions.
+	DumpCmd(ctx context.Context, binPath string, conn *connection.StoredConnection, opts DumpOptions) (*exec.Cmd, error)
+}
+
+// Restorer loads a backup produced by the engine's Dumper. Engines that cannot
+// be restored by Velld only implement Dumper.
+type Restorer interface {
+	// RestoreTool is the client binary used to restore a backup, e.g. psql.
+	RestoreTool() string
+	// RestoreCmd builds the command that loads a backup read from stdin into conn.
+	RestoreCmd(binPath string, conn *connection.StoredConnection) (*exec.Cmd, error)
+	// ValidateRestore turns the restore output into an error if the restore failed.
+	ValidateRestore(dbName string, output []byte, cmdErr error) error
+}
+
+// legacyRestorer is implemented by engines whose older backups are not a
+// single stream, so they are restored from their files in place.
+type legacyRestorer interface {
+	// LegacyBackupDir returns the directory holding a backup taken in the
+	// engine's old format, or false when path is in the current format.
+	LegacyBackupDir(path string) (string, bool)
+	// LegacyRestoreCmd builds the command that loads the backup in dir into conn.
+	LegacyRestoreCmd(binPath, dir string, conn *connection.StoredConnection) (*exec.Cmd, error)
+}
+
+// schemaOnlyDumper is implemented by engines whose DumpCmd honours
+// DumpOptions.SchemaOnly.
+type schemaOnlyDumper interface {
+	supportsSchemaOnly()
+}
+
+var engines = map[string]Dumper{}
+
+// registerEngine makes an engine available for the given connection types.
+func registerEngine(engine Dumper, dbTypes ...string) {
+	for _, dbType := range dbTypes {
+		if _, exists := engines[dbType]; exists {
+			panic(fmt.Sprintf("backup engine already registered for %s", dbType))
+		}
+		engines[dbType] = engine
+	}
+}
+
+func getDumper(dbType string) (Dumper, error) {
+	engine, exists := engines[dbType]
+	if !exists {
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+	return engine, nil
+}
+
+func getRestorer(dbType string) (Restorer, error) {
+	engine, exists := engines[dbType]
+	if !exists {
+		return nil, fmt.Errorf("unsupported database type: %s", dbType)
+	}
+
+	restorer, ok := engine.(Restorer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported database type for restore: %s", dbType)
+	}
+	return restorer, nil
+}
+
+// findTool returns the full path of an engine's client binary.
+func findTool(dbType, tool string) (string, error) {
+	binaryPath := common.FindBinaryPath(dbType, tool)
+	if binaryPath == "" {
+		return "", fmt.Errorf("%s not found for %s. Please ensure %s is installed and available in PATH", tool, dbType, tool)
+	}
+
+	return filepath.Join(binaryPath, common.GetPlatformExecutableName(tool)), nil
+}
+
+// checkDumpOptions rejects dump options the engine of dbType cannot honour.
+func checkDumpOptions(dbType string, opts DumpOptions) error {
+	dumper, err := getDumper(dbType)
+	if err != nil {
+		return err
+	}
+	if _, ok := dumper.(schemaOnlyDumper); opts.SchemaOnly && !ok {
+		return fmt.Errorf("schema-only backups are not supported for %s", dbType)
+	}
+	return nil
+}
+
+func createDumpCmd(ctx context.Context, dumper Dumper, conn *connection.StoredConnection, opts DumpOptions) (*exec.Cmd, error) {
+	if err := checkDumpOptions(conn.Type, opts); err != nil {
+		return nil, err
+	}
+	binPath, err := findTool(conn.Type, dumper.DumpTool())
+	if err != nil {
+		return nil, err
+	}
+	return dumper.DumpCmd(ctx, binPath, conn, opts)
+}
+
+func createRestoreCmd(restorer Restorer, conn *connection.StoredConnection) (*exec.Cmd, error) {
+	binPath, err := findTool(conn.Type, restorer.RestoreTool())
+	if err != nil {
+		return nil, err
+	}
+	return restorer.RestoreCmd(binPath, conn)
+}
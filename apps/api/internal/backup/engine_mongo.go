@@ -0,0 +1,111 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+type mongoEngine struct{}
+
+func init() {
+	registerEngine(mongoEngine{}, "mongodb")
+}
+
+func (mongoEngine) DumpTool() string      { return "mongodump" }
+func (mongoEngine) RestoreTool() string   { return "mongorestore" }
+func (mongoEngine) FileExtension() string { return ".archive" }
+
+func (mongoEngine) DumpCmd(ctx context.Context, binPath string, conn *connection.StoredConnection, opts DumpOptions) (*exec.Cmd, error) {
+	// --archive without a file name streams a single archive to stdout
+	args := []string{
+		"--host", conn.Host,
+		"--port", fmt.Sprintf("%d", conn.Port),
+		"--db", conn.DatabaseName,
+		"--archive",
+	}
+
+	if conn.Username != "" {
+		args = append(args, "--username", conn.Username)
+	}
+
+	if conn.Password != "" {
+		args = append(args, "--password", conn.Password)
+	}
+
+	return exec.CommandContext(ctx, binPath, args...), nil
+}
+
+func (mongoEngine) RestoreCmd(binPath string, conn *connection.StoredConnection) (*exec.Cmd, error) {
+	// Archives keep the source database name, so remap every namespace
+	// onto the target database.
+	args := []string{
+		"--host", conn.Host,
+		"--port", fmt.Sprintf("%d", conn.Port),
+		"--archive",
+		"--nsFrom", "$db$.$collection$",
+		"--nsTo", conn.DatabaseName + ".$collection$",
+	}
+
+	if conn.Username != "" {
+		args = append(args, "--username", conn.Username)
+	}
+
+	if conn.Password != "" {
+		args = append(args, "--password", conn.Password)
+	}
+
+	return exec.Command(binPath, args...), nil
+}
+
+// LegacyBackupDir finds the dump of a backup taken before backups were
+// archives. mongodump --out wrote those to <folder>/<database>/ next to the
+// recorded <database>_<timestamp>.sql path.
+func (mongoEngine) LegacyBackupDir(path string) (string, bool) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return path, true
+	}
+	if filepath.Ext(path) != ".sql" {
+		return "", false
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), ".sql")
+	if i := len(name) - len("_20060102_150405"); i > 0 {
+		name = name[:i]
+	}
+	return filepath.Join(filepath.Dir(path), name), true
+}
+
+func (mongoEngine) LegacyRestoreCmd(binPath, dir string, conn *connection.StoredConnection) (*exec.Cmd, error) {
+	args := []string{
+		"--host", conn.Host,
+		"--port", fmt.Sprintf("%d", conn.Port),
+		"--db", conn.DatabaseName,
+	}
+
+	if conn.Username != "" {
+		args = append(args, "--username", conn.Username)
+	}
+
+	if conn.Password != "" {
+		args = append(args, "--password", conn.Password)
+	}
+
+	return exec.Command(binPath, append(args, dir)...), nil
+}
+
+func (mongoEngine) ValidateRestore(dbName string, output []byte, cmdErr error) error {
+	if cmdErr != nil {
+		outputStr := string(output)
+		if outputStr == "" {
+			outputStr = cmdErr.Error()
+		}
+		return fmt.Errorf("restore failed for database '%s': %s", dbName, outputStr)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMongoLegacyBackupDir(t *testing.T) {
+	folder := t.TempDir()
+	dumpDir := filepath.Join(folder, "dump")
+	if err := os.Mkdir(dumpDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		wantDir    string
+		wantLegacy bool
+	}{
+		{"archive", filepath.Join(folder, "shop_20260101_020000.archive"), "", false},
+		{"compressed archive", filepath.Join(folder, "shop_20260101_020000.archive.zst"), "", false},
+		{"encrypted archive", filepath.Join(folder, "shop_20260101_020000.archive.gz.age"), "", false},
+		{"recorded file name", filepath.Join(folder, "shop_20250101_020000.sql"), filepath.Join(folder, "shop"), true},
+		{"underscores in the database name", filepath.Join(folder, "my_shop_20250101_020000.sql"), filepath.Join(folder, "my_shop"), true},
+		{"dump directory", dumpDir, dumpDir, true},
+	}
+	for _, tt := range tests {
+		dir, legacy := mongoEngine{}.LegacyBackupDir(tt.path)
+		if legacy != tt.wantLegacy || dir != tt.wantDir {
+			t.Errorf("%s: LegacyBackupDir(%s) = %q, %v, want %q, %v", tt.name, tt.path, dir, legacy, tt.wantDir, tt.wantLegacy)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// mysqlEngine covers both MySQL and MariaDB, which share client tools.
+type mysqlEngine struct{}
+
+func init() {
+	registerEngine(mysqlEngine{}, "mysql", "mariadb")
+}
+
+func (mysqlEngine) DumpTool() string      { return "mysqldump" }
+func (mysqlEngine) RestoreTool() string   { return "mysql" }
+func (mysqlEngine) FileExtension() string { return ".sql" }
+func (mysqlEngine) supportsSchemaOnly()   {}
+
+func (mysqlEngine) connectionArgs(conn *connection.StoredConnection) []string {
+	args := []string{
+		"-h", conn.Host,
+		"-P", fmt.Sprintf("%d", conn.Port),
+		"-u", conn.Username,
+		fmt.Sprintf("-p%s", conn.Password),
+	}
+
+	if !conn.SSL {
+		args = append(args, "--skip-ssl")
+	} else {
+		args = append(args, "--ssl-mode=REQUIRED")
+	}
+
+	return args
+}
+
+func (e mysqlEngine) DumpCmd(ctx context.Context, binPath string, conn *connection.StoredConnection, opts DumpOptions) (*exec.Cmd, error) {
+	args := e.connectionArgs(conn)
+	if opts.SchemaOnly {
+		args = append(args, "--no-data")
+	}
+	args = append(args, conn.DatabaseName)
+	return exec.CommandContext(ctx, binPath, args...), nil
+}
+
+func (e mysqlEngine) RestoreCmd(binPath string, conn *connection.StoredConnection) (*exec.Cmd, error) {
+	args := append(e.connectionArgs(conn), conn.DatabaseName)
+	return exec.Command(binPath, args...), nil
+}
+
+func (mysqlEngine) ValidateRestore(dbName string, output []byte, cmdErr error) error {
+	if cmdErr != nil {
+		outputStr := string(output)
+		if outputStr == "" {
+			outputStr = cmdErr.Error()
+		}
+		return fmt.Errorf("restore failed for database '%s': %s", dbName, outputStr)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+type postgresEngine struct{}
+
+func init() {
+	registerEngine(postgresEngine{}, "postgresql")
+}
+
+func (postgresEngine) DumpTool() string      { return "pg_dump" }
+func (postgresEngine) RestoreTool() string   { return "psql" }
+func (postgresEngine) FileExtension() string { return ".sql" }
+func (postgresEngine) supportsSchemaOnly()   {}
+
+func (postgresEngine) DumpCmd(ctx context.Context, binPath string, conn *connection.StoredConnection, opts DumpOptions) (*exec.Cmd, error) {
+	args := []string{
+		"-h", conn.Host,
+		"-p", fmt.Sprintf("%d", conn.Port),
+		"-U", conn.Username,
+		"-d", conn.DatabaseName,
+	}
+	if opts.SchemaOnly {
+		args = append(args, "--schema-only")
+	}
+	cmd := exec.CommandContext(ctx, binPath, args...)
+
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
+	return cmd, nil
+}
+
+func (postgresEngine) RestoreCmd(binPath string, conn *connection.StoredConnection) (*exec.Cmd, error) {
+	// Use -v ON_ERROR_STOP=1 to exit immediately on first error
+	// This ensures errors are properly caught
+	cmd := exec.Command(binPath,
+		"-h", conn.Host,
+		"-p", fmt.Sprintf("%d", conn.Port),
+		"-U", conn.Username,
+		"-d", conn.DatabaseName,
+		"-v", "ON_ERROR_STOP=1", // Exit on first error
+	)
+
+	cmd.Env = append(os.Environ(), fmt.Sprintf("PGPASSWORD=%s", conn.Password))
+	return cmd, nil
+}
+
+func (postgresEngine) ValidateRestore(dbName string, output []byte, cmdErr error) error {
+	outputStr := string(output)
+	lines := strings.Split(outputStr, "\n")
+
+	var criticalErrors []string
+
+	for _, line := range lines {
+		if !strings.Contains(line, "ERROR:") {
+			continue
+		}
+
+		if isCriticalPostgreSQLError(line) {
+			criticalErrors = append(criticalErrors, line)
+		}
+	}
+
+	if len(criticalErrors) > 0 {
+		for _, errLine := range criticalErrors {
+			if strings.Contains(errLine, "already exists") {
+				return fmt.Errorf("restore failed: target database must be empty. See documentation for restore best practices.\n\nError details:\n%s", errLine)
+			}
+		}
+		return fmt.Errorf("restore failed with %d error(s):\n%s", len(criticalErrors), strings.Join(criticalErrors, "\n"))
+	}
+
+	if cmdErr != nil {
+		return fmt.Errorf("restore failed: %s", cmdErr.Error())
+	}
+
+	return nil
+}
+
+func isCriticalPostgreSQLError(line string) bool {
+	nonCriticalPatterns := []string{
+		"WARNING:",
+		"must be member of role",
+		"no privileges",
+		"NOTICE:",
+	}
+
+	for _, pattern := range nonCriticalPatterns {
+		if strings.Contains(line, pattern) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,40 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// redisEngine only supports backups; RDB snapshots have to be restored by
+// replacing the server's dump file.
+type redisEngine struct{}
+
+func init() {
+	registerEngine(redisEngine{}, "redis")
+}
+
+func (redisEngine) DumpTool() string      { return "redis-cli" }
+func (redisEngine) FileExtension() string { return ".rdb" }
+
+func (redisEngine) DumpCmd(ctx context.Context, binPath string, conn *connection.StoredConnection, opts DumpOptions) (*exec.Cmd, error) {
+	args := []string{
+		"-h", conn.Host,
+		"-p", fmt.Sprintf("%d", conn.Port),
+	}
+
+	if conn.Password != "" {
+		args = append(args, "-a", conn.Password)
+	}
+
+	if conn.DatabaseName != "" {
+		args = append(args, "-n", conn.DatabaseName)
+	}
+
+	// A file name of "-" makes redis-cli write the RDB payload to stdout
+	args = append(args, "--rdb", "-")
+
+	return exec.CommandContext(ctx, binPath, args...), nil
+}
@@ -0,0 +1,219 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// gcsChunkSize is the chunk size of resumable GCS uploads; each upload
+// buffers one chunk in memory.
+const gcsChunkSize = 16 << 20
+
+type GCSConfig struct {
+	Bucket string
+	// CredentialsJSON is a service account key file. It may be left empty
+	// with an Endpoint, for emulators that do not check credentials.
+	CredentialsJSON string
+	// Endpoint overrides the GCS JSON API, such as
+	// http://127.0.0.1:4443/storage/v1/ for fake-gcs-server.
+	Endpoint string
+}
+
+// GCSStorage keeps objects in a Google Cloud Storage bucket.
+type GCSStorage struct {
+	client *storage.Client
+	bucket *storage.BucketHandle
+}
+
+// serviceAccountKey holds the fields read from a service account key file.
+type serviceAccountKey struct {
+	Type      string `json:"type"`
+	ProjectID string `json:"project_id"`
+}
+
+// parseServiceAccountKey checks credentials are a service account key file.
+func parseServiceAccountKey(credentials string) (*serviceAccountKey, error) {
+	var key serviceAccountKey
+	if err := json.Unmarshal([]byte(credentials), &key); err != nil {
+		return nil, fmt.Errorf("invalid service account JSON: %w", err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("credentials are not a service account key")
+	}
+	return &key, nil
+}
+
+func NewGCSStorage(config GCSConfig) (*GCSStorage, error) {
+	// Downloads use the JSON API like everything else, so a custom Endpoint
+	// serves them too
+	opts := []option.ClientOption{storage.WithJSONReads()}
+	projectID := ""
+	switch {
+	case config.CredentialsJSON != "":
+		key, err := parseServiceAccountKey(config.CredentialsJSON)
+		if err != nil {
+			return nil, err
+		}
+		projectID = key.ProjectID
+		opts = append(opts, option.WithCredentialsJSON([]byte(config.CredentialsJSON)))
+	case config.Endpoint != "":
+		opts = append(opts, option.WithoutAuthentication())
+	default:
+		return nil, fmt.Errorf("no GCS credentials provided (service account JSON required)")
+	}
+	if config.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(config.Endpoint))
+	}
+
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	bucket := client.Bucket(config.Bucket)
+	_, err = bucket.Attrs(ctx)
+	if errors.Is(err, storage.ErrBucketNotExist) {
+		if projectID == "" {
+			client.Close()
+			return nil, fmt.Errorf("bucket %s does not exist", config.Bucket)
+		}
+		err = bucket.Create(ctx, projectID, nil)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("failed to create bucket: %w", err)
+		}
+	} else if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to check bucket existence: %w", err)
+	}
+
+	return &GCSStorage{client: client, bucket: bucket}, nil
+}
+
+// Close releases the GCS client.
+func (s *GCSStorage) Close() error {
+	return s.client.Close()
+}
+
+func (s *GCSStorage) wrapNotFound(err error, key string) error {
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("%w: %s", errStorageNotFound, key)
+	}
+	return err
+}
+
+// Put streams r into a resumable upload, sent in gcsChunkSize chunks. The
+// object only appears once the upload is finalized.
+func (s *GCSStorage) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	// Cancelling the context is the only way to abandon a GCS upload
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := s.bucket.Object(key).NewWriter(ctx)
+	w.ChunkSize = gcsChunkSize
+	w.ContentType = "application/octet-stream"
+	if checksum != "" {
+		w.Metadata = map[string]string{checksumMetadataKey: checksum}
+	}
+
+	written, err := io.Copy(w, r)
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	if err != nil {
+		cancel()
+		w.Close()
+		return fmt.Errorf("failed to upload to GCS: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to upload to GCS: %w", err)
+	}
+	return nil
+}
+
+func (s *GCSStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	reader, err := s.bucket.Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, s.wrapNotFound(err, key)
+	}
+	return reader, nil
+}
+
+func (s *GCSStorage) Delete(ctx context.Context, key string) error {
+	err := s.bucket.Object(key).Delete(ctx)
+	if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+		return fmt.Errorf("failed to delete object from GCS: %w", err)
+	}
+	return nil
+}
+
+func (s *GCSStorage) List(ctx context.Context, prefix string) ([]StorageObject, error) {
+	var objects []StorageObject
+	it := s.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		objects = append(objects, StorageObject{
+			Key:     attrs.Name,
+			Size:    attrs.Size,
+			ModTime: attrs.Updated,
+		})
+	}
+	return objects, nil
+}
+
+// Stat returns an object's size and the sha256 metadata stored with it,
+// which is empty for objects uploaded without a checksum.
+func (s *GCSStorage) Stat(ctx context.Context, key string) (*StorageObject, error) {
+	attrs, err := s.bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, s.wrapNotFound(err, key)
+	}
+
+	object := &StorageObject{Key: key, Size: attrs.Size, ModTime: attrs.Updated}
+	for k, value := range attrs.Metadata {
+		if strings.EqualFold(k, checksumMetadataKey) {
+			object.Checksum = value
+		}
+	}
+	return object, nil
+}
+
+// SetChecksum adds the checksum of an object uploaded without one, such as
+// a streamed dump, to its metadata.
+func (s *GCSStorage) SetChecksum(ctx context.Context, key, checksum string) error {
+	_, err := s.bucket.Object(key).Update(ctx, storage.ObjectAttrsToUpdate{
+		Metadata: map[string]string{checksumMetadataKey: checksum},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set object checksum: %w", s.wrapNotFound(err, key))
+	}
+	return nil
+}
+
+// Move copies an object within the bucket and deletes the original. Large
+// objects are copied in several rewrite calls by the client.
+func (s *GCSStorage) Move(ctx context.Context, oldKey, newKey string) error {
+	src := s.bucket.Object(oldKey)
+	if _, err := s.bucket.Object(newKey).CopierFrom(src).Run(ctx); err != nil {
+		return fmt.Errorf("failed to copy object: %w", s.wrapNotFound(err, oldKey))
+	}
+	if err := s.Delete(ctx, oldKey); err != nil {
+		return fmt.Errorf("failed to delete old object: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+	"google.golang.org/api/option"
+)
+
+// newFakeGCSStorage connects to the fake-gcs-server JSON API at
+// VELLD_TEST_GCS_ENDPOINT, such as http://127.0.0.1:4443/storage/v1/,
+// skipping the test when it is not set; docker-compose.test.yml starts
+// one. Without credentials the storage does not create its bucket, so it
+// is created here.
+func newFakeGCSStorage(t *testing.T) *GCSStorage {
+	t.Helper()
+	endpoint := os.Getenv("VELLD_TEST_GCS_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("VELLD_TEST_GCS_ENDPOINT is not set")
+	}
+
+	ctx := context.Background()
+	bucket := "velld-test-" + uuid.NewString()
+	client, err := storage.NewClient(ctx, option.WithoutAuthentication(), option.WithEndpoint(endpoint))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.Bucket(bucket).Create(ctx, "velld-test", nil); err != nil {
+		t.Fatalf("creating bucket %s: %v", bucket, err)
+	}
+
+	gcs, err := NewGCSStorage(GCSConfig{Bucket: bucket, Endpoint: endpoint})
+	if err != nil {
+		t.Fatalf("NewGCSStorage: %v", err)
+	}
+	t.Cleanup(func() { gcs.Close() })
+	return gcs
+}
+
+func TestGCSStorage(t *testing.T) {
+	gcs := newFakeGCSStorage(t)
+
+	// More than one chunk, so the resumable upload sends several
+	data := bytes.Repeat([]byte("0123456789abcdef"), gcsChunkSize/16+4096)
+	testStorage(t, gcs, "backups", data)
+}
+
+func TestGCSStorageChecksum(t *testing.T) {
+	gcs := newFakeGCSStorage(t)
+	ctx := context.Background()
+
+	key := storageKey("backups", "conn-1", "db.sql.gz")
+	checksum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if err := gcs.Put(ctx, key, bytes.NewReader([]byte("test")), 4, checksum); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	info, err := gcs.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Checksum != checksum || info.Size != 4 {
+		t.Errorf("Stat = %d bytes with checksum %q, want 4 bytes with %q", info.Size, info.Checksum, checksum)
+	}
+
+	// A streamed object is given its checksum once the stream ends
+	streamed := storageKey("backups", "conn-1", "streamed.sql.gz")
+	if err := gcs.Put(ctx, streamed, bytes.NewReader([]byte("test")), -1, ""); err != nil {
+		t.Fatalf("Put of unknown size: %v", err)
+	}
+	if err := gcs.SetChecksum(ctx, streamed, checksum); err != nil {
+		t.Fatalf("SetChecksum: %v", err)
+	}
+	if info, err := gcs.Stat(ctx, streamed); err != nil || info.Checksum != checksum || info.Size != 4 {
+		t.Errorf("Stat of streamed object = %v, %v, want 4 bytes with checksum %q", info, err, checksum)
+	}
+
+	// The checksum travels with a renamed object
+	moved := storageKey("backups", "conn-1", "renamed.sql.gz")
+	if err := gcs.Move(ctx, key, moved); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if info, err := gcs.Stat(ctx, moved); err != nil || info.Checksum != checksum {
+		t.Errorf("Stat of renamed object = %v, %v, want checksum %q", info, err, checksum)
+	}
+}
@@ -0,0 +1,215 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	integrityUnknown   = "unknown"
+	integrityOK        = "ok"
+	integrityCorrupted = "corrupted"
+
+	// integritySweepSchedule runs the background verification daily at 04:00.
+	integritySweepSchedule = "0 0 4 * * *"
+	// integritySweepInterval is how long a verification result is trusted
+	// before the sweep checks the backup again.
+	integritySweepInterval = 7 * 24 * time.Hour
+	// integritySweepBatch caps how many backups a single sweep re-reads.
+	integritySweepBatch = 50
+)
+
+func integrityStatusOrUnknown(status string) string {
+	if status == "" {
+		return integrityUnknown
+	}
+	return status
+}
+
+// hashReader returns the hex SHA-256 of everything read from r and its size.
+func hashReader(r io.Reader) (string, int64, error) {
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	return hashReader(file)
+}
+
+// VerifyBackup re-reads every stored copy of a backup, compares it against
+// the checksum recorded when it was taken and saves the outcome.
+func (s *BackupService) VerifyBackup(backupID string, userID uuid.UUID) (*BackupVerification, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify backup ownership: %v", err)
+	}
+	if conn.UserID != userID {
+		return nil, errUnauthorized
+	}
+
+	if backup.Status != backupCompleted {
+		return nil, fmt.Errorf("backup is %s and cannot be verified", backup.Status)
+	}
+
+	return s.verifyBackup(backup, conn.UserID)
+}
+
+func (s *BackupService) verifyBackup(backup *Backup, ownerID uuid.UUID) (*BackupVerification, error) {
+	expected := ""
+	if backup.Checksum != nil {
+		expected = *backup.Checksum
+	}
+
+	var locations []LocationVerification
+	// corrupted is set when a copy is missing or differs from the checksum;
+	// inconclusive when a copy could not be read for reasons that say nothing
+	// about its contents, such as S3 being unreachable.
+	corrupted, inconclusive := false, false
+
+	copies, err := s.backupRepo.GetBackupCopies(backup.ID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup copies: %v", err)
+	}
+	hasStoredCopy := false
+	for _, copy := range copies {
+		if copy.Status == copyUploaded && copy.ObjectKey != nil {
+			hasStoredCopy = true
+		}
+	}
+
+	if _, err := os.Stat(backup.Path); err == nil {
+		location := LocationVerification{Location: "local", Path: backup.Path}
+		checksum, size, err := hashFile(backup.Path)
+		if err != nil {
+			location.Error = fmt.Sprintf("failed to read file: %v", err)
+			inconclusive = true
+		} else {
+			location.Checksum = checksum
+			location.Size = size
+			location.Match = size == backup.Size && (expected == "" || checksum == expected)
+			corrupted = corrupted || !location.Match
+		}
+		locations = append(locations, location)
+	} else if !hasStoredCopy {
+		// Without an offsite copy the local file is the only one, so its
+		// absence means the backup is gone.
+		locations = append(locations, LocationVerification{
+			Location: "local",
+			Path:     backup.Path,
+			Error:    "file not found",
+		})
+		corrupted = true
+	}
+
+	for _, copy := range copies {
+		if copy.Status != copyUploaded || copy.ObjectKey == nil {
+			continue
+		}
+		location := LocationVerification{Location: copy.DestinationName, Path: *copy.ObjectKey}
+		d, err := s.destinationByID(ownerID, copy.DestinationID)
+		if err != nil {
+			location.Error = err.Error()
+			inconclusive = true
+		} else {
+			checksum, size, err := hashObject(context.Background(), d.storage, *copy.ObjectKey)
+			d.close()
+			switch {
+			case errors.Is(err, errStorageNotFound):
+				location.Error = "object not found"
+				corrupted = true
+			case err != nil:
+				location.Error = err.Error()
+				inconclusive = true
+			default:
+				location.Checksum = checksum
+				location.Size = size
+				location.Match = size == backup.Size && (expected == "" || checksum == expected)
+				corrupted = corrupted || !location.Match
+			}
+		}
+		locations = append(locations, location)
+	}
+
+	status := integrityOK
+	switch {
+	case corrupted:
+		status = integrityCorrupted
+	case inconclusive || expected == "":
+		status = integrityUnknown
+	}
+
+	verifiedAt := time.Now()
+	if err := s.backupRepo.UpdateBackupIntegrity(backup.ID.String(), status, verifiedAt); err != nil {
+		return nil, fmt.Errorf("failed to save verification result: %v", err)
+	}
+
+	return &BackupVerification{
+		BackupID:        backup.ID,
+		Checksum:        backup.Checksum,
+		IntegrityStatus: status,
+		Locations:       locations,
+		VerifiedAt:      verifiedAt,
+	}, nil
+}
+
+// runIntegritySweep verifies backups that have not been checked recently and
+// notifies owners of backups that newly fail verification.
+func (s *BackupService) runIntegritySweep() {
+	backups, err := s.backupRepo.GetBackupsDueForVerification(time.Now().Add(-integritySweepInterval), integritySweepBatch)
+	if err != nil {
+		fmt.Printf("Error fetching backups for integrity sweep: %v\n", err)
+		return
+	}
+
+	corrupted := 0
+	for _, backup := range backups {
+		conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+		if err != nil {
+			fmt.Printf("Warning: Skipping integrity check of backup %s: %v\n", backup.ID, err)
+			continue
+		}
+
+		verification, err := s.verifyBackup(backup, conn.UserID)
+		if err != nil {
+			fmt.Printf("Warning: Failed to verify backup %s: %v\n", backup.ID, err)
+			continue
+		}
+
+		if verification.IntegrityStatus != integrityCorrupted {
+			continue
+		}
+		corrupted++
+
+		// Only alert on the transition so a known-bad backup is not
+		// reported again every week.
+		if backup.IntegrityStatus != integrityCorrupted {
+			if err := s.createCorruptionNotification(backup, verification); err != nil {
+				fmt.Printf("Warning: Failed to notify about corrupted backup %s: %v\n", backup.ID, err)
+			}
+		}
+	}
+
+	fmt.Printf("Integrity sweep completed: verified %d backups, %d corrupted\n", len(backups), corrupted)
+}
@@ -0,0 +1,342 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+	jobSkipped   = "skipped"
+
+	// jobProgressInterval is how often a running job's byte count is saved.
+	jobProgressInterval = 2 * time.Second
+	// jobLogPageSize caps the log lines returned by one request.
+	jobLogPageSize = 500
+)
+
+var (
+	errBackupCancelled = errors.New("backup cancelled")
+	errJobFinished     = errors.New("job has already finished")
+)
+
+// activeJob is the in-memory side of a job that has not finished yet.
+type activeJob struct {
+	mu           sync.Mutex
+	job          *BackupJob
+	connectionID string
+	host         string
+	// schedule is the schedule the job runs for, nil for manual backups
+	schedule *BackupSchedule
+	// dispatched is set by the queue, under its lock, once the job has been
+	// given a slot.
+	dispatched bool
+	ctx        context.Context
+	cancel     context.CancelFunc
+	progress   *dumpProgress
+	logger     *jobLogWriter
+	// done is closed once the job has finished; backup and err hold its
+	// outcome from then on.
+	done   chan struct{}
+	backup *Backup
+	err    error
+}
+
+// failUnfinishedJobs fails jobs orphaned by a previous process, whose
+// queue no longer exists.
+func (s *BackupService) failUnfinishedJobs() {
+	if n, err := s.backupRepo.FailUnfinishedBackupJobs("interrupted by server restart"); err != nil {
+		fmt.Printf("Error failing unfinished backup jobs: %v\n", err)
+	} else if n > 0 {
+		fmt.Printf("Marked %d unfinished backup jobs as failed\n", n)
+	}
+}
+
+// EnqueueBackup queues a manual backup of a connection and returns its job
+// without waiting for it to run.
+func (s *BackupService) EnqueueBackup(connectionID string) (*BackupJob, error) {
+	a, err := s.enqueueBackup(connectionID, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	return a.snapshot(), nil
+}
+
+// enqueueBackup queues a backup, for schedule if it is not nil. With
+// exclusive set it fails with errScheduleBusy instead of waiting behind
+// another job of the same schedule; the refused job is kept as skipped.
+func (s *BackupService) enqueueBackup(connectionID string, schedule *BackupSchedule, exclusive bool) (*activeJob, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %v", err)
+	}
+
+	scheduleID, _ := scheduleDump(schedule)
+	job := &BackupJob{
+		ID:           uuid.New(),
+		ConnectionID: connectionID,
+		ScheduleID:   scheduleID,
+		UserID:       conn.UserID,
+		Status:       jobQueued,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := s.backupRepo.CreateBackupJob(job); err != nil {
+		return nil, fmt.Errorf("failed to save backup job: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	logger := &jobLogWriter{repo: s.backupRepo, jobID: job.ID.String()}
+	a := &activeJob{
+		job:          job,
+		connectionID: connectionID,
+		host:         hostKey(conn),
+		schedule:     schedule,
+		ctx:          ctx,
+		cancel:       cancel,
+		progress:     &dumpProgress{Log: logger},
+		logger:       logger,
+		done:         make(chan struct{}),
+	}
+
+	// Mark the schedule before the job can start so a quick start is not
+	// overwritten by a late "queued"
+	if scheduleID != nil {
+		s.recordScheduleRunStatus(*scheduleID, jobQueued)
+	}
+
+	started, err := s.jobs.add(a, exclusive)
+	if err != nil {
+		cancel()
+		status := jobFailed
+		if errors.Is(err, errScheduleBusy) {
+			status = jobSkipped
+		}
+		a.progress.logf("Backup not started: %v", err)
+		a.finish(s.backupRepo, status, nil, err)
+		return nil, err
+	}
+
+	if !started {
+		a.progress.logf("Waiting for a free backup slot")
+	}
+	return a, nil
+}
+
+func (s *BackupService) runJob(a *activeJob) {
+	defer s.jobs.release(a)
+	defer a.cancel()
+
+	a.mu.Lock()
+	if a.job.Status != jobQueued {
+		// Cancelled just as it was given a slot
+		a.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	a.job.Status = jobRunning
+	a.job.StartedAt = &now
+	if err := s.backupRepo.UpdateBackupJob(a.job); err != nil {
+		fmt.Printf("Error updating backup job %s: %v\n", a.job.ID, err)
+	}
+	a.mu.Unlock()
+
+	if a.job.ScheduleID != nil {
+		s.recordScheduleRunStatus(*a.job.ScheduleID, jobRunning)
+	}
+
+	a.progress.logf("Starting backup of connection %s", a.job.ConnectionID)
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.backupRepo.UpdateBackupJobProgress(a.job.ID.String(), a.progress.bytesWritten()); err != nil {
+					fmt.Printf("Error saving progress of backup job %s: %v\n", a.job.ID, err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	backup, err := s.createBackup(a.ctx, a.job.ConnectionID, a.schedule, a.progress)
+	close(stop)
+
+	switch {
+	case errors.Is(err, errBackupCancelled):
+		a.progress.logf("Backup cancelled")
+		a.finish(s.backupRepo, jobCancelled, nil, err)
+	case err != nil:
+		a.progress.logf("Backup failed: %v", err)
+		a.finish(s.backupRepo, jobFailed, nil, err)
+	default:
+		a.progress.logf("Backup completed: %d bytes written", backup.Size)
+		a.finish(s.backupRepo, jobCompleted, backup, nil)
+	}
+}
+
+// finish records the outcome of a job and wakes anyone waiting on it.
+func (a *activeJob) finish(repo *BackupRepository, status string, backup *Backup, err error) {
+	a.logger.Flush()
+
+	a.mu.Lock()
+	now := time.Now()
+	a.job.Status = status
+	a.job.FinishedAt = &now
+	a.job.BytesWritten = a.progress.bytesWritten()
+	if backup != nil {
+		backupID := backup.ID.String()
+		a.job.BackupID = &backupID
+	}
+	if err != nil {
+		msg := err.Error()
+		a.job.Error = &msg
+	}
+	if updateErr := repo.UpdateBackupJob(a.job); updateErr != nil {
+		fmt.Printf("Error updating backup job %s: %v\n", a.job.ID, updateErr)
+	}
+	a.backup = backup
+	a.err = err
+	a.mu.Unlock()
+
+	close(a.done)
+}
+
+// snapshot returns a copy of the job with live progress filled in.
+func (a *activeJob) snapshot() *BackupJob {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	job := *a.job
+	if job.Status == jobRunning {
+		job.BytesWritten = a.progress.bytesWritten()
+	}
+	return &job
+}
+
+func (s *BackupService) getOwnedJob(jobID string, userID uuid.UUID) (*BackupJob, error) {
+	job, err := s.backupRepo.GetBackupJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, errUnauthorized
+	}
+	return job, nil
+}
+
+// GetJob returns a job with its live progress and elapsed time.
+func (s *BackupService) GetJob(jobID string, userID uuid.UUID) (*BackupJob, error) {
+	job, err := s.getOwnedJob(jobID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if a, ok := s.jobs.get(jobID); ok {
+		job = a.snapshot()
+	}
+
+	if job.StartedAt != nil {
+		end := time.Now()
+		if job.FinishedAt != nil {
+			end = *job.FinishedAt
+		}
+		job.ElapsedSeconds = end.Sub(*job.StartedAt).Seconds()
+	}
+
+	return job, nil
+}
+
+// GetJobLogs returns the log lines of a job written after afterID.
+func (s *BackupService) GetJobLogs(jobID string, userID uuid.UUID, afterID int64) ([]*BackupJobLog, error) {
+	if _, err := s.getOwnedJob(jobID, userID); err != nil {
+		return nil, err
+	}
+	return s.backupRepo.GetBackupJobLogs(jobID, afterID, jobLogPageSize)
+}
+
+// CancelJob stops a queued or running job. A running dump is killed and its
+// backup recorded as cancelled.
+func (s *BackupService) CancelJob(jobID string, userID uuid.UUID) (*BackupJob, error) {
+	job, err := s.getOwnedJob(jobID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	a, ok := s.jobs.get(jobID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errJobFinished, job.Status)
+	}
+
+	// Claim a queued job under the lock so runJob cannot start it at the
+	// same time; if it was already given a slot runJob skips it and frees
+	// the slot.
+	a.mu.Lock()
+	queued := a.job.Status == jobQueued
+	if queued {
+		a.job.Status = jobCancelled
+	}
+	a.mu.Unlock()
+
+	a.cancel()
+	if queued {
+		s.jobs.drop(a)
+		a.finish(s.backupRepo, jobCancelled, nil, errBackupCancelled)
+	}
+
+	return a.snapshot(), nil
+}
+
+// jobLogWriter saves everything written to it as job log lines.
+type jobLogWriter struct {
+	repo  *BackupRepository
+	jobID string
+	mu    sync.Mutex
+	buf   strings.Builder
+}
+
+func (w *jobLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, b := range p {
+		// Tools that redraw progress use \r, treat it as a line break too
+		if b == '\n' || b == '\r' {
+			w.flushLocked()
+			continue
+		}
+		w.buf.WriteByte(b)
+	}
+	return len(p), nil
+}
+
+// Flush saves a trailing line that was not terminated by a newline.
+func (w *jobLogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushLocked()
+}
+
+func (w *jobLogWriter) flushLocked() {
+	line := strings.TrimSpace(w.buf.String())
+	w.buf.Reset()
+	if line == "" {
+		return
+	}
+	if err := w.repo.AppendBackupJobLog(w.jobID, line); err != nil {
+		fmt.Printf("Error saving log of backup job %s: %v\n", w.jobID, err)
+	}
+}
@@ -0,0 +1,180 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+const (
+	defaultMaxConcurrentBackups        = 2
+	defaultMaxConcurrentBackupsPerHost = 1
+
+	// jobQueueSize is how many jobs can wait for a slot before new ones are
+	// rejected.
+	jobQueueSize = 256
+)
+
+var (
+	errQueueFull    = errors.New("backup queue is full, try again later")
+	errScheduleBusy = errors.New("a backup of this schedule is already queued or running")
+)
+
+// concurrencyLimits bounds how many backups run at the same time, overall
+// and against a single database host.
+type concurrencyLimits struct {
+	Global  int
+	PerHost int
+}
+
+// concurrencyLimitsFromEnv reads BACKUP_MAX_CONCURRENT and
+// BACKUP_MAX_CONCURRENT_PER_HOST, falling back to the defaults.
+func concurrencyLimitsFromEnv() concurrencyLimits {
+	return concurrencyLimits{
+		Global:  positiveIntFromEnv("BACKUP_MAX_CONCURRENT", defaultMaxConcurrentBackups),
+		PerHost: positiveIntFromEnv("BACKUP_MAX_CONCURRENT_PER_HOST", defaultMaxConcurrentBackupsPerHost),
+	}
+}
+
+func positiveIntFromEnv(envVar string, defaultValue int) int {
+	value := strings.TrimSpace(os.Getenv(envVar))
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		fmt.Printf("Warning: Invalid %s %q, using %d\n", envVar, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// hostKey identifies the database server a connection talks to. Connections
+// behind different SSH bastions are different hosts even if both point at
+// localhost.
+func hostKey(conn *connection.StoredConnection) string {
+	host := strings.ToLower(conn.Host)
+	if conn.SSHEnabled {
+		return strings.ToLower(conn.SSHHost) + "/" + host
+	}
+	return host
+}
+
+// jobQueue holds the jobs waiting for or running on a slot. Jobs start in
+// the order they were queued unless the global limit, their host's limit or
+// another job of the same connection holds them back.
+type jobQueue struct {
+	mu           sync.Mutex
+	limits       concurrencyLimits
+	active       map[string]*activeJob // queued and running jobs by ID
+	pending      []*activeJob
+	running      int
+	runningHosts map[string]int
+	runningConns map[string]bool
+	run          func(*activeJob)
+}
+
+func newJobQueue(limits concurrencyLimits, run func(*activeJob)) *jobQueue {
+	return &jobQueue{
+		limits:       limits,
+		active:       make(map[string]*activeJob),
+		runningHosts: make(map[string]int),
+		runningConns: make(map[string]bool),
+		run:          run,
+	}
+}
+
+// add queues a job and starts it if a slot is free, reporting whether it
+// started. With exclusive set the job is refused with errScheduleBusy when
+// its schedule already has a job queued or running; jobs of other schedules
+// of the connection are waited for like any other.
+func (q *jobQueue) add(a *activeJob, exclusive bool) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if exclusive && a.job.ScheduleID != nil {
+		for _, other := range q.active {
+			if other.job.ScheduleID != nil && *other.job.ScheduleID == *a.job.ScheduleID {
+				return false, errScheduleBusy
+			}
+		}
+	}
+	if len(q.pending) >= jobQueueSize {
+		return false, errQueueFull
+	}
+
+	q.active[a.job.ID.String()] = a
+	q.pending = append(q.pending, a)
+	q.dispatchLocked()
+	return a.dispatched, nil
+}
+
+func (q *jobQueue) get(jobID string) (*activeJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	a, ok := q.active[jobID]
+	return a, ok
+}
+
+// drop removes a job that has not started, such as one cancelled while
+// queued. It reports false if the job was already dispatched.
+func (q *jobQueue) drop(a *activeJob) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if a.dispatched {
+		return false
+	}
+	for i, pending := range q.pending {
+		if pending == a {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			break
+		}
+	}
+	delete(q.active, a.job.ID.String())
+	return true
+}
+
+// release frees the slot of a finished job and starts whatever it was
+// holding back.
+func (q *jobQueue) release(a *activeJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.active, a.job.ID.String())
+	q.running--
+	q.runningHosts[a.host]--
+	if q.runningHosts[a.host] <= 0 {
+		delete(q.runningHosts, a.host)
+	}
+	delete(q.runningConns, a.connectionID)
+	q.dispatchLocked()
+}
+
+func (q *jobQueue) dispatchLocked() {
+	remaining := q.pending[:0]
+	for _, a := range q.pending {
+		if q.running >= q.limits.Global ||
+			q.runningHosts[a.host] >= q.limits.PerHost ||
+			q.runningConns[a.connectionID] {
+			remaining = append(remaining, a)
+			continue
+		}
+
+		q.running++
+		q.runningHosts[a.host]++
+		q.runningConns[a.connectionID] = true
+		a.dispatched = true
+		go q.run(a)
+	}
+	// Clear the tail so dispatched jobs are not kept alive by the array
+	for i := len(remaining); i < len(q.pending); i++ {
+		q.pending[i] = nil
+	}
+	q.pending = remaining
+}
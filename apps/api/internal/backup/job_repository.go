@@ -0,0 +1,158 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+)
+
+func formatNullableTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	str := t.Format(time.RFC3339)
+	return &str
+}
+
+func (r *BackupRepository) CreateBackupJob(job *BackupJob) error {
+	now := time.Now().Format(time.RFC3339)
+	_, err := r.db.Exec(`
+		INSERT INTO backup_jobs (
+			id, connection_id, schedule_id, user_id, status, backup_id,
+			bytes_written, error, started_at, finished_at, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		job.ID, job.ConnectionID, job.ScheduleID, job.UserID.String(), job.Status, job.BackupID,
+		job.BytesWritten, job.Error, formatNullableTime(job.StartedAt), formatNullableTime(job.FinishedAt),
+		now, now)
+	return err
+}
+
+func (r *BackupRepository) UpdateBackupJob(job *BackupJob) error {
+	_, err := r.db.Exec(`
+		UPDATE backup_jobs
+		SET status = $1, backup_id = $2, bytes_written = $3, error = $4,
+		    started_at = $5, finished_at = $6, updated_at = $7
+		WHERE id = $8`,
+		job.Status, job.BackupID, job.BytesWritten, job.Error,
+		formatNullableTime(job.StartedAt), formatNullableTime(job.FinishedAt),
+		time.Now().Format(time.RFC3339), job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update backup job: %v", err)
+	}
+	return nil
+}
+
+func (r *BackupRepository) UpdateBackupJobProgress(jobID string, bytesWritten int64) error {
+	_, err := r.db.Exec(`
+		UPDATE backup_jobs SET bytes_written = $1, updated_at = $2 WHERE id = $3`,
+		bytesWritten, time.Now().Format(time.RFC3339), jobID)
+	return err
+}
+
+func (r *BackupRepository) GetBackupJob(id string) (*BackupJob, error) {
+	var (
+		startedAtStr  sql.NullString
+		finishedAtStr sql.NullString
+		createdAtStr  string
+		updatedAtStr  string
+	)
+	job := &BackupJob{}
+	err := r.db.QueryRow(`
+		SELECT id, connection_id, schedule_id, user_id, status, backup_id,
+		       COALESCE(bytes_written, 0), error, started_at, finished_at,
+		       created_at, updated_at
+		FROM backup_jobs WHERE id = $1`, id).Scan(
+		&job.ID, &job.ConnectionID, &job.ScheduleID, &job.UserID, &job.Status, &job.BackupID,
+		&job.BytesWritten, &job.Error, &startedAtStr, &finishedAtStr,
+		&createdAtStr, &updatedAtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if startedAtStr.Valid {
+		startedAt, err := common.ParseTime(startedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing started_at: %v", err)
+		}
+		job.StartedAt = &startedAt
+	}
+
+	if finishedAtStr.Valid {
+		finishedAt, err := common.ParseTime(finishedAtStr.String)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing finished_at: %v", err)
+		}
+		job.FinishedAt = &finishedAt
+	}
+
+	createdAt, err := common.ParseTime(createdAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing created_at: %v", err)
+	}
+	job.CreatedAt = createdAt
+
+	updatedAt, err := common.ParseTime(updatedAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing updated_at: %v", err)
+	}
+	job.UpdatedAt = updatedAt
+
+	return job, nil
+}
+
+// FailUnfinishedBackupJobs marks jobs left queued or running by a previous
+// process as failed, since their workers no longer exist.
+func (r *BackupRepository) FailUnfinishedBackupJobs(reason string) (int64, error) {
+	now := time.Now().Format(time.RFC3339)
+	result, err := r.db.Exec(`
+		UPDATE backup_jobs
+		SET status = 'failed', error = $1, finished_at = $2, updated_at = $2
+		WHERE status IN ('queued', 'running')`,
+		reason, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *BackupRepository) AppendBackupJobLog(jobID string, line string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO backup_job_logs (job_id, line, created_at) VALUES ($1, $2, $3)`,
+		jobID, line, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// GetBackupJobLogs returns up to limit log lines of a job with an ID greater
+// than afterID, oldest first.
+func (r *BackupRepository) GetBackupJobLogs(jobID string, afterID int64, limit int) ([]*BackupJobLog, error) {
+	rows, err := r.db.Query(`
+		SELECT id, job_id, line, created_at
+		FROM backup_job_logs
+		WHERE job_id = $1 AND id > $2
+		ORDER BY id ASC
+		LIMIT $3`,
+		jobID, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []*BackupJobLog{}
+	for rows.Next() {
+		var createdAtStr string
+		entry := &BackupJobLog{}
+		if err := rows.Scan(&entry.ID, &entry.JobID, &entry.Line, &createdAtStr); err != nil {
+			return nil, err
+		}
+		createdAt, err := common.ParseTime(createdAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing created_at: %v", err)
+		}
+		entry.CreatedAt = createdAt
+		logs = append(logs, entry)
+	}
+
+	return logs, rows.Err()
+}
@@ -0,0 +1,223 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage keeps objects as files under a root directory, such as a
+// mounted NAS share.
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage opens storage at root, which must lie within one of
+// allowedRoots once symlinks are followed.
+func NewLocalStorage(root string, allowedRoots []string) (*LocalStorage, error) {
+	root, err := checkLocalStoragePath(root, allowedRoots)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &LocalStorage{root: root}, nil
+}
+
+// localStorageRootsFromEnv reads LOCAL_STORAGE_ROOTS, the comma-separated
+// directories local destinations may keep backups under. Without it local
+// destinations are refused.
+func localStorageRootsFromEnv() []string {
+	var roots []string
+	for _, root := range strings.Split(os.Getenv("LOCAL_STORAGE_ROOTS"), ",") {
+		if root = strings.TrimSpace(root); root != "" {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// checkLocalStoragePath resolves path and checks it lies within one of
+// roots, returning the resolved path.
+func checkLocalStoragePath(path string, roots []string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if len(roots) == 0 {
+		return "", fmt.Errorf("local destinations are disabled, set LOCAL_STORAGE_ROOTS to allow them")
+	}
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid path: %w", err)
+	}
+	for _, root := range roots {
+		resolvedRoot, err := resolvePath(root)
+		if err != nil {
+			fmt.Printf("Warning: Invalid LOCAL_STORAGE_ROOTS entry %q: %v\n", root, err)
+			continue
+		}
+		rel, err := filepath.Rel(resolvedRoot, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("path %s is not within LOCAL_STORAGE_ROOTS", path)
+}
+
+// resolvePath makes path absolute and clean and follows the symlinks in the
+// part of it that exists, so a path that does not exist yet resolves to
+// where it would be created.
+func resolvePath(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	existing, rest := path, ""
+	for {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		parent := filepath.Dir(existing)
+		if !errors.Is(err, fs.ErrNotExist) || parent == existing {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(existing), rest)
+		existing = parent
+	}
+}
+
+// path resolves a key to a file under the root, refusing keys that would
+// escape it.
+func (s *LocalStorage) path(key string) (string, error) {
+	p := filepath.Join(s.root, filepath.FromSlash(key))
+	if p != s.root && !strings.HasPrefix(p, s.root+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return p, nil
+}
+
+func (s *LocalStorage) wrapNotFound(err error, key string) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", errStorageNotFound, key)
+	}
+	return err
+}
+
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Write to a temporary name so a partial file never shows up under key
+	tmp := p + ".partial"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	written, err := io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return os.Rename(tmp, p)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, s.wrapNotFound(err, key)
+	}
+	return file, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]StorageObject, error) {
+	var objects []StorageObject
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, ".partial") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, StorageObject{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	return objects, nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (*StorageObject, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, s.wrapNotFound(err, key)
+	}
+	return &StorageObject{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalStorage) Move(ctx context.Context, oldKey, newKey string) error {
+	oldPath, err := s.path(oldKey)
+	if err != nil {
+		return err
+	}
+	newPath, err := s.path(newKey)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return s.wrapNotFound(err, oldKey)
+	}
+	return nil
+}
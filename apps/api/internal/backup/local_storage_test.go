@@ -0,0 +1,76 @@
+package backup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorage(t *testing.T) {
+	root := t.TempDir()
+	storage, err := NewLocalStorage(filepath.Join(root, "nas"), []string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, storage, "velld", bytes.Repeat([]byte("backup data "), 100000))
+}
+
+func TestCheckLocalStoragePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	// A root given through a symlink allows the directory it points to
+	linkedRoot := filepath.Join(t.TempDir(), "linked")
+	if err := os.Symlink(root, linkedRoot); err != nil {
+		t.Fatal(err)
+	}
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		roots []string
+		want  string // empty when the path is refused
+	}{
+		{"no roots", filepath.Join(root, "nas"), nil, ""},
+		{"root itself", root, []string{root}, resolvedRoot},
+		{"new directory under the root", filepath.Join(root, "a", "b"), []string{root}, filepath.Join(resolvedRoot, "a", "b")},
+		{"second root", filepath.Join(root, "nas"), []string{outside, root}, filepath.Join(resolvedRoot, "nas")},
+		{"outside the root", filepath.Join(outside, "nas"), []string{root}, ""},
+		{"parent of the root", filepath.Dir(root), []string{root}, ""},
+		{"dot-dot out of the root", root + "/../" + filepath.Base(outside), []string{root}, ""},
+		{"symlink out of the root", filepath.Join(root, "escape", "nas"), []string{root}, ""},
+		{"root given through a symlink", filepath.Join(root, "nas"), []string{linkedRoot}, filepath.Join(resolvedRoot, "nas")},
+		{"sibling sharing the root's prefix", root + "-other", []string{root}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkLocalStoragePath(tt.path, tt.roots)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("allowed %s as %s", tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("resolved to %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewLocalStorage(filepath.Join(root, "escape", "nas"), []string{root}); err == nil {
+		t.Error("opened storage through a symlink out of the root")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "nas")); err == nil {
+		t.Error("created a directory outside the root")
+	}
+}
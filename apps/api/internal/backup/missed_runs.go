@@ -0,0 +1,145 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Missed run policies say what a schedule does on startup about the runs
+// it missed while the server was down. Every missed run is recorded in the
+// schedule's run history either way.
+const (
+	// missedRunSkip waits for the schedule's next run
+	missedRunSkip = "skip"
+	// missedRunOnce takes a single backup right away for all missed runs
+	missedRunOnce = "run_once"
+	// missedRunOnceJitter takes that backup after a random delay of up to
+	// BACKUP_MISSED_RUN_JITTER, so schedules do not all start at once
+	missedRunOnceJitter = "run_once_jitter"
+
+	defaultMissedRunPolicy = missedRunOnce
+	defaultMissedRunJitter = 300 // seconds
+
+	// runMissed is the status of a run that did not happen because the
+	// server was down.
+	runMissed = "missed"
+
+	// maxRecordedMissedRuns bounds the missed runs recorded one by one for
+	// a schedule on startup; later ones are summed up in a single run.
+	maxRecordedMissedRuns = 500
+)
+
+// applyMissedRunPolicy sets the schedule's missed run policy, keeping the
+// current one, or the default for a new schedule, when policy is empty.
+func applyMissedRunPolicy(schedule *BackupSchedule, policy string) error {
+	switch policy {
+	case "":
+		if schedule.MissedRunPolicy == "" {
+			schedule.MissedRunPolicy = defaultMissedRunPolicy
+		}
+	case missedRunSkip, missedRunOnce, missedRunOnceJitter:
+		schedule.MissedRunPolicy = policy
+	default:
+		return fmt.Errorf("missed_run_policy must be %s, %s or %s", missedRunSkip, missedRunOnce, missedRunOnceJitter)
+	}
+	return nil
+}
+
+// missedScheduleRuns lists the runs of schedule from its saved next run
+// time up to now as missed runs. Past maxRecordedMissedRuns the remaining
+// runs are covered by a last one that says so.
+func missedScheduleRuns(schedule *BackupSchedule, cronSchedule *zonedSchedule, now time.Time) []*ScheduleRun {
+	scheduleID := schedule.ID.String()
+	var runs []*ScheduleRun
+	for at := *schedule.NextRunTime; !at.IsZero() && at.Before(now); at = cronSchedule.Next(at) {
+		reason := "server was not running"
+		if len(runs) == maxRecordedMissedRuns {
+			reason = fmt.Sprintf("server was not running; runs missed from here until %s are not recorded one by one",
+				now.Format(time.RFC3339))
+		}
+		startedAt := at
+		runs = append(runs, &ScheduleRun{
+			ID:         uuid.New(),
+			ScheduleID: scheduleID,
+			Status:     runMissed,
+			Error:      &reason,
+			StartedAt:  startedAt,
+			FinishedAt: &startedAt,
+		})
+		if len(runs) > maxRecordedMissedRuns {
+			break
+		}
+	}
+	return runs
+}
+
+// recoverMissedRuns records the runs a schedule missed while the server was
+// down and makes up for them as its missed run policy says.
+func (s *BackupService) recoverMissedRuns(schedule *BackupSchedule, now time.Time, jitter time.Duration) {
+	scheduleID := schedule.ID.String()
+	cronSchedule, err := parseSchedule(schedule.CronSchedule, schedule.Timezone)
+	if err != nil {
+		fmt.Printf("Error parsing schedule %s: %v\n", scheduleID, err)
+		return
+	}
+
+	runs := missedScheduleRuns(schedule, cronSchedule, now)
+	if len(runs) == 0 {
+		return
+	}
+	if err := s.backupRepo.RecordMissedScheduleRuns(scheduleID, runs, cronSchedule.Next(now)); err != nil {
+		fmt.Printf("Error recording missed runs of schedule %s: %v\n", scheduleID, err)
+	}
+
+	delay, makeUp := missedRunDelay(schedule.MissedRunPolicy, jitter)
+	switch {
+	case !makeUp:
+		fmt.Printf("Schedule %s missed runs since %s, waiting for its next run\n",
+			scheduleID, schedule.NextRunTime.Format(time.RFC3339))
+	case delay > 0:
+		fmt.Printf("Schedule %s missed runs since %s, backing up in %s\n",
+			scheduleID, schedule.NextRunTime.Format(time.RFC3339), delay.Round(time.Second))
+		time.AfterFunc(delay, func() { s.runMissedSchedule(scheduleID, now) })
+	default:
+		fmt.Printf("Schedule %s missed runs since %s, backing up now\n",
+			scheduleID, schedule.NextRunTime.Format(time.RFC3339))
+		go s.runMissedSchedule(scheduleID, now)
+	}
+}
+
+// missedRunDelay says whether a schedule with the given missed run policy
+// makes up for its missed runs, and how long after startup.
+func missedRunDelay(policy string, jitter time.Duration) (time.Duration, bool) {
+	switch policy {
+	case missedRunSkip:
+		return 0, false
+	case missedRunOnceJitter:
+		if jitter <= 0 {
+			return 0, true
+		}
+		return time.Duration(rand.Int63n(int64(jitter))), true
+	default:
+		return 0, true
+	}
+}
+
+// runMissedSchedule takes the backup making up for a schedule's missed
+// runs, with the schedule as it is saved by then. It is not taken if the
+// schedule has been deleted or disabled or has run since startedAt.
+func (s *BackupService) runMissedSchedule(scheduleID string, startedAt time.Time) {
+	schedule, err := s.backupRepo.GetBackupScheduleByID(scheduleID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			fmt.Printf("Error loading schedule %s: %v\n", scheduleID, err)
+		}
+		return
+	}
+	if !schedule.Enabled || (schedule.LastBackupTime != nil && schedule.LastBackupTime.After(startedAt)) {
+		return
+	}
+	s.executeCronBackup(schedule)
+}
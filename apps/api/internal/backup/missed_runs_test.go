@@ -0,0 +1,202 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestMissedScheduleRuns(t *testing.T) {
+	cronSchedule, err := parseSchedule("0 0 * * * *", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 18, 10, 30, 0, 0, time.UTC)
+
+	nextRun := time.Date(2026, 10, 18, 7, 0, 0, 0, time.UTC)
+	schedule := &BackupSchedule{ID: uuid.New(), NextRunTime: &nextRun}
+	runs := missedScheduleRuns(schedule, cronSchedule, now)
+	if len(runs) != 4 {
+		t.Fatalf("got %d missed runs, want 4 (07:00 to 10:00)", len(runs))
+	}
+	for i, run := range runs {
+		want := nextRun.Add(time.Duration(i) * time.Hour)
+		if !run.StartedAt.Equal(want) || run.FinishedAt == nil || !run.FinishedAt.Equal(want) {
+			t.Errorf("run %d at %v-%v, want %v", i, run.StartedAt, run.FinishedAt, want)
+		}
+		if run.Status != runMissed || run.ScheduleID != schedule.ID.String() {
+			t.Errorf("run %d is %s of %s, want %s of %s", i, run.Status, run.ScheduleID, runMissed, schedule.ID)
+		}
+	}
+
+	future := now.Add(time.Minute)
+	schedule.NextRunTime = &future
+	if runs := missedScheduleRuns(schedule, cronSchedule, now); len(runs) != 0 {
+		t.Errorf("got %d missed runs for a schedule not yet due, want none", len(runs))
+	}
+}
+
+func TestMissedScheduleRunsCap(t *testing.T) {
+	cronSchedule, err := parseSchedule("* * * * * *", "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	nextRun := now.Add(-time.Hour)
+	schedule := &BackupSchedule{ID: uuid.New(), NextRunTime: &nextRun}
+
+	runs := missedScheduleRuns(schedule, cronSchedule, now)
+	if len(runs) != maxRecordedMissedRuns+1 {
+		t.Fatalf("got %d missed runs, want %d", len(runs), maxRecordedMissedRuns+1)
+	}
+	if reason := *runs[maxRecordedMissedRuns-1].Error; reason != "server was not running" {
+		t.Errorf("last run recorded one by one says %q", reason)
+	}
+	last := *runs[maxRecordedMissedRuns].Error
+	if !strings.Contains(last, "not recorded one by one") || !strings.Contains(last, now.Format(time.RFC3339)) {
+		t.Errorf("summary run says %q, want it to cover the runs up to %s", last, now.Format(time.RFC3339))
+	}
+}
+
+func TestMissedRunDelay(t *testing.T) {
+	const jitter = 5 * time.Minute
+	tests := []struct {
+		policy     string
+		jitter     time.Duration
+		wantMakeUp bool
+		wantJitter bool
+	}{
+		{policy: missedRunSkip, jitter: jitter, wantMakeUp: false},
+		{policy: missedRunOnce, jitter: jitter, wantMakeUp: true},
+		{policy: "", jitter: jitter, wantMakeUp: true},
+		{policy: missedRunOnceJitter, jitter: jitter, wantMakeUp: true, wantJitter: true},
+		{policy: missedRunOnceJitter, jitter: 0, wantMakeUp: true},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			delay, makeUp := missedRunDelay(tt.policy, tt.jitter)
+			if makeUp != tt.wantMakeUp {
+				t.Fatalf("missedRunDelay(%q) makes up = %v, want %v", tt.policy, makeUp, tt.wantMakeUp)
+			}
+			if tt.wantJitter && (delay < 0 || delay >= tt.jitter) {
+				t.Fatalf("missedRunDelay(%q) delay = %s, want under %s", tt.policy, delay, tt.jitter)
+			}
+			if !tt.wantJitter && delay != 0 {
+				t.Fatalf("missedRunDelay(%q) delay = %s, want none", tt.policy, delay)
+			}
+		}
+	}
+}
+
+func TestApplyMissedRunPolicy(t *testing.T) {
+	schedule := &BackupSchedule{}
+	if err := applyMissedRunPolicy(schedule, ""); err != nil || schedule.MissedRunPolicy != defaultMissedRunPolicy {
+		t.Errorf("new schedule got policy %q (%v), want %q", schedule.MissedRunPolicy, err, defaultMissedRunPolicy)
+	}
+	if err := applyMissedRunPolicy(schedule, missedRunSkip); err != nil || schedule.MissedRunPolicy != missedRunSkip {
+		t.Errorf("got policy %q (%v), want %q", schedule.MissedRunPolicy, err, missedRunSkip)
+	}
+	if err := applyMissedRunPolicy(schedule, ""); err != nil || schedule.MissedRunPolicy != missedRunSkip {
+		t.Errorf("empty policy changed %q to %q (%v)", missedRunSkip, schedule.MissedRunPolicy, err)
+	}
+	if err := applyMissedRunPolicy(schedule, "catch_up"); err == nil {
+		t.Error("unknown policy was accepted")
+	}
+}
+
+func TestRecoverMissedRunsRecordsRunsInUTC(t *testing.T) {
+	repo := newTestRepository(t)
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nextRun := time.Date(2026, 10, 15, 2, 0, 0, 0, tokyo)
+	schedule := &BackupSchedule{
+		ID:              uuid.New(),
+		ConnectionID:    uuid.NewString(),
+		Name:            "nightly",
+		Enabled:         true,
+		CronSchedule:    "0 0 2 * * *",
+		Timezone:        "Asia/Tokyo",
+		MissedRunPolicy: missedRunSkip,
+		NextRunTime:     &nextRun,
+	}
+	if err := repo.CreateBackupSchedule(schedule); err != nil {
+		t.Fatal(err)
+	}
+
+	// A run taken in the server's own zone, at 09:00 in Tokyo on the 17th.
+	// As text with its offset it would sort before that day's 02:00 run.
+	normalAt := time.Date(2026, 10, 16, 20, 0, 0, 0, newYork)
+	normal := &ScheduleRun{ID: uuid.New(), ScheduleID: schedule.ID.String(), Status: backupCompleted,
+		StartedAt: normalAt, FinishedAt: &normalAt}
+	if err := repo.CreateScheduleRun(normal); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, tokyo)
+	s := &BackupService{backupRepo: repo}
+	s.recoverMissedRuns(schedule, now, 0)
+
+	runs, err := repo.GetScheduleRuns(schedule.ID.String(), 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Time{
+		time.Date(2026, 10, 18, 2, 0, 0, 0, tokyo),
+		normalAt,
+		time.Date(2026, 10, 17, 2, 0, 0, 0, tokyo),
+		time.Date(2026, 10, 16, 2, 0, 0, 0, tokyo),
+		time.Date(2026, 10, 15, 2, 0, 0, 0, tokyo),
+	}
+	if len(runs) != len(want) {
+		t.Fatalf("got %d runs, want %d", len(runs), len(want))
+	}
+	for i, run := range runs {
+		if !run.StartedAt.Equal(want[i]) {
+			t.Errorf("run %d started at %v, want %v", i, run.StartedAt, want[i])
+		}
+	}
+
+	rows, err := repo.db.Query(`SELECT started_at, finished_at FROM backup_schedule_runs`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var startedAt, finishedAt string
+		if err := rows.Scan(&startedAt, &finishedAt); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(startedAt, "Z") || !strings.HasSuffix(finishedAt, "Z") {
+			t.Errorf("run stored at %s-%s, want UTC", startedAt, finishedAt)
+		}
+	}
+
+	saved, err := repo.GetBackupScheduleByID(schedule.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.LastRunStatus == nil || *saved.LastRunStatus != runMissed {
+		t.Errorf("last run status = %v, want %s", saved.LastRunStatus, runMissed)
+	}
+	if saved.LastRunAt == nil || !saved.LastRunAt.Equal(want[0]) {
+		t.Errorf("last run at = %v, want %v", saved.LastRunAt, want[0])
+	}
+	if wantNext := time.Date(2026, 10, 19, 2, 0, 0, 0, tokyo); saved.NextRunTime == nil || !saved.NextRunTime.Equal(wantNext) {
+		t.Errorf("next run = %v, want %v", saved.NextRunTime, wantNext)
+	}
+
+	// Recovering again finds nothing more to record
+	s.recoverMissedRuns(saved, now, 0)
+	if runs, err := repo.GetScheduleRuns(schedule.ID.String(), 50); err != nil || len(runs) != len(want) {
+		t.Errorf("got %d runs (%v) after recovering twice, want %d", len(runs), err, len(want))
+	}
+}
@@ -6,49 +6,124 @@ import (
 	"github.com/google/uuid"
 )
 
-// BackupSchedule represents a backup schedule configuration
+// BackupSchedule represents a backup schedule configuration. A connection
+// can have several schedules, each with its own dump options and retention;
+// a schedule's retention only applies to the backups it took. CronSchedule
+// runs in the IANA zone Timezone, such as Asia/Tokyo, or in the server's
+// local zone when Timezone is empty.
 type BackupSchedule struct {
-	ID             uuid.UUID  `json:"id"`
-	ConnectionID   string     `json:"connection_id"`
-	Enabled        bool       `json:"enabled"`
-	CronSchedule   string     `json:"cron_schedule"`
-	RetentionDays  int        `json:"retention_days"`
+	ID            uuid.UUID `json:"id"`
+	ConnectionID  string    `json:"connection_id"`
+	Name          string    `json:"name"`
+	Enabled       bool      `json:"enabled"`
+	CronSchedule  string    `json:"cron_schedule"`
+	Timezone      string    `json:"timezone"`
+	RetentionDays int       `json:"retention_days"`
+	DumpOptions
+	// MissedRunPolicy is what happens on startup about runs missed while
+	// the server was down: skip, run_once or run_once_jitter.
+	MissedRunPolicy string `json:"missed_run_policy"`
+	// A failed run is retried until MaxAttempts attempts have been made,
+	// waiting RetryInitialDelay seconds before the first retry and doubling
+	// the wait up to RetryMaxDelay seconds.
+	MaxAttempts       int `json:"max_attempts"`
+	RetryInitialDelay int `json:"retry_initial_delay"`
+	RetryMaxDelay     int `json:"retry_max_delay"`
+	// The GFS retention policy keeps the newest KeepLast backups plus the
+	// newest backup of each of the last KeepDaily days, KeepWeekly weeks,
+	// KeepMonthly months and KeepYearly years that have one. It replaces
+	// the plain RetentionDays cutoff when any of them is set; RetentionDays
+	// then keeps everything newer than it on top.
+	KeepLast       int        `json:"keep_last"`
+	KeepDaily      int        `json:"keep_daily"`
+	KeepWeekly     int        `json:"keep_weekly"`
+	KeepMonthly    int        `json:"keep_monthly"`
+	KeepYearly     int        `json:"keep_yearly"`
 	NextRunTime    *time.Time `json:"next_run_time"`
 	LastBackupTime *time.Time `json:"last_backup_time"`
-	CreatedAt      time.Time  `json:"created_at"`
-	UpdatedAt      time.Time  `json:"updated_at"`
+	// LastRunStatus is the outcome of the most recent run: queued, running,
+	// completed, failed, cancelled, skipped when the previous run of the
+	// schedule was still queued or running, or missed when the server was
+	// down.
+	LastRunStatus *string    `json:"last_run_status"`
+	LastRunAt     *time.Time `json:"last_run_at"`
+	SkippedRuns   int        `json:"skipped_runs"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
 }
 
 // Backup represents a single backup record
 type Backup struct {
-	ID            uuid.UUID  `json:"id"`
-	ConnectionID  string     `json:"connection_id"`
-	ScheduleID    *string    `json:"schedule_id"`
-	Status        string     `json:"status"`
-	Path          string     `json:"path"`
-	S3ObjectKey   *string    `json:"s3_object_key"`
-	Size          int64      `json:"size"`
+	ID           uuid.UUID `json:"id"`
+	ConnectionID string    `json:"connection_id"`
+	ScheduleID   *string   `json:"schedule_id"`
+	Status       string    `json:"status"`
+	Path         string    `json:"path"`
+	S3ObjectKey  *string   `json:"s3_object_key"`
+	Size         int64     `json:"size"`
+	// Compression is the codec the file was written with; Size is the size
+	// on disk and UncompressedSize the size of the raw dump.
+	Compression      string `json:"compression"`
+	UncompressedSize int64  `json:"uncompressed_size"`
+	// Encryption is "age" when the file is encrypted; EncryptionKey is the
+	// per-backup data key wrapped with the server key and is never exposed.
+	Encryption    string  `json:"encryption"`
+	EncryptionKey *string `json:"-"`
+	// Checksum is the hex SHA-256 of the stored file; IntegrityStatus is the
+	// result of the last verification against it.
+	Checksum        *string    `json:"checksum"`
+	IntegrityStatus string     `json:"integrity_status"`
+	VerifiedAt      *time.Time `json:"verified_at"`
+	// ErrorOutput and ExitCode describe why a failed backup failed; ExitCode
+	// is only set when the dump tool ran and exited non-zero.
+	ErrorOutput *string `json:"error_output"`
+	ExitCode    *int    `json:"exit_code"`
+	// A pinned backup is never removed by retention, DeleteBackup or
+	// connection cleanup. Pinned is false once PinExpiresAt has passed.
+	Pinned       bool       `json:"pinned"`
+	PinReason    *string    `json:"pin_reason"`
+	PinnedAt     *time.Time `json:"pinned_at"`
+	PinExpiresAt *time.Time `json:"pin_expires_at"`
+	// UploadStatus summarises the backup's copies on storage destinations:
+	// "pending" while any is still to be uploaded, "uploaded" once all are
+	// and "failed" when one can no longer be retried. It is nil for backups
+	// without destinations.
+	UploadStatus  *string    `json:"upload_status"`
 	StartedTime   time.Time  `json:"started_time"`
 	CompletedTime *time.Time `json:"completed_time"`
 	CreatedAt     time.Time  `json:"created_at"`
 	UpdatedAt     time.Time  `json:"updated_at"`
+	// Copies lists the backup's copies on storage destinations; it is only
+	// filled in when a single backup is fetched.
+	Copies []*BackupCopy `json:"copies,omitempty"`
 }
 
 // BackupList represents a backup in list view with additional info
 type BackupList struct {
-	ID            uuid.UUID `json:"id"`
-	ConnectionID  string    `json:"connection_id"`
-	DatabaseType  string    `json:"database_type"`
-	DatabaseName  string    `json:"database_name"`
-	ScheduleID    *string   `json:"schedule_id"`
-	Status        string    `json:"status"`
-	Path          string    `json:"path"`
-	S3ObjectKey   *string   `json:"s3_object_key"`
-	Size          int64     `json:"size"`
-	StartedTime   string    `json:"started_time"`
-	CompletedTime string    `json:"completed_time"`
-	CreatedAt     string    `json:"created_at"`
-	UpdatedAt     string    `json:"updated_at"`
+	ID               uuid.UUID `json:"id"`
+	ConnectionID     string    `json:"connection_id"`
+	DatabaseType     string    `json:"database_type"`
+	DatabaseName     string    `json:"database_name"`
+	ScheduleID       *string   `json:"schedule_id"`
+	Status           string    `json:"status"`
+	Path             string    `json:"path"`
+	S3ObjectKey      *string   `json:"s3_object_key"`
+	Size             int64     `json:"size"`
+	Compression      string    `json:"compression"`
+	UncompressedSize int64     `json:"uncompressed_size"`
+	Encryption       string    `json:"encryption"`
+	Checksum         *string   `json:"checksum"`
+	IntegrityStatus  string    `json:"integrity_status"`
+	ErrorOutput      *string   `json:"error_output"`
+	ExitCode         *int      `json:"exit_code"`
+	Pinned           bool      `json:"pinned"`
+	PinReason        *string   `json:"pin_reason"`
+	PinExpiresAt     *string   `json:"pin_expires_at"`
+	UploadStatus     *string   `json:"upload_status"`
+	StartedTime      string    `json:"started_time"`
+	CompletedTime    string    `json:"completed_time"`
+	CreatedAt        string    `json:"created_at"`
+	UpdatedAt        string    `json:"updated_at"`
 }
 
 // BackupRequest represents a request to create a backup
@@ -56,11 +131,134 @@ type BackupRequest struct {
 	ConnectionID string `json:"connection_id"`
 }
 
+// RetentionPolicy is the optional GFS retention configuration of a schedule
+// request; unset fields keep their current values.
+type RetentionPolicy struct {
+	KeepLast    *int `json:"keep_last"`
+	KeepDaily   *int `json:"keep_daily"`
+	KeepWeekly  *int `json:"keep_weekly"`
+	KeepMonthly *int `json:"keep_monthly"`
+	KeepYearly  *int `json:"keep_yearly"`
+}
+
+// RetentionPreviewRequest describes the retention to preview; unset fields
+// are taken from the schedule, which defaults to the connection's newest.
+type RetentionPreviewRequest struct {
+	ScheduleID    *string `json:"schedule_id"`
+	RetentionDays *int    `json:"retention_days"`
+	RetentionPolicy
+}
+
+// RetentionDecision says whether a backup is kept by a retention policy and
+// which rules keep it.
+type RetentionDecision struct {
+	Backup  *Backup  `json:"backup"`
+	Keep    bool     `json:"keep"`
+	Reasons []string `json:"reasons"`
+}
+
+// RetentionPreview lists what a retention policy would keep and delete.
+type RetentionPreview struct {
+	Keep   []*RetentionDecision `json:"keep"`
+	Delete []*RetentionDecision `json:"delete"`
+}
+
+// SchedulePreviewRequest describes a schedule to check before saving it.
+// ScheduleID names the schedule being edited, which is then neither warned
+// about overlapping itself nor ignored when estimating backup sizes.
+type SchedulePreviewRequest struct {
+	ConnectionID  string  `json:"connection_id"`
+	ScheduleID    *string `json:"schedule_id"`
+	CronSchedule  string  `json:"cron_schedule"`
+	Timezone      string  `json:"timezone"`
+	RetentionDays int     `json:"retention_days"`
+	RetentionPolicy
+	// Count is how many upcoming runs to list, 5 when unset
+	Count int `json:"count"`
+}
+
+// SchedulePreview describes when a schedule would run and what it would
+// cost. Storage is nil when the connection has no completed backups to
+// estimate sizes from.
+type SchedulePreview struct {
+	Description string             `json:"description"`
+	NextRuns    []time.Time        `json:"next_runs"`
+	Overlaps    []*ScheduleOverlap `json:"overlaps"`
+	Storage     *StorageEstimate   `json:"storage"`
+	Warnings    []string           `json:"warnings"`
+}
+
+// ScheduleOverlap is another schedule against the same database host with
+// runs that would still be going when previewed runs start, or the other
+// way round. Runs counts the previewed runs it overlaps.
+type ScheduleOverlap struct {
+	ScheduleID     uuid.UUID `json:"schedule_id"`
+	ScheduleName   string    `json:"schedule_name"`
+	ConnectionID   string    `json:"connection_id"`
+	ConnectionName string    `json:"connection_name"`
+	Runs           int       `json:"runs"`
+	FirstOverlap   time.Time `json:"first_overlap"`
+}
+
+// StorageEstimate is the space a schedule's backups take once retention
+// deletes as many as the schedule adds. Approximate is set when the
+// schedule runs too often to simulate in full; the estimate is then an
+// upper bound.
+type StorageEstimate struct {
+	RetainedBackups   int   `json:"retained_backups"`
+	AverageBackupSize int64 `json:"average_backup_size"`
+	EstimatedSize     int64 `json:"estimated_size"`
+	SampleSize        int   `json:"sample_size"`
+	Approximate       bool  `json:"approximate"`
+}
+
+// ScheduleReload is the outcome of rebuilding the scheduler's cron entries
+// from the saved schedules.
+type ScheduleReload struct {
+	Registered int      `json:"registered"`
+	Added      int      `json:"added"`
+	Updated    int      `json:"updated"`
+	Removed    int      `json:"removed"`
+	Unchanged  int      `json:"unchanged"`
+	Errors     []string `json:"errors"`
+}
+
+// RetryPolicy is the optional retry configuration of a schedule request;
+// unset fields keep their current or default values.
+type RetryPolicy struct {
+	MaxAttempts       *int `json:"max_attempts"`
+	RetryInitialDelay *int `json:"retry_initial_delay"`
+	RetryMaxDelay     *int `json:"retry_max_delay"`
+}
+
+// DumpOptions changes what a scheduled backup dumps.
+type DumpOptions struct {
+	// SchemaOnly dumps table definitions without their data. Only
+	// PostgreSQL and MySQL/MariaDB support it.
+	SchemaOnly bool `json:"schema_only"`
+	// Databases replaces the connection's selected databases when set.
+	Databases []string `json:"databases"`
+}
+
+// DumpOptionsRequest is the optional dump configuration of a schedule
+// request; unset fields keep their current values.
+type DumpOptionsRequest struct {
+	SchemaOnly *bool    `json:"schema_only"`
+	Databases  []string `json:"databases"`
+}
+
 // ScheduleBackupRequest represents a request to create a backup schedule
 type ScheduleBackupRequest struct {
 	ConnectionID  string `json:"connection_id"`
+	Name          string `json:"name"`
 	CronSchedule  string `json:"cron_schedule"`
+	Timezone      string `json:"timezone"`
 	RetentionDays int    `json:"retention_days"`
+	// MissedRunPolicy defaults to run_once
+	MissedRunPolicy string `json:"missed_run_policy"`
+	RetryPolicy
+	RetentionPolicy
+	DumpOptionsRequest
 }
 
 // BackupStats represents backup statistics
@@ -97,6 +295,246 @@ type BackupListOptions struct {
 }
 
 type UpdateScheduleRequest struct {
-	CronSchedule  string `json:"cron_schedule"`
-	RetentionDays int    `json:"retention_days"`
+	// Name, Enabled and Timezone keep their current values when unset
+	Name          *string `json:"name"`
+	Enabled       *bool   `json:"enabled"`
+	Timezone      *string `json:"timezone"`
+	CronSchedule  string  `json:"cron_schedule"`
+	RetentionDays int     `json:"retention_days"`
+	// MissedRunPolicy keeps its current value when unset
+	MissedRunPolicy *string `json:"missed_run_policy"`
+	RetryPolicy
+	RetentionPolicy
+	DumpOptionsRequest
+}
+
+// LocationVerification is the result of checking one copy of a backup.
+type LocationVerification struct {
+	Location string `json:"location"` // "local" or "s3"
+	Path     string `json:"path"`
+	Checksum string `json:"checksum,omitempty"`
+	Size     int64  `json:"size"`
+	Match    bool   `json:"match"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BackupVerification is the result of re-reading every copy of a backup and
+// comparing it against the checksum recorded when it was taken.
+type BackupVerification struct {
+	BackupID        uuid.UUID              `json:"backup_id"`
+	Checksum        *string                `json:"checksum"`
+	IntegrityStatus string                 `json:"integrity_status"`
+	Locations       []LocationVerification `json:"locations"`
+	VerifiedAt      time.Time              `json:"verified_at"`
+}
+
+// BackupJob is a queued or running backup. Manual and scheduled backups both
+// run as jobs so they share the same workers.
+type BackupJob struct {
+	ID           uuid.UUID  `json:"id"`
+	ConnectionID string     `json:"connection_id"`
+	ScheduleID   *string    `json:"schedule_id"`
+	UserID       uuid.UUID  `json:"-"`
+	Status       string     `json:"status"`
+	BackupID     *string    `json:"backup_id"`
+	BytesWritten int64      `json:"bytes_written"`
+	Error        *string    `json:"error"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	// ElapsedSeconds is computed when the job is read, up to now for a
+	// running job.
+	ElapsedSeconds float64   `json:"elapsed_seconds"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// BackupJobLog is one line of a job's log, numbered so clients can poll for
+// lines after the last one they saw.
+type BackupJobLog struct {
+	ID        int64     `json:"id"`
+	JobID     string    `json:"job_id"`
+	Line      string    `json:"line"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PinBackupRequest pins a backup until it is unpinned or, if set, until
+// ExpiresAt.
+type PinBackupRequest struct {
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// UnpinBackupRequest releases a pinned backup.
+type UnpinBackupRequest struct {
+	Reason string `json:"reason"`
+}
+
+// BackupPinEvent is an entry of the audit trail of pins and unpins.
+type BackupPinEvent struct {
+	ID        int64      `json:"id"`
+	BackupID  string     `json:"backup_id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	Action    string     `json:"action"` // "pin" or "unpin"
+	Reason    *string    `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ScheduleRun is one firing of a schedule and the attempts made for it.
+type ScheduleRun struct {
+	ID         uuid.UUID             `json:"id"`
+	ScheduleID string                `json:"schedule_id"`
+	Status     string                `json:"status"`
+	Error      *string               `json:"error"`
+	StartedAt  time.Time             `json:"started_at"`
+	FinishedAt *time.Time            `json:"finished_at"`
+	Attempts   []*ScheduleRunAttempt `json:"attempts"`
+}
+
+// ScheduleRunAttempt is a single backup attempt of a schedule run.
+type ScheduleRunAttempt struct {
+	ID         int64      `json:"id"`
+	RunID      string     `json:"run_id"`
+	Attempt    int        `json:"attempt"`
+	JobID      *string    `json:"job_id"`
+	BackupID   *string    `json:"backup_id"`
+	Status     string     `json:"status"`
+	Error      *string    `json:"error"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+// StorageDestination is a named place backups are copied to. The S3
+// storage configured in user settings is the builtin destination "s3".
+type StorageDestination struct {
+	ID        string            `json:"id"`
+	UserID    uuid.UUID         `json:"-"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Config    DestinationConfig `json:"config"`
+	Builtin   bool              `json:"builtin"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// DestinationConfig holds the settings of every destination type; each
+// type uses its own subset. Secrets are encrypted at rest and never
+// returned by the API.
+type DestinationConfig struct {
+	// PathPrefix is prepended to every key on the destination.
+	PathPrefix string `json:"path_prefix,omitempty"`
+	// BandwidthLimitMBps caps transfers to and from the destination, each
+	// way, on top of the global limit. It does not apply during the
+	// FullSpeedWindows, comma-separated HH:MM-HH:MM periods of local time.
+	BandwidthLimitMBps float64 `json:"bandwidth_limit_mbps,omitempty"`
+	FullSpeedWindows   string  `json:"full_speed_windows,omitempty"`
+	// Local directory, or the remote base directory for SFTP
+	Path string `json:"path,omitempty"`
+	// S3. GCS uses Bucket too, and Endpoint overrides the Azure Blob or GCS
+	// API for emulators and private endpoints
+	Endpoint  string `json:"endpoint,omitempty"`
+	Region    string `json:"region,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+	UseSSL    bool   `json:"use_ssl,omitempty"`
+	// Storage class, server-side encryption ("sse-s3" or "sse-kms") and
+	// object lock mode ("governance" or "compliance") of uploaded backups
+	StorageClass          string `json:"storage_class,omitempty"`
+	ServerSideEncryption  string `json:"server_side_encryption,omitempty"`
+	KMSKeyID              string `json:"kms_key_id,omitempty"`
+	ObjectLockMode        string `json:"object_lock_mode,omitempty"`
+	DisableBucketCreation bool   `json:"disable_bucket_creation,omitempty"`
+	// Azure Blob Storage, authenticated by AccountKey or SASToken
+	AccountName string `json:"account_name,omitempty"`
+	AccountKey  string `json:"account_key,omitempty"`
+	SASToken    string `json:"sas_token,omitempty"`
+	Container   string `json:"container,omitempty"`
+	// GCS service account key file
+	CredentialsJSON string `json:"credentials_json,omitempty"`
+	// SFTP
+	Host       string `json:"host,omitempty"`
+	Port       int    `json:"port,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Password   string `json:"password,omitempty"`
+	PrivateKey string `json:"private_key,omitempty"`
+	// Server public key or SHA256 fingerprint the SFTP server must present
+	HostKey string `json:"host_key,omitempty"`
+}
+
+// StorageDestinationRequest creates or updates a destination. On update an
+// empty secret keeps the stored one.
+type StorageDestinationRequest struct {
+	Name   string            `json:"name"`
+	Type   string            `json:"type"`
+	Config DestinationConfig `json:"config"`
+}
+
+// ConnectionDestinationsRequest sets the destinations a connection's
+// backups are copied to. An empty list restores the default, the settings
+// S3 storage when it is enabled.
+type ConnectionDestinationsRequest struct {
+	DestinationIDs []string `json:"destination_ids"`
+}
+
+// BackupCopy is the copy of a backup on one storage destination.
+type BackupCopy struct {
+	BackupID        string     `json:"backup_id"`
+	DestinationID   string     `json:"destination_id"`
+	DestinationName string     `json:"destination_name"`
+	Status          string     `json:"status"`
+	ObjectKey       *string    `json:"object_key"`
+	Size            int64      `json:"size"`
+	Error           *string    `json:"error"`
+	UploadedAt      *time.Time `json:"uploaded_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	// Attempts counts upload attempts; a failed copy is retried at
+	// NextAttemptAt, or never if it is nil. UploadID is the multipart upload
+	// an interrupted attempt left behind, resumed by the next one.
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	UploadID      *string    `json:"-"`
+}
+
+// ReconcileRequest asks for a destination to be compared with the backup
+// catalog. With Import set, orphaned objects that can be matched to one of
+// the user's connections are added to the catalog as backups.
+type ReconcileRequest struct {
+	Import bool `json:"import"`
+}
+
+// ReconcileReport lists the differences between a destination's objects and
+// the backups that refer to them.
+type ReconcileReport struct {
+	DestinationID   string          `json:"destination_id"`
+	DestinationName string          `json:"destination_name"`
+	Objects         int             `json:"objects"`
+	Orphans         []*OrphanObject `json:"orphans"`
+	Dangling        []*DanglingCopy `json:"dangling"`
+	Imported        int             `json:"imported"`
+}
+
+// OrphanObject is a stored object no backup refers to. ConnectionID,
+// DatabaseName and StartedTime are parsed from keys that follow the
+// <connection>/<database>_<timestamp> layout backups are uploaded with;
+// Reason says why an orphan cannot be imported. BackupID is set once it
+// has been imported.
+type OrphanObject struct {
+	Key          string     `json:"key"`
+	Size         int64      `json:"size"`
+	ModTime      time.Time  `json:"mod_time"`
+	ConnectionID *string    `json:"connection_id"`
+	DatabaseName *string    `json:"database_name"`
+	StartedTime  *time.Time `json:"started_time"`
+	Importable   bool       `json:"importable"`
+	Reason       *string    `json:"reason"`
+	BackupID     *string    `json:"backup_id"`
+}
+
+// DanglingCopy is a backup copy recorded as uploaded whose object is
+// missing from the destination.
+type DanglingCopy struct {
+	BackupID     string `json:"backup_id"`
+	ConnectionID string `json:"connection_id"`
+	Key          string `json:"key"`
 }
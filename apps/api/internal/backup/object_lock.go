@@ -0,0 +1,109 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// retentionHorizon returns until when the retention of schedule can keep a
+// backup it takes at now. The newest backup is kept by every rule of the
+// policy, so this is the end of the longest of RetentionDays and the GFS
+// buckets, counted in calendar periods from now. A bucket that skips
+// periods without backups can keep it for longer. It is now for policies
+// that keep backups for no fixed time: no retention at all, or KeepLast
+// alone.
+func retentionHorizon(schedule *BackupSchedule, now time.Time) time.Time {
+	horizon := now
+	for _, t := range []time.Time{
+		now.AddDate(0, 0, schedule.RetentionDays),
+		now.AddDate(0, 0, schedule.KeepDaily),
+		now.AddDate(0, 0, 7*schedule.KeepWeekly),
+		now.AddDate(0, schedule.KeepMonthly, 0),
+		now.AddDate(schedule.KeepYearly, 0, 0),
+	} {
+		if t.After(horizon) {
+			horizon = t
+		}
+	}
+	return horizon
+}
+
+// backupLockUntil returns until when a backup stored on storage is kept
+// under its object lock: the retention horizon of the schedule that took
+// it or, for manual backups, the furthest horizon of their connection's
+// schedules. ok is false for storage without object lock. A backup whose
+// retention keeps it for no fixed time cannot be locked and is refused, so
+// it does not sit unprotected on storage that is meant to protect it.
+func (s *BackupService) backupLockUntil(backup *Backup, storage Storage) (until time.Time, ok bool, err error) {
+	locker, ok := storage.(lockingStorage)
+	if !ok || !locker.LocksObjects() {
+		return time.Time{}, false, nil
+	}
+
+	now := time.Now()
+	until, err = s.backupLockHorizon(backup, now)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if !until.After(now) {
+		if backup.ScheduleID != nil {
+			return time.Time{}, false, fmt.Errorf("object lock is enabled, but the schedule's retention keeps backups for no fixed time; set retention_days or keep_daily, keep_weekly, keep_monthly or keep_yearly")
+		}
+		return time.Time{}, false, fmt.Errorf("object lock is enabled, but no schedule of the connection keeps backups for a fixed time to lock manual backups for; set retention_days or keep_daily, keep_weekly, keep_monthly or keep_yearly on one")
+	}
+	return until, true, nil
+}
+
+// backupLockContext returns ctx asking storage to write the backup's object
+// under its object lock, so it is never stored unprotected. It fails before
+// anything is uploaded when the backup cannot be locked.
+func (s *BackupService) backupLockContext(ctx context.Context, backup *Backup, storage Storage) (context.Context, error) {
+	until, ok, err := s.backupLockUntil(backup, storage)
+	if err != nil || !ok {
+		return ctx, err
+	}
+	return withObjectLock(ctx, until), nil
+}
+
+// lockBackupObject puts a backup's object that is already stored under the
+// storage's object lock, as backupLockUntil says. Storage without object
+// lock is left alone.
+func (s *BackupService) lockBackupObject(backup *Backup, storage Storage, key string) error {
+	until, ok, err := s.backupLockUntil(backup, storage)
+	if err != nil || !ok {
+		return err
+	}
+	if err := storage.(lockingStorage).LockObject(context.Background(), key, until); err != nil {
+		return fmt.Errorf("failed to lock object: %w", err)
+	}
+	return nil
+}
+
+// backupLockHorizon returns the retention horizon of backup, that of the
+// schedule that took it or, for manual backups and those of deleted
+// schedules, the furthest of its connection's schedules.
+func (s *BackupService) backupLockHorizon(backup *Backup, now time.Time) (time.Time, error) {
+	if backup.ScheduleID != nil {
+		schedule, err := s.backupRepo.GetBackupScheduleByID(*backup.ScheduleID)
+		if err == nil {
+			return retentionHorizon(schedule, now), nil
+		}
+		if err != sql.ErrNoRows {
+			return time.Time{}, fmt.Errorf("failed to get backup schedule: %w", err)
+		}
+	}
+
+	schedules, err := s.backupRepo.GetBackupSchedulesByConnectionID(backup.ConnectionID)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get backup schedules: %w", err)
+	}
+	horizon := now
+	for _, schedule := range schedules {
+		if t := retentionHorizon(schedule, now); t.After(horizon) {
+			horizon = t
+		}
+	}
+	return horizon, nil
+}
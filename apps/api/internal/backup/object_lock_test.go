@@ -0,0 +1,141 @@
+package backup
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRetentionHorizon(t *testing.T) {
+	now := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		schedule BackupSchedule
+		want     time.Time
+	}{
+		{"no retention", BackupSchedule{}, now},
+		{"keep_last only", BackupSchedule{KeepLast: 10}, now},
+		{"retention_days", BackupSchedule{RetentionDays: 14}, now.AddDate(0, 0, 14)},
+		{"keep_daily", BackupSchedule{KeepDaily: 7}, now.AddDate(0, 0, 7)},
+		{"keep_weekly", BackupSchedule{KeepWeekly: 4}, now.AddDate(0, 0, 28)},
+		{"keep_monthly", BackupSchedule{KeepMonthly: 1}, time.Date(2026, 3, 3, 12, 0, 0, 0, time.UTC)},
+		{"keep_yearly", BackupSchedule{KeepYearly: 2}, now.AddDate(2, 0, 0)},
+		{"longest bucket wins", BackupSchedule{RetentionDays: 30, KeepDaily: 7, KeepWeekly: 8, KeepMonthly: 1}, now.AddDate(0, 0, 56)},
+		{"retention_days beyond GFS", BackupSchedule{RetentionDays: 90, KeepDaily: 7, KeepMonthly: 2}, now.AddDate(0, 0, 90)},
+	}
+	for _, tt := range tests {
+		if got := retentionHorizon(&tt.schedule, now); !got.Equal(tt.want) {
+			t.Errorf("%s: horizon %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// lockRecorder is storage with object lock that records the locks it is
+// asked for.
+type lockRecorder struct {
+	Storage
+	locking bool
+	locks   map[string]time.Time
+}
+
+func (l *lockRecorder) LocksObjects() bool {
+	return l.locking
+}
+
+func (l *lockRecorder) LockObject(ctx context.Context, key string, until time.Time) error {
+	l.locks[key] = until
+	return nil
+}
+
+func TestLockBackupObject(t *testing.T) {
+	repo := newTestRepository(t)
+	s := &BackupService{backupRepo: repo}
+
+	connectionID := uuid.NewString()
+	newSchedule := func(connectionID string, retentionDays, keepLast, keepMonthly int) *BackupSchedule {
+		schedule := &BackupSchedule{
+			ID:            uuid.New(),
+			ConnectionID:  connectionID,
+			Name:          "schedule",
+			CronSchedule:  "0 0 2 * * *",
+			RetentionDays: retentionDays,
+			KeepLast:      keepLast,
+			KeepMonthly:   keepMonthly,
+		}
+		if err := repo.CreateBackupSchedule(schedule); err != nil {
+			t.Fatal(err)
+		}
+		return schedule
+	}
+	daily := newSchedule(connectionID, 7, 0, 0)
+	gfsOnly := newSchedule(connectionID, 0, 3, 6)
+	keepLastOnly := newSchedule(connectionID, 0, 5, 0)
+	otherConnection := uuid.NewString()
+	newSchedule(otherConnection, 0, 5, 0)
+
+	scheduleID := func(schedule *BackupSchedule) *string {
+		id := schedule.ID.String()
+		return &id
+	}
+	deletedSchedule := uuid.NewString()
+	tests := []struct {
+		name    string
+		backup  *Backup
+		want    time.Duration // after now, give or take a day for months
+		wantErr string
+	}{
+		{name: "retention_days", backup: &Backup{ConnectionID: connectionID, ScheduleID: scheduleID(daily)}, want: 7 * 24 * time.Hour},
+		{name: "GFS only", backup: &Backup{ConnectionID: connectionID, ScheduleID: scheduleID(gfsOnly)}, want: 6 * 30 * 24 * time.Hour},
+		{name: "keep_last only", backup: &Backup{ConnectionID: connectionID, ScheduleID: scheduleID(keepLastOnly)}, wantErr: "schedule's retention"},
+		{name: "manual", backup: &Backup{ConnectionID: connectionID}, want: 6 * 30 * 24 * time.Hour},
+		{name: "deleted schedule", backup: &Backup{ConnectionID: connectionID, ScheduleID: &deletedSchedule}, want: 6 * 30 * 24 * time.Hour},
+		{name: "manual without retention", backup: &Backup{ConnectionID: otherConnection}, wantErr: "manual backups"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &lockRecorder{locking: true, locks: map[string]time.Time{}}
+			err := s.lockBackupObject(tt.backup, storage, "key")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("lockBackupObject error = %v, want one containing %q", err, tt.wantErr)
+				}
+				if len(storage.locks) != 0 {
+					t.Errorf("locked %v despite the error", storage.locks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lockBackupObject: %v", err)
+			}
+			until, ok := storage.locks["key"]
+			if !ok {
+				t.Fatal("object was not locked")
+			}
+			if got := time.Until(until); got < tt.want-3*24*time.Hour || got > tt.want+3*24*time.Hour {
+				t.Errorf("locked for %s, want about %s", got.Round(time.Hour), tt.want)
+			}
+
+			// New uploads are asked to be written locked just as long
+			ctx, err := s.backupLockContext(context.Background(), tt.backup, storage)
+			if err != nil {
+				t.Fatalf("backupLockContext: %v", err)
+			}
+			if writeUntil, ok := objectLockFrom(ctx); !ok || writeUntil.Sub(until).Abs() > time.Minute {
+				t.Errorf("uploads locked until %v, want %v", writeUntil, until)
+			}
+		})
+	}
+
+	// Storage without object lock is left alone, whatever the retention
+	storage := &lockRecorder{locks: map[string]time.Time{}}
+	if err := s.lockBackupObject(&Backup{ConnectionID: otherConnection}, storage, "key"); err != nil || len(storage.locks) != 0 {
+		t.Errorf("storage without object lock: err %v, locks %v", err, storage.locks)
+	}
+	ctx, err := s.backupLockContext(context.Background(), &Backup{ConnectionID: otherConnection}, storage)
+	if _, ok := objectLockFrom(ctx); err != nil || ok {
+		t.Errorf("storage without object lock: uploads locked (err %v)", err)
+	}
+}
@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	pinActionPin   = "pin"
+	pinActionUnpin = "unpin"
+)
+
+var (
+	errBackupPinned    = errors.New("backup is pinned and cannot be deleted")
+	errBackupNotPinned = errors.New("backup is not pinned")
+	errInvalidPin      = errors.New("invalid pin")
+)
+
+// pinActive reports whether a stored pin still holds, i.e. it has not
+// reached its expiry.
+func pinActive(pinned bool, expiresAt *time.Time) bool {
+	return pinned && (expiresAt == nil || time.Now().Before(*expiresAt))
+}
+
+// getOwnedBackup returns a backup if it belongs to one of the user's
+// connections.
+func (s *BackupService) getOwnedBackup(backupID string, userID uuid.UUID) (*Backup, error) {
+	backup, err := s.backupRepo.GetBackup(backupID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify backup ownership: %v", err)
+	}
+	if conn.UserID != userID {
+		return nil, errUnauthorized
+	}
+	return backup, nil
+}
+
+// PinBackup puts a completed backup on hold so nothing removes it. Pinning a
+// pinned backup replaces its reason and expiry.
+func (s *BackupService) PinBackup(backupID string, userID uuid.UUID, req *PinBackupRequest) (*Backup, error) {
+	backup, err := s.getOwnedBackup(backupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if backup.Status != backupCompleted {
+		return nil, fmt.Errorf("%w: only completed backups can be pinned", errInvalidPin)
+	}
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		return nil, fmt.Errorf("%w: reason is required", errInvalidPin)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", errInvalidPin)
+	}
+
+	event := &BackupPinEvent{
+		BackupID:  backupID,
+		UserID:    userID,
+		Action:    pinActionPin,
+		Reason:    &reason,
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := s.backupRepo.SetBackupPin(backupID, true, &reason, req.ExpiresAt, event); err != nil {
+		return nil, err
+	}
+
+	return s.backupRepo.GetBackup(backupID)
+}
+
+// UnpinBackup releases a pinned backup back to retention.
+func (s *BackupService) UnpinBackup(backupID string, userID uuid.UUID, req *UnpinBackupRequest) (*Backup, error) {
+	backup, err := s.getOwnedBackup(backupID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !backup.Pinned {
+		return nil, errBackupNotPinned
+	}
+
+	event := &BackupPinEvent{
+		BackupID:  backupID,
+		UserID:    userID,
+		Action:    pinActionUnpin,
+		CreatedAt: time.Now(),
+	}
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		event.Reason = &reason
+	}
+	if err := s.backupRepo.SetBackupPin(backupID, false, nil, nil, event); err != nil {
+		return nil, err
+	}
+
+	return s.backupRepo.GetBackup(backupID)
+}
+
+// GetBackupPinEvents returns who pinned and unpinned a backup, and when.
+func (s *BackupService) GetBackupPinEvents(backupID string, userID uuid.UUID) ([]*BackupPinEvent, error) {
+	if _, err := s.getOwnedBackup(backupID, userID); err != nil {
+		return nil, err
+	}
+	return s.backupRepo.GetBackupPinEvents(backupID)
+}
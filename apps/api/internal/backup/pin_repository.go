@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+)
+
+// SetBackupPin pins or unpins a backup and records the change in the audit
+// trail, both or neither.
+func (r *BackupRepository) SetBackupPin(backupID string, pinned bool, reason *string, expiresAt *time.Time, event *BackupPinEvent) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var pinnedAt *time.Time
+	if pinned {
+		pinnedAt = &now
+	}
+	_, err = tx.Exec(`
+		UPDATE backups
+		SET pinned = $1, pin_reason = $2, pinned_at = $3, pin_expires_at = $4, updated_at = $5
+		WHERE id = $6`,
+		pinned, reason, formatNullableTime(pinnedAt), formatNullableTime(expiresAt),
+		now.Format(time.RFC3339), backupID)
+	if err != nil {
+		return fmt.Errorf("failed to update backup pin: %v", err)
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO backup_pin_events (backup_id, user_id, action, reason, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		event.BackupID, event.UserID.String(), event.Action, event.Reason,
+		formatNullableTime(event.ExpiresAt), event.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to record pin event: %v", err)
+	}
+	if event.ID, err = result.LastInsertId(); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetBackupPinEvents returns the pin audit trail of a backup, oldest first.
+func (r *BackupRepository) GetBackupPinEvents(backupID string) ([]*BackupPinEvent, error) {
+	rows, err := r.db.Query(`
+		SELECT id, backup_id, user_id, action, reason, expires_at, created_at
+		FROM backup_pin_events
+		WHERE backup_id = $1
+		ORDER BY id ASC`,
+		backupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*BackupPinEvent{}
+	for rows.Next() {
+		var (
+			expiresAtStr sql.NullString
+			createdAtStr string
+		)
+		event := &BackupPinEvent{}
+		if err := rows.Scan(&event.ID, &event.BackupID, &event.UserID, &event.Action,
+			&event.Reason, &expiresAtStr, &createdAtStr); err != nil {
+			return nil, err
+		}
+
+		if expiresAtStr.Valid {
+			expiresAt, err := common.ParseTime(expiresAtStr.String)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing expires_at: %v", err)
+			}
+			event.ExpiresAt = &expiresAt
+		}
+
+		createdAt, err := common.ParseTime(createdAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing created_at: %v", err)
+		}
+		event.CreatedAt = createdAt
+
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
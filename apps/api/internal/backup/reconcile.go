@@ -0,0 +1,246 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+)
+
+// backupKeyPattern matches the file name of an uploaded backup:
+// <database>_<timestamp><engine ext>[<compression ext>][.age].
+var backupKeyPattern = regexp.MustCompile(`^(.+)_(\d{8}_\d{6})(\.[a-z]+?)(\.gz|\.zst)?(\.age)?$`)
+
+// catalogObject is an object key recorded on a backup copy.
+type catalogObject struct {
+	BackupID     string
+	ConnectionID string
+	Status       string
+	Key          string
+}
+
+// parsedBackupKey is what an object key says about the backup it holds.
+type parsedBackupKey struct {
+	Connection   string
+	FileName     string
+	DatabaseName string
+	StartedTime  time.Time
+	Compression  string
+	Encrypted    bool
+}
+
+// parseBackupKey parses a key relative to the destination's path prefix,
+// laid out as <sanitized connection>/<database>_<timestamp>.<ext>.
+func parseBackupKey(key string) (*parsedBackupKey, error) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("key is not <connection>/<file>")
+	}
+
+	match := backupKeyPattern.FindStringSubmatch(parts[1])
+	if match == nil || !isEngineExtension(match[3]) {
+		return nil, fmt.Errorf("file name is not <database>_<timestamp>.<ext>")
+	}
+
+	startedTime, err := time.ParseInLocation("20060102_150405", match[2], time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q: %w", match[2], err)
+	}
+
+	compression := connection.CompressionNone
+	switch match[4] {
+	case compressionExtension(connection.CompressionGzip):
+		compression = connection.CompressionGzip
+	case compressionExtension(connection.CompressionZstd):
+		compression = connection.CompressionZstd
+	}
+
+	return &parsedBackupKey{
+		Connection:   parts[0],
+		FileName:     parts[1],
+		DatabaseName: match[1],
+		StartedTime:  startedTime,
+		Compression:  compression,
+		Encrypted:    match[5] == encryptionExtension,
+	}, nil
+}
+
+func isEngineExtension(ext string) bool {
+	for _, engine := range engines {
+		if engine.FileExtension() == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// ReconcileStorage compares the objects under a destination's path prefix
+// with the backups that refer to them. It reports orphaned objects no
+// backup refers to and copies whose object is gone. With req.Import set,
+// orphans matched to one of the user's connections are added as backups.
+func (s *BackupService) ReconcileStorage(destinationID string, userID uuid.UUID, req ReconcileRequest) (*ReconcileReport, error) {
+	dest, err := s.storageDestinationByID(userID, destinationID)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.openDestination(dest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open destination: %w", err)
+	}
+	defer d.close()
+
+	listPrefix := storageKey(d.PathPrefix)
+	if listPrefix != "" {
+		listPrefix += "/"
+	}
+	objects, err := d.storage.List(context.Background(), listPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded, err := s.backupRepo.GetDestinationObjects(userID, d.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup copies: %w", err)
+	}
+
+	report := &ReconcileReport{
+		DestinationID:   d.ID,
+		DestinationName: d.Name,
+		Objects:         len(objects),
+		Orphans:         []*OrphanObject{},
+		Dangling:        []*DanglingCopy{},
+	}
+
+	stored := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		stored[object.Key] = true
+	}
+	known := make(map[string]bool, len(recorded))
+	for _, object := range recorded {
+		known[object.Key] = true
+		if object.Status == copyUploaded && !stored[object.Key] {
+			report.Dangling = append(report.Dangling, &DanglingCopy{
+				BackupID:     object.BackupID,
+				ConnectionID: object.ConnectionID,
+				Key:          object.Key,
+			})
+		}
+	}
+
+	connections, err := s.connStorage.ListByUserID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connections: %w", err)
+	}
+	connectionsByFolder := make(map[string][]connection.ConnectionListItem)
+	for _, conn := range connections {
+		folder := common.SanitizeConnectionName(conn.Name)
+		connectionsByFolder[folder] = append(connectionsByFolder[folder], conn)
+	}
+
+	for _, object := range objects {
+		if known[object.Key] {
+			continue
+		}
+		orphan := &OrphanObject{Key: object.Key, Size: object.Size, ModTime: object.ModTime}
+		report.Orphans = append(report.Orphans, orphan)
+
+		parsed, err := parseBackupKey(strings.TrimPrefix(object.Key, listPrefix))
+		if err != nil {
+			setOrphanReason(orphan, err.Error())
+			continue
+		}
+		orphan.DatabaseName = &parsed.DatabaseName
+		orphan.StartedTime = &parsed.StartedTime
+
+		matches := connectionsByFolder[parsed.Connection]
+		switch {
+		case len(matches) == 0:
+			setOrphanReason(orphan, fmt.Sprintf("no connection matches folder %q", parsed.Connection))
+			continue
+		case len(matches) > 1:
+			setOrphanReason(orphan, fmt.Sprintf("several connections match folder %q", parsed.Connection))
+			continue
+		}
+		orphan.ConnectionID = &matches[0].ID
+
+		if parsed.Encrypted {
+			// The data key was kept on the lost backup row
+			setOrphanReason(orphan, "encrypted backups cannot be imported without their data key")
+			continue
+		}
+		orphan.Importable = true
+
+		if req.Import {
+			backupID, err := s.importOrphan(d, matches[0].ID, object, parsed)
+			if err != nil {
+				setOrphanReason(orphan, fmt.Sprintf("import failed: %v", err))
+				continue
+			}
+			orphan.BackupID = &backupID
+			report.Imported++
+		}
+	}
+
+	sort.Slice(report.Orphans, func(i, j int) bool {
+		return report.Orphans[i].Key < report.Orphans[j].Key
+	})
+	return report, nil
+}
+
+func setOrphanReason(orphan *OrphanObject, reason string) {
+	orphan.Reason = &reason
+}
+
+// importOrphan adds a completed backup for an orphaned object, with the
+// object as its only copy. Its checksum is unknown until it is verified.
+func (s *BackupService) importOrphan(d *destination, connectionID string, object StorageObject, parsed *parsedBackupKey) (string, error) {
+	uploaded := uploadUploaded
+	completedTime := object.ModTime
+	backup := &Backup{
+		ID:              uuid.New(),
+		ConnectionID:    connectionID,
+		Status:          backupCompleted,
+		Path:            filepath.Join(s.backupDir, parsed.Connection, parsed.FileName),
+		Size:            object.Size,
+		Compression:     parsed.Compression,
+		IntegrityStatus: integrityUnknown,
+		UploadStatus:    &uploaded,
+		StartedTime:     parsed.StartedTime,
+		CompletedTime:   &completedTime,
+		CreatedAt:       parsed.StartedTime,
+		UpdatedAt:       time.Now(),
+	}
+	if d.ID == defaultS3DestinationID {
+		backup.S3ObjectKey = &object.Key
+	}
+
+	if err := s.backupRepo.CreateBackup(backup); err != nil {
+		return "", err
+	}
+
+	copy := &BackupCopy{
+		BackupID:        backup.ID.String(),
+		DestinationID:   d.ID,
+		DestinationName: d.Name,
+		Status:          copyUploaded,
+		ObjectKey:       &object.Key,
+		Size:            object.Size,
+		UploadedAt:      &completedTime,
+	}
+	if err := s.backupRepo.SaveBackupCopy(copy); err != nil {
+		if delErr := s.backupRepo.DeleteBackup(backup.ID.String()); delErr != nil {
+			fmt.Printf("Warning: Failed to remove imported backup %s: %v\n", backup.ID, delErr)
+		}
+		return "", err
+	}
+
+	fmt.Printf("Imported backup %s from %s: %s\n", backup.ID, d.Name, object.Key)
+	return backup.ID.String(), nil
+}
@@ -0,0 +1,236 @@
+package backup
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var errInvalidRetention = errors.New("invalid retention")
+
+// applyRetentionPolicy copies the set fields of policy onto schedule.
+func applyRetentionPolicy(schedule *BackupSchedule, policy RetentionPolicy) error {
+	fields := []struct {
+		name  string
+		value *int
+		dest  *int
+	}{
+		{"keep_last", policy.KeepLast, &schedule.KeepLast},
+		{"keep_daily", policy.KeepDaily, &schedule.KeepDaily},
+		{"keep_weekly", policy.KeepWeekly, &schedule.KeepWeekly},
+		{"keep_monthly", policy.KeepMonthly, &schedule.KeepMonthly},
+		{"keep_yearly", policy.KeepYearly, &schedule.KeepYearly},
+	}
+	for _, f := range fields {
+		if f.value == nil {
+			continue
+		}
+		if *f.value < 0 {
+			return fmt.Errorf("%s must not be negative", f.name)
+		}
+		*f.dest = *f.value
+	}
+	return nil
+}
+
+// hasGFSRetention reports whether the schedule uses a GFS policy rather
+// than the plain retention_days cutoff.
+func hasGFSRetention(schedule *BackupSchedule) bool {
+	return schedule.KeepLast > 0 || schedule.KeepDaily > 0 || schedule.KeepWeekly > 0 ||
+		schedule.KeepMonthly > 0 || schedule.KeepYearly > 0
+}
+
+// setsRetention reports whether the request sets any GFS bucket.
+func (p RetentionPolicy) setsRetention() bool {
+	for _, v := range []*int{p.KeepLast, p.KeepDaily, p.KeepWeekly, p.KeepMonthly, p.KeepYearly} {
+		if v != nil && *v > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// retentionBucket groups backups by period; the newest backup of each of
+// the newest count periods is kept.
+type retentionBucket struct {
+	name  string
+	count int
+	key   func(t time.Time) string
+}
+
+func isoWeekKey(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// planRetention decides which of a connection's backups the schedule's
+// retention keeps. Pinned backups and backups still in progress are always
+// kept. The GFS buckets follow the calendar of the schedule's time zone, so
+// a backup counts toward the day it ran on where the schedule runs.
+//
+// Without a GFS policy every finished backup older than RetentionDays is
+// deleted, and nothing is if RetentionDays is 0. With one, completed
+// backups are kept by the GFS buckets or for being newer than
+// RetentionDays; backups that did not complete are kept only while newer
+// than the oldest completed backup that is kept.
+func planRetention(schedule *BackupSchedule, backups []*Backup, now time.Time) []*RetentionDecision {
+	sorted := make([]*Backup, len(backups))
+	copy(sorted, backups)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	var cutoff time.Time
+	if schedule.RetentionDays > 0 {
+		cutoff = now.AddDate(0, 0, -schedule.RetentionDays)
+	}
+	withinDays := func(b *Backup) bool {
+		return schedule.RetentionDays > 0 && b.CreatedAt.After(cutoff)
+	}
+
+	location, err := loadScheduleLocation(schedule.Timezone)
+	if err != nil {
+		location = time.Local
+	}
+
+	gfs := hasGFSRetention(schedule)
+	buckets := []retentionBucket{
+		{"daily", schedule.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", schedule.KeepWeekly, isoWeekKey},
+		{"monthly", schedule.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{"yearly", schedule.KeepYearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	seen := make([]map[string]bool, len(buckets))
+	for i := range seen {
+		seen[i] = make(map[string]bool)
+	}
+
+	decisions := make([]*RetentionDecision, 0, len(sorted))
+	kept := 0
+	var oldestKept *time.Time
+	for _, b := range sorted {
+		d := &RetentionDecision{Backup: b, Reasons: []string{}}
+		decisions = append(decisions, d)
+
+		switch {
+		case b.Status == backupInProgress:
+			d.Reasons = append(d.Reasons, "in progress")
+		case !gfs:
+			if schedule.RetentionDays <= 0 {
+				d.Reasons = append(d.Reasons, "no retention configured")
+			} else if withinDays(b) {
+				d.Reasons = append(d.Reasons, fmt.Sprintf("newer than %d days", schedule.RetentionDays))
+			}
+		case b.Status == backupCompleted:
+			if kept < schedule.KeepLast {
+				kept++
+				d.Reasons = append(d.Reasons, fmt.Sprintf("last %d", schedule.KeepLast))
+			}
+			createdAt := b.CreatedAt.In(location)
+			for i, bucket := range buckets {
+				key := bucket.key(createdAt)
+				if bucket.count == 0 || seen[i][key] || len(seen[i]) >= bucket.count {
+					continue
+				}
+				seen[i][key] = true
+				d.Reasons = append(d.Reasons, bucket.name+" "+key)
+			}
+			if withinDays(b) {
+				d.Reasons = append(d.Reasons, fmt.Sprintf("newer than %d days", schedule.RetentionDays))
+			}
+			if len(d.Reasons) > 0 {
+				createdAt := b.CreatedAt
+				oldestKept = &createdAt
+			}
+		}
+		if b.Pinned {
+			d.Reasons = append(d.Reasons, "pinned")
+		}
+		d.Keep = len(d.Reasons) > 0
+	}
+
+	if gfs {
+		// Keep the history of failed runs alongside the backups it sits between
+		for _, d := range decisions {
+			b := d.Backup
+			if d.Keep || b.Status == backupCompleted {
+				continue
+			}
+			if oldestKept != nil && b.CreatedAt.After(*oldestKept) {
+				d.Keep = true
+				d.Reasons = append(d.Reasons, "newer than oldest kept backup")
+			}
+		}
+	}
+
+	return decisions
+}
+
+// PreviewRetention shows which backups a retention policy would keep and
+// delete, without deleting anything. Fields the request leaves unset are
+// taken from the requested schedule, or the connection's newest. With a
+// schedule only the backups it took are considered, as retention does;
+// without one, all of the connection's backups are.
+func (s *BackupService) PreviewRetention(connectionID string, userID uuid.UUID, req *RetentionPreviewRequest) (*RetentionPreview, error) {
+	conn, err := s.connStorage.GetConnection(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if conn.UserID != userID {
+		return nil, errUnauthorized
+	}
+
+	policy := &BackupSchedule{ConnectionID: connectionID}
+	var schedule *BackupSchedule
+	if req.ScheduleID != nil {
+		schedule, err = s.backupRepo.GetBackupScheduleByID(*req.ScheduleID)
+		if err == nil && schedule.ConnectionID != connectionID {
+			err = sql.ErrNoRows
+		}
+	} else {
+		schedule, err = s.backupRepo.GetBackupSchedule(connectionID)
+	}
+	if err != nil && (err != sql.ErrNoRows || req.ScheduleID != nil) {
+		return nil, err
+	}
+	if schedule != nil {
+		*policy = *schedule
+	}
+
+	if req.RetentionDays != nil {
+		if *req.RetentionDays < 0 {
+			return nil, fmt.Errorf("%w: retention_days must not be negative", errInvalidRetention)
+		}
+		policy.RetentionDays = *req.RetentionDays
+	}
+	if err := applyRetentionPolicy(policy, req.RetentionPolicy); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRetention, err)
+	}
+
+	var backups []*Backup
+	if schedule != nil {
+		backups, err = s.backupRepo.GetBackupsByScheduleID(schedule.ID.String())
+	} else {
+		backups, err = s.backupRepo.GetBackupsByConnectionID(connectionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &RetentionPreview{
+		Keep:   []*RetentionDecision{},
+		Delete: []*RetentionDecision{},
+	}
+	for _, d := range planRetention(policy, backups, time.Now()) {
+		if d.Keep {
+			preview.Keep = append(preview.Keep, d)
+		} else {
+			preview.Delete = append(preview.Delete, d)
+		}
+	}
+	return preview, nil
+}
@@ -0,0 +1,226 @@
+package backup
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPlanRetention(t *testing.T) {
+	// Buckets follow the schedule's time zone, which is the server's local
+	// one when it has none, so backups are mostly taken at local times
+	at := func(year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, time.Local)
+	}
+	backup := func(name string, createdAt time.Time, status string) *Backup {
+		return &Backup{Path: name, CreatedAt: createdAt, Status: status}
+	}
+	pinned := func(b *Backup) *Backup {
+		b.Pinned = true
+		return b
+	}
+	now := at(2026, time.March, 15, 12)
+
+	tests := []struct {
+		name     string
+		schedule BackupSchedule
+		backups  []*Backup
+		wantKeep []string
+		// wantReasons are the reasons given for some of the kept backups
+		wantReasons map[string][]string
+	}{
+		{
+			name:     "no retention keeps everything",
+			schedule: BackupSchedule{},
+			backups: []*Backup{
+				backup("new", at(2026, time.March, 14, 2), backupCompleted),
+				backup("failed", at(2021, time.January, 1, 2), backupFailed),
+				backup("old", at(2020, time.January, 1, 2), backupCompleted),
+			},
+			wantKeep:    []string{"new", "failed", "old"},
+			wantReasons: map[string][]string{"old": {"no retention configured"}},
+		},
+		{
+			name:     "retention_days deletes what is older",
+			schedule: BackupSchedule{RetentionDays: 7},
+			backups: []*Backup{
+				backup("1d", now.AddDate(0, 0, -1), backupCompleted),
+				backup("6d", now.AddDate(0, 0, -6), backupFailed),
+				backup("8d", now.AddDate(0, 0, -8), backupCompleted),
+				backup("30d failed", now.AddDate(0, 0, -30), backupFailed),
+				backup("31d running", now.AddDate(0, 0, -31), backupInProgress),
+				pinned(backup("32d pinned", now.AddDate(0, 0, -32), backupCompleted)),
+			},
+			wantKeep: []string{"1d", "6d", "31d running", "32d pinned"},
+			wantReasons: map[string][]string{
+				"1d":          {"newer than 7 days"},
+				"31d running": {"in progress"},
+				"32d pinned":  {"pinned"},
+			},
+		},
+		{
+			name:     "weeks are ISO weeks across the new year",
+			schedule: BackupSchedule{KeepWeekly: 2},
+			backups: []*Backup{
+				// Monday, 2026-W02
+				backup("jan 5", at(2026, time.January, 5, 2), backupCompleted),
+				// Sunday, the last day of 2026-W01
+				backup("jan 4", at(2026, time.January, 4, 2), backupCompleted),
+				// Monday, the first day of 2026-W01 although in 2025
+				backup("dec 29", at(2025, time.December, 29, 2), backupCompleted),
+				// Sunday, 2025-W52
+				backup("dec 28", at(2025, time.December, 28, 2), backupCompleted),
+			},
+			wantKeep: []string{"jan 5", "jan 4"},
+			wantReasons: map[string][]string{
+				"jan 5": {"weekly 2026-W02"},
+				"jan 4": {"weekly 2026-W01"},
+			},
+		},
+		{
+			name:     "ISO week 53",
+			schedule: BackupSchedule{KeepWeekly: 2},
+			backups: []*Backup{
+				// Friday, 2021-W01
+				backup("jan 8 2021", at(2021, time.January, 8, 2), backupCompleted),
+				// Friday, 2020-W53
+				backup("jan 1 2021", at(2021, time.January, 1, 2), backupCompleted),
+				// Monday, 2020-W53
+				backup("dec 28 2020", at(2020, time.December, 28, 2), backupCompleted),
+			},
+			wantKeep: []string{"jan 8 2021", "jan 1 2021"},
+			wantReasons: map[string][]string{
+				"jan 1 2021": {"weekly 2020-W53"},
+			},
+		},
+		{
+			name:     "months and years keep their newest backup",
+			schedule: BackupSchedule{KeepMonthly: 2, KeepYearly: 2},
+			backups: []*Backup{
+				backup("mar 10", at(2026, time.March, 10, 2), backupCompleted),
+				backup("mar 1", at(2026, time.March, 1, 2), backupCompleted),
+				backup("feb 15", at(2026, time.February, 15, 2), backupCompleted),
+				backup("jan 20", at(2026, time.January, 20, 2), backupCompleted),
+				backup("dec 31 2025", at(2025, time.December, 31, 23), backupCompleted),
+				backup("jun 1 2025", at(2025, time.June, 1, 2), backupCompleted),
+				backup("dec 31 2024", at(2024, time.December, 31, 2), backupCompleted),
+			},
+			wantKeep: []string{"mar 10", "feb 15", "dec 31 2025"},
+			wantReasons: map[string][]string{
+				"mar 10":      {"monthly 2026-03", "yearly 2026"},
+				"feb 15":      {"monthly 2026-02"},
+				"dec 31 2025": {"yearly 2025"},
+			},
+		},
+		{
+			name:     "in progress backups do not count toward keep_last",
+			schedule: BackupSchedule{KeepLast: 2},
+			backups: []*Backup{
+				backup("running", at(2026, time.March, 15, 2), backupInProgress),
+				backup("a", at(2026, time.March, 14, 2), backupCompleted),
+				backup("b", at(2026, time.March, 13, 2), backupCompleted),
+				backup("c", at(2026, time.March, 12, 2), backupCompleted),
+			},
+			wantKeep: []string{"running", "a", "b"},
+			wantReasons: map[string][]string{
+				"running": {"in progress"},
+				"a":       {"last 2"},
+			},
+		},
+		{
+			name:     "pinned backups are kept outside every bucket",
+			schedule: BackupSchedule{KeepLast: 1},
+			backups: []*Backup{
+				backup("newest", at(2026, time.March, 14, 2), backupCompleted),
+				backup("failed", at(2026, time.March, 13, 2), backupFailed),
+				pinned(backup("pinned", at(2026, time.March, 12, 2), backupCompleted)),
+				backup("oldest", at(2026, time.March, 11, 2), backupCompleted),
+			},
+			wantKeep:    []string{"newest", "pinned"},
+			wantReasons: map[string][]string{"pinned": {"pinned"}},
+		},
+		{
+			name:     "keep_last and daily overlap",
+			schedule: BackupSchedule{KeepLast: 2, KeepDaily: 2},
+			backups: []*Backup{
+				backup("d3 evening", at(2026, time.March, 13, 18), backupCompleted),
+				backup("d3 morning", at(2026, time.March, 13, 6), backupCompleted),
+				backup("d3 failed", at(2026, time.March, 13, 3), backupFailed),
+				backup("d2 evening", at(2026, time.March, 12, 18), backupCompleted),
+				backup("d2 failed", at(2026, time.March, 12, 9), backupFailed),
+				backup("d2 morning", at(2026, time.March, 12, 6), backupCompleted),
+				backup("d1", at(2026, time.March, 11, 12), backupCompleted),
+			},
+			// The failed run between kept backups stays; d2 failed is older
+			// than the oldest kept one, d2 evening
+			wantKeep: []string{"d3 evening", "d3 morning", "d3 failed", "d2 evening"},
+			wantReasons: map[string][]string{
+				"d3 evening": {"last 2", "daily 2026-03-13"},
+				"d3 morning": {"last 2"},
+				"d3 failed":  {"newer than oldest kept backup"},
+				"d2 evening": {"daily 2026-03-12"},
+			},
+		},
+		{
+			name:     "retention_days keeps everything newer on top of GFS",
+			schedule: BackupSchedule{KeepLast: 1, RetentionDays: 3},
+			backups: []*Backup{
+				backup("1d", now.AddDate(0, 0, -1), backupCompleted),
+				backup("2d", now.AddDate(0, 0, -2), backupCompleted),
+				backup("4d", now.AddDate(0, 0, -4), backupCompleted),
+			},
+			wantKeep: []string{"1d", "2d"},
+			wantReasons: map[string][]string{
+				"1d": {"last 1", "newer than 3 days"},
+				"2d": {"newer than 3 days"},
+			},
+		},
+		{
+			name:     "daily buckets follow the schedule's time zone",
+			schedule: BackupSchedule{KeepDaily: 2, Timezone: "Asia/Tokyo"},
+			backups: []*Backup{
+				// 00:30 on March 14 in Tokyo, still March 13 in UTC
+				backup("tokyo mar 14 00:30", time.Date(2026, time.March, 13, 15, 30, 0, 0, time.UTC), backupCompleted),
+				backup("tokyo mar 13 23:00", time.Date(2026, time.March, 13, 14, 0, 0, 0, time.UTC), backupCompleted),
+				backup("tokyo mar 13 09:00", time.Date(2026, time.March, 13, 0, 0, 0, 0, time.UTC), backupCompleted),
+			},
+			wantKeep: []string{"tokyo mar 14 00:30", "tokyo mar 13 23:00"},
+			wantReasons: map[string][]string{
+				"tokyo mar 14 00:30": {"daily 2026-03-14"},
+				"tokyo mar 13 23:00": {"daily 2026-03-13"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Order must not matter
+			backups := slices.Clone(tt.backups)
+			slices.Reverse(backups)
+
+			decisions := planRetention(&tt.schedule, backups, now)
+			if len(decisions) != len(tt.backups) {
+				t.Fatalf("got %d decisions for %d backups", len(decisions), len(tt.backups))
+			}
+			var kept, deleted []string
+			for i, d := range decisions {
+				if i > 0 && d.Backup.CreatedAt.After(decisions[i-1].Backup.CreatedAt) {
+					t.Errorf("decisions are not newest first: %s after %s", d.Backup.Path, decisions[i-1].Backup.Path)
+				}
+				if d.Keep {
+					kept = append(kept, d.Backup.Path)
+				} else {
+					deleted = append(deleted, d.Backup.Path)
+					if len(d.Reasons) != 0 {
+						t.Errorf("%s is deleted with reasons %v", d.Backup.Path, d.Reasons)
+					}
+				}
+				if want, ok := tt.wantReasons[d.Backup.Path]; ok && !slices.Equal(d.Reasons, want) {
+					t.Errorf("%s kept for %v, want %v", d.Backup.Path, d.Reasons, want)
+				}
+			}
+			if !slices.Equal(kept, tt.wantKeep) {
+				t.Errorf("kept %v, want %v (deleted %v)", kept, tt.wantKeep, deleted)
+			}
+		})
+	}
+}
@@ -2,30 +2,58 @@ package backup
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/dendianugerah/velld/internal/settings"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 )
 
 type S3Config struct {
-	Endpoint   string
-	Region     string
-	Bucket     string
-	AccessKey  string
-	SecretKey  string
-	UseSSL     bool
-	PathPrefix string
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// StorageClass, such as STANDARD_IA, is set on every upload when given.
+	StorageClass string
+	// ServerSideEncryption is "sse-s3", "sse-kms" with an optional KMSKeyID,
+	// or empty for the bucket default.
+	ServerSideEncryption string
+	KMSKeyID             string
+	// ObjectLockMode is "governance" or "compliance" to put uploaded backups
+	// under object-lock retention. The bucket must have object lock enabled.
+	ObjectLockMode string
+	// DisableBucketCreation makes a missing bucket an error instead of
+	// creating it.
+	DisableBucketCreation bool
 }
 
+// checksumMetadataKey is the user metadata key holding an object's SHA-256.
+const checksumMetadataKey = "sha256"
+
+// streamPartSize is the multipart upload part size for objects of unknown
+// size. S3 allows 10000 parts, so streamed objects are capped at 640 GiB.
+const streamPartSize = 64 << 20
+
+// resumeMinPartSize is the smallest part size of resumable uploads.
+const resumeMinPartSize = 16 << 20
+
 type S3Storage struct {
-	client *minio.Client
-	bucket string
-	prefix string
+	client       *minio.Client
+	bucket       string
+	storageClass string
+	sse          encrypt.ServerSide
+	lockMode     minio.RetentionMode
 }
 
 func NewS3Storage(config S3Config) (*S3Storage, error) {
@@ -38,6 +66,34 @@ func NewS3Storage(config S3Config) (*S3Storage, error) {
 		return nil, fmt.Errorf("failed to create S3 client: %w", err)
 	}
 
+	storage := &S3Storage{
+		client:       client,
+		bucket:       config.Bucket,
+		storageClass: config.StorageClass,
+	}
+
+	switch config.ServerSideEncryption {
+	case "":
+	case settings.S3EncryptionSSES3:
+		storage.sse = encrypt.NewSSE()
+	case settings.S3EncryptionSSEKMS:
+		if storage.sse, err = encrypt.NewSSEKMS(config.KMSKeyID, nil); err != nil {
+			return nil, fmt.Errorf("invalid KMS encryption: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported server-side encryption: %s", config.ServerSideEncryption)
+	}
+
+	switch config.ObjectLockMode {
+	case "":
+	case settings.S3ObjectLockGovernance:
+		storage.lockMode = minio.Governance
+	case settings.S3ObjectLockCompliance:
+		storage.lockMode = minio.Compliance
+	default:
+		return nil, fmt.Errorf("unsupported object lock mode: %s", config.ObjectLockMode)
+	}
+
 	ctx := context.Background()
 	exists, err := client.BucketExists(ctx, config.Bucket)
 	if err != nil {
@@ -45,106 +101,225 @@ func NewS3Storage(config S3Config) (*S3Storage, error) {
 	}
 
 	if !exists {
+		if config.DisableBucketCreation {
+			return nil, fmt.Errorf("bucket %s does not exist and bucket creation is disabled", config.Bucket)
+		}
 		err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{
-			Region: config.Region,
+			Region:        config.Region,
+			ObjectLocking: storage.lockMode != "",
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create bucket: %w", err)
 		}
+	} else if storage.lockMode != "" {
+		// Object lock can only be turned on when a bucket is created, so
+		// fail now rather than on every upload
+		objectLock, _, _, _, err := client.GetObjectLockConfig(ctx, config.Bucket)
+		if err != nil || objectLock != "Enabled" {
+			return nil, fmt.Errorf("bucket %s does not have object lock enabled", config.Bucket)
+		}
 	}
 
-	return &S3Storage{
-		client: client,
-		bucket: config.Bucket,
-		prefix: config.PathPrefix,
-	}, nil
+	return storage, nil
 }
 
-func (s *S3Storage) UploadFile(ctx context.Context, localPath string) (string, error) {
-	file, err := os.Open(localPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+// putOptions returns the options every upload is made with, including the
+// object lock asked for by ctx.
+func (s *S3Storage) putOptions(ctx context.Context, checksum string) minio.PutObjectOptions {
+	opts := minio.PutObjectOptions{
+		ContentType:          "application/octet-stream",
+		StorageClass:         s.storageClass,
+		ServerSideEncryption: s.sse,
 	}
-	defer file.Close()
+	if checksum != "" {
+		opts.UserMetadata = map[string]string{checksumMetadataKey: checksum}
+	}
+	s.setObjectLock(ctx, &opts)
+	return opts
+}
 
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return "", fmt.Errorf("failed to stat file: %w", err)
+// setObjectLock sets the retention asked for by ctx on opts when object
+// lock is configured.
+func (s *S3Storage) setObjectLock(ctx context.Context, opts *minio.PutObjectOptions) {
+	if until, ok := objectLockFrom(ctx); ok && s.lockMode != "" {
+		opts.Mode = s.lockMode
+		opts.RetainUntilDate = until
 	}
+}
 
-	fileName := filepath.Base(localPath)
-	objectKey := s.getObjectKey(fileName)
+// wrapNotFound turns S3's missing-object errors into errStorageNotFound.
+func (s *S3Storage) wrapNotFound(err error, key string) error {
+	var resp minio.ErrorResponse
+	if errors.As(err, &resp) && resp.Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %s", errStorageNotFound, key)
+	}
+	return err
+}
 
-	_, err = s.client.PutObject(ctx, s.bucket, objectKey, file, fileInfo.Size(), minio.PutObjectOptions{
-		ContentType: "application/octet-stream",
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload to S3: %w", err)
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	opts := s.putOptions(ctx, checksum)
+	opts.SendContentMd5 = true
+	if size < 0 {
+		opts.PartSize = streamPartSize
 	}
 
-	return objectKey, nil
+	if _, err := s.client.PutObject(ctx, s.bucket, key, r, size, opts); err != nil {
+		return fmt.Errorf("failed to upload to S3: %w", err)
+	}
+	return nil
 }
 
-// UploadFileWithPath uploads a file to S3 with a custom subfolder path
-func (s *S3Storage) UploadFileWithPath(ctx context.Context, localPath string, subfolder string) (string, error) {
-	file, err := os.Open(localPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open file: %w", err)
+// resumePartSize returns the part size of a resumable upload. It depends
+// only on the object size so a retry splits the file the same way and can
+// reuse the parts already uploaded.
+func resumePartSize(size int64) int64 {
+	partSize := int64(resumeMinPartSize)
+	// S3 allows at most 10000 parts
+	if perPart := (size + 9999) / 10000; perPart > partSize {
+		partSize = perPart
 	}
-	defer file.Close()
+	return partSize
+}
 
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return "", fmt.Errorf("failed to stat file: %w", err)
+func isNoSuchUpload(err error) bool {
+	return minio.ToErrorResponse(err).Code == minio.NoSuchUpload
+}
+
+// PutResumable uploads r in parts. When uploadID is still open, parts it
+// already holds are kept if their MD5 matches the local data; an upload the
+// bucket no longer knows is started again. Objects that fit in one part
+// are uploaded with Put. With SSE-KMS part ETags are not MD5s, so a resumed
+// upload sends every part again. A resumed upload may have been started
+// without the object lock asked for by ctx, so its object is locked once
+// complete.
+func (s *S3Storage) PutResumable(ctx context.Context, key string, r io.ReaderAt, size int64, checksum, uploadID string, onStart func(uploadID string)) error {
+	partSize := resumePartSize(size)
+	if size <= partSize {
+		if uploadID != "" {
+			if err := s.AbortUpload(ctx, key, uploadID); err != nil {
+				fmt.Printf("Warning: Failed to abort stale upload of %s: %v\n", key, err)
+			}
+		}
+		return s.Put(ctx, key, io.NewSectionReader(r, 0, size), size, checksum)
 	}
 
-	fileName := filepath.Base(localPath)
-	objectKey := s.getObjectKeyWithPath(fileName, subfolder)
+	core := minio.Core{Client: s.client}
+	uploaded := map[int]minio.ObjectPart{}
+	resumed := false
+	if uploadID != "" {
+		parts, err := s.uploadedParts(ctx, core, key, uploadID)
+		switch {
+		case err == nil:
+			uploaded = parts
+			resumed = true
+		case isNoSuchUpload(err):
+			uploadID = ""
+		default:
+			return fmt.Errorf("failed to list uploaded parts: %w", err)
+		}
+	}
 
-	_, err = s.client.PutObject(ctx, s.bucket, objectKey, file, fileInfo.Size(), minio.PutObjectOptions{
-		ContentType: "application/octet-stream",
-	})
-	if err != nil {
-		return "", fmt.Errorf("failed to upload to S3: %w", err)
+	if uploadID == "" {
+		id, err := core.NewMultipartUpload(ctx, s.bucket, key, s.putOptions(ctx, checksum))
+		if err != nil {
+			return fmt.Errorf("failed to start multipart upload: %w", err)
+		}
+		uploadID = id
+		onStart(uploadID)
 	}
 
-	return objectKey, nil
-}
+	var parts []minio.CompletePart
+	for partNumber, offset := 1, int64(0); offset < size; partNumber, offset = partNumber+1, offset+partSize {
+		length := partSize
+		if size-offset < length {
+			length = size - offset
+		}
 
-func (s *S3Storage) DownloadFile(ctx context.Context, objectKey, localPath string) error {
-	object, err := s.client.GetObject(ctx, s.bucket, objectKey, minio.GetObjectOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to get object from S3: %w", err)
+		hasher := md5.New()
+		if _, err := io.Copy(hasher, io.NewSectionReader(r, offset, length)); err != nil {
+			return fmt.Errorf("failed to read part %d: %w", partNumber, err)
+		}
+		sum := hasher.Sum(nil)
+
+		if part, ok := uploaded[partNumber]; ok && part.Size == length && strings.Trim(part.ETag, `"`) == hex.EncodeToString(sum) {
+			parts = append(parts, minio.CompletePart{PartNumber: partNumber, ETag: part.ETag})
+			continue
+		}
+
+		part, err := core.PutObjectPart(ctx, s.bucket, key, uploadID, partNumber,
+			io.NewSectionReader(r, offset, length), length,
+			minio.PutObjectPartOptions{Md5Base64: base64.StdEncoding.EncodeToString(sum)})
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+		}
+		parts = append(parts, minio.CompletePart{PartNumber: partNumber, ETag: part.ETag})
 	}
-	defer object.Close()
 
-	file, err := os.Create(localPath)
-	if err != nil {
-		return fmt.Errorf("failed to create local file: %w", err)
+	var completeOpts minio.PutObjectOptions
+	s.setObjectLock(ctx, &completeOpts)
+	if _, err := core.CompleteMultipartUpload(ctx, s.bucket, key, uploadID, parts, completeOpts); err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
 	}
-	defer file.Close()
+	if until, ok := objectLockFrom(ctx); ok && resumed {
+		return s.LockObject(ctx, key, until)
+	}
+	return nil
+}
 
-	_, err = io.Copy(file, object)
-	if err != nil {
-		return fmt.Errorf("failed to download from S3: %w", err)
+// uploadedParts returns the parts of an open multipart upload by number.
+func (s *S3Storage) uploadedParts(ctx context.Context, core minio.Core, key, uploadID string) (map[int]minio.ObjectPart, error) {
+	parts := map[int]minio.ObjectPart{}
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, s.bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range result.ObjectParts {
+			parts[part.PartNumber] = part
+		}
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
 	}
+}
 
+func (s *S3Storage) AbortUpload(ctx context.Context, key, uploadID string) error {
+	core := minio.Core{Client: s.client}
+	if err := core.AbortMultipartUpload(ctx, s.bucket, key, uploadID); err != nil && !isNoSuchUpload(err) {
+		return fmt.Errorf("failed to abort multipart upload: %w", err)
+	}
 	return nil
 }
 
-func (s *S3Storage) DeleteFile(ctx context.Context, objectKey string) error {
-	err := s.client.RemoveObject(ctx, s.bucket, objectKey, minio.RemoveObjectOptions{})
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object from S3: %w", err)
+	}
+	// GetObject is lazy; stat it so a missing object fails here rather than
+	// on the first read
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, s.wrapNotFound(err, key)
+	}
+	return object, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to delete object from S3: %w", err)
 	}
 	return nil
 }
 
-func (s *S3Storage) ListFiles(ctx context.Context) ([]string, error) {
-	var files []string
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]StorageObject, error) {
+	var objects []StorageObject
 
 	opts := minio.ListObjectsOptions{
-		Prefix:    s.prefix,
+		Prefix:    prefix,
 		Recursive: true,
 	}
 
@@ -152,81 +327,160 @@ func (s *S3Storage) ListFiles(ctx context.Context) ([]string, error) {
 		if object.Err != nil {
 			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
 		}
-		files = append(files, object.Key)
+		objects = append(objects, StorageObject{
+			Key:     object.Key,
+			Size:    object.Size,
+			ModTime: object.LastModified,
+		})
 	}
 
-	return files, nil
+	return objects, nil
 }
 
-func (s *S3Storage) GetFileSize(ctx context.Context, objectKey string) (int64, error) {
-	info, err := s.client.StatObject(ctx, s.bucket, objectKey, minio.StatObjectOptions{})
+// Stat returns an object's size and the sha256 metadata stored with it,
+// which is empty for objects uploaded without a checksum.
+func (s *S3Storage) Stat(ctx context.Context, key string) (*StorageObject, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
 	if err != nil {
-		return 0, fmt.Errorf("failed to stat object: %w", err)
+		return nil, s.wrapNotFound(err, key)
+	}
+
+	object := &StorageObject{Key: key, Size: info.Size, ModTime: info.LastModified}
+	for k, value := range info.UserMetadata {
+		if strings.EqualFold(k, checksumMetadataKey) {
+			object.Checksum = value
+		}
 	}
-	return info.Size, nil
+	return object, nil
 }
 
-func (s *S3Storage) TestConnection(ctx context.Context) error {
-	exists, err := s.client.BucketExists(ctx, s.bucket)
-	if err != nil {
-		return fmt.Errorf("failed to check bucket: %w", err)
+// LocksObjects reports whether an object lock mode is configured.
+func (s *S3Storage) LocksObjects() bool {
+	return s.lockMode != ""
+}
+
+// LockObject puts an existing object under the configured object-lock
+// retention until the given time. It does nothing when object lock is not
+// configured.
+func (s *S3Storage) LockObject(ctx context.Context, key string, until time.Time) error {
+	if s.lockMode == "" {
+		return nil
 	}
-	if !exists {
-		return fmt.Errorf("bucket does not exist: %s", s.bucket)
+	mode := s.lockMode
+	err := s.client.PutObjectRetention(ctx, s.bucket, key, minio.PutObjectRetentionOptions{
+		Mode:            &mode,
+		RetainUntilDate: &until,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set object retention: %w", err)
 	}
 	return nil
 }
 
-func (s *S3Storage) getObjectKey(fileName string) string {
-	if s.prefix == "" {
-		return fileName
+// Move moves/renames an object in S3 (copy then delete). With object lock
+// the copy keeps the source's retention; deleting the source then only
+// hides it behind a delete marker, and its locked version is left to expire.
+func (s *S3Storage) Move(ctx context.Context, oldKey, newKey string) error {
+	if err := s.copyObject(ctx, oldKey, newKey, nil); err != nil {
+		return err
+	}
+
+	// Delete old object
+	err := s.client.RemoveObject(ctx, s.bucket, oldKey, minio.RemoveObjectOptions{})
+	if err != nil {
+		if s.lockMode != "" {
+			// The copy is in place, so the rename stands even if the locked
+			// source stays visible until its retention ends
+			fmt.Printf("Warning: Leaving locked object %s in place after copying it to %s: %v\n", oldKey, newKey, err)
+			return nil
+		}
+		return fmt.Errorf("failed to delete old object: %w", err)
 	}
-	
-	// Ensure prefix doesn't end with / and fileName doesn't start with /
-	prefix := strings.TrimSuffix(s.prefix, "/")
-	fileName = strings.TrimPrefix(fileName, "/")
-	return fmt.Sprintf("%s/%s", prefix, fileName)
+
+	return nil
+}
+
+// SetChecksum stores the checksum of an object uploaded without one, such
+// as a streamed dump, by copying the object onto itself with the checksum
+// added to its metadata. With object lock the copy takes the same
+// retention, and the version without the checksum is left to expire.
+func (s *S3Storage) SetChecksum(ctx context.Context, key, checksum string) error {
+	return s.copyObject(ctx, key, key, map[string]string{checksumMetadataKey: checksum})
 }
 
-func (s *S3Storage) getObjectKeyWithPath(fileName string, subfolder string) string {
-	// Build path: prefix/subfolder/fileName
-	var parts []string
-	
-	if s.prefix != "" {
-		parts = append(parts, strings.TrimSuffix(s.prefix, "/"))
+// copyObject copies an object server-side, in parts when it is too large
+// for a single copy. The copy keeps the source's content type, metadata
+// with the entries of extra set on top, storage class and, with object
+// lock, retention, and is encrypted as configured.
+func (s *S3Storage) copyObject(ctx context.Context, srcKey, dstKey string, extra map[string]string) error {
+	info, err := s.client.StatObject(ctx, s.bucket, srcKey, minio.StatObjectOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to copy object: %w", s.wrapNotFound(err, srcKey))
 	}
-	
-	if subfolder != "" {
-		parts = append(parts, strings.Trim(subfolder, "/"))
+
+	// A copy only takes a storage class along with replaced metadata, so
+	// the source's metadata is carried over with the configured class, or
+	// the source's own when none is
+	metadata := make(map[string]string, len(info.UserMetadata)+len(extra)+1)
+	for k, v := range info.UserMetadata {
+		metadata[k] = v
+	}
+	for k, v := range extra {
+		for existing := range metadata {
+			if strings.EqualFold(existing, k) {
+				delete(metadata, existing)
+			}
+		}
+		metadata[k] = v
+	}
+	storageClass := s.storageClass
+	if storageClass == "" {
+		storageClass = info.StorageClass
+	}
+	if storageClass != "" {
+		metadata["X-Amz-Storage-Class"] = storageClass
 	}
-	
-	parts = append(parts, strings.TrimPrefix(fileName, "/"))
-	
-	return strings.Join(parts, "/")
-}
 
-// MoveFile moves/renames an object in S3 (copy then delete)
-func (s *S3Storage) MoveFile(ctx context.Context, oldKey, newKey string) error {
-	// Copy to new location
 	src := minio.CopySrcOptions{
 		Bucket: s.bucket,
-		Object: oldKey,
+		Object: srcKey,
 	}
 	dst := minio.CopyDestOptions{
-		Bucket: s.bucket,
-		Object: newKey,
+		Bucket:          s.bucket,
+		Object:          dstKey,
+		Encryption:      s.sse,
+		ContentType:     info.ContentType,
+		UserMetadata:    metadata,
+		ReplaceMetadata: true,
 	}
-	
-	_, err := s.client.CopyObject(ctx, dst, src)
-	if err != nil {
-		return fmt.Errorf("failed to copy object: %w", err)
+	if s.lockMode != "" {
+		mode, until, err := s.objectRetention(ctx, srcKey)
+		if err != nil {
+			return fmt.Errorf("failed to get object retention: %w", err)
+		}
+		if mode != "" {
+			dst.Mode = mode
+			dst.RetainUntilDate = until
+		}
 	}
+	if _, err := s.client.ComposeObject(ctx, dst, src); err != nil {
+		return fmt.Errorf("failed to copy object: %w", s.wrapNotFound(err, srcKey))
+	}
+	return nil
+}
 
-	// Delete old object
-	err = s.client.RemoveObject(ctx, s.bucket, oldKey, minio.RemoveObjectOptions{})
+// objectRetention returns the object-lock retention of an object still in
+// effect, or an empty mode for an object without one.
+func (s *S3Storage) objectRetention(ctx context.Context, key string) (minio.RetentionMode, time.Time, error) {
+	mode, until, err := s.client.GetObjectRetention(ctx, s.bucket, key, "")
+	if minio.ToErrorResponse(err).Code == "NoSuchObjectLockConfiguration" {
+		return "", time.Time{}, nil
+	}
 	if err != nil {
-		return fmt.Errorf("failed to delete old object: %w", err)
+		return "", time.Time{}, s.wrapNotFound(err, key)
 	}
-
-	return nil
+	if mode == nil || until == nil || !until.After(time.Now()) {
+		return "", time.Time{}, nil
+	}
+	return *mode, *until, nil
 }
@@ -0,0 +1,207 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/settings"
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+)
+
+// minioConfig returns the address and keys of the MinIO server at
+// VELLD_TEST_MINIO_ENDPOINT, such as 127.0.0.1:9000, skipping the test when
+// it is not set. Keys default to MinIO's minioadmin and can be set with
+// VELLD_TEST_MINIO_ACCESS_KEY and VELLD_TEST_MINIO_SECRET_KEY.
+// docker-compose.test.yml starts one.
+func minioConfig(t *testing.T) S3Config {
+	t.Helper()
+	config := S3Config{
+		Endpoint:  os.Getenv("VELLD_TEST_MINIO_ENDPOINT"),
+		AccessKey: os.Getenv("VELLD_TEST_MINIO_ACCESS_KEY"),
+		SecretKey: os.Getenv("VELLD_TEST_MINIO_SECRET_KEY"),
+	}
+	if config.Endpoint == "" {
+		t.Skip("VELLD_TEST_MINIO_ENDPOINT is not set")
+	}
+	if config.AccessKey == "" {
+		config.AccessKey, config.SecretKey = "minioadmin", "minioadmin"
+	}
+	return config
+}
+
+// newMinIOStorage returns storage on a new bucket of the test MinIO server,
+// created with the options of config.
+func newMinIOStorage(t *testing.T, config S3Config) *S3Storage {
+	t.Helper()
+	server := minioConfig(t)
+	config.Endpoint, config.AccessKey, config.SecretKey = server.Endpoint, server.AccessKey, server.SecretKey
+	config.Bucket = "velld-test-" + uuid.NewString()
+
+	storage, err := NewS3Storage(config)
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	return storage
+}
+
+func TestS3Storage(t *testing.T) {
+	storage := newMinIOStorage(t, S3Config{})
+	testStorage(t, storage, "backups", bytes.Repeat([]byte("backup data "), 100000))
+}
+
+// TestS3StorageMoveKeepsOptions checks a moved object keeps its storage
+// class and checksum, and its encryption when VELLD_TEST_MINIO_SSE is set;
+// MinIO only encrypts with a KMS configured.
+func TestS3StorageMoveKeepsOptions(t *testing.T) {
+	config := S3Config{StorageClass: "REDUCED_REDUNDANCY"}
+	encrypted := os.Getenv("VELLD_TEST_MINIO_SSE") != ""
+	if encrypted {
+		config.ServerSideEncryption = settings.S3EncryptionSSES3
+	}
+	storage := newMinIOStorage(t, config)
+	ctx := context.Background()
+
+	key := storageKey("backups", "conn-1", "db.sql.gz")
+	checksum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if err := storage.Put(ctx, key, bytes.NewReader([]byte("test")), 4, checksum); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	moved := storageKey("backups", "conn-1", "archive", "db.sql.gz")
+	if err := storage.Move(ctx, key, moved); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+
+	info, err := storage.client.StatObject(ctx, storage.bucket, moved, minio.StatObjectOptions{})
+	if err != nil {
+		t.Fatalf("StatObject: %v", err)
+	}
+	if info.StorageClass != "REDUCED_REDUNDANCY" {
+		t.Errorf("moved object has storage class %q, want REDUCED_REDUNDANCY", info.StorageClass)
+	}
+	if sse := info.Metadata.Get("X-Amz-Server-Side-Encryption"); encrypted && sse != "AES256" {
+		t.Errorf("moved object has server-side encryption %q, want AES256", sse)
+	}
+	if object, err := storage.Stat(ctx, moved); err != nil || object.Checksum != checksum {
+		t.Errorf("Stat of moved object = %v, %v, want checksum %q", object, err, checksum)
+	}
+}
+
+// TestS3StorageSetChecksum checks a streamed object given its checksum
+// afterwards keeps its content and storage class.
+func TestS3StorageSetChecksum(t *testing.T) {
+	storage := newMinIOStorage(t, S3Config{StorageClass: "REDUCED_REDUNDANCY"})
+	ctx := context.Background()
+
+	key := storageKey("backups", "conn-1", "streamed.sql.gz")
+	if err := storage.Put(ctx, key, bytes.NewReader([]byte("test")), -1, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	checksum := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	if err := storage.SetChecksum(ctx, key, checksum); err != nil {
+		t.Fatalf("SetChecksum: %v", err)
+	}
+	if object, err := storage.Stat(ctx, key); err != nil || object.Checksum != checksum || object.Size != 4 {
+		t.Errorf("Stat = %v, %v, want 4 bytes with checksum %q", object, err, checksum)
+	}
+	info, err := storage.client.StatObject(ctx, storage.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		t.Fatalf("StatObject: %v", err)
+	}
+	if info.StorageClass != "REDUCED_REDUNDANCY" {
+		t.Errorf("object has storage class %q, want REDUCED_REDUNDANCY", info.StorageClass)
+	}
+}
+
+func TestS3PutOptionsObjectLock(t *testing.T) {
+	until := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ctx := withObjectLock(context.Background(), until)
+
+	locking := &S3Storage{lockMode: minio.Compliance}
+	opts := locking.putOptions(ctx, "abc")
+	if opts.Mode != minio.Compliance || !opts.RetainUntilDate.Equal(until) {
+		t.Errorf("put options lock %q until %v, want %s until %v", opts.Mode, opts.RetainUntilDate, minio.Compliance, until)
+	}
+	if opts.UserMetadata[checksumMetadataKey] != "abc" {
+		t.Errorf("put options metadata = %v, want the checksum", opts.UserMetadata)
+	}
+	if opts := locking.putOptions(context.Background(), ""); opts.Mode != "" || !opts.RetainUntilDate.IsZero() {
+		t.Errorf("put options without a lock asked for lock %q until %v", opts.Mode, opts.RetainUntilDate)
+	}
+
+	// A bucket without object lock ignores the request
+	if opts := (&S3Storage{}).putOptions(ctx, ""); opts.Mode != "" || !opts.RetainUntilDate.IsZero() {
+		t.Errorf("put options without object lock lock %q until %v", opts.Mode, opts.RetainUntilDate)
+	}
+}
+
+func TestS3StorageObjectLock(t *testing.T) {
+	storage := newMinIOStorage(t, S3Config{ObjectLockMode: settings.S3ObjectLockGovernance})
+	ctx := context.Background()
+	if !storage.LocksObjects() {
+		t.Fatal("storage with a lock mode does not lock objects")
+	}
+
+	checkRetention := func(key string, until time.Time) {
+		t.Helper()
+		mode, retainUntil, err := storage.client.GetObjectRetention(ctx, storage.bucket, key, "")
+		if err != nil {
+			t.Fatalf("GetObjectRetention of %s: %v", key, err)
+		}
+		if mode == nil || *mode != minio.Governance || retainUntil == nil || !retainUntil.Equal(until) {
+			t.Errorf("retention of %s = %v until %v, want %s until %v", key, mode, retainUntil, minio.Governance, until)
+		}
+	}
+
+	// Objects are written locked, whether in one piece, streamed or
+	// resumably in parts
+	until := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	lockCtx := withObjectLock(ctx, until)
+	key := storageKey("backups", "conn-1", "db.sql.gz")
+	if err := storage.Put(lockCtx, key, bytes.NewReader([]byte("test")), 4, ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	checkRetention(key, until)
+	streamed := storageKey("backups", "conn-1", "streamed.sql.gz")
+	if err := storage.Put(lockCtx, streamed, bytes.NewReader([]byte("test")), -1, ""); err != nil {
+		t.Fatalf("Put of unknown size: %v", err)
+	}
+	checkRetention(streamed, until)
+	data := bytes.Repeat([]byte("x"), resumeMinPartSize+1)
+	multipart := storageKey("backups", "conn-1", "multipart.sql.gz")
+	err := storage.PutResumable(lockCtx, multipart, bytes.NewReader(data), int64(len(data)), "", "", func(string) {})
+	if err != nil {
+		t.Fatalf("PutResumable: %v", err)
+	}
+	checkRetention(multipart, until)
+
+	// Objects already stored can be locked for longer
+	later := until.Add(24 * time.Hour)
+	if err := storage.LockObject(ctx, key, later); err != nil {
+		t.Fatalf("LockObject: %v", err)
+	}
+	checkRetention(key, later)
+
+	// Moving copies the retention and leaves the locked source to expire
+	moved := key + ".moved"
+	if err := storage.Move(ctx, key, moved); err != nil {
+		t.Fatalf("Move in a locked bucket: %v", err)
+	}
+	checkRetention(moved, later)
+	if keys := listKeys(t, storage, key); !equalKeys(keys, []string{moved}) {
+		t.Errorf("keys after move = %v, want only %s", keys, moved)
+	}
+
+	// An existing bucket without object lock is refused rather than
+	// failing on every upload
+	config := minioConfig(t)
+	config.Bucket = newMinIOStorage(t, S3Config{}).bucket
+	config.ObjectLockMode = settings.S3ObjectLockGovernance
+	if _, err := NewS3Storage(config); err == nil || !strings.Contains(err.Error(), "does not have object lock enabled") {
+		t.Errorf("NewS3Storage on a bucket without object lock = %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package backup
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/dendianugerah/velld/internal/common"
+	"github.com/dendianugerah/velld/internal/common/response"
+	"github.com/gorilla/mux"
+)
+
+func (h *BackupHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	schedules, err := h.backupService.ListSchedules(userID, r.URL.Query().Get("connection_id"))
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedules retrieved successfully", schedules)
+}
+
+func (h *BackupHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req ScheduleBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.ConnectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+	if req.Name == "" {
+		response.SendError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if !checkScheduleRequest(w, req.CronSchedule, req.RetentionDays, req.RetentionPolicy) {
+		return
+	}
+
+	schedule, err := h.backupService.CreateSchedule(&req, userID)
+	if err != nil {
+		sendScheduleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule created successfully", schedule)
+}
+
+func (h *BackupHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scheduleID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	schedule, err := h.backupService.GetSchedule(scheduleID, userID)
+	if err != nil {
+		sendScheduleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule retrieved successfully", schedule)
+}
+
+func (h *BackupHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scheduleID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req UpdateScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !checkScheduleRequest(w, req.CronSchedule, req.RetentionDays, req.RetentionPolicy) {
+		return
+	}
+
+	schedule, err := h.backupService.UpdateSchedule(scheduleID, userID, &req)
+	if err != nil {
+		sendScheduleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule updated successfully", schedule)
+}
+
+func (h *BackupHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scheduleID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.backupService.DeleteSchedule(scheduleID, userID); err != nil {
+		sendScheduleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedule deleted successfully", nil)
+}
+
+func (h *BackupHandler) GetScheduleRunsByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	scheduleID := vars["id"]
+
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	runs, err := h.backupService.GetScheduleRunsByID(scheduleID, userID)
+	if err != nil {
+		sendScheduleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Schedule runs retrieved successfully", runs)
+}
+
+func (h *BackupHandler) PreviewSchedule(w http.ResponseWriter, r *http.Request) {
+	userID, err := common.GetUserIDFromContext(r.Context())
+	if err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req SchedulePreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.ConnectionID == "" {
+		response.SendError(w, http.StatusBadRequest, "connection_id is required")
+		return
+	}
+	if !checkScheduleRequest(w, req.CronSchedule, req.RetentionDays, req.RetentionPolicy) {
+		return
+	}
+
+	preview, err := h.backupService.PreviewSchedule(&req, userID)
+	if err != nil {
+		sendScheduleError(w, err)
+		return
+	}
+
+	response.SendSuccess(w, "Schedule preview generated successfully", preview)
+}
+
+// ReloadSchedules rebuilds the cron entries of all schedules from the
+// database. It is served under /api/admin, so only users listed in
+// ADMIN_USERNAMES reach it.
+func (h *BackupHandler) ReloadSchedules(w http.ResponseWriter, r *http.Request) {
+	if _, err := common.GetUserIDFromContext(r.Context()); err != nil {
+		response.SendError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	result, err := h.backupService.ReloadSchedules()
+	if err != nil {
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response.SendSuccess(w, "Backup schedules reloaded successfully", result)
+}
+
+// checkScheduleRequest rejects a schedule request without a cron expression
+// or any retention, reporting whether it may go ahead.
+func checkScheduleRequest(w http.ResponseWriter, cronSchedule string, retentionDays int, policy RetentionPolicy) bool {
+	if cronSchedule == "" {
+		response.SendError(w, http.StatusBadRequest, "cron_schedule is required")
+		return false
+	}
+	if retentionDays < 0 || (retentionDays == 0 && !policy.setsRetention()) {
+		response.SendError(w, http.StatusBadRequest, "retention_days must be greater than 0 unless a GFS retention policy is set")
+		return false
+	}
+	return true
+}
+
+func sendScheduleError(w http.ResponseWriter, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		response.SendError(w, http.StatusNotFound, "Schedule not found")
+	case errors.Is(err, errUnauthorized):
+		response.SendError(w, http.StatusForbidden, "Not authorized to access this schedule")
+	case errors.Is(err, errInvalidSchedule):
+		response.SendError(w, http.StatusBadRequest, err.Error())
+	default:
+		response.SendError(w, http.StatusInternalServerError, err.Error())
+	}
+}
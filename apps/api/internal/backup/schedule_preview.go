@@ -0,0 +1,275 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPreviewRuns = 5
+	maxPreviewRuns     = 100
+
+	// sizeSamples is how many recent completed backups sizes and durations
+	// are averaged over.
+	sizeSamples = 10
+
+	// minOverlapWindow is how long a run is assumed to take when its
+	// connection has no completed backups to go by.
+	minOverlapWindow = time.Minute
+
+	// maxSimulatedRuns bounds the runs simulated to estimate how many
+	// backups retention keeps.
+	maxSimulatedRuns = 10000
+)
+
+// PreviewSchedule checks a schedule without saving it: when it would run,
+// which schedules against the same database host it would overlap, and how
+// much storage its backups would take under its retention.
+func (s *BackupService) PreviewSchedule(req *SchedulePreviewRequest, userID uuid.UUID) (*SchedulePreview, error) {
+	conn, err := s.connStorage.GetConnection(req.ConnectionID)
+	if err != nil {
+		return nil, err
+	}
+	if conn.UserID != userID {
+		return nil, errUnauthorized
+	}
+
+	if req.ScheduleID != nil {
+		schedule, err := s.backupRepo.GetBackupScheduleByID(*req.ScheduleID)
+		if err != nil {
+			return nil, err
+		}
+		if schedule.ConnectionID != req.ConnectionID {
+			return nil, sql.ErrNoRows
+		}
+	}
+
+	count := req.Count
+	if count == 0 {
+		count = defaultPreviewRuns
+	}
+	if count < 0 || count > maxPreviewRuns {
+		return nil, fmt.Errorf("%w: count must be between 1 and %d", errInvalidSchedule, maxPreviewRuns)
+	}
+
+	cronSchedule, err := parseSchedule(req.CronSchedule, req.Timezone)
+	if err != nil {
+		return nil, invalidSchedule(err)
+	}
+	policy := &BackupSchedule{RetentionDays: req.RetentionDays, Timezone: req.Timezone}
+	if err := applyRetentionPolicy(policy, req.RetentionPolicy); err != nil {
+		return nil, invalidSchedule(err)
+	}
+
+	description := describeCron(req.CronSchedule)
+	if req.Timezone != "" {
+		description += " (" + req.Timezone + ")"
+	} else {
+		description += " (server time)"
+	}
+	preview := &SchedulePreview{
+		Description: description,
+		NextRuns:    []time.Time{},
+		Overlaps:    []*ScheduleOverlap{},
+		Warnings:    []string{},
+	}
+
+	next := time.Now()
+	for len(preview.NextRuns) < count {
+		next = cronSchedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		preview.NextRuns = append(preview.NextRuns, next)
+	}
+	if len(preview.NextRuns) == 0 {
+		preview.Warnings = append(preview.Warnings, "The schedule never runs")
+		return preview, nil
+	}
+
+	var backups []*Backup
+	if req.ScheduleID != nil {
+		backups, err = s.backupRepo.GetBackupsByScheduleID(*req.ScheduleID)
+	}
+	if err == nil && len(backups) == 0 {
+		backups, err = s.backupRepo.GetBackupsByConnectionID(req.ConnectionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	size, duration, samples := recentBackupStats(backups)
+
+	if runs := preview.NextRuns; samples > 0 && len(runs) > 1 {
+		for i := 1; i < len(runs); i++ {
+			if gap := runs[i].Sub(runs[i-1]); gap < duration {
+				preview.Warnings = append(preview.Warnings, fmt.Sprintf(
+					"Runs can be %s apart, but backups of this connection take about %s; runs that find the previous one still going are skipped",
+					gap, duration.Round(time.Second)))
+				break
+			}
+		}
+	}
+
+	overlaps, err := s.findScheduleOverlaps(conn, req.ScheduleID, userID, preview.NextRuns, max(duration, minOverlapWindow))
+	if err != nil {
+		return nil, err
+	}
+	preview.Overlaps = overlaps
+	for _, o := range overlaps {
+		preview.Warnings = append(preview.Warnings, fmt.Sprintf(
+			"%d of the next %d runs overlap schedule %q of %s, which backs up the same host",
+			o.Runs, len(preview.NextRuns), o.ScheduleName, o.ConnectionName))
+	}
+
+	if samples == 0 {
+		preview.Warnings = append(preview.Warnings, "Storage cannot be estimated until the connection has a completed backup")
+		return preview, nil
+	}
+	retained, approximate := simulateRetention(policy, cronSchedule, time.Now())
+	preview.Storage = &StorageEstimate{
+		RetainedBackups:   retained,
+		AverageBackupSize: size,
+		EstimatedSize:     size * int64(retained),
+		SampleSize:        samples,
+		Approximate:       approximate,
+	}
+	return preview, nil
+}
+
+// findScheduleOverlaps looks for the user's other enabled schedules against
+// the host of conn that would run at the same time as runs, each of which
+// is assumed to take window.
+func (s *BackupService) findScheduleOverlaps(conn *connection.StoredConnection, scheduleID *string, userID uuid.UUID, runs []time.Time, window time.Duration) ([]*ScheduleOverlap, error) {
+	schedules, err := s.backupRepo.ListBackupSchedules(userID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	host := hostKey(conn)
+	conns := map[string]*connection.StoredConnection{conn.ID: conn}
+	windows := map[string]time.Duration{conn.ID: window}
+	overlaps := []*ScheduleOverlap{}
+	for _, other := range schedules {
+		if !other.Enabled || (scheduleID != nil && other.ID.String() == *scheduleID) {
+			continue
+		}
+		otherConn, ok := conns[other.ConnectionID]
+		if !ok {
+			otherConn, err = s.connStorage.GetConnection(other.ConnectionID)
+			if err != nil {
+				fmt.Printf("Warning: Failed to get connection %s of schedule %s: %v\n", other.ConnectionID, other.ID, err)
+				continue
+			}
+			conns[other.ConnectionID] = otherConn
+		}
+		if hostKey(otherConn) != host {
+			continue
+		}
+		otherSchedule, err := parseSchedule(other.CronSchedule, other.Timezone)
+		if err != nil {
+			continue
+		}
+
+		otherWindow, ok := windows[other.ConnectionID]
+		if !ok {
+			backups, err := s.backupRepo.GetBackupsByConnectionID(other.ConnectionID)
+			if err != nil {
+				return nil, err
+			}
+			_, duration, _ := recentBackupStats(backups)
+			otherWindow = max(duration, minOverlapWindow)
+			windows[other.ConnectionID] = otherWindow
+		}
+
+		var overlap *ScheduleOverlap
+		for _, run := range runs {
+			// The first of its runs still going at run, or starting before
+			// run is over
+			otherRun := otherSchedule.Next(run.Add(-otherWindow))
+			if otherRun.IsZero() || !otherRun.Before(run.Add(window)) {
+				continue
+			}
+			if overlap == nil {
+				overlap = &ScheduleOverlap{
+					ScheduleID:     other.ID,
+					ScheduleName:   other.Name,
+					ConnectionID:   other.ConnectionID,
+					ConnectionName: otherConn.Name,
+					FirstOverlap:   run,
+				}
+				overlaps = append(overlaps, overlap)
+			}
+			overlap.Runs++
+		}
+	}
+	return overlaps, nil
+}
+
+// recentBackupStats averages the size and duration of the newest completed
+// of backups, which are ordered newest first, and says how many it used.
+func recentBackupStats(backups []*Backup) (int64, time.Duration, int) {
+	var size int64
+	var duration time.Duration
+	samples := 0
+	for _, b := range backups {
+		if samples == sizeSamples {
+			break
+		}
+		if b.Status != backupCompleted || b.CompletedTime == nil {
+			continue
+		}
+		size += b.Size
+		duration += b.CompletedTime.Sub(b.StartedTime)
+		samples++
+	}
+	if samples == 0 {
+		return 0, 0, 0
+	}
+	return size / int64(samples), duration / time.Duration(samples), samples
+}
+
+// simulateRetention counts the backups policy keeps once the schedule has
+// run long enough for retention to delete one backup for each it adds. It
+// runs the schedule from now through the longest period policy keeps and
+// applies the retention at the end. Schedules that run more than
+// maxSimulatedRuns times in that period are extrapolated from the runs
+// simulated, and the count reported as approximate.
+func simulateRetention(policy *BackupSchedule, schedule *zonedSchedule, now time.Time) (int, bool) {
+	horizon := retentionHorizon(policy, now).AddDate(0, 0, 1)
+
+	var backups []*Backup
+	next := now
+	for len(backups) < maxSimulatedRuns {
+		next = schedule.Next(next)
+		if next.IsZero() || (next.After(horizon) && len(backups) >= policy.KeepLast) {
+			break
+		}
+		backups = append(backups, &Backup{Status: backupCompleted, CreatedAt: next})
+	}
+	if len(backups) == 0 {
+		return 0, false
+	}
+
+	end := backups[len(backups)-1].CreatedAt
+	kept := 0
+	for _, d := range planRetention(policy, backups, end) {
+		if d.Keep {
+			kept++
+		}
+	}
+	if len(backups) < maxSimulatedRuns || !end.Before(horizon) {
+		return kept, false
+	}
+
+	// Runs newer than RetentionDays grow with the rate, GFS buckets do not
+	simulated := end.Sub(now)
+	perDay := float64(len(backups)) / simulated.Hours() * 24
+	byDays := int(math.Ceil(perDay * float64(policy.RetentionDays)))
+	return max(kept, byDays) + policy.KeepDaily + policy.KeepWeekly +
+		policy.KeepMonthly + policy.KeepYearly, true
+}
@@ -0,0 +1,193 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultMaxAttempts       = 1
+	defaultRetryInitialDelay = 60  // seconds
+	defaultRetryMaxDelay     = 900 // seconds
+	maxRetryAttempts         = 10
+
+	runRetrying = "retrying"
+
+	// scheduleRunHistoryLimit caps the runs returned for a schedule.
+	scheduleRunHistoryLimit = 50
+)
+
+// applyRetryPolicy copies the set fields of policy onto schedule, filling
+// in defaults for a schedule that has none yet.
+func applyRetryPolicy(schedule *BackupSchedule, policy RetryPolicy) error {
+	if policy.MaxAttempts != nil {
+		schedule.MaxAttempts = *policy.MaxAttempts
+	}
+	if policy.RetryInitialDelay != nil {
+		schedule.RetryInitialDelay = *policy.RetryInitialDelay
+	}
+	if policy.RetryMaxDelay != nil {
+		schedule.RetryMaxDelay = *policy.RetryMaxDelay
+	}
+
+	if schedule.MaxAttempts == 0 {
+		schedule.MaxAttempts = defaultMaxAttempts
+	}
+	if schedule.RetryInitialDelay == 0 {
+		schedule.RetryInitialDelay = defaultRetryInitialDelay
+	}
+	if schedule.RetryMaxDelay == 0 {
+		schedule.RetryMaxDelay = defaultRetryMaxDelay
+	}
+
+	if schedule.MaxAttempts < 1 || schedule.MaxAttempts > maxRetryAttempts {
+		return fmt.Errorf("max_attempts must be between 1 and %d", maxRetryAttempts)
+	}
+	if schedule.RetryInitialDelay < 1 {
+		return fmt.Errorf("retry_initial_delay must be at least 1 second")
+	}
+	if schedule.RetryMaxDelay < schedule.RetryInitialDelay {
+		return fmt.Errorf("retry_max_delay must not be less than retry_initial_delay")
+	}
+	return nil
+}
+
+// retryDelay is the wait after the given failed attempt: the initial delay
+// doubled for every earlier retry, capped at the maximum delay.
+func retryDelay(schedule *BackupSchedule, attempt int) time.Duration {
+	delay := time.Duration(schedule.RetryInitialDelay) * time.Second
+	maxDelay := time.Duration(schedule.RetryMaxDelay) * time.Second
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// runScheduleAttempts runs a scheduled backup, retrying failures with
+// exponential backoff, and records every attempt under run. Retries use
+// the schedule as it is saved by then and stop once it is deleted or
+// disabled, or when ctx is cancelled while waiting. Once all attempts have
+// failed the returned error lists each attempt's error.
+func (s *BackupService) runScheduleAttempts(ctx context.Context, schedule *BackupSchedule, run *ScheduleRun) (*Backup, error) {
+	scheduleID := schedule.ID.String()
+	maxAttempts := schedule.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var failures []string
+	for attempt := 1; ; attempt++ {
+		record := &ScheduleRunAttempt{
+			RunID:     run.ID.String(),
+			Attempt:   attempt,
+			StartedAt: time.Now(),
+		}
+
+		jobID, backup, err := s.runScheduledJob(schedule)
+
+		finishedAt := time.Now()
+		record.FinishedAt = &finishedAt
+		record.JobID = jobID
+		switch {
+		case err == nil:
+			record.Status = jobCompleted
+			backupID := backup.ID.String()
+			record.BackupID = &backupID
+		case errors.Is(err, errScheduleBusy):
+			record.Status = jobSkipped
+		case errors.Is(err, errBackupCancelled):
+			record.Status = jobCancelled
+		default:
+			record.Status = jobFailed
+		}
+		if err != nil {
+			msg := err.Error()
+			record.Error = &msg
+		}
+		if recordErr := s.backupRepo.CreateScheduleRunAttempt(record); recordErr != nil {
+			fmt.Printf("Error recording attempt %d of schedule %s: %v\n", attempt, scheduleID, recordErr)
+		}
+
+		if err == nil || errors.Is(err, errScheduleBusy) || errors.Is(err, errBackupCancelled) {
+			return backup, err
+		}
+
+		failures = append(failures, fmt.Sprintf("attempt %d: %v", attempt, err))
+		if attempt >= maxAttempts {
+			if maxAttempts == 1 {
+				return nil, err
+			}
+			return nil, fmt.Errorf("backup failed after %d attempts: %s", attempt, strings.Join(failures, "; "))
+		}
+
+		delay := retryDelay(schedule, attempt)
+		fmt.Printf("Scheduled backup for schedule %s failed (attempt %d/%d), retrying in %s: %v\n",
+			scheduleID, attempt, maxAttempts, delay, err)
+
+		run.Status = runRetrying
+		if err := s.backupRepo.UpdateScheduleRun(run); err != nil {
+			fmt.Printf("Error updating run of schedule %s: %v\n", scheduleID, err)
+		}
+		s.recordScheduleRunStatus(scheduleID, runRetrying)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+
+		// Retry with the schedule as it is saved now, unless it has been
+		// deleted or disabled while waiting
+		current, err := s.backupRepo.GetBackupScheduleByID(scheduleID)
+		switch {
+		case err == sql.ErrNoRows || (err == nil && !current.Enabled):
+			return nil, fmt.Errorf("backup failed after %d attempts, not retrying as the schedule is no longer enabled: %s",
+				attempt, strings.Join(failures, "; "))
+		case ctx.Err() != nil:
+			return nil, fmt.Errorf("%w: not retrying after %d failed attempts as the scheduler no longer runs the schedule: %s",
+				errBackupCancelled, attempt, strings.Join(failures, "; "))
+		case err != nil:
+			fmt.Printf("Error reloading schedule %s, retrying with its previous settings: %v\n", scheduleID, err)
+		default:
+			schedule = current
+		}
+	}
+}
+
+// GetScheduleRuns returns the recent run history of a connection's most
+// recent schedule.
+func (s *BackupService) GetScheduleRuns(connectionID string) ([]*ScheduleRun, error) {
+	schedule, err := s.backupRepo.GetBackupSchedule(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.backupRepo.GetScheduleRuns(schedule.ID.String(), scheduleRunHistoryLimit)
+}
+
+// GetScheduleRunsByID returns the recent run history of one of the user's
+// schedules.
+func (s *BackupService) GetScheduleRunsByID(scheduleID string, userID uuid.UUID) ([]*ScheduleRun, error) {
+	if _, _, err := s.getOwnedSchedule(scheduleID, userID); err != nil {
+		return nil, err
+	}
+	return s.backupRepo.GetScheduleRuns(scheduleID, scheduleRunHistoryLimit)
+}
+
+func newScheduleRun(scheduleID string) *ScheduleRun {
+	return &ScheduleRun{
+		ID:         uuid.New(),
+		ScheduleID: scheduleID,
+		Status:     jobRunning,
+		StartedAt:  time.Now(),
+	}
+}
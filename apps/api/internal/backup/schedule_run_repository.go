@@ -0,0 +1,187 @@
+package backup
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+)
+
+// formatRunTime formats the time of a schedule run in UTC. Runs of
+// schedules with their own time zone would otherwise carry its offset, and
+// run times, which are compared as strings, would not sort in order.
+func formatRunTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatNullableRunTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	str := formatRunTime(*t)
+	return &str
+}
+
+func (r *BackupRepository) CreateScheduleRun(run *ScheduleRun) error {
+	_, err := r.db.Exec(`
+		INSERT INTO backup_schedule_runs (id, schedule_id, status, error, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		run.ID, run.ScheduleID, run.Status, run.Error,
+		formatRunTime(run.StartedAt), formatNullableRunTime(run.FinishedAt))
+	return err
+}
+
+func (r *BackupRepository) UpdateScheduleRun(run *ScheduleRun) error {
+	_, err := r.db.Exec(`
+		UPDATE backup_schedule_runs
+		SET status = $1, error = $2, finished_at = $3
+		WHERE id = $4`,
+		run.Status, run.Error, formatNullableRunTime(run.FinishedAt), run.ID)
+	return err
+}
+
+func (r *BackupRepository) CreateScheduleRunAttempt(attempt *ScheduleRunAttempt) error {
+	result, err := r.db.Exec(`
+		INSERT INTO backup_schedule_run_attempts (
+			run_id, attempt, job_id, backup_id, status, error, started_at, finished_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		attempt.RunID, attempt.Attempt, attempt.JobID, attempt.BackupID,
+		attempt.Status, attempt.Error,
+		formatRunTime(attempt.StartedAt), formatNullableRunTime(attempt.FinishedAt))
+	if err != nil {
+		return err
+	}
+	attempt.ID, err = result.LastInsertId()
+	return err
+}
+
+// GetScheduleRuns returns the most recent runs of a schedule, newest first,
+// with their attempts.
+func (r *BackupRepository) GetScheduleRuns(scheduleID string, limit int) ([]*ScheduleRun, error) {
+	rows, err := r.db.Query(`
+		SELECT id, schedule_id, status, error, started_at, finished_at
+		FROM backup_schedule_runs
+		WHERE schedule_id = $1
+		ORDER BY started_at DESC
+		LIMIT $2`,
+		scheduleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []*ScheduleRun{}
+	runsByID := make(map[string]*ScheduleRun)
+	for rows.Next() {
+		var (
+			startedAtStr  string
+			finishedAtStr sql.NullString
+		)
+		run := &ScheduleRun{Attempts: []*ScheduleRunAttempt{}}
+		if err := rows.Scan(&run.ID, &run.ScheduleID, &run.Status, &run.Error,
+			&startedAtStr, &finishedAtStr); err != nil {
+			return nil, err
+		}
+		if run.StartedAt, err = common.ParseTime(startedAtStr); err != nil {
+			return nil, fmt.Errorf("error parsing started_at: %v", err)
+		}
+		if finishedAtStr.Valid {
+			finishedAt, err := common.ParseTime(finishedAtStr.String)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing finished_at: %v", err)
+			}
+			run.FinishedAt = &finishedAt
+		}
+		runs = append(runs, run)
+		runsByID[run.ID.String()] = run
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(runs) == 0 {
+		return runs, nil
+	}
+
+	attemptRows, err := r.db.Query(`
+		SELECT a.id, a.run_id, a.attempt, a.job_id, a.backup_id, a.status, a.error,
+		       a.started_at, a.finished_at
+		FROM backup_schedule_run_attempts a
+		JOIN backup_schedule_runs r ON r.id = a.run_id
+		WHERE r.schedule_id = $1
+		ORDER BY a.run_id, a.attempt`,
+		scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer attemptRows.Close()
+
+	for attemptRows.Next() {
+		var (
+			startedAtStr  string
+			finishedAtStr sql.NullString
+		)
+		attempt := &ScheduleRunAttempt{}
+		if err := attemptRows.Scan(&attempt.ID, &attempt.RunID, &attempt.Attempt,
+			&attempt.JobID, &attempt.BackupID, &attempt.Status, &attempt.Error,
+			&startedAtStr, &finishedAtStr); err != nil {
+			return nil, err
+		}
+
+		run, ok := runsByID[attempt.RunID]
+		if !ok {
+			continue
+		}
+
+		if attempt.StartedAt, err = common.ParseTime(startedAtStr); err != nil {
+			return nil, fmt.Errorf("error parsing started_at: %v", err)
+		}
+		if finishedAtStr.Valid {
+			finishedAt, err := common.ParseTime(finishedAtStr.String)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing finished_at: %v", err)
+			}
+			attempt.FinishedAt = &finishedAt
+		}
+		run.Attempts = append(run.Attempts, attempt)
+	}
+
+	return runs, attemptRows.Err()
+}
+
+// RecordMissedScheduleRuns adds a missed run to a schedule's history for
+// each of the runs it missed, which are in order, and moves its next run
+// time on to nextRun so they are not recorded again.
+func (r *BackupRepository) RecordMissedScheduleRuns(scheduleID string, runs []*ScheduleRun, nextRun time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO backup_schedule_runs (id, schedule_id, status, error, started_at, finished_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, run := range runs {
+		if _, err := stmt.Exec(run.ID, run.ScheduleID, run.Status, run.Error,
+			formatRunTime(run.StartedAt), formatNullableRunTime(run.FinishedAt)); err != nil {
+			return fmt.Errorf("failed to record missed run: %v", err)
+		}
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	if _, err := tx.Exec(`
+		UPDATE backup_schedules
+		SET next_run_time = $1, last_run_status = $2, last_run_at = $3, updated_at = $4
+		WHERE id = $5`,
+		nextRun.Format(time.RFC3339), runMissed,
+		formatRunTime(runs[len(runs)-1].StartedAt), now, scheduleID); err != nil {
+		return fmt.Errorf("failed to update backup schedule: %v", err)
+	}
+	return tx.Commit()
+}
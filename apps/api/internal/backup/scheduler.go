@@ -0,0 +1,212 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduler keeps a cron entry for every enabled backup schedule. Entries
+// only hold the schedule's ID; the schedule is read from the repository
+// each time its entry fires, so a run always uses the schedule as it is
+// saved. It is safe for concurrent use by handlers, startup recovery and
+// firing entries.
+type scheduler struct {
+	mu      sync.Mutex
+	cron    *cron.Cron
+	entries map[string]*scheduleEntry // by schedule ID
+	// running holds the schedules with a run in progress, retries
+	// included, and cancels the run's context
+	running map[string]context.CancelFunc
+	ctx     context.Context
+	stopCtx context.CancelFunc
+
+	// load reads a schedule from the repository and run runs it
+	load func(scheduleID string) (*BackupSchedule, error)
+	run  func(schedule *BackupSchedule)
+}
+
+// scheduleEntry is the cron entry of a schedule, along with the cron
+// expression and time zone it was registered with.
+type scheduleEntry struct {
+	id       cron.EntryID
+	spec     string
+	timezone string
+}
+
+func newScheduler(load func(string) (*BackupSchedule, error), run func(*BackupSchedule)) *scheduler {
+	ctx, stop := context.WithCancel(context.Background())
+	return &scheduler{
+		cron:    cron.New(cron.WithSeconds()),
+		entries: make(map[string]*scheduleEntry),
+		running: make(map[string]context.CancelFunc),
+		ctx:     ctx,
+		stopCtx: stop,
+		load:    load,
+		run:     run,
+	}
+}
+
+// start starts running entries as they come due.
+func (sc *scheduler) start() {
+	sc.cron.Start()
+}
+
+// stop stops firing entries and cancels the runs in progress.
+func (sc *scheduler) stop() {
+	sc.cron.Stop()
+	sc.stopCtx()
+}
+
+// begin marks a run of the schedule as started. The returned context is
+// cancelled when the schedule's entry is removed or the scheduler stops,
+// and done must be called once the run, retries included, has finished.
+// It reports false if the schedule already has a run in progress.
+func (sc *scheduler) begin(scheduleID string) (ctx context.Context, done func(), ok bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if _, busy := sc.running[scheduleID]; busy {
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithCancel(sc.ctx)
+	sc.running[scheduleID] = cancel
+	return ctx, func() {
+		sc.mu.Lock()
+		delete(sc.running, scheduleID)
+		sc.mu.Unlock()
+		cancel()
+	}, true
+}
+
+// addTask runs fn on a cron expression next to the schedules, for
+// background work such as the integrity sweep.
+func (sc *scheduler) addTask(spec string, fn func()) error {
+	_, err := sc.cron.AddFunc(spec, fn)
+	return err
+}
+
+// register (re)places the cron entry of a schedule.
+func (sc *scheduler) register(schedule *BackupSchedule) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.registerLocked(schedule)
+}
+
+func (sc *scheduler) registerLocked(schedule *BackupSchedule) error {
+	scheduleID := schedule.ID.String()
+	cronSchedule, err := parseSchedule(schedule.CronSchedule, schedule.Timezone)
+	if err != nil {
+		return fmt.Errorf("failed to schedule backup: %v", err)
+	}
+	// A run in progress carries on with the schedule's new settings
+	sc.removeEntryLocked(scheduleID)
+
+	entry := &scheduleEntry{spec: schedule.CronSchedule, timezone: schedule.Timezone}
+	entry.id = sc.cron.Schedule(cronSchedule, cron.FuncJob(func() {
+		sc.fire(scheduleID, entry)
+	}))
+	sc.entries[scheduleID] = entry
+	return nil
+}
+
+// unregister removes the cron entry of a schedule, if it has one, and
+// cancels the context of its run in progress.
+func (sc *scheduler) unregister(scheduleID string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.removeLocked(scheduleID)
+}
+
+func (sc *scheduler) removeLocked(scheduleID string) {
+	sc.removeEntryLocked(scheduleID)
+	if cancel, running := sc.running[scheduleID]; running {
+		cancel()
+	}
+}
+
+func (sc *scheduler) removeEntryLocked(scheduleID string) {
+	if entry, exists := sc.entries[scheduleID]; exists {
+		sc.cron.Remove(entry.id)
+		delete(sc.entries, scheduleID)
+	}
+}
+
+// fire runs the schedule whose entry came due. A schedule deleted or
+// disabled since its entry was registered loses the entry instead, and one
+// whose cron expression or time zone changed is registered again and runs
+// at its new times.
+func (sc *scheduler) fire(scheduleID string, entry *scheduleEntry) {
+	schedule, err := sc.load(scheduleID)
+	if err != nil && err != sql.ErrNoRows {
+		fmt.Printf("Error loading schedule %s: %v\n", scheduleID, err)
+		return
+	}
+
+	sc.mu.Lock()
+	if sc.entries[scheduleID] != entry {
+		// Replaced or removed while loading
+		sc.mu.Unlock()
+		return
+	}
+	switch {
+	case err == sql.ErrNoRows || !schedule.Enabled:
+		fmt.Printf("Schedule %s was deleted or disabled, removing it from the scheduler\n", scheduleID)
+		sc.removeLocked(scheduleID)
+		schedule = nil
+	case schedule.CronSchedule != entry.spec || schedule.Timezone != entry.timezone:
+		fmt.Printf("Schedule %s changed, rescheduling it\n", scheduleID)
+		if err := sc.registerLocked(schedule); err != nil {
+			fmt.Printf("Error rescheduling schedule %s: %v\n", scheduleID, err)
+			sc.removeLocked(scheduleID)
+		}
+		schedule = nil
+	}
+	sc.mu.Unlock()
+
+	if schedule != nil {
+		sc.run(schedule)
+	}
+}
+
+// reload makes the entries match schedules, the enabled schedules as
+// saved: entries of schedules no longer among them are removed, new ones
+// added and those whose cron expression or time zone changed replaced.
+func (sc *scheduler) reload(schedules []*BackupSchedule) *ScheduleReload {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	result := &ScheduleReload{Errors: []string{}}
+	wanted := make(map[string]bool, len(schedules))
+	for _, schedule := range schedules {
+		scheduleID := schedule.ID.String()
+		wanted[scheduleID] = true
+
+		entry, exists := sc.entries[scheduleID]
+		if exists && entry.spec == schedule.CronSchedule && entry.timezone == schedule.Timezone {
+			result.Unchanged++
+			continue
+		}
+		if err := sc.registerLocked(schedule); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("schedule %s: %v", scheduleID, err))
+			sc.removeLocked(scheduleID)
+			continue
+		}
+		if exists {
+			result.Updated++
+		} else {
+			result.Added++
+		}
+	}
+	for scheduleID := range sc.entries {
+		if !wanted[scheduleID] {
+			sc.removeLocked(scheduleID)
+			result.Removed++
+		}
+	}
+	result.Registered = len(sc.entries)
+	return result
+}
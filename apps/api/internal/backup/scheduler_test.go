@@ -0,0 +1,92 @@
+package backup
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestSchedulerRunInProgress(t *testing.T) {
+	sc := newScheduler(nil, nil)
+	schedule := &BackupSchedule{ID: uuid.New(), CronSchedule: "0 0 2 * * *", Enabled: true}
+	scheduleID := schedule.ID.String()
+	if err := sc.register(schedule); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, done, ok := sc.begin(scheduleID)
+	if !ok {
+		t.Fatal("begin refused a schedule with no run in progress")
+	}
+	if _, _, ok := sc.begin(scheduleID); ok {
+		t.Error("begin allowed a second run while the first, retries included, is in progress")
+	}
+	if _, otherDone, ok := sc.begin(uuid.NewString()); !ok {
+		t.Error("begin refused another schedule")
+	} else {
+		otherDone()
+	}
+
+	// Saving the schedule with new times keeps its run going
+	schedule.CronSchedule = "0 30 3 * * *"
+	if err := sc.register(schedule); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() != nil {
+		t.Error("re-registering the schedule cancelled its run")
+	}
+
+	// Unregistering it stops the run's retries
+	sc.unregister(scheduleID)
+	if ctx.Err() == nil {
+		t.Error("unregistering the schedule did not cancel its run")
+	}
+	if _, _, ok := sc.begin(scheduleID); ok {
+		t.Error("begin allowed a run before the cancelled one finished")
+	}
+
+	done()
+	_, done, ok = sc.begin(scheduleID)
+	if !ok {
+		t.Fatal("begin refused a run after the previous one finished")
+	}
+	defer done()
+}
+
+func TestSchedulerStop(t *testing.T) {
+	sc := newScheduler(nil, nil)
+	sc.start()
+	ctx, done, ok := sc.begin(uuid.NewString())
+	if !ok {
+		t.Fatal("begin refused a schedule with no run in progress")
+	}
+	defer done()
+
+	sc.stop()
+	if ctx.Err() == nil {
+		t.Error("stopping the scheduler did not cancel the run in progress")
+	}
+}
+
+func TestSchedulerReloadCancelsRemovedSchedules(t *testing.T) {
+	sc := newScheduler(nil, nil)
+	kept := &BackupSchedule{ID: uuid.New(), CronSchedule: "0 0 2 * * *", Enabled: true}
+	removed := &BackupSchedule{ID: uuid.New(), CronSchedule: "0 0 3 * * *", Enabled: true}
+	for _, schedule := range []*BackupSchedule{kept, removed} {
+		if err := sc.register(schedule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keptCtx, keptDone, _ := sc.begin(kept.ID.String())
+	defer keptDone()
+	removedCtx, removedDone, _ := sc.begin(removed.ID.String())
+	defer removedDone()
+
+	sc.reload([]*BackupSchedule{kept})
+	if keptCtx.Err() != nil {
+		t.Error("reload cancelled the run of a schedule it kept")
+	}
+	if removedCtx.Err() == nil {
+		t.Error("reload did not cancel the run of a schedule it removed")
+	}
+}
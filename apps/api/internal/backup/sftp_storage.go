@@ -0,0 +1,308 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+type SFTPConfig struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	PrivateKey string
+	// HostKey is the server's public key, as a known_hosts line, an
+	// authorized_keys line or a SHA256 fingerprint. Connections to a server
+	// presenting any other key are refused.
+	HostKey string
+	// Path is the remote base directory. Relative paths are resolved from
+	// the login directory.
+	Path string
+}
+
+// SFTPStorage keeps objects as files under a directory on an SFTP server.
+type SFTPStorage struct {
+	client *sftp.Client
+	conn   *ssh.Client
+	root   string
+}
+
+func NewSFTPStorage(config SFTPConfig) (*SFTPStorage, error) {
+	var authMethods []ssh.AuthMethod
+
+	if config.Password != "" {
+		authMethods = append(authMethods, ssh.Password(config.Password))
+	}
+
+	if config.PrivateKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(config.PrivateKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		authMethods = append(authMethods, ssh.PublicKeys(signer))
+	}
+
+	if len(authMethods) == 0 {
+		return nil, fmt.Errorf("no SFTP authentication method provided (password or private key required)")
+	}
+
+	hostKeyCallback, err := sftpHostKeyCallback(config.HostKey)
+	if err != nil {
+		return nil, err
+	}
+
+	port := config.Port
+	if port == 0 {
+		port = 22
+	}
+
+	conn, err := ssh.Dial("tcp", net.JoinHostPort(config.Host, strconv.Itoa(port)), &ssh.ClientConfig{
+		User:            config.Username,
+		Auth:            authMethods,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SFTP server: %w", err)
+	}
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+
+	storage, err := NewSFTPStorageWithClient(client, config.Path)
+	if err != nil {
+		client.Close()
+		conn.Close()
+		return nil, err
+	}
+	storage.conn = conn
+	return storage, nil
+}
+
+// sftpHostKeyCallback accepts only the server key given by hostKey, which
+// is a known_hosts line, an authorized_keys line such as the output of
+// ssh-keyscan, or a fingerprint as printed by ssh-keygen -l. A server
+// presenting another key is refused with the fingerprint of the key it
+// presented, so it can be checked and pinned.
+func sftpHostKeyCallback(hostKey string) (ssh.HostKeyCallback, error) {
+	hostKey = strings.TrimSpace(hostKey)
+	if hostKey == "" {
+		return nil, fmt.Errorf("no SFTP host key provided (the server's public key or its SHA256 fingerprint is required)")
+	}
+
+	if strings.HasPrefix(hostKey, "SHA256:") {
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if fingerprint := ssh.FingerprintSHA256(key); fingerprint != hostKey {
+				return fmt.Errorf("host key mismatch for %s: server presented %s %s", hostname, key.Type(), fingerprint)
+			}
+			return nil
+		}, nil
+	}
+
+	key, err := parseHostKey(hostKey)
+	if err != nil {
+		return nil, err
+	}
+	fixed := ssh.FixedHostKey(key)
+	return func(hostname string, remote net.Addr, presented ssh.PublicKey) error {
+		if err := fixed(hostname, remote, presented); err != nil {
+			return fmt.Errorf("host key mismatch for %s: server presented %s %s",
+				hostname, presented.Type(), ssh.FingerprintSHA256(presented))
+		}
+		return nil
+	}, nil
+}
+
+// parseHostKey reads a public key from a known_hosts or authorized_keys
+// line.
+func parseHostKey(hostKey string) (ssh.PublicKey, error) {
+	if _, _, key, _, _, err := ssh.ParseKnownHosts([]byte(hostKey)); err == nil {
+		return key, nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse host key: %w", err)
+	}
+	return key, nil
+}
+
+// NewSFTPStorageWithClient uses an existing SFTP session, such as one to an
+// in-process server. Closing the storage closes the client.
+func NewSFTPStorageWithClient(client *sftp.Client, root string) (*SFTPStorage, error) {
+	if root == "" {
+		root = "."
+	}
+	if !path.IsAbs(root) {
+		wd, err := client.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get remote working directory: %w", err)
+		}
+		root = path.Join(wd, root)
+	}
+	root = path.Clean(root)
+
+	if err := client.MkdirAll(root); err != nil {
+		return nil, fmt.Errorf("failed to create remote directory: %w", err)
+	}
+	return &SFTPStorage{client: client, root: root}, nil
+}
+
+// Close ends the SFTP session and the SSH connection under it.
+func (s *SFTPStorage) Close() error {
+	err := s.client.Close()
+	if s.conn != nil {
+		if connErr := s.conn.Close(); err == nil {
+			err = connErr
+		}
+	}
+	return err
+}
+
+// path resolves a key to a file under the root, refusing keys that would
+// escape it.
+func (s *SFTPStorage) path(key string) (string, error) {
+	p := path.Join(s.root, key)
+	if p != s.root && !strings.HasPrefix(p, strings.TrimSuffix(s.root, "/")+"/") {
+		return "", fmt.Errorf("invalid key: %s", key)
+	}
+	return p, nil
+}
+
+func (s *SFTPStorage) wrapNotFound(err error, key string) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s", errStorageNotFound, key)
+	}
+	return err
+}
+
+// rename moves a file over any existing one, using the posix-rename
+// extension where the server supports it.
+func (s *SFTPStorage) rename(oldPath, newPath string) error {
+	if _, ok := s.client.HasExtension("posix-rename@openssh.com"); ok {
+		return s.client.PosixRename(oldPath, newPath)
+	}
+	if err := s.client.Remove(newPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return s.client.Rename(oldPath, newPath)
+}
+
+func (s *SFTPStorage) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := s.client.MkdirAll(path.Dir(p)); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+
+	// Write to a temporary name so a partial file never shows up under key
+	tmp := p + ".partial"
+	file, err := s.client.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file: %w", err)
+	}
+	written, err := file.ReadFrom(r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	if err != nil {
+		s.client.Remove(tmp)
+		return fmt.Errorf("failed to upload to SFTP: %w", err)
+	}
+	if err := s.rename(tmp, p); err != nil {
+		s.client.Remove(tmp)
+		return fmt.Errorf("failed to rename uploaded file: %w", err)
+	}
+	return nil
+}
+
+func (s *SFTPStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := s.client.Open(p)
+	if err != nil {
+		return nil, s.wrapNotFound(err, key)
+	}
+	return file, nil
+}
+
+func (s *SFTPStorage) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := s.client.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete remote file: %w", err)
+	}
+	return nil
+}
+
+func (s *SFTPStorage) List(ctx context.Context, prefix string) ([]StorageObject, error) {
+	var objects []StorageObject
+	walker := s.client.Walk(s.root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return nil, fmt.Errorf("failed to list remote files: %w", err)
+		}
+		info := walker.Stat()
+		if info.IsDir() || strings.HasSuffix(walker.Path(), ".partial") {
+			continue
+		}
+		key := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), s.root), "/")
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		objects = append(objects, StorageObject{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return objects, nil
+}
+
+func (s *SFTPStorage) Stat(ctx context.Context, key string) (*StorageObject, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.client.Stat(p)
+	if err != nil {
+		return nil, s.wrapNotFound(err, key)
+	}
+	return &StorageObject{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *SFTPStorage) Move(ctx context.Context, oldKey, newKey string) error {
+	oldPath, err := s.path(oldKey)
+	if err != nil {
+		return err
+	}
+	newPath, err := s.path(newKey)
+	if err != nil {
+		return err
+	}
+	if err := s.client.MkdirAll(path.Dir(newPath)); err != nil {
+		return fmt.Errorf("failed to create remote directory: %w", err)
+	}
+	if err := s.rename(oldPath, newPath); err != nil {
+		return s.wrapNotFound(err, oldKey)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// startSFTPServer serves pkg/sftp's in-memory file system over SSH on a
+// loopback port, accepting the password "secret", and returns its address
+// and host key.
+func startSFTPServer(t *testing.T) (string, int, ssh.PublicKey) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) != "secret" {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	// Every connection shares one file system, like a real server's disk
+	handlers := sftp.InMemHandler()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSFTP(conn, config, handlers)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, signer.PublicKey()
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig, handlers sftp.Handlers) {
+	defer conn.Close()
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions are served")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range channelRequests {
+				// The payload is the length-prefixed subsystem name
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if ok {
+					server := sftp.NewRequestServer(channel, handlers)
+					server.Serve()
+					server.Close()
+				}
+			}
+		}()
+	}
+}
+
+func TestSFTPStorage(t *testing.T) {
+	host, port, hostKey := startSFTPServer(t)
+	storage, err := NewSFTPStorage(SFTPConfig{
+		Host:     host,
+		Port:     port,
+		Username: "velld",
+		Password: "secret",
+		HostKey:  string(ssh.MarshalAuthorizedKey(hostKey)),
+		Path:     "/backups",
+	})
+	if err != nil {
+		t.Fatalf("NewSFTPStorage: %v", err)
+	}
+	defer storage.Close()
+
+	testStorage(t, storage, "velld", bytes.Repeat([]byte("backup data "), 100000))
+}
+
+func TestSFTPStorageOverPipe(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	server := sftp.NewRequestServer(serverConn, sftp.InMemHandler())
+	go server.Serve()
+	defer server.Close()
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	if err != nil {
+		t.Fatalf("NewClientPipe: %v", err)
+	}
+	storage, err := NewSFTPStorageWithClient(client, "/backups")
+	if err != nil {
+		t.Fatalf("NewSFTPStorageWithClient: %v", err)
+	}
+	defer storage.Close()
+
+	testStorage(t, storage, "", []byte("small backup"))
+
+	if _, err := storage.Stat(t.Context(), "../outside"); err == nil {
+		t.Error("Stat of a key escaping the root succeeded")
+	}
+}
+
+func TestSFTPStorageHostKey(t *testing.T) {
+	host, port, hostKey := startSFTPServer(t)
+	_, otherPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ssh.NewPublicKey(otherPrivate.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostKey)))
+	knownHost := knownHostsLine(host, port, hostKey)
+	tests := []struct {
+		name    string
+		hostKey string
+		wantErr string
+	}{
+		{name: "authorized_keys line", hostKey: authorizedKey},
+		{name: "known_hosts line", hostKey: knownHost},
+		{name: "fingerprint", hostKey: ssh.FingerprintSHA256(hostKey)},
+		{name: "missing", hostKey: "", wantErr: "no SFTP host key provided"},
+		{name: "unparsable", hostKey: "not a key", wantErr: "failed to parse host key"},
+		{name: "other key", hostKey: string(ssh.MarshalAuthorizedKey(otherKey)), wantErr: ssh.FingerprintSHA256(hostKey)},
+		{name: "other fingerprint", hostKey: ssh.FingerprintSHA256(otherKey), wantErr: "host key mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage, err := NewSFTPStorage(SFTPConfig{
+				Host:     host,
+				Port:     port,
+				Username: "velld",
+				Password: "secret",
+				HostKey:  tt.hostKey,
+				Path:     "/backups",
+			})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("NewSFTPStorage: %v", err)
+				}
+				storage.Close()
+				return
+			}
+			if err == nil {
+				storage.Close()
+				t.Fatalf("NewSFTPStorage connected, want an error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewSFTPStorage error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func knownHostsLine(host string, port int, key ssh.PublicKey) string {
+	return "[" + host + "]:" + strconv.Itoa(port) + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
@@ -0,0 +1,108 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// errStorageNotFound is wrapped by Storage methods when a key does not exist.
+var errStorageNotFound = errors.New("object not found")
+
+// Storage is a place backup files are kept, such as a directory or a bucket.
+// Keys are slash-separated paths from the root of the storage.
+type Storage interface {
+	// Put stores size bytes read from r under key, or everything up to EOF
+	// if size is -1. A non-empty checksum is the hex SHA-256 of the content
+	// and is kept with the object where the backend supports it.
+	Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// List returns the objects whose keys start with prefix.
+	List(ctx context.Context, prefix string) ([]StorageObject, error)
+	Stat(ctx context.Context, key string) (*StorageObject, error)
+	Move(ctx context.Context, oldKey, newKey string) error
+}
+
+// resumableStorage is implemented by backends whose uploads can pick up
+// where a failed attempt stopped.
+type resumableStorage interface {
+	// PutResumable stores size bytes from r under key, continuing the
+	// upload uploadID if it is still open. onStart is called with the ID of
+	// a newly started upload before any data is sent.
+	PutResumable(ctx context.Context, key string, r io.ReaderAt, size int64, checksum, uploadID string, onStart func(uploadID string)) error
+	// AbortUpload discards an unfinished upload and the data sent for it.
+	AbortUpload(ctx context.Context, key, uploadID string) error
+}
+
+// checksumStorage is implemented by backends that keep a checksum with
+// their objects, so an object uploaded before its checksum was known, such
+// as a streamed dump, can be given it afterwards.
+type checksumStorage interface {
+	// SetChecksum stores checksum, the hex SHA-256 of the content, with
+	// the object under key. Wrappers of backends that keep no checksums
+	// return errors.ErrUnsupported.
+	SetChecksum(ctx context.Context, key, checksum string) error
+}
+
+// objectLockKey is the context key of the time objects are locked until.
+type objectLockKey struct{}
+
+// withObjectLock returns a context asking lockingStorage backends to write
+// the objects put with it already locked until the given time.
+func withObjectLock(ctx context.Context, until time.Time) context.Context {
+	return context.WithValue(ctx, objectLockKey{}, until)
+}
+
+// objectLockFrom returns the time set by withObjectLock, if any.
+func objectLockFrom(ctx context.Context) (time.Time, bool) {
+	until, ok := ctx.Value(objectLockKey{}).(time.Time)
+	return until, ok
+}
+
+// lockingStorage is implemented by backends that can protect objects from
+// deletion for a time.
+type lockingStorage interface {
+	// LockObject keeps the object under key, which already exists, from
+	// being deleted or overwritten until the given time. New objects are
+	// locked as they are written, through withObjectLock.
+	LockObject(ctx context.Context, key string, until time.Time) error
+	// LocksObjects reports whether object lock is configured, so uploads
+	// are expected to be locked.
+	LocksObjects() bool
+}
+
+// StorageObject describes a stored object. Checksum is only set by Stat on
+// backends that keep one.
+type StorageObject struct {
+	Key      string
+	Size     int64
+	Checksum string
+	ModTime  time.Time
+}
+
+// storageKey joins key parts with slashes, dropping empty parts and stray
+// slashes around them.
+func storageKey(parts ...string) string {
+	var cleaned []string
+	for _, part := range parts {
+		part = strings.Trim(part, "/")
+		if part != "" {
+			cleaned = append(cleaned, part)
+		}
+	}
+	return path.Join(cleaned...)
+}
+
+// hashObject streams an object and returns its SHA-256 and size.
+func hashObject(ctx context.Context, storage Storage, key string) (string, int64, error) {
+	object, err := storage.Get(ctx, key)
+	if err != nil {
+		return "", 0, err
+	}
+	defer object.Close()
+	return hashReader(object)
+}
@@ -0,0 +1,103 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+// testStorage runs storage through the operations backups use: uploading
+// under the <connection>/<file> layout, reading back, listing, moving and
+// deleting. Keys are put under prefix so runs against a shared bucket do
+// not see each other.
+func testStorage(t *testing.T, storage Storage, prefix string, data []byte) {
+	t.Helper()
+	ctx := context.Background()
+	key := storageKey(prefix, "conn-1", "db_20240101_020000.sql.gz")
+	other := storageKey(prefix, "conn-2", "db_20240101_030000.sql.gz")
+
+	if err := storage.Put(ctx, key, bytes.NewReader(data), int64(len(data)), ""); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := storage.Put(ctx, other, bytes.NewReader([]byte("other")), -1, ""); err != nil {
+		t.Fatalf("Put of unknown size: %v", err)
+	}
+
+	r, err := storage.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Get returned %d bytes, want the %d put", len(got), len(data))
+	}
+
+	info, err := storage.Stat(ctx, key)
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Key != key || info.Size != int64(len(data)) {
+		t.Errorf("Stat = %s (%d bytes), want %s (%d bytes)", info.Key, info.Size, key, len(data))
+	}
+
+	if keys := listKeys(t, storage, prefix); !equalKeys(keys, []string{key, other}) {
+		t.Errorf("List(%q) = %v, want %v", prefix, keys, []string{key, other})
+	}
+	connPrefix := storageKey(prefix, "conn-1") + "/"
+	if keys := listKeys(t, storage, connPrefix); !equalKeys(keys, []string{key}) {
+		t.Errorf("List(%q) = %v, want %v", connPrefix, keys, []string{key})
+	}
+
+	moved := storageKey(prefix, "conn-1", "archive", "db_20240101_020000.sql.gz")
+	if err := storage.Move(ctx, key, moved); err != nil {
+		t.Fatalf("Move: %v", err)
+	}
+	if _, err := storage.Stat(ctx, key); !errors.Is(err, errStorageNotFound) {
+		t.Errorf("Stat of moved key = %v, want %v", err, errStorageNotFound)
+	}
+	if info, err := storage.Stat(ctx, moved); err != nil || info.Size != int64(len(data)) {
+		t.Errorf("Stat of new key = %v, %v, want %d bytes", info, err, len(data))
+	}
+
+	for _, k := range []string{moved, other} {
+		if err := storage.Delete(ctx, k); err != nil {
+			t.Fatalf("Delete(%s): %v", k, err)
+		}
+	}
+	if err := storage.Delete(ctx, moved); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+	if _, err := storage.Get(ctx, moved); !errors.Is(err, errStorageNotFound) {
+		t.Errorf("Get of deleted key = %v, want %v", err, errStorageNotFound)
+	}
+	if keys := listKeys(t, storage, prefix); len(keys) != 0 {
+		t.Errorf("List after deleting everything = %v", keys)
+	}
+}
+
+func listKeys(t *testing.T, storage Storage, prefix string) []string {
+	t.Helper()
+	objects, err := storage.List(context.Background(), prefix)
+	if err != nil {
+		t.Fatalf("List(%q): %v", prefix, err)
+	}
+	keys := make([]string, 0, len(objects))
+	for _, o := range objects {
+		keys = append(keys, o.Key)
+	}
+	return keys
+}
+
+func equalKeys(got, want []string) bool {
+	got, want = slices.Clone(got), slices.Clone(want)
+	slices.Sort(got)
+	slices.Sort(want)
+	return slices.Equal(got, want)
+}
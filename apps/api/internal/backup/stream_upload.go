@@ -0,0 +1,156 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/connection"
+)
+
+// dumpBackup runs a dump into the backup file or, when the user streams
+// uploads, straight into the connection's storage. streamed reports whether
+// the dump went to storage, in which case it has no local file and its copy
+// is already recorded.
+func (s *BackupService) dumpBackup(ctx context.Context, cmd *exec.Cmd, backup *Backup, conn *connection.StoredConnection, opts artifactOptions, progress *dumpProgress) (result *dumpResult, streamed bool, err error) {
+	d := s.streamDestination(conn, progress)
+	if d == nil {
+		result, err = runDump(cmd, backup.Path, opts, progress)
+		return result, false, err
+	}
+	defer d.close()
+
+	progress.logf("Streaming dump to %s", d.Name)
+	result, err = s.streamBackup(ctx, cmd, backup, conn.Name, d, opts, progress)
+	return result, true, err
+}
+
+// streamDestination returns the destination to stream a connection's dumps
+// to, or nil to stage them locally. Streaming needs S3 stream uploads turned
+// on and exactly one destination, since the dump can only be read once.
+func (s *BackupService) streamDestination(conn *connection.StoredConnection, progress *dumpProgress) *destination {
+	userSettings, err := s.settingsService.GetUserSettingsInternal(conn.UserID)
+	if err != nil || !userSettings.S3StreamUpload {
+		return nil
+	}
+
+	dests, err := s.destinationsForConnection(conn)
+	if err != nil {
+		fmt.Printf("Warning: Failed to open storage for streaming, staging locally: %v\n", err)
+		progress.logf("Failed to open storage for streaming, staging locally: %v", err)
+		return nil
+	}
+	if len(dests) != 1 {
+		for _, d := range dests {
+			d.close()
+		}
+		if len(dests) > 1 {
+			progress.logf("Streaming needs a single storage destination, staging locally")
+		}
+		return nil
+	}
+	return dests[0]
+}
+
+// streamBackup pipes a dump into a multipart upload to d and records the
+// copy. An upload that fails or does not match the dump fails the backup,
+// as there is no local file to fall back on.
+func (s *BackupService) streamBackup(ctx context.Context, cmd *exec.Cmd, backup *Backup, connectionName string, d *destination, opts artifactOptions, progress *dumpProgress) (*dumpResult, error) {
+	key := d.objectKey(connectionName, backup.Path)
+	uploadCtx, err := s.backupLockContext(ctx, backup, d.storage)
+	if err != nil {
+		return nil, err
+	}
+	copy := &BackupCopy{
+		BackupID:        backup.ID.String(),
+		DestinationID:   d.ID,
+		DestinationName: d.Name,
+		Status:          copyUploading,
+		ObjectKey:       &key,
+	}
+	if err := s.backupRepo.SaveBackupCopy(copy); err != nil {
+		fmt.Printf("Warning: Failed to record copy of backup %s on %s: %v\n", backup.ID, d.Name, err)
+	}
+
+	pr, pw := io.Pipe()
+	uploadDone := make(chan error, 1)
+	go func() {
+		err := d.storage.Put(uploadCtx, key, pr, -1, "")
+		// Unblock the dump if the upload stopped before reading everything
+		pr.CloseWithError(err)
+		uploadDone <- err
+	}()
+
+	result, err := streamDump(cmd, pw, opts, progress)
+	pw.CloseWithError(err)
+	uploadErr := <-uploadDone
+
+	if err == nil && uploadErr != nil {
+		err = fmt.Errorf("failed to upload dump to %s: %w", d.Name, uploadErr)
+	}
+	if err == nil {
+		err = verifyStreamedObject(d.storage, key, result)
+	}
+	if err != nil {
+		if uploadErr == nil {
+			if delErr := d.storage.Delete(context.Background(), key); delErr != nil {
+				fmt.Printf("Warning: Failed to delete incomplete object %s: %v\n", key, delErr)
+			}
+		}
+		msg := err.Error()
+		copy.Status = copyFailed
+		copy.Error = &msg
+		if saveErr := s.backupRepo.SaveBackupCopy(copy); saveErr != nil {
+			fmt.Printf("Warning: Failed to record copy of backup %s on %s: %v\n", backup.ID, d.Name, saveErr)
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	copy.Status = copyUploaded
+	copy.Size = result.Size
+	copy.UploadedAt = &now
+	if err := s.backupRepo.SaveBackupCopy(copy); err != nil {
+		fmt.Printf("Warning: Failed to record copy of backup %s on %s: %v\n", backup.ID, d.Name, err)
+	}
+	if d.ID == defaultS3DestinationID {
+		backup.S3ObjectKey = &key
+	}
+	status := uploadUploaded
+	backup.UploadStatus = &status
+
+	fmt.Printf("Successfully streamed backup %s to %s: %s\n", backup.ID, d.Name, key)
+	return result, nil
+}
+
+// verifyStreamedObject checks the stored object has the size of the dump
+// that was streamed into it. The dump's checksum is only known once the
+// stream ends, so on backends that keep checksums it is stored with the
+// object then, and must read back the same.
+func verifyStreamedObject(storage Storage, key string, result *dumpResult) error {
+	ctx := context.Background()
+	checksummer, keepsChecksums := storage.(checksumStorage)
+	if keepsChecksums {
+		err := checksummer.SetChecksum(ctx, key, result.Checksum)
+		if errors.Is(err, errors.ErrUnsupported) {
+			keepsChecksums = false
+		} else if err != nil {
+			return fmt.Errorf("failed to verify upload: %w", err)
+		}
+	}
+
+	object, err := storage.Stat(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to verify upload: %w", err)
+	}
+	if object.Size != result.Size {
+		return fmt.Errorf("failed to verify upload: stored object has size %d, expected %d", object.Size, result.Size)
+	}
+	if keepsChecksums && object.Checksum != result.Checksum {
+		return fmt.Errorf("failed to verify upload: stored object has checksum %q, expected %s", object.Checksum, result.Checksum)
+	}
+	return nil
+}
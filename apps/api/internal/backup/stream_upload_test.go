@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dendianugerah/velld/internal/connection"
+	"github.com/google/uuid"
+)
+
+// checksumRecorder is storage that keeps the checksums set on its objects
+// and reports them from Stat, or reports stat instead when it is set.
+type checksumRecorder struct {
+	Storage
+	checksums map[string]string
+	stat      string
+}
+
+func (c *checksumRecorder) SetChecksum(ctx context.Context, key, checksum string) error {
+	c.checksums[key] = checksum
+	return nil
+}
+
+func (c *checksumRecorder) Stat(ctx context.Context, key string) (*StorageObject, error) {
+	object, err := c.Storage.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	object.Checksum = c.checksums[key]
+	if c.stat != "" {
+		object.Checksum = c.stat
+	}
+	return object, nil
+}
+
+func TestStreamBackupStoresChecksum(t *testing.T) {
+	s := &BackupService{backupRepo: newTestRepository(t)}
+	storage := &checksumRecorder{Storage: newTestLocalStorage(t), checksums: map[string]string{}}
+	d := &destination{ID: uuid.NewString(), Name: "bucket", storage: storage}
+	backup := &Backup{ID: uuid.New(), Path: "/backups/db_20260101_020000.sql.gz"}
+
+	dump := testDump()
+	result, err := s.streamBackup(context.Background(), dumpCommand(t, dump), backup, "conn", d,
+		artifactOptions{Compression: connection.CompressionGzip}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := d.objectKey("conn", backup.Path)
+	r, err := storage.Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, r); err != nil {
+		t.Fatal(err)
+	}
+	if stored := hex.EncodeToString(hasher.Sum(nil)); result.Checksum != stored {
+		t.Errorf("dump checksum %s, stored object hashes to %s", result.Checksum, stored)
+	}
+	if storage.checksums[key] != result.Checksum {
+		t.Errorf("checksum kept with the object %q, want %s", storage.checksums[key], result.Checksum)
+	}
+}
+
+func TestVerifyStreamedObject(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("streamed dump")
+	sum := sha256.Sum256(data)
+	result := &dumpResult{Size: int64(len(data)), Checksum: hex.EncodeToString(sum[:])}
+	const key = "conn/db.sql.gz"
+
+	tests := []struct {
+		name    string
+		storage func(local Storage) Storage
+		wantErr string
+	}{
+		{
+			name: "checksum stored and read back",
+			storage: func(local Storage) Storage {
+				return &checksumRecorder{Storage: local, checksums: map[string]string{}}
+			},
+		},
+		{
+			name: "checksum read back differs",
+			storage: func(local Storage) Storage {
+				return &checksumRecorder{Storage: local, checksums: map[string]string{}, stat: strings.Repeat("0", 64)}
+			},
+			wantErr: "checksum",
+		},
+		{
+			name:    "backend without checksums checks the size",
+			storage: func(local Storage) Storage { return local },
+		},
+		{
+			name:    "throttled backend without checksums checks the size",
+			storage: func(local Storage) Storage { return &throttledStorage{Storage: local} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local := newTestLocalStorage(t)
+			if err := local.Put(ctx, key, bytes.NewReader(data), -1, ""); err != nil {
+				t.Fatal(err)
+			}
+			err := verifyStreamedObject(tt.storage(local), key, result)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got %v, want an error about the %s", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A short object fails whatever the backend keeps
+	local := newTestLocalStorage(t)
+	if err := local.Put(ctx, key, bytes.NewReader(data[:4]), -1, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyStreamedObject(local, key, result); err == nil || !strings.Contains(err.Error(), "size") {
+		t.Errorf("short object: got %v, want a size mismatch", err)
+	}
+}
@@ -0,0 +1,132 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dendianugerah/velld/internal/common"
+)
+
+// destinationLimiters are the bandwidth limiters of one destination, shared
+// by all transfers to and from it. limit and windows are the config they
+// were built from.
+type destinationLimiters struct {
+	limit    float64
+	windows  string
+	upload   *common.BandwidthLimiter
+	download *common.BandwidthLimiter
+}
+
+// limitersFor returns the limiters of a destination's own bandwidth limit,
+// rebuilding them when its config has changed.
+func (s *BackupService) limitersFor(dest *StorageDestination) (*destinationLimiters, error) {
+	s.limitersMu.Lock()
+	defer s.limitersMu.Unlock()
+
+	limiters := s.destinationLimiters[dest.ID]
+	if limiters != nil && limiters.limit == dest.Config.BandwidthLimitMBps && limiters.windows == dest.Config.FullSpeedWindows {
+		return limiters, nil
+	}
+
+	windows, err := common.ParseBandwidthWindows(dest.Config.FullSpeedWindows)
+	if err != nil {
+		return nil, fmt.Errorf("invalid full speed windows: %w", err)
+	}
+	limiters = &destinationLimiters{
+		limit:    dest.Config.BandwidthLimitMBps,
+		windows:  dest.Config.FullSpeedWindows,
+		upload:   common.NewBandwidthLimiter(dest.Config.BandwidthLimitMBps, windows),
+		download: common.NewBandwidthLimiter(dest.Config.BandwidthLimitMBps, windows),
+	}
+	if s.destinationLimiters == nil {
+		s.destinationLimiters = make(map[string]*destinationLimiters)
+	}
+	s.destinationLimiters[dest.ID] = limiters
+	return limiters, nil
+}
+
+// throttleDestination limits transfers of an opened destination to its own
+// bandwidth limit and, unless it is a local directory, the global one. The
+// storage is left as is when neither applies.
+func (s *BackupService) throttleDestination(d *destination, dest *StorageDestination) error {
+	limiters, err := s.limitersFor(dest)
+	if err != nil {
+		return err
+	}
+	throttled := &throttledStorage{Storage: d.storage}
+	if limiters.upload != nil {
+		throttled.upload = append(throttled.upload, limiters.upload)
+		throttled.download = append(throttled.download, limiters.download)
+	}
+	if dest.Type != destinationLocal && common.GlobalUploadLimiter() != nil {
+		throttled.upload = append(throttled.upload, common.GlobalUploadLimiter())
+		throttled.download = append(throttled.download, common.GlobalDownloadLimiter())
+	}
+	if len(throttled.upload) > 0 {
+		d.storage = throttled
+	}
+	return nil
+}
+
+// throttledStorage passes the data of uploads and downloads through
+// bandwidth limiters. It keeps the optional interfaces of the storage it
+// wraps, falling back to plain uploads for backends that cannot resume.
+type throttledStorage struct {
+	Storage
+	upload   []*common.BandwidthLimiter
+	download []*common.BandwidthLimiter
+}
+
+func (t *throttledStorage) Put(ctx context.Context, key string, r io.Reader, size int64, checksum string) error {
+	return t.Storage.Put(ctx, key, common.ThrottleReader(ctx, r, t.upload...), size, checksum)
+}
+
+func (t *throttledStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := t.Storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{common.ThrottleReader(ctx, object, t.download...), object}, nil
+}
+
+func (t *throttledStorage) PutResumable(ctx context.Context, key string, r io.ReaderAt, size int64, checksum, uploadID string, onStart func(uploadID string)) error {
+	resumable, ok := t.Storage.(resumableStorage)
+	if !ok {
+		return t.Put(ctx, key, io.NewSectionReader(r, 0, size), size, checksum)
+	}
+	return resumable.PutResumable(ctx, key, common.ThrottleReaderAt(ctx, r, t.upload...), size, checksum, uploadID, onStart)
+}
+
+func (t *throttledStorage) AbortUpload(ctx context.Context, key, uploadID string) error {
+	if resumable, ok := t.Storage.(resumableStorage); ok {
+		return resumable.AbortUpload(ctx, key, uploadID)
+	}
+	return nil
+}
+
+func (t *throttledStorage) LockObject(ctx context.Context, key string, until time.Time) error {
+	if locker, ok := t.Storage.(lockingStorage); ok {
+		return locker.LockObject(ctx, key, until)
+	}
+	return nil
+}
+
+func (t *throttledStorage) SetChecksum(ctx context.Context, key, checksum string) error {
+	if checksummer, ok := t.Storage.(checksumStorage); ok {
+		return checksummer.SetChecksum(ctx, key, checksum)
+	}
+	return errors.ErrUnsupported
+}
+
+func (t *throttledStorage) Close() error {
+	if closer, ok := t.Storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Backup upload statuses, summarising the backup's copies.
+const (
+	uploadPending  = "pending"
+	uploadUploaded = "uploaded"
+	uploadFailed   = "failed"
+)
+
+const (
+	// uploadReconcileSchedule retries due uploads every minute.
+	uploadReconcileSchedule = "0 * * * * *"
+	// uploadReconcileBatch caps how many copies a single run uploads.
+	uploadReconcileBatch = 10
+
+	uploadRetryInitialDelay = time.Minute
+	uploadRetryMaxDelay     = 6 * time.Hour
+
+	defaultUploadAlertHours = 24
+)
+
+// uploadRetryDelay is the wait after the given failed upload attempt: the
+// initial delay doubled for every earlier attempt, capped at the maximum.
+func uploadRetryDelay(attempt int) time.Duration {
+	delay := uploadRetryInitialDelay
+	for i := 1; i < attempt && delay < uploadRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > uploadRetryMaxDelay {
+		delay = uploadRetryMaxDelay
+	}
+	return delay
+}
+
+// uploadStatusOf sums up a backup's copies: uploaded once every copy is,
+// failed once any copy has been given up on, and pending while uploads are
+// running or waiting for a retry. Backups without copies have no status.
+func uploadStatusOf(copies []*BackupCopy) *string {
+	if len(copies) == 0 {
+		return nil
+	}
+
+	status := uploadUploaded
+	for _, copy := range copies {
+		switch {
+		case (copy.Status == copyFailed || copy.Status == copyUnverified) && copy.NextAttemptAt == nil:
+			status = uploadFailed
+		case copy.Status != copyUploaded && status != uploadFailed:
+			status = uploadPending
+		}
+	}
+	return &status
+}
+
+// applyUploadStatus sets the backup's upload status from its copies and,
+// once every copy is confirmed uploaded, purges the local file if the user
+// asked for it.
+func (s *BackupService) applyUploadStatus(backup *Backup, ownerID uuid.UUID) {
+	copies, err := s.backupRepo.GetBackupCopies(backup.ID.String())
+	if err != nil {
+		fmt.Printf("Warning: Failed to get copies of backup %s: %v\n", backup.ID, err)
+		return
+	}
+	backup.UploadStatus = uploadStatusOf(copies)
+
+	if backup.UploadStatus == nil || *backup.UploadStatus != uploadUploaded {
+		return
+	}
+	userSettings, err := s.settingsService.GetUserSettingsInternal(ownerID)
+	if err != nil || !userSettings.S3PurgeLocal {
+		return
+	}
+	if _, err := os.Stat(backup.Path); err != nil {
+		return
+	}
+	if err := os.Remove(backup.Path); err != nil {
+		fmt.Printf("Warning: Failed to purge local backup file %s: %v\n", backup.Path, err)
+	} else {
+		fmt.Printf("Successfully purged local backup file: %s\n", backup.Path)
+	}
+}
+
+// failInterruptedUploads marks uploads cut off by a restart as failed so
+// the reconciler resumes them.
+func (s *BackupService) failInterruptedUploads() {
+	count, err := s.backupRepo.FailInterruptedUploads("interrupted by server restart")
+	if err != nil {
+		fmt.Printf("Warning: Failed to mark interrupted uploads as failed: %v\n", err)
+		return
+	}
+	if count > 0 {
+		fmt.Printf("Marked %d interrupted uploads for retry\n", count)
+	}
+}
+
+// runUploadReconciler retries backup copies whose upload failed and alerts
+// owners of backups that have gone too long without every copy uploaded.
+// A run is skipped while the previous one is still uploading.
+func (s *BackupService) runUploadReconciler() {
+	if !s.uploadReconcileMu.TryLock() {
+		return
+	}
+	defer s.uploadReconcileMu.Unlock()
+
+	copies, err := s.backupRepo.GetCopiesDueForUpload(time.Now(), uploadReconcileBatch)
+	if err != nil {
+		fmt.Printf("Error fetching uploads to retry: %v\n", err)
+	} else {
+		for _, copy := range copies {
+			s.retryBackupCopy(copy)
+		}
+	}
+
+	s.alertMissingUploads()
+}
+
+// retryBackupCopy uploads a failed copy again. A copy whose backup,
+// connection or destination is gone is given up on.
+func (s *BackupService) retryBackupCopy(copy *BackupCopy) {
+	backup, err := s.backupRepo.GetBackup(copy.BackupID)
+	if err != nil {
+		s.abandonBackupCopy(copy, fmt.Errorf("failed to get backup: %w", err))
+		return
+	}
+	conn, err := s.connStorage.GetConnection(backup.ConnectionID)
+	if err != nil {
+		s.abandonBackupCopy(copy, fmt.Errorf("failed to get connection: %w", err))
+		return
+	}
+
+	dest, err := s.storageDestinationByID(conn.UserID, copy.DestinationID)
+	if err != nil {
+		s.abandonBackupCopy(copy, fmt.Errorf("failed to get destination: %w", err))
+	} else if err := s.uploadBackupCopy(backup, conn.Name, dest, copy); err != nil {
+		fmt.Printf("Warning: Retry %d of upload of backup %s to %s failed: %v\n", copy.Attempts, backup.ID, dest.Name, err)
+	} else if copy.DestinationID == defaultS3DestinationID {
+		if err := s.backupRepo.UpdateBackupS3ObjectKey(backup.ID.String(), *copy.ObjectKey); err != nil {
+			fmt.Printf("Warning: Failed to update S3 object key of backup %s: %v\n", backup.ID, err)
+		}
+	}
+
+	s.applyUploadStatus(backup, conn.UserID)
+	if err := s.backupRepo.UpdateBackupUploadStatus(backup.ID.String(), backup.UploadStatus); err != nil {
+		fmt.Printf("Warning: Failed to update upload status of backup %s: %v\n", backup.ID, err)
+	}
+}
+
+// abandonBackupCopy stops retrying a copy, recording why.
+func (s *BackupService) abandonBackupCopy(copy *BackupCopy, reason error) {
+	fmt.Printf("Warning: Giving up on upload of backup %s to %s: %v\n", copy.BackupID, copy.DestinationName, reason)
+	msg := reason.Error()
+	copy.Error = &msg
+	copy.NextAttemptAt = nil
+	if err := s.backupRepo.SaveBackupCopy(copy); err != nil {
+		fmt.Printf("Warning: Failed to record copy of backup %s on %s: %v\n", copy.BackupID, copy.DestinationName, err)
+	}
+}
+
+// alertMissingUploads notifies owners, once per backup, about backups still
+// missing a copy OFFSITE_COPY_ALERT_HOURS after they completed.
+func (s *BackupService) alertMissingUploads() {
+	hours := positiveIntFromEnv("OFFSITE_COPY_ALERT_HOURS", defaultUploadAlertHours)
+	now := time.Now()
+	backups, err := s.backupRepo.GetBackupsMissingUploads(now.Add(-time.Duration(hours) * time.Hour))
+	if err != nil {
+		fmt.Printf("Error fetching backups missing uploads: %v\n", err)
+		return
+	}
+
+	for _, backup := range backups {
+		if err := s.createUploadMissingNotification(backup, hours); err != nil {
+			fmt.Printf("Warning: Failed to notify about missing upload of backup %s: %v\n", backup.ID, err)
+			continue
+		}
+		if err := s.backupRepo.MarkUploadAlerted(backup.ID.String(), now); err != nil {
+			fmt.Printf("Warning: Failed to record upload alert for backup %s: %v\n", backup.ID, err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// bandwidthBurst is the most a limiter lets through at once, and the
+// largest read a throttled reader makes.
+const bandwidthBurst = 256 << 10
+
+// BandwidthWindow is a daily period of local time, in minutes since
+// midnight. A window whose end is before its start runs past midnight.
+type BandwidthWindow struct {
+	Start int
+	End   int
+}
+
+func (w BandwidthWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.Start <= w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+// ParseBandwidthWindows parses comma-separated HH:MM-HH:MM windows, such as
+// "22:00-06:00,12:00-13:00".
+func ParseBandwidthWindows(value string) ([]BandwidthWindow, error) {
+	var windows []BandwidthWindow
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q: expected HH:MM-HH:MM", part)
+		}
+		var window BandwidthWindow
+		var err error
+		if window.Start, err = parseClockMinute(start); err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", part, err)
+		}
+		if window.End, err = parseClockMinute(end); err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", part, err)
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+func parseClockMinute(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// BandwidthLimiter caps the rate of transfers that share it, except during
+// its full-speed windows. A nil limiter does not limit.
+type BandwidthLimiter struct {
+	limiter          *rate.Limiter
+	fullSpeedWindows []BandwidthWindow
+}
+
+// NewBandwidthLimiter returns a limiter of mbps megabytes (10^6 bytes) per
+// second, or nil if mbps is not positive.
+func NewBandwidthLimiter(mbps float64, fullSpeedWindows []BandwidthWindow) *BandwidthLimiter {
+	if mbps <= 0 {
+		return nil
+	}
+	return &BandwidthLimiter{
+		limiter:          rate.NewLimiter(rate.Limit(mbps*1e6), bandwidthBurst),
+		fullSpeedWindows: fullSpeedWindows,
+	}
+}
+
+// WaitN blocks until n bytes, at most bandwidthBurst, may be transferred.
+func (l *BandwidthLimiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	now := time.Now()
+	for _, window := range l.fullSpeedWindows {
+		if window.contains(now) {
+			return nil
+		}
+	}
+	return l.limiter.WaitN(ctx, n)
+}
+
+type throttledReader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*BandwidthLimiter
+}
+
+// ThrottleReader limits reads from r to the rate of every given limiter.
+// Nil limiters are ignored, and r is returned as is if all are nil.
+func ThrottleReader(ctx context.Context, r io.Reader, limiters ...*BandwidthLimiter) io.Reader {
+	limiters = activeLimiters(limiters)
+	if len(limiters) == 0 {
+		return r
+	}
+	return &throttledReader{ctx: ctx, r: r, limiters: limiters}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > bandwidthBurst {
+		p = p[:bandwidthBurst]
+	}
+	n, err := t.r.Read(p)
+	if waitErr := waitAll(t.ctx, t.limiters, n); waitErr != nil {
+		return n, waitErr
+	}
+	return n, err
+}
+
+type throttledReaderAt struct {
+	ctx      context.Context
+	r        io.ReaderAt
+	limiters []*BandwidthLimiter
+}
+
+// ThrottleReaderAt is ThrottleReader for an io.ReaderAt.
+func ThrottleReaderAt(ctx context.Context, r io.ReaderAt, limiters ...*BandwidthLimiter) io.ReaderAt {
+	limiters = activeLimiters(limiters)
+	if len(limiters) == 0 {
+		return r
+	}
+	return &throttledReaderAt{ctx: ctx, r: r, limiters: limiters}
+}
+
+func (t *throttledReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		end := min(read+bandwidthBurst, len(p))
+		n, err := t.r.ReadAt(p[read:end], off+int64(read))
+		read += n
+		if waitErr := waitAll(t.ctx, t.limiters, n); waitErr != nil {
+			return read, waitErr
+		}
+		if err != nil {
+			return read, err
+		}
+	}
+	return read, nil
+}
+
+func activeLimiters(limiters []*BandwidthLimiter) []*BandwidthLimiter {
+	var active []*BandwidthLimiter
+	for _, l := range limiters {
+		if l != nil {
+			active = append(active, l)
+		}
+	}
+	return active
+}
+
+func waitAll(ctx context.Context, limiters []*BandwidthLimiter, n int) error {
+	for _, l := range limiters {
+		if err := l.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	globalLimitersOnce sync.Once
+	globalUpload       *BandwidthLimiter
+	globalDownload     *BandwidthLimiter
+)
+
+// loadGlobalLimiters reads BANDWIDTH_LIMIT_MBPS and
+// BANDWIDTH_FULL_SPEED_WINDOWS. Uploads and downloads are limited
+// separately, each to the full rate.
+func loadGlobalLimiters() {
+	value := strings.TrimSpace(os.Getenv("BANDWIDTH_LIMIT_MBPS"))
+	if value == "" {
+		return
+	}
+	mbps, err := strconv.ParseFloat(value, 64)
+	if err != nil || mbps < 0 {
+		fmt.Printf("Warning: Invalid BANDWIDTH_LIMIT_MBPS %q, bandwidth is not limited\n", value)
+		return
+	}
+
+	windows, err := ParseBandwidthWindows(os.Getenv("BANDWIDTH_FULL_SPEED_WINDOWS"))
+	if err != nil {
+		fmt.Printf("Warning: Invalid BANDWIDTH_FULL_SPEED_WINDOWS: %v, limiting at all times\n", err)
+		windows = nil
+	}
+	globalUpload = NewBandwidthLimiter(mbps, windows)
+	globalDownload = NewBandwidthLimiter(mbps, windows)
+}
+
+// GlobalUploadLimiter returns the limiter shared by every outgoing transfer,
+// or nil when bandwidth is not limited.
+func GlobalUploadLimiter() *BandwidthLimiter {
+	globalLimitersOnce.Do(loadGlobalLimiters)
+	return globalUpload
+}
+
+// GlobalDownloadLimiter returns the limiter shared by every incoming
+// transfer, or nil when bandwidth is not limited.
+func GlobalDownloadLimiter() *BandwidthLimiter {
+	globalLimitersOnce.Do(loadGlobalLimiters)
+	return globalDownload
+}
@@ -16,6 +16,7 @@ type Secrets struct {
 	EncryptionKey           string
 	AdminUsernameCredential string
 	AdminPasswordCredential string
+	AdminUsernames          []string
 	IsAllowSignup           bool
 }
 
@@ -51,6 +52,10 @@ func loadSecrets() *Secrets {
 	adminUsernameCredential := os.Getenv("ADMIN_USERNAME_CREDENTIAL")
 	adminPasswordCredential := os.Getenv("ADMIN_PASSWORD_CREDENTIAL")
 
+	// Users allowed on the /api/admin routes, by default only the admin
+	// created from the credentials above
+	adminUsernames := getWithDefault("ADMIN_USERNAMES", adminUsernameCredential)
+
 	isAllowSignup := getWithDefault("ALLOW_REGISTER", "true")
 
 	return &Secrets{
@@ -58,6 +63,7 @@ func loadSecrets() *Secrets {
 		EncryptionKey:           encryptionKey,
 		AdminUsernameCredential: adminUsernameCredential,
 		AdminPasswordCredential: adminPasswordCredential,
+		AdminUsernames:          splitList(adminUsernames),
 		IsAllowSignup:           strings.ToLower(isAllowSignup) == "true",
 	}
 }
@@ -86,6 +92,17 @@ func getWithDefault(envVar, defaultValue string) string {
 	return value
 }
 
+// splitList splits a comma-separated value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func validateEncryptionKey(key string) error {
 	key = strings.TrimSpace(key)
 
@@ -156,16 +156,13 @@ func (h *ConnectionHandler) UpdateConnectionSettings(w http.ResponseWriter, r *h
 		return
 	}
 
-	var req struct {
-		S3CleanupOnRetention *bool `json:"s3_cleanup_on_retention"`
-	}
-
+	var req ConnectionSettings
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.SendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	if err := h.service.UpdateConnectionSettings(id, req.S3CleanupOnRetention); err != nil {
+	if err := h.service.UpdateConnectionSettings(id, req); err != nil {
 		response.SendError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -2,6 +2,7 @@ package connection
 
 import (
 	"database/sql"
+	"slices"
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/google/uuid"
@@ -66,9 +67,10 @@ func (r *ConnectionRepository) Save(conn StoredConnection) error {
 			id, name, type, host, port, username, password, 
 			database_name, ssl, database_size, created_at, updated_at, 
 			last_connected_at, user_id, status, ssh_enabled, ssh_host, 
-			ssh_port, ssh_username, ssh_password, ssh_private_key, s3_cleanup_on_retention
+			ssh_port, ssh_username, ssh_password, ssh_private_key, s3_cleanup_on_retention,
+			compression, compression_level
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24
 		)`
 
 	_, err = r.db.Exec(
@@ -95,6 +97,8 @@ func (r *ConnectionRepository) Save(conn StoredConnection) error {
 		sshPassword,
 		sshPrivateKey,
 		s3CleanupInt,
+		compressionOrDefault(conn.Compression),
+		conn.CompressionLevel,
 	)
 
 	return err
@@ -112,7 +116,9 @@ func (r *ConnectionRepository) GetConnection(id string) (*StoredConnection, erro
 		database_size, created_at, updated_at, last_connected_at, user_id, status,
 		ssh_enabled, ssh_host, ssh_port, ssh_username, ssh_password, ssh_private_key,
 		COALESCE(selected_databases, '') as selected_databases,
-		COALESCE(s3_cleanup_on_retention, 1) as s3_cleanup_on_retention
+		COALESCE(s3_cleanup_on_retention, 1) as s3_cleanup_on_retention,
+		COALESCE(compression, 'none') as compression,
+		COALESCE(compression_level, 0) as compression_level
 	FROM connections WHERE id = $1`
 
 	err := r.db.QueryRow(query, id).Scan(
@@ -139,6 +145,8 @@ func (r *ConnectionRepository) GetConnection(id string) (*StoredConnection, erro
 		&encryptedSSHPrivateKey,
 		&selectedDatabasesStr,
 		&s3CleanupInt,
+		&conn.Compression,
+		&conn.CompressionLevel,
 	)
 	if err != nil {
 		return nil, err
@@ -238,8 +246,9 @@ func (r *ConnectionRepository) Update(conn StoredConnection) error {
 			username = $5, password = $6, database_name = $7, 
 			ssl = $8, ssh_enabled = $9, ssh_host = $10, ssh_port = $11,
 			ssh_username = $12, ssh_password = $13, ssh_private_key = $14,
-			database_size = $15, s3_cleanup_on_retention = $16, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $17`
+			database_size = $15, s3_cleanup_on_retention = $16,
+			compression = $17, compression_level = $18, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $19`
 
 	_, err = r.db.Exec(
 		query,
@@ -259,6 +268,8 @@ func (r *ConnectionRepository) Update(conn StoredConnection) error {
 		sshPrivateKey,
 		conn.DatabaseSize,
 		s3CleanupInt,
+		compressionOrDefault(conn.Compression),
+		conn.CompressionLevel,
 		conn.ID,
 	)
 
@@ -275,20 +286,17 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 			c.status,
 			c.database_size,
 			b.completed_time as last_backup_time,
-			COALESCE(bs.enabled, false) as backup_enabled,
-			bs.cron_schedule,
-			bs.retention_days,
 			COALESCE(c.s3_cleanup_on_retention, 1) as s3_cleanup_on_retention
 		FROM connections c
-		LEFT JOIN backup_schedules bs ON c.id = bs.connection_id AND bs.enabled = true
 		LEFT JOIN backups b ON c.id = b.connection_id
+			AND b.status = 'completed'
 			AND b.completed_time = (
 				SELECT MAX(completed_time)
 				FROM backups
-				WHERE connection_id = c.id
+				WHERE connection_id = c.id AND status = 'completed'
 			)
 		WHERE c.user_id = $1
-		GROUP BY c.id, c.name, c.type, c.host, c.status, c.database_size, b.completed_time, bs.enabled, bs.cron_schedule, bs.retention_days, c.s3_cleanup_on_retention
+		GROUP BY c.id, c.name, c.type, c.host, c.status, c.database_size, b.completed_time, c.s3_cleanup_on_retention
 	`
 
 	rows, err := r.db.Query(query, userID)
@@ -301,8 +309,6 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 	for rows.Next() {
 		var conn ConnectionListItem
 		var lastBackupTime sql.NullString
-		var cronSchedule sql.NullString
-		var retentionDays sql.NullInt64
 		var s3CleanupInt int
 
 		err := rows.Scan(
@@ -313,9 +319,6 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 			&conn.Status,
 			&conn.DatabaseSize,
 			&lastBackupTime,
-			&conn.BackupEnabled,
-			&cronSchedule,
-			&retentionDays,
 			&s3CleanupInt,
 		)
 		if err != nil {
@@ -325,26 +328,88 @@ func (r *ConnectionRepository) ListByUserID(userID uuid.UUID) ([]ConnectionListI
 		if lastBackupTime.Valid {
 			conn.LastBackupTime = &lastBackupTime.String
 		}
-		if cronSchedule.Valid {
-			conn.CronSchedule = &cronSchedule.String
-		}
-		if retentionDays.Valid {
-			days := int(retentionDays.Int64)
-			conn.RetentionDays = &days
-		}
 		conn.S3CleanupOnRetention = s3CleanupInt != 0
+		conn.Schedules = []ScheduleSummary{}
 
 		connections = append(connections, conn)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	schedules, err := r.listScheduleSummaries(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range connections {
+		conn := &connections[i]
+		conn.Schedules = append(conn.Schedules, schedules[conn.ID]...)
+		// The legacy fields describe the newest enabled schedule, as the
+		// per-connection schedule endpoints act on the newest schedule
+		for _, schedule := range slices.Backward(conn.Schedules) {
+			if !schedule.Enabled {
+				continue
+			}
+			cronSchedule, retentionDays := schedule.CronSchedule, schedule.RetentionDays
+			conn.BackupEnabled = true
+			conn.CronSchedule = &cronSchedule
+			conn.RetentionDays = &retentionDays
+			break
+		}
+	}
 	return connections, nil
 }
 
+// listScheduleSummaries returns the backup schedules of a user's
+// connections by connection ID, oldest first.
+func (r *ConnectionRepository) listScheduleSummaries(userID uuid.UUID) (map[string][]ScheduleSummary, error) {
+	rows, err := r.db.Query(`
+		SELECT bs.id, bs.connection_id, COALESCE(bs.name, ''), COALESCE(bs.enabled, false),
+		       COALESCE(bs.cron_schedule, ''), COALESCE(bs.timezone, ''), COALESCE(bs.retention_days, 0),
+		       bs.next_run_time, bs.last_run_status
+		FROM backup_schedules bs
+		JOIN connections c ON c.id = bs.connection_id
+		WHERE c.user_id = $1
+		ORDER BY bs.created_at ASC`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := make(map[string][]ScheduleSummary)
+	for rows.Next() {
+		var schedule ScheduleSummary
+		var connectionID string
+		var nextRunTime, lastRunStatus sql.NullString
+		if err := rows.Scan(&schedule.ID, &connectionID, &schedule.Name, &schedule.Enabled,
+			&schedule.CronSchedule, &schedule.Timezone, &schedule.RetentionDays, &nextRunTime, &lastRunStatus); err != nil {
+			return nil, err
+		}
+		if nextRunTime.Valid {
+			schedule.NextRunTime = &nextRunTime.String
+		}
+		if lastRunStatus.Valid {
+			schedule.LastRunStatus = &lastRunStatus.String
+		}
+		schedules[connectionID] = append(schedules[connectionID], schedule)
+	}
+	return schedules, rows.Err()
+}
+
 func (r *ConnectionRepository) Delete(id string) error {
 	query := `DELETE FROM connections WHERE id = $1`
 	_, err := r.db.Exec(query, id)
 	return err
 }
 
+func compressionOrDefault(compression string) string {
+	if compression == "" {
+		return CompressionNone
+	}
+	return compression
+}
+
 func (r *ConnectionRepository) UpdateSelectedDatabases(id string, databases []string) error {
 	// Convert []string to comma-separated string for storage
 	var dbString string
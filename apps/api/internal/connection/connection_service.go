@@ -6,6 +6,24 @@ import (
 	"github.com/google/uuid"
 )
 
+func validateCompression(compression string, level int) error {
+	switch compression {
+	case "", CompressionNone:
+		return nil
+	case CompressionGzip:
+		if level < 0 || level > 9 {
+			return fmt.Errorf("gzip compression level must be 0 (default) or 1–9")
+		}
+	case CompressionZstd:
+		if level < 0 || level > 22 {
+			return fmt.Errorf("zstd compression level must be 0 (default) or 1–22")
+		}
+	default:
+		return fmt.Errorf("unsupported compression: %s", compression)
+	}
+	return nil
+}
+
 type ConnectionService struct {
 	repo    *ConnectionRepository
 	manager *ConnectionManager
@@ -32,6 +50,17 @@ func (s *ConnectionService) SaveConnection(config ConnectionConfig, userID uuid.
 		config.ID = uuid.New().String()
 	}
 
+	compression, compressionLevel := CompressionNone, 0
+	if config.Compression != nil {
+		compression = *config.Compression
+	}
+	if config.CompressionLevel != nil {
+		compressionLevel = *config.CompressionLevel
+	}
+	if err := validateCompression(compression, compressionLevel); err != nil {
+		return nil, err
+	}
+
 	if err := s.manager.Connect(config); err != nil {
 		return nil, err
 	}
@@ -43,24 +72,26 @@ func (s *ConnectionService) SaveConnection(config ConnectionConfig, userID uuid.
 	}
 
 	storedConn := StoredConnection{
-		ID:            config.ID,
-		Name:          config.Name,
-		Type:          config.Type,
-		Host:          config.Host,
-		Port:          config.Port,
-		Username:      config.Username,
-		Password:      config.Password,
-		DatabaseName:  config.Database,
-		SSL:           config.SSL,
-		SSHEnabled:    config.SSHEnabled,
-		SSHHost:       config.SSHHost,
-		SSHPort:       config.SSHPort,
-		SSHUsername:   config.SSHUsername,
-		SSHPassword:   config.SSHPassword,
-		SSHPrivateKey: config.SSHPrivateKey,
-		UserID:        userID,
-		Status:        "connected",
-		DatabaseSize:  dbSize,
+		ID:               config.ID,
+		Name:             config.Name,
+		Type:             config.Type,
+		Host:             config.Host,
+		Port:             config.Port,
+		Username:         config.Username,
+		Password:         config.Password,
+		DatabaseName:     config.Database,
+		SSL:              config.SSL,
+		SSHEnabled:       config.SSHEnabled,
+		SSHHost:          config.SSHHost,
+		SSHPort:          config.SSHPort,
+		SSHUsername:      config.SSHUsername,
+		SSHPassword:      config.SSHPassword,
+		SSHPrivateKey:    config.SSHPrivateKey,
+		Compression:      compression,
+		CompressionLevel: compressionLevel,
+		UserID:           userID,
+		Status:           "connected",
+		DatabaseSize:     dbSize,
 	}
 
 	if err := s.repo.Save(storedConn); err != nil {
@@ -115,6 +146,8 @@ func (s *ConnectionService) UpdateConnection(config ConnectionConfig, userID uui
 		Status:               "connected",
 		DatabaseSize:         dbSize,
 		S3CleanupOnRetention: existingConn.S3CleanupOnRetention, // preserve existing value
+		Compression:          existingConn.Compression,
+		CompressionLevel:     existingConn.CompressionLevel,
 	}
 
 	// Update S3 cleanup setting if provided
@@ -122,6 +155,16 @@ func (s *ConnectionService) UpdateConnection(config ConnectionConfig, userID uui
 		storedConn.S3CleanupOnRetention = *config.S3CleanupOnRetention
 	}
 
+	if config.Compression != nil {
+		storedConn.Compression = *config.Compression
+	}
+	if config.CompressionLevel != nil {
+		storedConn.CompressionLevel = *config.CompressionLevel
+	}
+	if err := validateCompression(storedConn.Compression, storedConn.CompressionLevel); err != nil {
+		return nil, err
+	}
+
 	if err := s.repo.Update(storedConn); err != nil {
 		return nil, err
 	}
@@ -130,14 +173,24 @@ func (s *ConnectionService) UpdateConnection(config ConnectionConfig, userID uui
 }
 
 // UpdateConnectionSettings updates connection settings without testing the connection
-func (s *ConnectionService) UpdateConnectionSettings(id string, s3CleanupOnRetention *bool) error {
+func (s *ConnectionService) UpdateConnectionSettings(id string, settings ConnectionSettings) error {
 	existingConn, err := s.repo.GetConnection(id)
 	if err != nil {
 		return fmt.Errorf("failed to get connection: %w", err)
 	}
 
-	if s3CleanupOnRetention != nil {
-		existingConn.S3CleanupOnRetention = *s3CleanupOnRetention
+	if settings.S3CleanupOnRetention != nil {
+		existingConn.S3CleanupOnRetention = *settings.S3CleanupOnRetention
+	}
+
+	if settings.Compression != nil {
+		existingConn.Compression = *settings.Compression
+	}
+	if settings.CompressionLevel != nil {
+		existingConn.CompressionLevel = *settings.CompressionLevel
+	}
+	if err := validateCompression(existingConn.Compression, existingConn.CompressionLevel); err != nil {
+		return err
 	}
 
 	return s.repo.Update(*existingConn)
@@ -0,0 +1,40 @@
+package connection
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCompression(t *testing.T) {
+	tests := []struct {
+		compression string
+		level       int
+		wantErr     string
+	}{
+		{"", 0, ""},
+		{CompressionNone, 0, ""},
+		{CompressionGzip, 0, ""},
+		{CompressionGzip, 1, ""},
+		{CompressionGzip, 9, ""},
+		{CompressionGzip, -1, "gzip compression level must be 0 (default) or 1–9"},
+		{CompressionGzip, 10, "gzip compression level must be 0 (default) or 1–9"},
+		{CompressionZstd, 0, ""},
+		{CompressionZstd, 1, ""},
+		{CompressionZstd, 22, ""},
+		{CompressionZstd, -1, "zstd compression level must be 0 (default) or 1–22"},
+		{CompressionZstd, 23, "zstd compression level must be 0 (default) or 1–22"},
+		{"brotli", 0, "unsupported compression: brotli"},
+	}
+	for _, tt := range tests {
+		err := validateCompression(tt.compression, tt.level)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateCompression(%q, %d) = %v", tt.compression, tt.level, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateCompression(%q, %d) = %v, want %q", tt.compression, tt.level, err, tt.wantErr)
+		}
+	}
+}
@@ -6,49 +6,68 @@ import (
 	"github.com/google/uuid"
 )
 
+// Compression codecs supported for backup files.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
 type StoredConnection struct {
-	ID                string     `json:"id"`
-	Name              string     `json:"name"`
-	Type              string     `json:"type"`
-	Host              string     `json:"host"`
-	Port              int        `json:"port"`
-	Username          string     `json:"username"`
-	Password          string     `json:"password"`
-	DatabaseName      string     `json:"database_name"`
-	SelectedDatabases []string   `json:"selected_databases"`
-	SSL               bool       `json:"ssl"`
-	SSHEnabled        bool       `json:"ssh_enabled"`
-	SSHHost           string     `json:"ssh_host"`
-	SSHPort           int        `json:"ssh_port"`
-	SSHUsername       string     `json:"ssh_username"`
-	SSHPassword            string     `json:"ssh_password"`
-	SSHPrivateKey          string     `json:"ssh_private_key"`
-	S3CleanupOnRetention   bool       `json:"s3_cleanup_on_retention"`
-	CreatedAt              string     `json:"created_at"`
-	UpdatedAt              string     `json:"updated_at"`
-	LastConnectedAt        *time.Time `json:"last_connected_at"`
-	UserID                 uuid.UUID  `json:"user_id"`
-	Status                 string     `json:"status"`
-	DatabaseSize           int64      `json:"database_size"`
+	ID                   string     `json:"id"`
+	Name                 string     `json:"name"`
+	Type                 string     `json:"type"`
+	Host                 string     `json:"host"`
+	Port                 int        `json:"port"`
+	Username             string     `json:"username"`
+	Password             string     `json:"password"`
+	DatabaseName         string     `json:"database_name"`
+	SelectedDatabases    []string   `json:"selected_databases"`
+	SSL                  bool       `json:"ssl"`
+	SSHEnabled           bool       `json:"ssh_enabled"`
+	SSHHost              string     `json:"ssh_host"`
+	SSHPort              int        `json:"ssh_port"`
+	SSHUsername          string     `json:"ssh_username"`
+	SSHPassword          string     `json:"ssh_password"`
+	SSHPrivateKey        string     `json:"ssh_private_key"`
+	S3CleanupOnRetention bool       `json:"s3_cleanup_on_retention"`
+	Compression          string     `json:"compression"`
+	CompressionLevel     int        `json:"compression_level"`
+	CreatedAt            string     `json:"created_at"`
+	UpdatedAt            string     `json:"updated_at"`
+	LastConnectedAt      *time.Time `json:"last_connected_at"`
+	UserID               uuid.UUID  `json:"user_id"`
+	Status               string     `json:"status"`
+	DatabaseSize         int64      `json:"database_size"`
 }
 
 type ConnectionConfig struct {
-	ID                   string `json:"id"`
-	Name                 string `json:"name"`
-	Type                 string `json:"type"`
-	Host                 string `json:"host"`
-	Port                 int    `json:"port"`
-	Username             string `json:"username"`
-	Password             string `json:"password"`
-	Database             string `json:"database"`
-	SSL                  bool   `json:"ssl"`
-	SSHEnabled           bool   `json:"ssh_enabled"`
-	SSHHost              string `json:"ssh_host"`
-	SSHPort              int    `json:"ssh_port"`
-	SSHUsername          string `json:"ssh_username"`
-	SSHPassword          string `json:"ssh_password"`
-	SSHPrivateKey        string `json:"ssh_private_key"`
-	S3CleanupOnRetention *bool  `json:"s3_cleanup_on_retention,omitempty"`
+	ID                   string  `json:"id"`
+	Name                 string  `json:"name"`
+	Type                 string  `json:"type"`
+	Host                 string  `json:"host"`
+	Port                 int     `json:"port"`
+	Username             string  `json:"username"`
+	Password             string  `json:"password"`
+	Database             string  `json:"database"`
+	SSL                  bool    `json:"ssl"`
+	SSHEnabled           bool    `json:"ssh_enabled"`
+	SSHHost              string  `json:"ssh_host"`
+	SSHPort              int     `json:"ssh_port"`
+	SSHUsername          string  `json:"ssh_username"`
+	SSHPassword          string  `json:"ssh_password"`
+	SSHPrivateKey        string  `json:"ssh_private_key"`
+	S3CleanupOnRetention *bool   `json:"s3_cleanup_on_retention,omitempty"`
+	Compression          *string `json:"compression,omitempty"`
+	CompressionLevel     *int    `json:"compression_level,omitempty"`
+}
+
+// ConnectionSettings holds the per-connection backup settings that can be
+// changed without re-testing the connection.
+type ConnectionSettings struct {
+	S3CleanupOnRetention *bool   `json:"s3_cleanup_on_retention"`
+	Compression          *string `json:"compression"`
+	CompressionLevel     *int    `json:"compression_level"`
 }
 
 type ConnectionStats struct {
@@ -68,9 +87,24 @@ type ConnectionListItem struct {
 	Host           string  `json:"host"`
 	Status         string  `json:"status"`
 	DatabaseSize   int64   `json:"database_size"`
-	LastBackupTime       *string `json:"last_backup_time"`
-	BackupEnabled        bool    `json:"backup_enabled"`
-	CronSchedule         *string `json:"cron_schedule"`
-	RetentionDays        *int    `json:"retention_days"`
-	S3CleanupOnRetention bool    `json:"s3_cleanup_on_retention"`
+	LastBackupTime *string `json:"last_backup_time"`
+	// BackupEnabled, CronSchedule and RetentionDays describe the first
+	// enabled schedule; Schedules lists all of them.
+	BackupEnabled        bool              `json:"backup_enabled"`
+	CronSchedule         *string           `json:"cron_schedule"`
+	RetentionDays        *int              `json:"retention_days"`
+	Schedules            []ScheduleSummary `json:"schedules"`
+	S3CleanupOnRetention bool              `json:"s3_cleanup_on_retention"`
+}
+
+// ScheduleSummary is a backup schedule as shown in the connection list.
+type ScheduleSummary struct {
+	ID            string  `json:"id"`
+	Name          string  `json:"name"`
+	Enabled       bool    `json:"enabled"`
+	CronSchedule  string  `json:"cron_schedule"`
+	Timezone      string  `json:"timezone"`
+	RetentionDays int     `json:"retention_days"`
+	NextRunTime   *string `json:"next_run_time"`
+	LastRunStatus *string `json:"last_run_status"`
 }
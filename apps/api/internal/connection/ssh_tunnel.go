@@ -1,11 +1,13 @@
 package connection
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"time"
 
+	"github.com/dendianugerah/velld/internal/common"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -110,17 +112,18 @@ func (tunnel *SSHTunnel) forward(localConn net.Conn) {
 		return
 	}
 
-	// Copy data bidirectionally
+	// Copy data bidirectionally, within the global bandwidth limits
+	ctx := context.Background()
 	go func() {
 		defer localConn.Close()
 		defer remoteConn.Close()
-		io.Copy(remoteConn, localConn)
+		io.Copy(remoteConn, common.ThrottleReader(ctx, localConn, common.GlobalUploadLimiter()))
 	}()
 
 	go func() {
 		defer localConn.Close()
 		defer remoteConn.Close()
-		io.Copy(localConn, remoteConn)
+		io.Copy(localConn, common.ThrottleReader(ctx, remoteConn, common.GlobalDownloadLimiter()))
 	}()
 }
 
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding compression settings to connections and backups tables';
+
+ALTER TABLE connections ADD COLUMN compression TEXT DEFAULT 'none';
+ALTER TABLE connections ADD COLUMN compression_level INTEGER DEFAULT 0;
+
+ALTER TABLE backups ADD COLUMN compression TEXT DEFAULT 'none';
+ALTER TABLE backups ADD COLUMN uncompressed_size INTEGER DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing compression settings from connections and backups tables';
+
+ALTER TABLE backups DROP COLUMN uncompressed_size;
+ALTER TABLE backups DROP COLUMN compression;
+
+ALTER TABLE connections DROP COLUMN compression_level;
+ALTER TABLE connections DROP COLUMN compression;
+
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding backup encryption settings';
+
+ALTER TABLE user_settings ADD COLUMN backup_encryption TEXT DEFAULT 'none';
+ALTER TABLE user_settings ADD COLUMN backup_age_recipients TEXT;
+
+ALTER TABLE backups ADD COLUMN encryption TEXT DEFAULT 'none';
+ALTER TABLE backups ADD COLUMN encryption_key TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing backup encryption settings';
+
+ALTER TABLE backups DROP COLUMN encryption_key;
+ALTER TABLE backups DROP COLUMN encryption;
+
+ALTER TABLE user_settings DROP COLUMN backup_age_recipients;
+ALTER TABLE user_settings DROP COLUMN backup_encryption;
+
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding integrity checksums to backups table';
+
+ALTER TABLE backups ADD COLUMN checksum TEXT;
+ALTER TABLE backups ADD COLUMN integrity_status TEXT DEFAULT 'unknown';
+ALTER TABLE backups ADD COLUMN verified_at TEXT;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing integrity checksums from backups table';
+
+ALTER TABLE backups DROP COLUMN verified_at;
+ALTER TABLE backups DROP COLUMN integrity_status;
+ALTER TABLE backups DROP COLUMN checksum;
+
+-- +goose StatementEnd
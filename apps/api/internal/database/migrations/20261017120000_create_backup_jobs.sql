@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE backup_jobs (
+    id TEXT PRIMARY KEY,
+    connection_id TEXT REFERENCES connections(id),
+    schedule_id TEXT REFERENCES backup_schedules(id),
+    user_id TEXT NOT NULL,
+    status TEXT NOT NULL, -- 'queued', 'running', 'completed', 'failed', 'cancelled'
+    backup_id TEXT,
+    bytes_written INTEGER DEFAULT 0,
+    error TEXT,
+    started_at TEXT,
+    finished_at TEXT,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE backup_job_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id TEXT NOT NULL REFERENCES backup_jobs(id) ON DELETE CASCADE,
+    line TEXT NOT NULL,
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose StatementEnd
+
+CREATE INDEX idx_backup_jobs_connection_id ON backup_jobs(connection_id);
+CREATE INDEX idx_backup_jobs_status ON backup_jobs(status);
+CREATE INDEX idx_backup_job_logs_job_id ON backup_job_logs(job_id);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE backup_job_logs;
+DROP TABLE backup_jobs;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding last run status to backup_schedules table';
+
+ALTER TABLE backup_schedules ADD COLUMN last_run_status TEXT;
+ALTER TABLE backup_schedules ADD COLUMN last_run_at TEXT;
+ALTER TABLE backup_schedules ADD COLUMN skipped_runs INTEGER DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing last run status from backup_schedules table';
+
+ALTER TABLE backup_schedules DROP COLUMN skipped_runs;
+ALTER TABLE backup_schedules DROP COLUMN last_run_at;
+ALTER TABLE backup_schedules DROP COLUMN last_run_status;
+
+-- +goose StatementEnd
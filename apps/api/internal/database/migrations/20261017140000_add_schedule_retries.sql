@@ -0,0 +1,46 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding retry policy and run history to backup schedules';
+
+ALTER TABLE backup_schedules ADD COLUMN max_attempts INTEGER DEFAULT 1;
+ALTER TABLE backup_schedules ADD COLUMN retry_initial_delay INTEGER DEFAULT 60;
+ALTER TABLE backup_schedules ADD COLUMN retry_max_delay INTEGER DEFAULT 900;
+
+CREATE TABLE backup_schedule_runs (
+    id TEXT PRIMARY KEY,
+    schedule_id TEXT NOT NULL REFERENCES backup_schedules(id) ON DELETE CASCADE,
+    status TEXT NOT NULL, -- 'running', 'retrying', 'completed', 'failed', 'cancelled', 'skipped'
+    error TEXT,
+    started_at TEXT NOT NULL,
+    finished_at TEXT
+);
+
+CREATE TABLE backup_schedule_run_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id TEXT NOT NULL REFERENCES backup_schedule_runs(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    job_id TEXT,
+    backup_id TEXT,
+    status TEXT NOT NULL,
+    error TEXT,
+    started_at TEXT NOT NULL,
+    finished_at TEXT
+);
+
+-- +goose StatementEnd
+
+CREATE INDEX idx_backup_schedule_runs_schedule_id ON backup_schedule_runs(schedule_id);
+CREATE INDEX idx_backup_schedule_run_attempts_run_id ON backup_schedule_run_attempts(run_id);
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing retry policy and run history from backup schedules';
+
+DROP TABLE backup_schedule_run_attempts;
+DROP TABLE backup_schedule_runs;
+
+ALTER TABLE backup_schedules DROP COLUMN retry_max_delay;
+ALTER TABLE backup_schedules DROP COLUMN retry_initial_delay;
+ALTER TABLE backup_schedules DROP COLUMN max_attempts;
+
+-- +goose StatementEnd
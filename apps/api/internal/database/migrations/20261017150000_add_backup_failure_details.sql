@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding failure details to backups table';
+
+ALTER TABLE backups ADD COLUMN error_output TEXT;
+ALTER TABLE backups ADD COLUMN exit_code INTEGER;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing failure details from backups table';
+
+ALTER TABLE backups DROP COLUMN exit_code;
+ALTER TABLE backups DROP COLUMN error_output;
+
+-- +goose StatementEnd
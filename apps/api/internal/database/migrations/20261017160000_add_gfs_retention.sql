@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding GFS retention policy to backup_schedules table';
+
+ALTER TABLE backup_schedules ADD COLUMN keep_last INTEGER DEFAULT 0;
+ALTER TABLE backup_schedules ADD COLUMN keep_daily INTEGER DEFAULT 0;
+ALTER TABLE backup_schedules ADD COLUMN keep_weekly INTEGER DEFAULT 0;
+ALTER TABLE backup_schedules ADD COLUMN keep_monthly INTEGER DEFAULT 0;
+ALTER TABLE backup_schedules ADD COLUMN keep_yearly INTEGER DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing GFS retention policy from backup_schedules table';
+
+ALTER TABLE backup_schedules DROP COLUMN keep_yearly;
+ALTER TABLE backup_schedules DROP COLUMN keep_monthly;
+ALTER TABLE backup_schedules DROP COLUMN keep_weekly;
+ALTER TABLE backup_schedules DROP COLUMN keep_daily;
+ALTER TABLE backup_schedules DROP COLUMN keep_last;
+
+-- +goose StatementEnd
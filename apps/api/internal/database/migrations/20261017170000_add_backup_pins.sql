@@ -0,0 +1,35 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding pins to backups table';
+
+ALTER TABLE backups ADD COLUMN pinned INTEGER DEFAULT 0;
+ALTER TABLE backups ADD COLUMN pin_reason TEXT;
+ALTER TABLE backups ADD COLUMN pinned_at TEXT;
+ALTER TABLE backups ADD COLUMN pin_expires_at TEXT;
+
+CREATE TABLE backup_pin_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    backup_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    action TEXT NOT NULL,
+    reason TEXT,
+    expires_at TEXT,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_backup_pin_events_backup_id ON backup_pin_events(backup_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing pins from backups table';
+
+DROP TABLE backup_pin_events;
+
+ALTER TABLE backups DROP COLUMN pin_expires_at;
+ALTER TABLE backups DROP COLUMN pinned_at;
+ALTER TABLE backups DROP COLUMN pin_reason;
+ALTER TABLE backups DROP COLUMN pinned;
+
+-- +goose StatementEnd
@@ -0,0 +1,51 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE storage_destinations (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id),
+    name TEXT NOT NULL,
+    type TEXT NOT NULL, -- 'local', 's3'
+    config TEXT NOT NULL, -- JSON, secrets encrypted
+    created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    updated_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE connection_storage_destinations (
+    connection_id TEXT NOT NULL REFERENCES connections(id),
+    destination_id TEXT NOT NULL,
+    PRIMARY KEY (connection_id, destination_id)
+);
+
+-- destination_id is a storage_destinations id, or 's3' for the S3 storage
+-- configured in user settings
+CREATE TABLE backup_copies (
+    backup_id TEXT NOT NULL REFERENCES backups(id),
+    destination_id TEXT NOT NULL,
+    destination_name TEXT NOT NULL,
+    status TEXT NOT NULL, -- 'uploading', 'uploaded', 'failed'
+    object_key TEXT,
+    size INTEGER DEFAULT 0,
+    error TEXT,
+    uploaded_at TEXT,
+    updated_at TEXT DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (backup_id, destination_id)
+);
+
+-- Existing S3 uploads become copies on the settings S3 destination
+INSERT INTO backup_copies (backup_id, destination_id, destination_name, status, object_key, size, uploaded_at, updated_at)
+SELECT id, 's3', 's3', 'uploaded', s3_object_key, size, COALESCE(completed_time, updated_at), updated_at
+FROM backups
+WHERE s3_object_key IS NOT NULL AND s3_object_key != '';
+
+-- +goose StatementEnd
+
+CREATE INDEX idx_storage_destinations_user_id ON storage_destinations(user_id);
+CREATE INDEX idx_backup_copies_destination_id ON backup_copies(destination_id);
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE backup_copies;
+DROP TABLE connection_storage_destinations;
+DROP TABLE storage_destinations;
+-- +goose StatementEnd
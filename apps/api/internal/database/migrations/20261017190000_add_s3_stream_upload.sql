@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding s3_stream_upload setting to user_settings';
+
+ALTER TABLE user_settings ADD COLUMN s3_stream_upload INTEGER DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing s3_stream_upload setting from user_settings';
+
+ALTER TABLE user_settings DROP COLUMN s3_stream_upload;
+
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding upload tracking to backups and backup_copies';
+
+-- 'pending', 'uploaded' or 'failed'; NULL when the backup has no destinations
+ALTER TABLE backups ADD COLUMN upload_status TEXT;
+ALTER TABLE backups ADD COLUMN upload_alerted_at TEXT;
+
+ALTER TABLE backup_copies ADD COLUMN attempts INTEGER DEFAULT 0;
+ALTER TABLE backup_copies ADD COLUMN next_attempt_at TEXT;
+-- Multipart upload to resume on the next attempt
+ALTER TABLE backup_copies ADD COLUMN upload_id TEXT;
+
+UPDATE backups SET upload_status = 'uploaded'
+WHERE s3_object_key IS NOT NULL AND s3_object_key != '';
+
+-- +goose StatementEnd
+
+CREATE INDEX idx_backup_copies_next_attempt_at ON backup_copies(next_attempt_at);
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing upload tracking from backups and backup_copies';
+
+DROP INDEX idx_backup_copies_next_attempt_at;
+ALTER TABLE backup_copies DROP COLUMN upload_id;
+ALTER TABLE backup_copies DROP COLUMN next_attempt_at;
+ALTER TABLE backup_copies DROP COLUMN attempts;
+ALTER TABLE backups DROP COLUMN upload_alerted_at;
+ALTER TABLE backups DROP COLUMN upload_status;
+
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding S3 storage class, encryption and object lock settings to user_settings';
+
+ALTER TABLE user_settings ADD COLUMN s3_storage_class TEXT;
+ALTER TABLE user_settings ADD COLUMN s3_server_side_encryption TEXT; -- 'sse-s3', 'sse-kms'
+ALTER TABLE user_settings ADD COLUMN s3_kms_key_id TEXT;
+ALTER TABLE user_settings ADD COLUMN s3_object_lock_mode TEXT; -- 'governance', 'compliance'
+ALTER TABLE user_settings ADD COLUMN s3_disable_bucket_creation INTEGER DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing S3 storage class, encryption and object lock settings from user_settings';
+
+ALTER TABLE user_settings DROP COLUMN s3_disable_bucket_creation;
+ALTER TABLE user_settings DROP COLUMN s3_object_lock_mode;
+ALTER TABLE user_settings DROP COLUMN s3_kms_key_id;
+ALTER TABLE user_settings DROP COLUMN s3_server_side_encryption;
+ALTER TABLE user_settings DROP COLUMN s3_storage_class;
+
+-- +goose StatementEnd
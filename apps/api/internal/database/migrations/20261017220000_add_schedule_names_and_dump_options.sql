@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding names and dump options to backup_schedules table';
+
+ALTER TABLE backup_schedules ADD COLUMN name TEXT;
+ALTER TABLE backup_schedules ADD COLUMN schema_only BOOLEAN DEFAULT FALSE;
+ALTER TABLE backup_schedules ADD COLUMN dump_databases TEXT; -- comma-separated, empty for the connection's own
+
+UPDATE backup_schedules SET name = 'Default' WHERE name IS NULL;
+
+-- Retention now only covers a schedule's own backups. Connections had a
+-- single schedule whose retention covered all their backups, so hand it
+-- the ones it did not record as its own.
+UPDATE backups
+SET schedule_id = (
+    SELECT bs.id FROM backup_schedules bs
+    WHERE bs.connection_id = backups.connection_id
+    ORDER BY bs.created_at DESC LIMIT 1
+)
+WHERE schedule_id IS NULL
+  AND EXISTS (SELECT 1 FROM backup_schedules bs WHERE bs.connection_id = backups.connection_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing names and dump options from backup_schedules table';
+
+ALTER TABLE backup_schedules DROP COLUMN dump_databases;
+ALTER TABLE backup_schedules DROP COLUMN schema_only;
+ALTER TABLE backup_schedules DROP COLUMN name;
+
+-- +goose StatementEnd
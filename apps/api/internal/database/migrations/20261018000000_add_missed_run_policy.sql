@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Adding missed run policy to backup_schedules table';
+
+-- 'skip', 'run_once' or 'run_once_jitter'; schedule runs missed while the
+-- server was down are recorded in backup_schedule_runs as 'missed'
+ALTER TABLE backup_schedules ADD COLUMN missed_run_policy TEXT DEFAULT 'run_once';
+
+UPDATE backup_schedules SET missed_run_policy = 'run_once' WHERE missed_run_policy IS NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Removing missed run policy from backup_schedules table';
+
+DELETE FROM backup_schedule_runs WHERE status = 'missed';
+ALTER TABLE backup_schedules DROP COLUMN missed_run_policy;
+
+-- +goose StatementEnd
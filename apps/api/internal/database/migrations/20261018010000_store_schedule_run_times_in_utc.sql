@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'Storing schedule run times in UTC';
+
+-- Run times were stored with the offset of the server or of the schedule's
+-- time zone, which does not sort as text. strftime converts them to UTC.
+UPDATE backup_schedule_runs
+SET started_at = strftime('%Y-%m-%dT%H:%M:%SZ', started_at),
+    finished_at = strftime('%Y-%m-%dT%H:%M:%SZ', finished_at)
+WHERE started_at NOT LIKE '%Z';
+
+UPDATE backup_schedule_run_attempts
+SET started_at = strftime('%Y-%m-%dT%H:%M:%SZ', started_at),
+    finished_at = strftime('%Y-%m-%dT%H:%M:%SZ', finished_at)
+WHERE started_at NOT LIKE '%Z';
+
+UPDATE backup_schedules
+SET last_run_at = strftime('%Y-%m-%dT%H:%M:%SZ', last_run_at)
+WHERE last_run_at NOT LIKE '%Z';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'Schedule run times stay in UTC';
+-- +goose StatementEnd
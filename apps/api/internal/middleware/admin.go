@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type AdminMiddleware struct {
+	usernames []string
+}
+
+// NewAdminMiddleware allows the given usernames through RequireAdmin. With
+// none, every request is refused.
+func NewAdminMiddleware(usernames []string) *AdminMiddleware {
+	return &AdminMiddleware{usernames: usernames}
+}
+
+// RequireAdmin refuses requests from users who are not admins. It must run
+// after RequireAuth, which puts the token's claims in the context.
+func (m *AdminMiddleware) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := r.Context().Value(user).(jwt.MapClaims)
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		username, _ := claims["username"].(string)
+		if username == "" || !slices.Contains(m.usernames, username) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
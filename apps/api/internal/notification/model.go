@@ -12,6 +12,8 @@ type NotificationType string
 const (
 	BackupFailed    NotificationType = "backup_failed"
 	BackupCompleted NotificationType = "backup_completed"
+	BackupCorrupted NotificationType = "backup_corrupted"
+	UploadMissing   NotificationType = "upload_missing"
 )
 
 type NotificationStatus string
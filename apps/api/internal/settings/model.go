@@ -6,6 +6,24 @@ import (
 	"github.com/google/uuid"
 )
 
+// Backup encryption modes. Both modes wrap a per-backup data key with the
+// server key so Velld can restore; "age" additionally encrypts every backup
+// to the configured age recipients so it can be decrypted outside Velld.
+const (
+	BackupEncryptionNone   = "none"
+	BackupEncryptionServer = "server"
+	BackupEncryptionAge    = "age"
+)
+
+// S3 server-side encryption and object lock modes.
+const (
+	S3EncryptionSSES3  = "sse-s3"
+	S3EncryptionSSEKMS = "sse-kms"
+
+	S3ObjectLockGovernance = "governance"
+	S3ObjectLockCompliance = "compliance"
+)
+
 type UserSettings struct {
 	ID              uuid.UUID `json:"id"`
 	UserID          uuid.UUID `json:"user_id"`
@@ -19,18 +37,30 @@ type UserSettings struct {
 	SMTPUsername    *string   `json:"smtp_username,omitempty"`
 	SMTPPassword    *string   `json:"smtp_password,omitempty"`
 	// S3-compatible storage settings
-	S3Enabled    bool      `json:"s3_enabled"`
-	S3Endpoint   *string   `json:"s3_endpoint,omitempty"`
-	S3Region     *string   `json:"s3_region,omitempty"`
-	S3Bucket     *string   `json:"s3_bucket,omitempty"`
-	S3AccessKey  *string   `json:"s3_access_key,omitempty"`
-	S3SecretKey  *string   `json:"s3_secret_key,omitempty"`
-	S3UseSSL     bool      `json:"s3_use_ssl"`
-	S3PathPrefix *string   `json:"s3_path_prefix,omitempty"`
-	S3PurgeLocal bool      `json:"s3_purge_local"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	EnvConfigured map[string]bool `json:"env_configured,omitempty"`
+	S3Enabled      bool    `json:"s3_enabled"`
+	S3Endpoint     *string `json:"s3_endpoint,omitempty"`
+	S3Region       *string `json:"s3_region,omitempty"`
+	S3Bucket       *string `json:"s3_bucket,omitempty"`
+	S3AccessKey    *string `json:"s3_access_key,omitempty"`
+	S3SecretKey    *string `json:"s3_secret_key,omitempty"`
+	S3UseSSL       bool    `json:"s3_use_ssl"`
+	S3PathPrefix   *string `json:"s3_path_prefix,omitempty"`
+	S3PurgeLocal   bool    `json:"s3_purge_local"`
+	S3StreamUpload bool    `json:"s3_stream_upload"`
+	// Storage class, server-side encryption and object-lock retention applied
+	// to uploaded backups. With bucket creation disabled a missing bucket is
+	// an error rather than being created.
+	S3StorageClass          *string `json:"s3_storage_class,omitempty"`
+	S3ServerSideEncryption  *string `json:"s3_server_side_encryption,omitempty"`
+	S3KMSKeyID              *string `json:"s3_kms_key_id,omitempty"`
+	S3ObjectLockMode        *string `json:"s3_object_lock_mode,omitempty"`
+	S3DisableBucketCreation bool    `json:"s3_disable_bucket_creation"`
+	// Backup encryption settings
+	BackupEncryption    string          `json:"backup_encryption"`
+	BackupAgeRecipients *string         `json:"backup_age_recipients,omitempty"`
+	CreatedAt           time.Time       `json:"created_at"`
+	UpdatedAt           time.Time       `json:"updated_at"`
+	EnvConfigured       map[string]bool `json:"env_configured,omitempty"`
 }
 
 type UpdateSettingsRequest struct {
@@ -44,13 +74,23 @@ type UpdateSettingsRequest struct {
 	SMTPUsername    *string `json:"smtp_username,omitempty"`
 	SMTPPassword    *string `json:"smtp_password,omitempty"`
 	// S3-compatible storage settings
-	S3Enabled    *bool   `json:"s3_enabled,omitempty"`
-	S3Endpoint   *string `json:"s3_endpoint,omitempty"`
-	S3Region     *string `json:"s3_region,omitempty"`
-	S3Bucket     *string `json:"s3_bucket,omitempty"`
-	S3AccessKey  *string `json:"s3_access_key,omitempty"`
-	S3SecretKey  *string `json:"s3_secret_key,omitempty"`
-	S3UseSSL     *bool   `json:"s3_use_ssl,omitempty"`
-	S3PathPrefix *string `json:"s3_path_prefix,omitempty"`
-	S3PurgeLocal *bool   `json:"s3_purge_local,omitempty"`
+	S3Enabled      *bool   `json:"s3_enabled,omitempty"`
+	S3Endpoint     *string `json:"s3_endpoint,omitempty"`
+	S3Region       *string `json:"s3_region,omitempty"`
+	S3Bucket       *string `json:"s3_bucket,omitempty"`
+	S3AccessKey    *string `json:"s3_access_key,omitempty"`
+	S3SecretKey    *string `json:"s3_secret_key,omitempty"`
+	S3UseSSL       *bool   `json:"s3_use_ssl,omitempty"`
+	S3PathPrefix   *string `json:"s3_path_prefix,omitempty"`
+	S3PurgeLocal   *bool   `json:"s3_purge_local,omitempty"`
+	S3StreamUpload *bool   `json:"s3_stream_upload,omitempty"`
+	// An empty string clears the storage class, encryption or lock mode
+	S3StorageClass          *string `json:"s3_storage_class,omitempty"`
+	S3ServerSideEncryption  *string `json:"s3_server_side_encryption,omitempty"`
+	S3KMSKeyID              *string `json:"s3_kms_key_id,omitempty"`
+	S3ObjectLockMode        *string `json:"s3_object_lock_mode,omitempty"`
+	S3DisableBucketCreation *bool   `json:"s3_disable_bucket_creation,omitempty"`
+	// Backup encryption settings
+	BackupEncryption    *string `json:"backup_encryption,omitempty"`
+	BackupAgeRecipients *string `json:"backup_age_recipients,omitempty"`
 }
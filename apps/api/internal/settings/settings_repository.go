@@ -25,6 +25,9 @@ func (r *SettingsRepository) GetUserSettings(userID uuid.UUID) (*UserSettings, e
                webhook_url, email, smtp_host, smtp_port, smtp_username, 
                smtp_password, s3_enabled, s3_endpoint, s3_region, s3_bucket,
                s3_access_key, s3_secret_key, s3_use_ssl, s3_path_prefix, s3_purge_local,
+               s3_stream_upload, s3_storage_class, s3_server_side_encryption, s3_kms_key_id,
+               s3_object_lock_mode, COALESCE(s3_disable_bucket_creation, 0),
+               COALESCE(backup_encryption, 'none'), backup_age_recipients,
                created_at, updated_at
         FROM user_settings
         WHERE user_id = $1`, userID).Scan(
@@ -34,19 +37,23 @@ func (r *SettingsRepository) GetUserSettings(userID uuid.UUID) (*UserSettings, e
 		&settings.SMTPUsername, &settings.SMTPPassword,
 		&settings.S3Enabled, &settings.S3Endpoint, &settings.S3Region, &settings.S3Bucket,
 		&settings.S3AccessKey, &settings.S3SecretKey, &settings.S3UseSSL, &settings.S3PathPrefix,
-		&settings.S3PurgeLocal,
+		&settings.S3PurgeLocal, &settings.S3StreamUpload,
+		&settings.S3StorageClass, &settings.S3ServerSideEncryption, &settings.S3KMSKeyID,
+		&settings.S3ObjectLockMode, &settings.S3DisableBucketCreation,
+		&settings.BackupEncryption, &settings.BackupAgeRecipients,
 		&createdAtStr, &updatedAtStr)
 
 	if err == sql.ErrNoRows {
 		// Create default settings if none exist
 		now := time.Now()
 		settings = &UserSettings{
-			ID:              uuid.New(),
-			UserID:          userID,
-			NotifyDashboard: true,
-			S3UseSSL:        true,
-			CreatedAt:       now,
-			UpdatedAt:       now,
+			ID:               uuid.New(),
+			UserID:           userID,
+			NotifyDashboard:  true,
+			S3UseSSL:         true,
+			BackupEncryption: BackupEncryptionNone,
+			CreatedAt:        now,
+			UpdatedAt:        now,
 		}
 		return settings, r.CreateUserSettings(settings)
 	}
@@ -76,15 +83,20 @@ func (r *SettingsRepository) CreateUserSettings(settings *UserSettings) error {
             webhook_url, email, smtp_host, smtp_port, smtp_username, 
             smtp_password, s3_enabled, s3_endpoint, s3_region, s3_bucket,
             s3_access_key, s3_secret_key, s3_use_ssl, s3_path_prefix, s3_purge_local,
+            s3_stream_upload, s3_storage_class, s3_server_side_encryption, s3_kms_key_id,
+            s3_object_lock_mode, s3_disable_bucket_creation, backup_encryption, backup_age_recipients,
             created_at, updated_at
-        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)`,
+        ) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30)`,
 		settings.ID, settings.UserID, settings.NotifyDashboard,
 		settings.NotifyEmail, settings.NotifyWebhook, settings.WebhookURL,
 		settings.Email, settings.SMTPHost, settings.SMTPPort,
 		settings.SMTPUsername, settings.SMTPPassword,
 		settings.S3Enabled, settings.S3Endpoint, settings.S3Region, settings.S3Bucket,
 		settings.S3AccessKey, settings.S3SecretKey, settings.S3UseSSL, settings.S3PathPrefix,
-		settings.S3PurgeLocal,
+		settings.S3PurgeLocal, settings.S3StreamUpload,
+		settings.S3StorageClass, settings.S3ServerSideEncryption, settings.S3KMSKeyID,
+		settings.S3ObjectLockMode, settings.S3DisableBucketCreation,
+		settings.BackupEncryption, settings.BackupAgeRecipients,
 		settings.CreatedAt, settings.UpdatedAt)
 	return err
 }
@@ -98,14 +110,20 @@ func (r *SettingsRepository) UpdateUserSettings(settings *UserSettings) error {
             smtp_username = $8, smtp_password = $9, s3_enabled = $10,
             s3_endpoint = $11, s3_region = $12, s3_bucket = $13,
             s3_access_key = $14, s3_secret_key = $15, s3_use_ssl = $16,
-            s3_path_prefix = $17, s3_purge_local = $18, updated_at = $19
-        WHERE user_id = $20`,
+            s3_path_prefix = $17, s3_purge_local = $18, s3_stream_upload = $19,
+            s3_storage_class = $20, s3_server_side_encryption = $21, s3_kms_key_id = $22,
+            s3_object_lock_mode = $23, s3_disable_bucket_creation = $24,
+            backup_encryption = $25, backup_age_recipients = $26, updated_at = $27
+        WHERE user_id = $28`,
 		settings.NotifyDashboard, settings.NotifyEmail, settings.NotifyWebhook,
 		settings.WebhookURL, settings.Email, settings.SMTPHost, settings.SMTPPort,
 		settings.SMTPUsername, settings.SMTPPassword,
 		settings.S3Enabled, settings.S3Endpoint, settings.S3Region, settings.S3Bucket,
 		settings.S3AccessKey, settings.S3SecretKey, settings.S3UseSSL, settings.S3PathPrefix,
-		settings.S3PurgeLocal,
+		settings.S3PurgeLocal, settings.S3StreamUpload,
+		settings.S3StorageClass, settings.S3ServerSideEncryption, settings.S3KMSKeyID,
+		settings.S3ObjectLockMode, settings.S3DisableBucketCreation,
+		settings.BackupEncryption, settings.BackupAgeRecipients,
 		settings.UpdatedAt, settings.UserID)
 	return err
 }
@@ -1,8 +1,13 @@
 package settings
 
 import (
+	"fmt"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+
+	"filippo.io/age"
 
 	"github.com/dendianugerah/velld/internal/common"
 	"github.com/google/uuid"
@@ -77,6 +82,51 @@ func (s *SettingsService) applyDefaults(settings *UserSettings) {
 	}
 }
 
+func validateBackupEncryption(settings *UserSettings) error {
+	switch settings.BackupEncryption {
+	case "", BackupEncryptionNone, BackupEncryptionServer:
+		return nil
+	case BackupEncryptionAge:
+		if settings.BackupAgeRecipients == nil || strings.TrimSpace(*settings.BackupAgeRecipients) == "" {
+			return fmt.Errorf("age encryption requires at least one recipient")
+		}
+		if _, err := age.ParseRecipients(strings.NewReader(*settings.BackupAgeRecipients)); err != nil {
+			return fmt.Errorf("invalid age recipients: %v", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported backup encryption: %s", settings.BackupEncryption)
+	}
+}
+
+// storageClassPattern matches S3 storage class names such as STANDARD_IA.
+var storageClassPattern = regexp.MustCompile(`^[A-Z][A-Z_]*$`)
+
+// ValidateS3StorageOptions checks the storage class, server-side encryption
+// and object lock mode applied to S3 uploads. Empty values are unset.
+func ValidateS3StorageOptions(storageClass, serverSideEncryption, kmsKeyID, objectLockMode string) error {
+	if storageClass != "" && !storageClassPattern.MatchString(storageClass) {
+		return fmt.Errorf("invalid S3 storage class: %s", storageClass)
+	}
+
+	switch serverSideEncryption {
+	case "", S3EncryptionSSES3:
+		if kmsKeyID != "" {
+			return fmt.Errorf("a KMS key ID requires %s encryption", S3EncryptionSSEKMS)
+		}
+	case S3EncryptionSSEKMS:
+	default:
+		return fmt.Errorf("unsupported S3 server-side encryption: %s", serverSideEncryption)
+	}
+
+	switch objectLockMode {
+	case "", S3ObjectLockGovernance, S3ObjectLockCompliance:
+	default:
+		return fmt.Errorf("unsupported S3 object lock mode: %s", objectLockMode)
+	}
+	return nil
+}
+
 func (s *SettingsService) UpdateUserSettings(userID uuid.UUID, req *UpdateSettingsRequest) (*UserSettings, error) {
 	settings, err := s.repo.GetUserSettings(userID)
 	if err != nil {
@@ -155,6 +205,39 @@ func (s *SettingsService) UpdateUserSettings(userID uuid.UUID, req *UpdateSettin
 	if req.S3PurgeLocal != nil {
 		settings.S3PurgeLocal = *req.S3PurgeLocal
 	}
+	if req.S3StreamUpload != nil {
+		settings.S3StreamUpload = *req.S3StreamUpload
+	}
+	if req.S3StorageClass != nil {
+		settings.S3StorageClass = nilIfEmpty(strings.ToUpper(strings.TrimSpace(*req.S3StorageClass)))
+	}
+	if req.S3ServerSideEncryption != nil {
+		settings.S3ServerSideEncryption = nilIfEmpty(*req.S3ServerSideEncryption)
+	}
+	if req.S3KMSKeyID != nil {
+		settings.S3KMSKeyID = nilIfEmpty(strings.TrimSpace(*req.S3KMSKeyID))
+	}
+	if req.S3ObjectLockMode != nil {
+		settings.S3ObjectLockMode = nilIfEmpty(*req.S3ObjectLockMode)
+	}
+	if req.S3DisableBucketCreation != nil {
+		settings.S3DisableBucketCreation = *req.S3DisableBucketCreation
+	}
+	if err := ValidateS3StorageOptions(valueOrEmpty(settings.S3StorageClass), valueOrEmpty(settings.S3ServerSideEncryption),
+		valueOrEmpty(settings.S3KMSKeyID), valueOrEmpty(settings.S3ObjectLockMode)); err != nil {
+		return nil, err
+	}
+
+	// Update backup encryption settings
+	if req.BackupEncryption != nil {
+		settings.BackupEncryption = *req.BackupEncryption
+	}
+	if req.BackupAgeRecipients != nil {
+		settings.BackupAgeRecipients = req.BackupAgeRecipients
+	}
+	if err := validateBackupEncryption(settings); err != nil {
+		return nil, err
+	}
 
 	if err := s.repo.UpdateUserSettings(settings); err != nil {
 		return nil, err
@@ -165,3 +248,17 @@ func (s *SettingsService) UpdateUserSettings(userID uuid.UUID, req *UpdateSettin
 	settings.S3SecretKey = nil
 	return settings, nil
 }
+
+func nilIfEmpty(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func valueOrEmpty(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}